@@ -48,6 +48,7 @@ class JobResponse(BaseModel):
     id: str
     track_id: str
     status: str
+    model: str | None = None
     priority: int = 10
     progress: float = 0.0
     result: dict[str, str] | None = None
@@ -109,6 +110,7 @@ async def create_job(
             id=job.id,
             track_id=job.track_id,
             status=get_value(job.status),
+            model=job.model,
             priority=int(job.priority),
             progress=job.progress,
             created_at=job.created_at.strftime('%Y-%m-%dT%H:%M:%SZ'),
@@ -142,6 +144,7 @@ async def get_job_status(job_id: str):
             id=job.id,
             track_id=job.track_id,
             status=get_value(job.status),
+            model=job.model,
             progress=job.progress,
             result=job.result,
             error=job.error,
@@ -0,0 +1,26 @@
+-- Library File Manifest Migration
+-- Description: Persist the scanner's view of the filesystem so scans can be incremental
+-- Order: 008
+
+-- 1. Manifest of every audio file the scanner has dispatched
+-- file_path uses the same representation as tracks.file_path (relative to the root).
+CREATE TABLE IF NOT EXISTS library_files (
+    root TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    mtime TIMESTAMP WITH TIME ZONE NOT NULL,
+    content_hash TEXT,
+    last_scan_id UUID,
+    first_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (root, file_path)
+);
+
+-- 2. Indexes
+CREATE INDEX IF NOT EXISTS idx_library_files_content_hash ON library_files (content_hash) WHERE content_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_library_files_last_scan ON library_files (root, last_scan_id);
+
+-- 3. Commentary
+COMMENT ON TABLE library_files IS 'Scanner manifest (path, size, mtime, hash) used to dispatch only new or changed files';
+COMMENT ON COLUMN library_files.content_hash IS 'Optional SHA-256 of the file contents, computed when SCAN_CONTENT_HASH is enabled';
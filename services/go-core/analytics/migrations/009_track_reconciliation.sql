@@ -0,0 +1,26 @@
+-- Track Reconciliation Migration
+-- Description: Track availability so deleted and moved files can be reconciled by the scanner
+-- Order: 009
+
+-- 1. Availability status on tracks
+ALTER TABLE tracks
+ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active',
+ADD COLUMN IF NOT EXISTS missing_since TIMESTAMP WITH TIME ZONE;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_tracks_status') THEN
+        ALTER TABLE tracks ADD CONSTRAINT chk_tracks_status CHECK (status IN ('active', 'missing', 'deleted'));
+    END IF;
+END $$;
+
+-- 2. Missing marker on the scanner manifest
+ALTER TABLE library_files ADD COLUMN IF NOT EXISTS missing_since TIMESTAMP WITH TIME ZONE;
+
+-- 3. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_file_path ON tracks (file_path);
+CREATE INDEX IF NOT EXISTS idx_tracks_status ON tracks (status) WHERE status <> 'active';
+
+-- 4. Commentary
+COMMENT ON COLUMN tracks.status IS 'active: file present; missing: file not found by the last scan; deleted: missing beyond the grace period';
+COMMENT ON COLUMN tracks.missing_since IS 'When the scanner first noticed the file was gone';
@@ -0,0 +1,15 @@
+-- Library Roots Migration
+-- Description: Link manifest entries to the file_path stored on tracks so library queries can filter by root
+-- Order: 010
+
+-- 1. Track path per manifest entry (relative to MEDIA_PATH, or absolute for roots outside it)
+ALTER TABLE library_files ADD COLUMN IF NOT EXISTS track_path TEXT;
+
+-- Existing entries all belong to MEDIA_PATH, where both paths are identical
+UPDATE library_files SET track_path = file_path WHERE track_path IS NULL;
+
+-- 2. Indexes
+CREATE INDEX IF NOT EXISTS idx_library_files_track_path ON library_files (root, track_path);
+
+-- 3. Commentary
+COMMENT ON COLUMN library_files.track_path IS 'Value of tracks.file_path for this file';
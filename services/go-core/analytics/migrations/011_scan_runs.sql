@@ -0,0 +1,47 @@
+-- Scan Runs Migration
+-- Description: Persist every scanner pass with its counters and the files that failed
+-- Order: 011
+
+-- 1. One row per scan pass (full scans and watcher rescans)
+CREATE TABLE IF NOT EXISTS scan_runs (
+    id UUID PRIMARY KEY,
+    root TEXT NOT NULL,
+    root_path TEXT NOT NULL,
+    trigger TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE,
+    duration_ms BIGINT,
+    files_seen INTEGER NOT NULL DEFAULT 0,
+    added INTEGER NOT NULL DEFAULT 0,
+    changed INTEGER NOT NULL DEFAULT 0,
+    unchanged INTEGER NOT NULL DEFAULT 0,
+    moved INTEGER NOT NULL DEFAULT 0,
+    missing INTEGER NOT NULL DEFAULT 0,
+    still_missing INTEGER NOT NULL DEFAULT 0,
+    restored INTEGER NOT NULL DEFAULT 0,
+    dispatched INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    CONSTRAINT chk_scan_runs_status CHECK (status IN ('running', 'completed', 'failed', 'interrupted'))
+);
+
+-- 2. Per-file errors recorded during a run
+CREATE TABLE IF NOT EXISTS scan_run_errors (
+    id BIGSERIAL PRIMARY KEY,
+    scan_id UUID NOT NULL REFERENCES scan_runs(id) ON DELETE CASCADE,
+    file_path TEXT NOT NULL,
+    stage TEXT NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 3. Indexes
+CREATE INDEX IF NOT EXISTS idx_scan_runs_root_started ON scan_runs (root, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_scan_run_errors_scan ON scan_run_errors (scan_id);
+
+-- 4. Commentary
+COMMENT ON TABLE scan_runs IS 'History of scanner passes; trigger is startup, schedule, manual or watch';
+COMMENT ON COLUMN scan_runs.missing IS 'Files that went missing with this pass; still_missing counts those already missing before it';
+COMMENT ON COLUMN scan_run_errors.stage IS 'Where the file failed: access, stat, hash, dispatch or manifest';
@@ -0,0 +1,7 @@
+-- Scan Run Cancellation Migration
+-- Description: Allow scan runs to end as cancelled when stopped through the API
+-- Order: 012
+
+ALTER TABLE scan_runs DROP CONSTRAINT IF EXISTS chk_scan_runs_status;
+ALTER TABLE scan_runs ADD CONSTRAINT chk_scan_runs_status
+    CHECK (status IN ('running', 'completed', 'failed', 'interrupted', 'cancelled'));
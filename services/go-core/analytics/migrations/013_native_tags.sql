@@ -0,0 +1,17 @@
+-- Native Tags Migration
+-- Description: Store the properties read by the scanner's tag reader, count indexed files per run and speed up artist/album lookups
+-- Order: 013
+
+-- 1. Stream properties not covered by the initial schema
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS bit_depth INTEGER;
+
+-- 2. Scan runs count the files indexed from tags
+ALTER TABLE scan_runs ADD COLUMN IF NOT EXISTS indexed INTEGER NOT NULL DEFAULT 0;
+
+-- 3. Indexes for find-or-create during scans
+CREATE INDEX IF NOT EXISTS idx_artists_name ON artists (name);
+CREATE INDEX IF NOT EXISTS idx_albums_title_artist ON albums (title, artist_id);
+
+-- 4. Commentary
+COMMENT ON COLUMN tracks.bit_depth IS 'Bits per sample of lossless streams, NULL for lossy codecs';
+COMMENT ON COLUMN scan_runs.indexed IS 'Files whose artist, album and track rows were written from their own tags';
@@ -0,0 +1,42 @@
+-- Content Validation Migration
+-- Description: Record the codec and container detected from file content and quarantine files that fail validation
+-- Order: 014
+
+-- 1. Detected stream format, independent of the file extension stored in tracks.format
+ALTER TABLE tracks
+ADD COLUMN IF NOT EXISTS codec TEXT,
+ADD COLUMN IF NOT EXISTS container TEXT;
+
+-- 2. Files the scanner refused to index or dispatch
+CREATE TABLE IF NOT EXISTS library_quarantine (
+    root TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    container TEXT,
+    codec TEXT,
+    size_bytes BIGINT NOT NULL,
+    mtime TIMESTAMP WITH TIME ZONE NOT NULL,
+    scan_id UUID NOT NULL,
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (root, file_path),
+    CONSTRAINT chk_library_quarantine_reason CHECK (reason IN ('unsupported', 'corrupt', 'misnamed'))
+);
+
+-- 3. Scan runs count quarantined files
+ALTER TABLE scan_runs ADD COLUMN IF NOT EXISTS quarantined INTEGER NOT NULL DEFAULT 0;
+
+-- 4. invalid: the file is still there but failed validation since it was indexed
+ALTER TABLE tracks DROP CONSTRAINT IF EXISTS chk_tracks_status;
+ALTER TABLE tracks ADD CONSTRAINT chk_tracks_status CHECK (status IN ('active', 'missing', 'deleted', 'invalid'));
+
+-- 5. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_codec ON tracks (codec);
+CREATE INDEX IF NOT EXISTS idx_library_quarantine_last_seen ON library_quarantine (last_seen DESC);
+
+-- 6. Commentary
+COMMENT ON COLUMN tracks.codec IS 'Codec detected from the file content (flac, mp3, aac, alac, vorbis, opus, pcm, ...)';
+COMMENT ON COLUMN tracks.container IS 'Container detected from the file content (flac, mpeg, mp4, ogg, wav, aiff)';
+COMMENT ON COLUMN tracks.status IS 'active: file present; missing: file not found by the last scan; deleted: missing beyond the grace period; invalid: file present but quarantined since it was indexed';
+COMMENT ON TABLE library_quarantine IS 'Unsupported, corrupt or misnamed files kept out of the library until they change or are released';
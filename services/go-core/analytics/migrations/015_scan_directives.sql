@@ -0,0 +1,27 @@
+-- Scan Directives Migration
+-- Description: Store the media kind and compilation hints set by per-directory directive files
+-- Order: 015
+
+-- 1. Media kind of each track; audiobooks and podcasts can be kept out of music views
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS media_kind TEXT NOT NULL DEFAULT 'music';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_tracks_media_kind') THEN
+        ALTER TABLE tracks ADD CONSTRAINT chk_tracks_media_kind CHECK (media_kind IN ('music', 'audiobook', 'podcast'));
+    END IF;
+END $$;
+
+-- 2. Compilation flag on albums
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS is_compilation BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 3. Directives each manifest entry was indexed with, so changing them re-indexes the files
+ALTER TABLE library_files ADD COLUMN IF NOT EXISTS directives TEXT;
+
+-- 4. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_media_kind ON tracks (media_kind) WHERE media_kind <> 'music';
+
+-- 5. Commentary
+COMMENT ON COLUMN tracks.media_kind IS 'music, audiobook or podcast; set by .sonantica directive files or the .m4b extension';
+COMMENT ON COLUMN albums.is_compilation IS 'Various-artists album, flagged by a directive file or a compilation tag';
+COMMENT ON COLUMN library_files.directives IS 'Fingerprint of the directives applied when the file was last indexed; NULL when none applied';
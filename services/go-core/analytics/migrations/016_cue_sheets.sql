@@ -0,0 +1,21 @@
+-- Cue Sheets Migration
+-- Description: Split single-file album rips into virtual tracks using their cue sheets
+-- Order: 016
+
+-- 1. Virtual tracks share the file_path of their image and play the range between the offsets
+ALTER TABLE tracks
+ADD COLUMN IF NOT EXISTS cue_track INTEGER,
+ADD COLUMN IF NOT EXISTS start_offset DOUBLE PRECISION,
+ADD COLUMN IF NOT EXISTS end_offset DOUBLE PRECISION;
+
+-- 2. Cue sheet each manifest entry was split with, so editing the sheet re-indexes the image
+ALTER TABLE library_files ADD COLUMN IF NOT EXISTS cue_hash TEXT;
+
+-- 3. Indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tracks_cue_track ON tracks (file_path, cue_track) WHERE cue_track IS NOT NULL;
+
+-- 4. Commentary
+COMMENT ON COLUMN tracks.cue_track IS 'Track number within the cue sheet of a single-file rip; NULL for whole files';
+COMMENT ON COLUMN tracks.start_offset IS 'Start of a cue sheet track within its file, in seconds';
+COMMENT ON COLUMN tracks.end_offset IS 'End of a cue sheet track within its file, in seconds; NULL when it runs to the end of the file';
+COMMENT ON COLUMN library_files.cue_hash IS 'Fingerprint of the cue sheet that split the file; NULL for whole files';
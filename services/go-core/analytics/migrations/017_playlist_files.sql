@@ -0,0 +1,23 @@
+-- Playlist Files Migration
+-- Description: Link MANUAL playlists to the M3U/PLS/XSPF files they were imported from
+-- Order: 017
+
+-- 1. Source file of imported playlists; NULL for playlists created in the app
+ALTER TABLE playlists
+ADD COLUMN IF NOT EXISTS source_root TEXT,
+ADD COLUMN IF NOT EXISTS source_path TEXT,
+ADD COLUMN IF NOT EXISTS source_hash TEXT,
+ADD COLUMN IF NOT EXISTS unresolved TEXT[];
+
+-- 2. Scan runs count the playlists they imported or removed
+ALTER TABLE scan_runs ADD COLUMN IF NOT EXISTS playlists INTEGER NOT NULL DEFAULT 0;
+
+-- 3. Indexes
+CREATE UNIQUE INDEX IF NOT EXISTS idx_playlists_source ON playlists (source_root, source_path) WHERE source_path IS NOT NULL;
+
+-- 4. Commentary
+COMMENT ON COLUMN playlists.source_root IS 'Library root path holding the playlist file the playlist was imported from';
+COMMENT ON COLUMN playlists.source_path IS 'Playlist file the playlist was imported from, relative to source_root; re-synced when it changes';
+COMMENT ON COLUMN playlists.source_hash IS 'Fingerprint of the playlist file content at the last import';
+COMMENT ON COLUMN playlists.unresolved IS 'Entries of the playlist file that matched no track, retried on every scan';
+COMMENT ON COLUMN scan_runs.playlists IS 'Playlists imported, re-synced or removed by the run';
@@ -0,0 +1,25 @@
+-- Integrity Checks Migration
+-- Description: Record the outcome of full-file integrity checks (FLAC MD5, MPEG frame sync, duration) per track
+-- Order: 018
+
+-- 1. Outcome of the last check; NULL until the file has been verified
+ALTER TABLE tracks
+ADD COLUMN IF NOT EXISTS integrity TEXT,
+ADD COLUMN IF NOT EXISTS integrity_issues TEXT[],
+ADD COLUMN IF NOT EXISTS integrity_checked_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE tracks DROP CONSTRAINT IF EXISTS chk_tracks_integrity;
+ALTER TABLE tracks ADD CONSTRAINT chk_tracks_integrity CHECK (integrity IN ('ok', 'corrupt', 'unverified'));
+
+-- 2. Scan runs count the corrupt files they found
+ALTER TABLE scan_runs ADD COLUMN IF NOT EXISTS corrupt INTEGER NOT NULL DEFAULT 0;
+
+-- 3. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_integrity ON tracks (integrity) WHERE integrity = 'corrupt';
+CREATE INDEX IF NOT EXISTS idx_tracks_integrity_pending ON tracks (file_path) WHERE integrity_checked_at IS NULL;
+
+-- 4. Commentary
+COMMENT ON COLUMN tracks.integrity IS 'ok, corrupt, or unverified for containers without a check (MP4, Ogg); NULL until checked';
+COMMENT ON COLUMN tracks.integrity_issues IS 'What the integrity check found wrong with a corrupt file';
+COMMENT ON COLUMN tracks.integrity_checked_at IS 'When the file was last read in full; cleared when the file changes';
+COMMENT ON COLUMN scan_runs.corrupt IS 'Files the run found corrupt during integrity checks';
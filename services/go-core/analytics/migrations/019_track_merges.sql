@@ -0,0 +1,12 @@
+-- Track Merges Migration
+-- Description: Remember which track a duplicate was merged into so scans do not bring it back
+-- Order: 019
+
+-- 1. Track that replaced a merged duplicate; the duplicate itself is marked deleted
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS merged_into UUID REFERENCES tracks(id) ON DELETE SET NULL;
+
+-- 2. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_merged_into ON tracks (merged_into) WHERE merged_into IS NOT NULL;
+
+-- 3. Commentary
+COMMENT ON COLUMN tracks.merged_into IS 'Track this duplicate was merged into; scans keep merged tracks deleted while set';
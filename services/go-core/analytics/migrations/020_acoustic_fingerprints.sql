@@ -0,0 +1,39 @@
+-- Acoustic Fingerprints Migration
+-- Description: Store Chromaprint compatible fingerprints per track and the acoustically identical pairs found through a local index
+-- Order: 020
+
+-- 1. Fingerprint of the first two minutes of each track
+CREATE TABLE IF NOT EXISTS track_fingerprints (
+    track_id UUID PRIMARY KEY REFERENCES tracks(id) ON DELETE CASCADE,
+    algorithm SMALLINT NOT NULL,
+    fingerprint INTEGER[] NOT NULL,
+    index_keys INTEGER[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 2. Tracks found to hold the same recording, stored once per pair
+CREATE TABLE IF NOT EXISTS track_acoustic_matches (
+    track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    match_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    similarity REAL NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (track_id, match_id)
+);
+
+ALTER TABLE track_acoustic_matches DROP CONSTRAINT IF EXISTS chk_acoustic_match_order;
+ALTER TABLE track_acoustic_matches ADD CONSTRAINT chk_acoustic_match_order CHECK (track_id < match_id);
+
+-- 3. When the track was last fingerprinted; NULL until then and whenever its file changes
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS fingerprinted_at TIMESTAMP WITH TIME ZONE;
+
+-- 4. Indexes
+CREATE INDEX IF NOT EXISTS idx_track_fingerprints_keys ON track_fingerprints USING GIN (index_keys);
+CREATE INDEX IF NOT EXISTS idx_track_acoustic_matches_match ON track_acoustic_matches (match_id);
+CREATE INDEX IF NOT EXISTS idx_tracks_fingerprint_pending ON tracks (file_path) WHERE fingerprinted_at IS NULL;
+
+-- 5. Commentary
+COMMENT ON TABLE track_fingerprints IS 'Chromaprint compatible fingerprints computed by the core service';
+COMMENT ON COLUMN track_fingerprints.fingerprint IS 'Raw 32-bit subfingerprints, stored as signed integers';
+COMMENT ON COLUMN track_fingerprints.index_keys IS 'Distinct top 20 bits of the subfingerprints, the inverted index used to find candidates';
+COMMENT ON TABLE track_acoustic_matches IS 'Pairs of tracks whose fingerprints match; track_id is the lower ID';
+COMMENT ON COLUMN tracks.fingerprinted_at IS 'When the track was fingerprinted, or found impossible to decode; cleared when the file changes';
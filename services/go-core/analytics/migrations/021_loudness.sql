@@ -0,0 +1,36 @@
+-- Loudness Migration
+-- Description: Store ReplayGain gains read from tags or measured as EBU R128 loudness, so players can normalize playback
+-- Order: 021
+
+-- 1. ReplayGain 2.0 gains (dB to -18 LUFS) and sample peaks (linear, 1.0 is full scale)
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS replaygain_track_gain DOUBLE PRECISION;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS replaygain_track_peak DOUBLE PRECISION;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS replaygain_album_gain DOUBLE PRECISION;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS replaygain_album_peak DOUBLE PRECISION;
+
+-- 2. Integrated loudness and true peak of the track
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_lufs DOUBLE PRECISION;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS true_peak DOUBLE PRECISION;
+
+-- 3. Where the values came from and when; NULL until then and whenever the file changes
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_source TEXT;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS album_gain_source TEXT;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_checked_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE tracks DROP CONSTRAINT IF EXISTS chk_loudness_source;
+ALTER TABLE tracks ADD CONSTRAINT chk_loudness_source CHECK (loudness_source IN ('tags', 'analysis'));
+ALTER TABLE tracks DROP CONSTRAINT IF EXISTS chk_album_gain_source;
+ALTER TABLE tracks ADD CONSTRAINT chk_album_gain_source CHECK (album_gain_source IN ('tags', 'analysis'));
+
+-- 4. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_loudness_pending ON tracks (file_path) WHERE loudness_checked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_tracks_album_gain_pending ON tracks (album_id) WHERE replaygain_album_gain IS NULL AND loudness_lufs IS NOT NULL;
+
+-- 5. Commentary
+COMMENT ON COLUMN tracks.replaygain_track_gain IS 'Gain in dB that brings the track to -18 LUFS';
+COMMENT ON COLUMN tracks.replaygain_album_gain IS 'Gain in dB that brings the album to -18 LUFS, keeping the level differences between its tracks';
+COMMENT ON COLUMN tracks.loudness_lufs IS 'Integrated loudness in LUFS, measured or derived from the track gain';
+COMMENT ON COLUMN tracks.true_peak IS 'Peak in dBTP; a true peak when measured, the tagged sample peak otherwise';
+COMMENT ON COLUMN tracks.loudness_source IS 'tags when read from ReplayGain or R128 tags, analysis when measured by the core service';
+COMMENT ON COLUMN tracks.album_gain_source IS 'tags when the album gain was read from tags, analysis when combined from the loudness of the album tracks';
+COMMENT ON COLUMN tracks.loudness_checked_at IS 'When loudness was read or measured, or found impossible to decode; cleared when the file changes';
@@ -0,0 +1,35 @@
+-- Technical Metadata Migration
+-- Description: Store the file size, modification time, content hash, codec profile, lossless flag and encoder of each track
+-- Order: 022
+
+-- 1. File properties, copied from the scan manifest so tracks can be filtered without joining it
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS file_size BIGINT;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS file_mtime TIMESTAMP WITH TIME ZONE;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS content_hash TEXT;
+
+-- 2. Encoding details read from the stream headers
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS codec_profile TEXT;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS lossless BOOLEAN;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS encoder TEXT;
+
+-- 3. Backfill what is already known
+UPDATE tracks t SET file_size = lf.size_bytes, file_mtime = lf.mtime, content_hash = lf.content_hash
+FROM library_files lf
+WHERE lf.track_path = t.file_path AND t.file_size IS NULL;
+
+UPDATE tracks SET lossless = codec IN ('flac', 'alac', 'pcm', 'pcm_float')
+WHERE lossless IS NULL AND codec IS NOT NULL;
+
+-- 4. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_lossless ON tracks (lossless);
+CREATE INDEX IF NOT EXISTS idx_tracks_sample_rate ON tracks (sample_rate);
+CREATE INDEX IF NOT EXISTS idx_tracks_bit_depth ON tracks (bit_depth);
+CREATE INDEX IF NOT EXISTS idx_tracks_content_hash ON tracks (content_hash);
+
+-- 5. Commentary
+COMMENT ON COLUMN tracks.file_size IS 'Size of the audio file in bytes; the whole image for cue sheet tracks';
+COMMENT ON COLUMN tracks.file_mtime IS 'Modification time of the audio file when it was last indexed';
+COMMENT ON COLUMN tracks.content_hash IS 'SHA-256 of the audio file when SCAN_CONTENT_HASH is enabled';
+COMMENT ON COLUMN tracks.codec_profile IS 'CBR, ABR or VBR for MP3; LC, HE-AAC, HE-AACv2, ... for AAC';
+COMMENT ON COLUMN tracks.lossless IS 'Whether the codec is lossless (FLAC, ALAC, PCM)';
+COMMENT ON COLUMN tracks.encoder IS 'Software that encoded the file, from the LAME header, Vorbis vendor string or encoder tag';
@@ -0,0 +1,26 @@
+-- Album Covers Migration
+-- Description: Record where an album cover came from and how large it is, so the scanner only replaces it with a better one
+-- Order: 023
+
+-- 1. Details of the cover chosen by the core service; NULL for covers set by the analysis worker
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS cover_source TEXT;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS cover_hash TEXT;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS cover_width INTEGER;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS cover_height INTEGER;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS cover_front BOOLEAN;
+
+ALTER TABLE albums DROP CONSTRAINT IF EXISTS chk_cover_source;
+ALTER TABLE albums ADD CONSTRAINT chk_cover_source CHECK (cover_source IN ('embedded', 'folder'));
+
+-- 2. When the album's files were last searched for artwork; NULL until then
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS cover_checked_at TIMESTAMP WITH TIME ZONE;
+
+-- 3. Indexes
+CREATE INDEX IF NOT EXISTS idx_albums_cover_pending ON albums (id) WHERE cover_checked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_albums_cover_hash ON albums (cover_hash);
+
+-- 4. Commentary
+COMMENT ON COLUMN albums.cover_source IS 'embedded when extracted from an audio file, folder when copied from a cover/folder/front image';
+COMMENT ON COLUMN albums.cover_hash IS 'SHA-256 of the cover image, also its file name under COVER_PATH';
+COMMENT ON COLUMN albums.cover_front IS 'Whether the image is tagged or named as a front cover';
+COMMENT ON COLUMN albums.cover_checked_at IS 'When the album files were last searched for artwork';
@@ -0,0 +1,30 @@
+-- Stem Manifests Migration
+-- Description: Record the files a stem separation wrote for each track, so streams resolve stems without guessing paths
+-- Order: 024
+
+-- 1. Separation job last dispatched for the track; pending until its manifest is recorded
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS stem_job_id TEXT;
+
+-- 2. One row per stem file of a track
+CREATE TABLE IF NOT EXISTS track_stems (
+    track_id UUID NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    stem TEXT NOT NULL,
+    path TEXT NOT NULL,
+    format TEXT NOT NULL,
+    model TEXT,
+    duration_seconds DOUBLE PRECISION,
+    job_id TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (track_id, stem)
+);
+
+-- 3. Indexes
+CREATE INDEX IF NOT EXISTS idx_tracks_stem_job_pending ON tracks (id) WHERE stem_job_id IS NOT NULL AND has_stems = false;
+
+-- 4. Commentary
+COMMENT ON COLUMN tracks.stem_job_id IS 'Stem separation job last dispatched for the track';
+COMMENT ON TABLE track_stems IS 'Stem manifest: the files a separation job wrote for a track, replaced as a whole by the next job';
+COMMENT ON COLUMN track_stems.stem IS 'Stem name as written by the model: vocals, drums, bass, other, guitar, piano or a premixed no_vocals';
+COMMENT ON COLUMN track_stems.path IS 'Path of the stem file relative to STEMS_PATH';
+COMMENT ON COLUMN track_stems.format IS 'Probed format of the stem file: wav, flac, aiff, mp3...';
+COMMENT ON COLUMN track_stems.model IS 'Separation model that produced the stem; NULL for stems imported from disk';
@@ -26,6 +26,22 @@ func NewAnalyticsStorage() *AnalyticsStorage {
 	}
 }
 
+// PruneEvents deletes the raw events recorded before a cutoff and the
+// sessions that ended before it. Aggregated statistics are kept.
+func (s *AnalyticsStorage) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, `DELETE FROM analytics_events WHERE timestamp < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune analytics events: %w", err)
+	}
+	if _, err := s.db.Exec(ctx, `
+		DELETE FROM analytics_sessions
+		WHERE COALESCE(ended_at, last_heartbeat, started_at) < $1
+	`, before); err != nil {
+		return tag.RowsAffected(), fmt.Errorf("failed to prune analytics sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
 // CreateSession creates a new analytics session
 func (s *AnalyticsStorage) CreateSession(ctx context.Context, session *models.Session) error {
 	query := `
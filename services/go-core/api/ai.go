@@ -159,9 +159,11 @@ func (h *AIHandler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
 		query := `
 			SELECT 
 				t.id, t.title, t.album_id, t.artist_id, t.file_path, t.duration_seconds, 
-				t.format, t.bitrate, t.sample_rate, t.channels, t.track_number, t.disc_number, 
+				t.format, t.bitrate, t.sample_rate, t.channels, t.bit_depth, t.codec, t.container, t.track_number, t.disc_number, 
 				t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at,
-				t.ai_metadata, t.has_stems, t.has_embeddings,
+				t.ai_metadata, t.has_stems, t.has_embeddings, t.status, t.media_kind, t.integrity, t.integrity_issues,
+				t.loudness_lufs, t.true_peak, t.replaygain_track_gain, t.replaygain_track_peak, t.replaygain_album_gain, t.replaygain_album_peak,
+				t.codec_profile, t.lossless, t.encoder, t.file_size, t.file_mtime, t.content_hash,
 				a.name as artist_name,
 				al.title as album_title,
 				al.cover_art as album_cover_art
@@ -187,7 +189,7 @@ func (h *AIHandler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
 	if len(albumIDs) > 0 {
 		query := `
 			SELECT 
-				al.id, al.title, al.artist_id, al.release_date::TEXT, al.cover_art, al.genre, al.created_at,
+				al.id, al.title, al.artist_id, al.release_date::TEXT, al.cover_art, al.genre, al.is_compilation, al.created_at,
 				a.name as artist_name
 			FROM albums al
 			LEFT JOIN artists a ON al.artist_id = a.id
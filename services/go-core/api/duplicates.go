@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"sonantica-core/duplicates"
+
+	"github.com/google/uuid"
+)
+
+// GetDuplicates lists groups of tracks holding the same recording, best quality
+// first. ?tolerance=seconds sets how far durations of tracks with the same tags
+// may differ and ?match=content|tags|acoustic keeps only groups found that way.
+func GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	scope, err := parseLibraryScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tolerance := duplicates.DefaultTolerance
+	if v := r.URL.Query().Get("tolerance"); v != "" {
+		if tolerance, err = strconv.ParseFloat(v, 64); err != nil || tolerance < 0 {
+			http.Error(w, fmt.Sprintf("Invalid tolerance: %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+	match := r.URL.Query().Get("match")
+	if match != "" && match != duplicates.MatchContent && match != duplicates.MatchTags && match != duplicates.MatchAcoustic {
+		http.Error(w, fmt.Sprintf("Unknown match: %s", match), http.StatusBadRequest)
+		return
+	}
+
+	cond, args := scope.trackFilter("t", 1)
+	tracks, err := duplicates.Load(r.Context(), cond, args...)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	groups := duplicates.Find(tracks, tolerance)
+	if match != "" {
+		filtered := groups[:0]
+		for _, g := range groups {
+			for _, m := range g.Match {
+				if m == match {
+					filtered = append(filtered, g)
+					break
+				}
+			}
+		}
+		groups = filtered
+	}
+
+	var wasted int64
+	for _, g := range groups {
+		wasted += g.Wasted
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"groups": groups,
+		"total":  len(groups),
+		"wasted": wasted,
+	})
+}
+
+// MergeDuplicates keeps one track and folds the others into it: playlist
+// entries, listening history and statistics move to the kept track and the
+// others are removed from the library. Files on disk are left alone.
+func MergeDuplicates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Keep   string   `json:"keep"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	ids := make([]string, 0, len(req.Remove)+1)
+	for _, id := range append([]string{req.Keep}, req.Remove...) {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid track ID: %s", id), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, parsed.String())
+	}
+
+	result, err := duplicates.Merge(r.Context(), ids[0], ids[1:])
+	if err != nil {
+		switch {
+		case errors.Is(err, duplicates.ErrInvalidMerge):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, duplicates.ErrTrackNotFound):
+			http.Error(w, "Track not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to merge tracks: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
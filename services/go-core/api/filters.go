@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sonantica-core/scanner"
+	"sonantica-core/tags"
+)
+
+// libraryScope narrows library listings and stats, e.g. to a single root
+type libraryScope struct {
+	root *scanner.Root
+	kind string // music, audiobook or podcast; empty for all
+	// integrity is ok, corrupt, unverified or unchecked; empty for all
+	integrity string
+
+	// Technical filters; zero values leave the library unfiltered
+	lossless      *bool
+	codec         string
+	bitDepth      int
+	minBitDepth   int
+	minSampleRate int
+	minBitrate    int
+}
+
+// technicalFilters are the integer query parameters of the technical filters
+var technicalFilters = []string{"bitDepth", "minBitDepth", "minSampleRate", "minBitrate"}
+
+// parseLibraryScope reads the scope from the query string
+// (?root=name&kind=audiobook&integrity=corrupt&lossless=true&minSampleRate=96000)
+func parseLibraryScope(r *http.Request) (libraryScope, error) {
+	var s libraryScope
+	if name := r.URL.Query().Get("root"); name != "" {
+		root, ok := scanner.LookupRoot(name)
+		if !ok {
+			return s, fmt.Errorf("unknown library root: %s", name)
+		}
+		s.root = &root
+	}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		if !scanner.IsMediaKind(kind) {
+			return s, fmt.Errorf("unknown media kind: %s", kind)
+		}
+		s.kind = kind
+	}
+	if integrity := r.URL.Query().Get("integrity"); integrity != "" {
+		switch integrity {
+		case tags.IntegrityOK, tags.IntegrityCorrupt, tags.IntegrityUnverified, "unchecked":
+		default:
+			return s, fmt.Errorf("unknown integrity status: %s", integrity)
+		}
+		s.integrity = integrity
+	}
+	if lossless := r.URL.Query().Get("lossless"); lossless != "" {
+		b, err := strconv.ParseBool(lossless)
+		if err != nil {
+			return s, fmt.Errorf("invalid lossless: %s", lossless)
+		}
+		s.lossless = &b
+	}
+	s.codec = strings.ToLower(r.URL.Query().Get("codec"))
+	for i, dst := range []*int{&s.bitDepth, &s.minBitDepth, &s.minSampleRate, &s.minBitrate} {
+		v := r.URL.Query().Get(technicalFilters[i])
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return s, fmt.Errorf("invalid %s: %s", technicalFilters[i], v)
+		}
+		*dst = n
+	}
+	return s, nil
+}
+
+// cacheKey identifies the scope in cache keys; empty for the whole library
+func (s libraryScope) cacheKey() string {
+	var parts []string
+	if s.root != nil {
+		parts = append(parts, "root="+s.root.Name)
+	}
+	if s.kind != "" {
+		parts = append(parts, "kind="+s.kind)
+	}
+	if s.integrity != "" {
+		parts = append(parts, "integrity="+s.integrity)
+	}
+	if s.lossless != nil {
+		parts = append(parts, "lossless="+strconv.FormatBool(*s.lossless))
+	}
+	if s.codec != "" {
+		parts = append(parts, "codec="+s.codec)
+	}
+	for i, v := range []int{s.bitDepth, s.minBitDepth, s.minSampleRate, s.minBitrate} {
+		if v > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", technicalFilters[i], v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// trackFilter returns the SQL condition restricting the tracks aliased as alias
+// to the scope. Deleted tracks and those of files that failed validation are
+// never listed. Placeholders are numbered from next and args must be appended
+// to the query arguments in order.
+func (s libraryScope) trackFilter(alias string, next int) (string, []any) {
+	cond := alias + ".status NOT IN ('deleted', 'invalid')"
+	var args []any
+	if s.root != nil {
+		cond += fmt.Sprintf(" AND %s.file_path IN (SELECT track_path FROM library_files WHERE root = $%d)", alias, next)
+		args = append(args, s.root.Path)
+	}
+	if s.kind != "" {
+		cond += fmt.Sprintf(" AND %s.media_kind = $%d", alias, next+len(args))
+		args = append(args, s.kind)
+	}
+	switch s.integrity {
+	case "":
+	case "unchecked":
+		cond += fmt.Sprintf(" AND %s.integrity IS NULL", alias)
+	default:
+		cond += fmt.Sprintf(" AND %s.integrity = $%d", alias, next+len(args))
+		args = append(args, s.integrity)
+	}
+	if s.lossless != nil {
+		cond += fmt.Sprintf(" AND %s.lossless = $%d", alias, next+len(args))
+		args = append(args, *s.lossless)
+	}
+	if s.codec != "" {
+		cond += fmt.Sprintf(" AND %s.codec = $%d", alias, next+len(args))
+		args = append(args, s.codec)
+	}
+	for _, f := range []struct {
+		column, op string
+		value      int
+	}{
+		{"bit_depth", "=", s.bitDepth},
+		{"bit_depth", ">=", s.minBitDepth},
+		{"sample_rate", ">=", s.minSampleRate},
+		{"bitrate", ">=", s.minBitrate},
+	} {
+		if f.value > 0 {
+			cond += fmt.Sprintf(" AND %s.%s %s $%d", alias, f.column, f.op, next+len(args))
+			args = append(args, f.value)
+		}
+	}
+	return cond, args
+}
+
+// scoped reports whether the scope restricts the library at all
+func (s libraryScope) scoped() bool {
+	return s.cacheKey() != ""
+}
+
+// ownerFilter scopes an entity that owns tracks, such as an artist or album.
+// join links the tracks alias t to the owner (e.g. "t.artist_id = artists.id");
+// countCond counts the owner's tracks in scope and where hides owners without any.
+func (s libraryScope) ownerFilter(join string, next int) (countCond, where string, args []any) {
+	cond, args := s.trackFilter("t", next)
+	countCond = join + " AND " + cond
+	if s.scoped() {
+		where = fmt.Sprintf("WHERE EXISTS (SELECT 1 FROM tracks t WHERE %s)", countCond)
+	}
+	return countCond, where, args
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrackFilterHidesUnplayableTracks(t *testing.T) {
+	cond, args := libraryScope{}.trackFilter("t", 1)
+	if len(args) != 0 {
+		t.Errorf("args = %v, want none", args)
+	}
+	for _, status := range []string{"'deleted'", "'invalid'"} {
+		if !strings.Contains(cond, status) {
+			t.Errorf("condition %q does not exclude %s tracks", cond, status)
+		}
+	}
+	if strings.Contains(cond, "'missing'") {
+		t.Errorf("condition %q hides missing tracks", cond)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"sonantica-core/database"
+	"sonantica-core/fingerprint"
+	"sonantica-core/models"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// acousticMatch is a track holding the same recording as another
+type acousticMatch struct {
+	models.Track
+	Similarity float64 `json:"similarity" db:"similarity"`
+}
+
+// GetAcousticMatches lists the tracks acoustically identical to a track,
+// whatever their tags, most similar first, with the track's compressed
+// Chromaprint fingerprint. ?threshold= raises the minimum similarity.
+func GetAcousticMatches(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	trackID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(trackID); err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	threshold := fingerprint.DefaultThreshold
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		if _, err := fmt.Sscanf(v, "%g", &threshold); err != nil || threshold > 1 {
+			http.Error(w, fmt.Sprintf("Invalid threshold: %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var fingerprinted bool
+	err := database.DB.QueryRow(r.Context(), `SELECT fingerprinted_at IS NOT NULL FROM tracks WHERE id = $1`, trackID).Scan(&fingerprinted)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Track not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fp, err := fingerprint.Get(r.Context(), trackID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := database.DB.Query(r.Context(), `
+		SELECT
+			t.id, t.title, t.album_id, t.artist_id, t.file_path, t.duration_seconds,
+			t.format, t.bitrate, t.sample_rate, t.channels, t.bit_depth, t.codec, t.container, t.track_number, t.disc_number,
+			t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at,
+			t.ai_metadata, t.has_stems, t.has_embeddings, t.status, t.media_kind, t.integrity, t.integrity_issues,
+			t.loudness_lufs, t.true_peak, t.replaygain_track_gain, t.replaygain_track_peak, t.replaygain_album_gain, t.replaygain_album_peak,
+			t.codec_profile, t.lossless, t.encoder, t.file_size, t.file_mtime, t.content_hash,
+			a.name as artist_name,
+			al.title as album_title,
+			al.cover_art as album_cover_art,
+			m.similarity::float8 as similarity
+		FROM track_acoustic_matches m
+		JOIN tracks t ON t.id = CASE WHEN m.track_id = $1 THEN m.match_id ELSE m.track_id END
+		LEFT JOIN artists a ON t.artist_id = a.id
+		LEFT JOIN albums al ON t.album_id = al.id
+		WHERE (m.track_id = $1 OR m.match_id = $1) AND m.similarity >= $2 AND t.status <> 'deleted'
+		ORDER BY m.similarity DESC, t.title
+	`, trackID, threshold)
+	if err != nil {
+		slog.Error("Failed to query acoustic matches", "error", err, "track_id", trackID)
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	matches, err := pgx.CollectRows(rows, pgx.RowToStructByName[acousticMatch])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Row scan error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var compressed *string
+	if fp != nil {
+		s := fingerprint.Compress(fp)
+		compressed = &s
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"trackId":       trackID,
+		"fingerprinted": fingerprinted,
+		"fingerprint":   compressed,
+		"matches":       matches,
+	})
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"sonantica-core/transcode"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// hlsPlaylistType is the content type of HLS playlists
+const hlsPlaylistType = "application/vnd.apple.mpegurl"
+
+// GetHLSMaster lists the HLS renditions of a track, or of its ?stem=
+func GetHLSMaster(w http.ResponseWriter, r *http.Request) {
+	trackID, ok := streamTrackID(w, r)
+	if !ok {
+		return
+	}
+	src := hlsSource(w, r, trackID)
+	if src == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", hlsPlaylistType)
+	fmt.Fprint(w, transcode.MasterPlaylist(transcode.RenditionsFor(src.bitrate), r.URL.RawQuery))
+}
+
+// GetHLSPlaylist lists the segments of a rendition
+func GetHLSPlaylist(w http.ResponseWriter, r *http.Request) {
+	trackID, ok := streamTrackID(w, r)
+	if !ok {
+		return
+	}
+	if _, ok := hlsRendition(w, r); !ok {
+		return
+	}
+	src := hlsSource(w, r, trackID)
+	if src == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", hlsPlaylistType)
+	fmt.Fprint(w, transcode.MediaPlaylist(src.duration, r.URL.RawQuery))
+}
+
+// GetHLSSegment converts a segment of a rendition, or serves it from the transcode cache
+func GetHLSSegment(w http.ResponseWriter, r *http.Request) {
+	trackID, ok := streamTrackID(w, r)
+	if !ok {
+		return
+	}
+	bitrate, ok := hlsRendition(w, r)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(chi.URLParam(r, "segment"))
+	if err != nil || index < 0 {
+		http.Error(w, "Invalid segment", http.StatusBadRequest)
+		return
+	}
+	src := hlsSource(w, r, trackID)
+	if src == nil {
+		return
+	}
+	if index >= transcode.Segments(src.duration) {
+		http.NotFound(w, r)
+		return
+	}
+
+	serveJob(w, r, trackID, transcode.Segment(src.job(), src.duration, index, bitrate))
+}
+
+// hlsSource resolves the file of an HLS request like StreamTrack does.
+// Segments are cut by time, so tracks of unknown duration cannot be streamed.
+func hlsSource(w http.ResponseWriter, r *http.Request, trackID string) *streamSource {
+	if Transcodes == nil {
+		http.Error(w, "Transcoding is unavailable", http.StatusServiceUnavailable)
+		return nil
+	}
+	src := resolveStream(w, r, trackID, r.URL.Query().Get("stem"))
+	if src == nil {
+		return nil
+	}
+	if src.duration <= 0 {
+		slog.Warn("Track duration is unknown, cannot segment it", "track_id", trackID)
+		http.Error(w, "Track duration is unknown", http.StatusUnprocessableEntity)
+		return nil
+	}
+	return src
+}
+
+// hlsRendition reads the bitrate of the requested rendition
+func hlsRendition(w http.ResponseWriter, r *http.Request) (int, bool) {
+	bitrate, err := strconv.Atoi(chi.URLParam(r, "bitrate"))
+	if err != nil || !transcode.IsRendition(bitrate) {
+		http.Error(w, fmt.Sprintf("Invalid rendition, expected one of %v", transcode.Renditions), http.StatusBadRequest)
+		return 0, false
+	}
+	return bitrate, true
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"sonantica-core/scheduler"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetJobs lists the scheduled background jobs with their last and next runs
+func GetJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": scheduler.List(),
+	})
+}
+
+// GetJob returns the status of a single job
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	job, ok := scheduler.Lookup(chi.URLParam(r, "name"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(job)
+}
+
+// RunJob starts a job immediately, outside its schedule
+func RunJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	name := chi.URLParam(r, "name")
+	if err := scheduler.RunNow(name); err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrUnknownJob):
+			http.Error(w, fmt.Sprintf("Unknown job: %s", name), http.StatusNotFound)
+		case errors.Is(err, scheduler.ErrJobRunning):
+			http.Error(w, fmt.Sprintf("Job already running: %s", name), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	job, _ := scheduler.Lookup(name)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "started",
+		"job":    job,
+	})
+}
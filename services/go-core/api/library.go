@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
 	"sonantica-core/cache"
 	"sonantica-core/database"
 	"sonantica-core/models"
 	"sonantica-core/scanner"
+	"sonantica-core/scheduler"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
@@ -21,6 +23,12 @@ import (
 func GetTracks(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	scope, err := parseLibraryScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limit := 50
 	offset := 0
 
@@ -45,7 +53,7 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 
 		// Try cache first
 		var tracks []models.Track
-		if err := cache.GetAllTracks(r.Context(), &tracks); err == nil {
+		if err := cache.GetAllTracks(r.Context(), scope.cacheKey(), &tracks); err == nil {
 			slog.Debug("Cache hit for ALL tracks")
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"tracks": tracks,
@@ -56,6 +64,7 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Cache miss, query ALL from database
+		cond, args := scope.trackFilter("t", 1)
 		orderBy := "t.created_at DESC"
 		switch sortParam {
 		case "title":
@@ -71,19 +80,22 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 		query := fmt.Sprintf(`
 			SELECT 
 				t.id, t.title, t.album_id, t.artist_id, t.file_path, t.duration_seconds, 
-				t.format, t.bitrate, t.sample_rate, t.channels, t.track_number, t.disc_number, 
+				t.format, t.bitrate, t.sample_rate, t.channels, t.bit_depth, t.codec, t.container, t.track_number, t.disc_number, 
 				t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at,
-				t.ai_metadata, t.has_stems, t.has_embeddings,
+				t.ai_metadata, t.has_stems, t.has_embeddings, t.status, t.media_kind, t.integrity, t.integrity_issues,
+				t.loudness_lufs, t.true_peak, t.replaygain_track_gain, t.replaygain_track_peak, t.replaygain_album_gain, t.replaygain_album_peak,
+				t.codec_profile, t.lossless, t.encoder, t.file_size, t.file_mtime, t.content_hash,
 				a.name as artist_name,
 				al.title as album_title,
 				al.cover_art as album_cover_art
 			FROM tracks t
 			LEFT JOIN artists a ON t.artist_id = a.id
 			LEFT JOIN albums al ON t.album_id = al.id
+			WHERE %s
 			ORDER BY %s
-		`, orderBy)
+		`, cond, orderBy)
 
-		rows, err := database.DB.Query(r.Context(), query)
+		rows, err := database.DB.Query(r.Context(), query, args...)
 		if err != nil {
 			slog.Error("Failed to query ALL tracks", "error", err)
 			http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -99,7 +111,7 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Cache the complete library
-		if err := cache.SetAllTracks(r.Context(), tracks); err != nil {
+		if err := cache.SetAllTracks(r.Context(), scope.cacheKey(), tracks); err != nil {
 			slog.Warn("Failed to cache ALL tracks", "error", err)
 		}
 
@@ -134,7 +146,7 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 
 	// Try cache first
 	var tracks []models.Track
-	if err := cache.GetTracks(r.Context(), offset, limit, sortParam, orderParam, &tracks); err == nil {
+	if err := cache.GetTracks(r.Context(), scope.cacheKey(), offset, limit, sortParam, orderParam, &tracks); err == nil {
 		slog.Debug("Cache hit for tracks", "offset", offset, "limit", limit)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"tracks": tracks,
@@ -146,23 +158,27 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cache miss, query database
+	cond, args := scope.trackFilter("t", 3)
 	query := fmt.Sprintf(`
 		SELECT 
 			t.id, t.title, t.album_id, t.artist_id, t.file_path, t.duration_seconds, 
-			t.format, t.bitrate, t.sample_rate, t.channels, t.track_number, t.disc_number, 
+			t.format, t.bitrate, t.sample_rate, t.channels, t.bit_depth, t.codec, t.container, t.track_number, t.disc_number, 
 			t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at,
-			t.ai_metadata, t.has_stems, t.has_embeddings,
+			t.ai_metadata, t.has_stems, t.has_embeddings, t.status, t.media_kind, t.integrity, t.integrity_issues,
+			t.loudness_lufs, t.true_peak, t.replaygain_track_gain, t.replaygain_track_peak, t.replaygain_album_gain, t.replaygain_album_peak,
+			t.codec_profile, t.lossless, t.encoder, t.file_size, t.file_mtime, t.content_hash,
 			a.name as artist_name,
 			al.title as album_title,
 			al.cover_art as album_cover_art
 		FROM tracks t
 		LEFT JOIN artists a ON t.artist_id = a.id
 		LEFT JOIN albums al ON t.album_id = al.id
+		WHERE %s
 		ORDER BY %s
 		LIMIT $1 OFFSET $2
-	`, orderBy)
+	`, cond, orderBy)
 
-	rows, err := database.DB.Query(r.Context(), query, limit, offset)
+	rows, err := database.DB.Query(r.Context(), query, append([]any{limit, offset}, args...)...)
 	if err != nil {
 		slog.Error("Failed to query tracks", "error", err)
 		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -178,7 +194,7 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cache the result
-	if err := cache.SetTracks(r.Context(), offset, limit, sortParam, orderParam, tracks); err != nil {
+	if err := cache.SetTracks(r.Context(), scope.cacheKey(), offset, limit, sortParam, orderParam, tracks); err != nil {
 		slog.Warn("Failed to cache tracks", "error", err)
 	}
 
@@ -195,6 +211,12 @@ func GetTracks(w http.ResponseWriter, r *http.Request) {
 func GetArtists(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	scope, err := parseLibraryScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limit := 50
 	offset := 0
 
@@ -217,7 +239,7 @@ func GetArtists(w http.ResponseWriter, r *http.Request) {
 
 		// Try cache first
 		var artists []models.Artist
-		if err := cache.GetAllArtists(r.Context(), &artists); err == nil {
+		if err := cache.GetAllArtists(r.Context(), scope.cacheKey(), &artists); err == nil {
 			slog.Debug("Cache hit for ALL artists")
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"artists": artists,
@@ -237,9 +259,10 @@ func GetArtists(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		query := fmt.Sprintf("SELECT id, name, bio, cover_art, created_at, (SELECT count(*) FROM tracks WHERE artist_id = artists.id) as track_count FROM artists ORDER BY %s", orderBy)
+		countCond, where, args := scope.ownerFilter("t.artist_id = artists.id", 1)
+		query := fmt.Sprintf("SELECT id, name, bio, cover_art, created_at, (SELECT count(*) FROM tracks t WHERE %s) as track_count FROM artists %s ORDER BY %s", countCond, where, orderBy)
 
-		rows, err := database.DB.Query(r.Context(), query)
+		rows, err := database.DB.Query(r.Context(), query, args...)
 		if err != nil {
 			slog.Error("Failed to query ALL artists", "error", err)
 			http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -255,7 +278,7 @@ func GetArtists(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Cache the complete library
-		if err := cache.SetAllArtists(r.Context(), artists); err != nil {
+		if err := cache.SetAllArtists(r.Context(), scope.cacheKey(), artists); err != nil {
 			slog.Warn("Failed to cache ALL artists", "error", err)
 		}
 
@@ -286,15 +309,16 @@ func GetArtists(w http.ResponseWriter, r *http.Request) {
 
 	// Try cache first
 	var artists []models.Artist
-	if err := cache.GetArtists(r.Context(), offset, limit, sortParam, orderParam, &artists); err == nil {
+	if err := cache.GetArtists(r.Context(), scope.cacheKey(), offset, limit, sortParam, orderParam, &artists); err == nil {
 		slog.Debug("Artist cache hit")
 		json.NewEncoder(w).Encode(map[string]interface{}{"artists": artists, "limit": limit, "offset": offset, "cached": true})
 		return
 	}
 
-	query := fmt.Sprintf("SELECT id, name, bio, cover_art, created_at, (SELECT count(*) FROM tracks WHERE artist_id = artists.id) as track_count FROM artists ORDER BY %s LIMIT $1 OFFSET $2", orderBy)
+	countCond, where, args := scope.ownerFilter("t.artist_id = artists.id", 3)
+	query := fmt.Sprintf("SELECT id, name, bio, cover_art, created_at, (SELECT count(*) FROM tracks t WHERE %s) as track_count FROM artists %s ORDER BY %s LIMIT $1 OFFSET $2", countCond, where, orderBy)
 
-	rows, err := database.DB.Query(r.Context(), query, limit, offset)
+	rows, err := database.DB.Query(r.Context(), query, append([]any{limit, offset}, args...)...)
 	if err != nil {
 		slog.Error("Failed to query artists", "error", err)
 		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -310,7 +334,7 @@ func GetArtists(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cache the result
-	if err := cache.SetArtists(r.Context(), offset, limit, sortParam, orderParam, artists); err != nil {
+	if err := cache.SetArtists(r.Context(), scope.cacheKey(), offset, limit, sortParam, orderParam, artists); err != nil {
 		slog.Warn("Failed to cache artists", "error", err)
 	}
 
@@ -327,6 +351,12 @@ func GetArtists(w http.ResponseWriter, r *http.Request) {
 func GetAlbums(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	scope, err := parseLibraryScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limit := 50
 	offset := 0
 
@@ -349,7 +379,7 @@ func GetAlbums(w http.ResponseWriter, r *http.Request) {
 
 		// Try cache first
 		var albums []models.Album
-		if err := cache.GetAllAlbums(r.Context(), &albums); err == nil {
+		if err := cache.GetAllAlbums(r.Context(), scope.cacheKey(), &albums); err == nil {
 			slog.Debug("Cache hit for ALL albums")
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"albums": albums,
@@ -377,17 +407,19 @@ func GetAlbums(w http.ResponseWriter, r *http.Request) {
 			orderBy += " ASC"
 		}
 
+		countCond, where, args := scope.ownerFilter("t.album_id = al.id", 1)
 		query := fmt.Sprintf(`
 			SELECT 
-				al.id, al.title, al.artist_id, al.release_date::TEXT, al.cover_art, al.genre, al.created_at,
+				al.id, al.title, al.artist_id, al.release_date::TEXT, al.cover_art, al.genre, al.is_compilation, al.created_at,
 				a.name as artist_name,
-				(SELECT count(*) FROM tracks WHERE album_id = al.id) as track_count
+				(SELECT count(*) FROM tracks t WHERE %s) as track_count
 			FROM albums al
 			LEFT JOIN artists a ON al.artist_id = a.id
+			%s
 			ORDER BY %s
-		`, orderBy)
+		`, countCond, where, orderBy)
 
-		rows, err := database.DB.Query(r.Context(), query)
+		rows, err := database.DB.Query(r.Context(), query, args...)
 		if err != nil {
 			slog.Error("Failed to query ALL albums", "error", err)
 			http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -403,7 +435,7 @@ func GetAlbums(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Cache the complete library
-		if err := cache.SetAllAlbums(r.Context(), albums); err != nil {
+		if err := cache.SetAllAlbums(r.Context(), scope.cacheKey(), albums); err != nil {
 			slog.Warn("Failed to cache ALL albums", "error", err)
 		}
 
@@ -443,7 +475,7 @@ func GetAlbums(w http.ResponseWriter, r *http.Request) {
 
 	// Try cache for paginated albums
 	var albums []models.Album
-	if err := cache.GetAlbums(r.Context(), offset, limit, sortParam, orderParam, &albums); err == nil {
+	if err := cache.GetAlbums(r.Context(), scope.cacheKey(), offset, limit, sortParam, orderParam, &albums); err == nil {
 		slog.Debug("Albums cache hit")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"albums": albums,
@@ -454,18 +486,20 @@ func GetAlbums(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	countCond, where, args := scope.ownerFilter("t.album_id = al.id", 3)
 	query := fmt.Sprintf(`
 		SELECT 
-			al.id, al.title, al.artist_id, al.release_date::TEXT, al.cover_art, al.genre, al.created_at,
+			al.id, al.title, al.artist_id, al.release_date::TEXT, al.cover_art, al.genre, al.is_compilation, al.created_at,
 			a.name as artist_name,
-			(SELECT count(*) FROM tracks WHERE album_id = al.id) as track_count
+			(SELECT count(*) FROM tracks t WHERE %s) as track_count
 		FROM albums al
 		LEFT JOIN artists a ON al.artist_id = a.id
+		%s
 		ORDER BY %s
 		LIMIT $1 OFFSET $2
-	`, orderBy)
+	`, countCond, where, orderBy)
 
-	rows, err := database.DB.Query(r.Context(), query, limit, offset)
+	rows, err := database.DB.Query(r.Context(), query, append([]any{limit, offset}, args...)...)
 	if err != nil {
 		slog.Error("Failed to query albums", "error", err)
 		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -481,7 +515,7 @@ func GetAlbums(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cache the result
-	if err := cache.SetAlbums(r.Context(), offset, limit, sortParam, orderParam, albums); err != nil {
+	if err := cache.SetAlbums(r.Context(), scope.cacheKey(), offset, limit, sortParam, orderParam, albums); err != nil {
 		slog.Warn("Failed to cache albums", "error", err)
 	}
 
@@ -493,37 +527,112 @@ func GetAlbums(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ScanLibrary triggers a manual scan of the media library
+// ScanLibrary triggers a manual scan of one library root (?root=name) or of every enabled root.
+// With ?dryRun=true the roots are walked synchronously and the diff a scan would apply is returned instead;
+// ?limit= caps how many new or changed files each root probes.
 func ScanLibrary(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Parse custom paths if sent in body, but for now just use root
-	// MVP: Trigger root scan
+	var targets []scanner.Root
+	if name := r.URL.Query().Get("root"); name != "" {
+		root, ok := scanner.LookupRoot(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown library root: %s", name), http.StatusNotFound)
+			return
+		}
+		if !root.Enabled {
+			http.Error(w, fmt.Sprintf("Library root is disabled: %s", name), http.StatusConflict)
+			return
+		}
+		targets = append(targets, root)
+	} else {
+		for _, root := range scanner.Roots() {
+			if root.Enabled {
+				targets = append(targets, root)
+			}
+		}
+	}
 
-	mediaPath := os.Getenv("MEDIA_PATH")
-	if mediaPath == "" {
-		mediaPath = "/media"
+	if r.URL.Query().Get("dryRun") == "true" {
+		limit := scanner.DryRunLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+				http.Error(w, "Invalid limit, expected a positive number of files", http.StatusBadRequest)
+				return
+			}
+		}
+		reports := make([]*scanner.DryRunReport, 0, len(targets))
+		for _, root := range targets {
+			slog.Info("Dry-run scan requested via API", "root", root.Name, "path", root.Path)
+			report, err := scanner.DryRun(r.Context(), root, limit)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Dry run failed for %s: %v", root.Name, err), http.StatusInternalServerError)
+				return
+			}
+			reports = append(reports, report)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"dryRun":  true,
+			"reports": reports,
+		})
+		return
 	}
 
-	slog.Info("Manual scan triggered via API", "path", mediaPath)
-	scanner.TriggerScan(mediaPath)
+	// A root that is already being scanned gets one coalesced rescan queued behind it
+	names := make([]string, 0, len(targets))
+	queued := make([]string, 0)
+	for _, root := range targets {
+		slog.Info("Manual scan triggered via API", "root", root.Name, "path", root.Path)
+		if scanner.TriggerScan(root) {
+			queued = append(queued, root.Name)
+		}
+		names = append(names, root.Name)
+	}
 
 	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{
+	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": "scanning_started",
-		"path":   mediaPath,
+		"roots":  names,
+		"queued": queued,
 	})
 }
 
-// GetScanStatus returns the current status and statistics of the library
+// GetScanStatus returns the current status and statistics of the library.
+// With ?root=name the status and statistics cover that root only.
 func GetScanStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	scope, err := parseLibraryScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rootName := ""
+	isScanning := scanner.IsScanning()
+	isPaused := false
+	if scope.root != nil {
+		rootName = scope.root.Name
+		isScanning = scanner.IsRootScanning(rootName)
+		isPaused = scanner.IsRootPaused(rootName)
+	}
+
+	// Live counters of the running scan, published by the scanner
+	var progress map[string]interface{}
+	if isScanning {
+		progress, _ = cache.GetScanStatus(r.Context())
+	}
+
 	// Try cache first
-	if stats, err := cache.GetLibraryStats(r.Context()); err == nil {
+	if stats, err := cache.GetLibraryStats(r.Context(), scope.cacheKey()); err == nil {
 		slog.Debug("Cache hit for library stats")
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"isScanning": scanner.IsScanning(),
+			"isScanning": isScanning,
+			"isPaused":   isPaused,
+			"scanning":   scanner.ScanningRoots(),
+			"progress":   progress,
+			"lastScan":   scanner.LastResult(rootName),
 			"stats":      stats,
 			"cached":     true,
 		})
@@ -533,9 +642,15 @@ func GetScanStatus(w http.ResponseWriter, r *http.Request) {
 	// Cache miss, query database
 	var trackCount, artistCount, albumCount int
 
-	database.DB.QueryRow(r.Context(), "SELECT count(*) FROM tracks").Scan(&trackCount)
-	database.DB.QueryRow(r.Context(), "SELECT count(*) FROM artists").Scan(&artistCount)
-	database.DB.QueryRow(r.Context(), "SELECT count(*) FROM albums").Scan(&albumCount)
+	cond, args := scope.trackFilter("t", 1)
+	database.DB.QueryRow(r.Context(), "SELECT count(*) FROM tracks t WHERE "+cond, args...).Scan(&trackCount)
+	if scope.scoped() {
+		database.DB.QueryRow(r.Context(), "SELECT count(DISTINCT t.artist_id) FROM tracks t WHERE "+cond, args...).Scan(&artistCount)
+		database.DB.QueryRow(r.Context(), "SELECT count(DISTINCT t.album_id) FROM tracks t WHERE "+cond, args...).Scan(&albumCount)
+	} else {
+		database.DB.QueryRow(r.Context(), "SELECT count(*) FROM artists").Scan(&artistCount)
+		database.DB.QueryRow(r.Context(), "SELECT count(*) FROM albums").Scan(&albumCount)
+	}
 
 	stats := map[string]interface{}{
 		"tracks":  trackCount,
@@ -544,41 +659,84 @@ func GetScanStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Cache the stats
-	if err := cache.SetLibraryStats(r.Context(), stats); err != nil {
+	if err := cache.SetLibraryStats(r.Context(), scope.cacheKey(), stats); err != nil {
 		slog.Warn("Failed to cache library stats", "error", err)
 	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"isScanning": scanner.IsScanning(),
+		"isScanning": isScanning,
+		"isPaused":   isPaused,
+		"scanning":   scanner.ScanningRoots(),
+		"progress":   progress,
+		"lastScan":   scanner.LastResult(rootName),
 		"stats":      stats,
 		"cached":     false,
 	})
 }
 
+// GetLibraryRoots lists the configured library roots with their scan state
+func GetLibraryRoots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	roots := scanner.Roots()
+	result := make([]map[string]interface{}, 0, len(roots))
+	for _, root := range roots {
+		var nextScan *time.Time
+		if job, ok := scheduler.Lookup(scanner.JobName(root.Name)); ok {
+			nextScan = job.NextRun
+		}
+		result = append(result, map[string]interface{}{
+			"name":       root.Name,
+			"path":       root.Path,
+			"include":    root.Include,
+			"exclude":    root.Exclude,
+			"enabled":    root.Enabled,
+			"schedule":   root.Schedule,
+			"nextScan":   nextScan,
+			"isScanning": scanner.IsRootScanning(root.Name),
+			"isPaused":   scanner.IsRootPaused(root.Name),
+			"lastScan":   scanner.LastResult(root.Name),
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"roots": result,
+	})
+}
+
 // GetTracksByArtist returns tracks filtered by artist ID
 func GetTracksByArtist(w http.ResponseWriter, r *http.Request) {
 	artistID := chi.URLParam(r, "id")
 	w.Header().Set("Content-Type", "application/json")
 
+	scope, err := parseLibraryScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	slog.Info("Fetching tracks by artist", "artist_id", artistID)
 
+	cond, args := scope.trackFilter("t", 2)
 	query := `
 		SELECT 
 			t.id, t.title, t.album_id, t.artist_id, t.file_path, t.duration_seconds, 
-			t.format, t.bitrate, t.sample_rate, t.channels, t.track_number, t.disc_number, 
+			t.format, t.bitrate, t.sample_rate, t.channels, t.bit_depth, t.codec, t.container, t.track_number, t.disc_number, 
 			t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at,
-			t.ai_metadata, t.has_stems, t.has_embeddings,
+			t.ai_metadata, t.has_stems, t.has_embeddings, t.status, t.media_kind, t.integrity, t.integrity_issues,
+			t.loudness_lufs, t.true_peak, t.replaygain_track_gain, t.replaygain_track_peak, t.replaygain_album_gain, t.replaygain_album_peak,
+			t.codec_profile, t.lossless, t.encoder, t.file_size, t.file_mtime, t.content_hash,
 			a.name as artist_name,
 			al.title as album_title,
 			al.cover_art as album_cover_art
 		FROM tracks t
 		LEFT JOIN artists a ON t.artist_id = a.id
 		LEFT JOIN albums al ON t.album_id = al.id
-		WHERE t.artist_id = $1
+		WHERE t.artist_id = $1 AND ` + cond + `
 		ORDER BY al.release_date DESC, t.track_number ASC
 	`
 
-	rows, err := database.DB.Query(r.Context(), query, artistID)
+	rows, err := database.DB.Query(r.Context(), query, append([]any{artistID}, args...)...)
 	if err != nil {
 		slog.Error("Failed to query tracks by artist", "error", err, "artist_id", artistID)
 		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
@@ -603,25 +761,34 @@ func GetTracksByAlbum(w http.ResponseWriter, r *http.Request) {
 	albumID := chi.URLParam(r, "id")
 	w.Header().Set("Content-Type", "application/json")
 
+	scope, err := parseLibraryScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	slog.Info("Fetching tracks by album", "album_id", albumID)
 
+	cond, args := scope.trackFilter("t", 2)
 	query := `
 		SELECT 
 			t.id, t.title, t.album_id, t.artist_id, t.file_path, t.duration_seconds, 
-			t.format, t.bitrate, t.sample_rate, t.channels, t.track_number, t.disc_number, 
+			t.format, t.bitrate, t.sample_rate, t.channels, t.bit_depth, t.codec, t.container, t.track_number, t.disc_number, 
 			t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at,
-			t.ai_metadata, t.has_stems, t.has_embeddings,
+			t.ai_metadata, t.has_stems, t.has_embeddings, t.status, t.media_kind, t.integrity, t.integrity_issues,
+			t.loudness_lufs, t.true_peak, t.replaygain_track_gain, t.replaygain_track_peak, t.replaygain_album_gain, t.replaygain_album_peak,
+			t.codec_profile, t.lossless, t.encoder, t.file_size, t.file_mtime, t.content_hash,
 			a.name as artist_name,
 			al.title as album_title,
 			al.cover_art as album_cover_art
 		FROM tracks t
 		LEFT JOIN artists a ON t.artist_id = a.id
 		LEFT JOIN albums al ON t.album_id = al.id
-		WHERE t.album_id = $1
+		WHERE t.album_id = $1 AND ` + cond + `
 		ORDER BY t.disc_number ASC, t.track_number ASC
 	`
 
-	rows, err := database.DB.Query(r.Context(), query, albumID)
+	rows, err := database.DB.Query(r.Context(), query, append([]any{albumID}, args...)...)
 	if err != nil {
 		slog.Error("Failed to query tracks by album", "error", err, "album_id", albumID)
 		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
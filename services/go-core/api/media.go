@@ -1,14 +1,18 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sonantica-core/cache"
+	"sonantica-core/covers"
 	"sonantica-core/database"
+	"sonantica-core/stems"
+	"sonantica-core/tags"
+	"sonantica-core/transcode"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -28,81 +32,213 @@ func resolveMediaPath(path string) string {
 	return filepath.Join(mediaPath, path)
 }
 
-// StreamTrack serves the audio file or specific stems if requested
+// StreamTrack serves the audio file, specific stems or a mix of stems if requested
 func StreamTrack(w http.ResponseWriter, r *http.Request) {
+	trackID, ok := streamTrackID(w, r)
+	if !ok {
+		return
+	}
+
+	stemType := r.URL.Query().Get("stem") // vocals, drums, bass, other, no_vocals
+	gainMode := r.URL.Query().Get("gain") // track or album
+	if gainMode != "" && gainMode != "track" && gainMode != "album" {
+		http.Error(w, "Invalid gain, expected track or album", http.StatusBadRequest)
+		return
+	}
+	// Mixes choose their own output format, so they skip the transcoding profile
+	if r.URL.Query().Has("mix") {
+		streamMix(w, r, trackID, gainMode)
+		return
+	}
+	profile, offset, err := streamProfile(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid transcoding profile: %v", err), http.StatusBadRequest)
+		return
+	}
+	slog.Info("Streaming request", "track_id", trackID, "stem", stemType, "gain", gainMode)
+
+	src := resolveStream(w, r, trackID, stemType)
+	if src == nil {
+		return
+	}
+	if gainMode != "" {
+		setGainHeaders(w, gainMode, src.gain)
+	}
+
+	// Without a premixed file the accompaniment is mixed from the separate stems
+	if stemType == stems.NoVocals && !src.stem {
+		if mix := accompaniment(src.stems); len(mix) > 0 {
+			serveMix(w, r, trackID, src.stems, mix, mixFormat, offset)
+			return
+		}
+	}
+
+	if !profile.IsZero() && !profile.Satisfies(src.codec, src.bitrate) {
+		job := src.job()
+		job.Offset = offset
+		serveTranscode(w, r, trackID, profile, job)
+		return
+	}
+
+	// Cue sheet tracks are cut out of their image so they play and seek like standalone files
+	if src.start != nil {
+		serveSegment(w, r, trackID, src.path, *src.start, src.end)
+		return
+	}
+
+	slog.Info("Serving file", "path", src.path)
+	http.ServeFile(w, r, src.path)
+}
+
+// streamTrackID reads the track ID of a stream request, writing the error response when it is invalid
+func streamTrackID(w http.ResponseWriter, r *http.Request) (string, bool) {
 	trackID := chi.URLParam(r, "id")
 	if trackID == "" {
 		http.Error(w, "Track ID is required", http.StatusBadRequest)
-		return
+		return "", false
 	}
 
 	if _, err := uuid.Parse(trackID); err != nil {
 		slog.Warn("Invalid UUID format for track_id", "track_id", trackID)
 		http.Error(w, "Invalid Track ID format", http.StatusBadRequest)
-		return
+		return "", false
 	}
+	return trackID, true
+}
 
-	stemType := r.URL.Query().Get("stem") // vocals, drums, bass, other, no_vocals
-	slog.Info("Streaming request", "track_id", trackID, "stem", stemType)
+// streamSource is the file a stream request resolves to
+type streamSource struct {
+	path    string
+	codec   string
+	bitrate int      // kbps, 0 when unknown
+	start   *float64 // Where a cue sheet track starts in its image
+	end     float64  // Where it ends; 0 runs to the end of the image
+	// duration is the length of the track in seconds
+	duration float64
+	stem     bool
+	stems    []stems.Stem // Stem manifest, loaded when a stem is requested
+	gain     replayGain
+}
 
-	var filePath string
-	var aiMetadataStr *string
-	query := `SELECT file_path, ai_metadata FROM tracks WHERE id = $1`
+// job returns the transcoding job of the whole source
+func (s *streamSource) job() transcode.Job {
+	job := transcode.Job{Path: s.path}
+	if s.start != nil {
+		job.Start = *s.start
+		job.Duration = max(s.end-*s.start, 0)
+	}
+	return job
+}
+
+// resolveStream loads the track of a stream request and finds the file to
+// send: the requested stem when the analysis produced it, the track's file
+// otherwise. It writes the error response and returns nil when the track
+// cannot be streamed.
+func resolveStream(w http.ResponseWriter, r *http.Request, trackID, stemType string) *streamSource {
+	var filePath, status string
+	var bitrate int // bits per second
+	var startOffset, endOffset *float64
+	src := &streamSource{}
+	query := `
+		SELECT file_path, status, start_offset, end_offset, COALESCE(codec, ''), COALESCE(bitrate, 0),
+			COALESCE(duration_seconds, 0),
+			replaygain_track_gain, replaygain_track_peak, replaygain_album_gain, replaygain_album_peak
+		FROM tracks WHERE id = $1`
 
-	err := database.DB.QueryRow(r.Context(), query, trackID).Scan(&filePath, &aiMetadataStr)
+	err := database.DB.QueryRow(r.Context(), query, trackID).Scan(&filePath, &status, &startOffset, &endOffset, &src.codec, &bitrate,
+		&src.duration, &src.gain.trackGain, &src.gain.trackPeak, &src.gain.albumGain, &src.gain.albumPeak)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			slog.Warn("Track not found in database", "track_id", trackID)
 			http.NotFound(w, r)
-			return
+			return nil
 		}
 		slog.Error("Database error during streaming", "error", err, "track_id", trackID)
 		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
-		return
+		return nil
 	}
 
-	fullPath := resolveMediaPath(filePath)
-
-	// If a stem is requested and results exist
-	if stemType != "" && aiMetadataStr != nil {
-		var metadata map[string]interface{}
-		if err := json.Unmarshal([]byte(*aiMetadataStr), &metadata); err == nil {
-			// Check if stems exist in metadata.
-			// Format usually: {"stems": {"vocals": "path/to/vocals.mp3", ...}}
-			// OR if it's the JobID from Demucs: {"demucs_job_id": "..."}
-			if jobID, ok := metadata["demucs_job_id"].(string); ok {
-				// We assume stems are in MEDIA_PATH/ai-stems/JOB_ID/
-				// Demucs default paths are usually output_dir/model/job_id/track_name/stem.wav
-				// For simplicity in our current setup, let's assume they are stored and we can find them.
-
-				// Logic for 'no_vocals' (mix of drums, bass, other)
-				// Note: Real 'no_vocals' might need a premixed file or 3-source mixing.
-				// For now, let's look for the specific stem file.
-
-				stemFile := stemType + ".mp3" // Or .wav depending on Demucs config
-				if stemType == "no_vocals" {
-					stemFile = "no_vocals.mp3"
-				}
-
-				// Search in the ai-stems bucket
-				stemPath := filepath.Join(os.Getenv("MEDIA_PATH"), "ai-stems", jobID, stemFile)
-				if _, err := os.Stat(stemPath); err == nil {
-					fullPath = stemPath
-					slog.Info("Serving AI Stem", "type", stemType, "path", fullPath)
-				} else {
-					// Fallback to wav if mp3 not found
-					stemPathWav := filepath.Join(os.Getenv("MEDIA_PATH"), "ai-stems", jobID, stemType+".wav")
-					if _, err := os.Stat(stemPathWav); err == nil {
-						fullPath = stemPathWav
-						slog.Info("Serving AI Stem (wav)", "type", stemType, "path", fullPath)
-					}
-				}
-			}
+	// The scanner no longer finds this file on disk
+	if status != "active" {
+		slog.Warn("Track file is unavailable", "track_id", trackID, "status", status)
+		http.Error(w, "Track file is unavailable", http.StatusGone)
+		return nil
+	}
+
+	src.path = resolveMediaPath(filePath)
+	src.bitrate = kbps(bitrate)
+	if startOffset != nil && stemType == "" {
+		src.start = startOffset
+		if endOffset != nil {
+			src.end = *endOffset
 		}
 	}
 
-	slog.Info("Serving file", "path", fullPath)
-	http.ServeFile(w, r, fullPath)
+	// Stems come from the manifest the separation job recorded
+	if stemType != "" {
+		manifest, err := stems.ForTrack(r.Context(), trackID)
+		if err != nil {
+			slog.Error("Failed to load stem manifest", "error", err, "track_id", trackID)
+			http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+			return nil
+		}
+		src.stems = manifest
+		if s := stems.Find(manifest, stemType); s != nil {
+			// Stems are encoded differently from the track
+			src.path, src.stem = s.File(), true
+			src.codec, src.bitrate = s.Format, 0
+			slog.Info("Serving AI Stem", "type", stemType, "path", src.path, "format", s.Format)
+		}
+	}
+	return src
+}
+
+// replayGain holds the normalization values of a track
+type replayGain struct {
+	trackGain, trackPeak, albumGain, albumPeak *float64
+}
+
+// setGainHeaders tells the player the gain in dB to apply for track or album
+// normalization and the peak to keep below full scale. Album mode falls back
+// to the track gain of tracks without an album gain; tracks without any gain
+// get no headers.
+func setGainHeaders(w http.ResponseWriter, mode string, rg replayGain) {
+	gain, peak := rg.trackGain, rg.trackPeak
+	if mode == "album" && rg.albumGain != nil {
+		gain, peak = rg.albumGain, rg.albumPeak
+	} else {
+		mode = "track"
+	}
+	if gain == nil {
+		return
+	}
+	w.Header().Set("X-ReplayGain-Mode", mode)
+	w.Header().Set("X-ReplayGain-Gain", strconv.FormatFloat(*gain, 'f', 2, 64))
+	if peak != nil {
+		w.Header().Set("X-ReplayGain-Peak", strconv.FormatFloat(*peak, 'f', 6, 64))
+	}
+}
+
+// serveSegment streams the range of an image file that holds a cue sheet track
+func serveSegment(w http.ResponseWriter, r *http.Request, trackID, fullPath string, start, end float64) {
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		slog.Warn("Track file is unavailable", "track_id", trackID, "path", fullPath, "error", err)
+		http.Error(w, "Track file is unavailable", http.StatusGone)
+		return
+	}
+
+	seg, err := tags.OpenSegment(fullPath, start, end)
+	if err != nil {
+		slog.Error("Failed to cut cue sheet track", "track_id", trackID, "path", fullPath, "error", err)
+		http.Error(w, fmt.Sprintf("Segment error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer seg.Close()
+
+	slog.Info("Serving cue sheet track", "path", fullPath, "start", seg.Start, "end", seg.End)
+	w.Header().Set("Content-Type", seg.ContentType)
+	http.ServeContent(w, r, filepath.Base(fullPath), info.ModTime(), seg)
 }
 
 // GetAlbumCover serves the local image file for the album cover
@@ -122,12 +258,17 @@ func GetAlbumCover(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid Album ID format", http.StatusBadRequest)
 		return
 	}
+	size, format, err := parseCoverVariant(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid cover variant: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	// 1. Try Cache First
 	coverArtPath, err := cache.GetAlbumCover(r.Context(), albumID)
 	if err == nil && coverArtPath != "" {
 		slog.Info("Requesting cover (cached)", "album_id", albumID)
-		serveCover(w, r, coverArtPath, albumID)
+		serveCover(w, r, coverArtPath, albumID, size, format)
 		return
 	}
 
@@ -160,10 +301,30 @@ func GetAlbumCover(w http.ResponseWriter, r *http.Request) {
 		slog.Warn("Failed to cache album cover", "album_id", albumID, "error", err)
 	}
 
-	serveCover(w, r, *dbPath, albumID)
+	serveCover(w, r, *dbPath, albumID, size, format)
+}
+
+// parseCoverVariant reads the optional size and format of the requested cover
+func parseCoverVariant(r *http.Request) (int, string, error) {
+	size := 0
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || !covers.ValidSize(n) {
+			return 0, "", fmt.Errorf("size must be one of %v", covers.VariantSizes)
+		}
+		size = n
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != covers.FormatJPEG && format != covers.FormatPNG {
+		return 0, "", fmt.Errorf("format must be jpeg or png")
+	}
+	return size, format, nil
 }
 
-func serveCover(w http.ResponseWriter, r *http.Request, path string, albumID string) {
+// serveCover sends the cover at path, or its variant when a size or format is
+// requested. Covers can change when a better one is found, so clients
+// revalidate with the ETag derived from the image's content hash.
+func serveCover(w http.ResponseWriter, r *http.Request, path string, albumID string, size int, format string) {
 	fullPath := resolveMediaPath(path)
 
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
@@ -172,7 +333,22 @@ func serveCover(w http.ResponseWriter, r *http.Request, path string, albumID str
 		return
 	}
 
-	// Add Cache-Control Header (1 year for images since they are immutable in this flow)
-	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	etag := ""
+	if size != 0 || format != "" {
+		variant, err := covers.GetVariant(albumID, fullPath, size, format)
+		if err != nil {
+			slog.Error("Failed to generate cover variant", "error", err, "album_id", albumID, "size", size, "format", format)
+			http.Error(w, fmt.Sprintf("Cover error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		fullPath, etag = variant.Path, variant.ETag
+	} else if hash, err := covers.SourceHash(fullPath); err == nil {
+		etag = covers.ETag(hash)
+	}
+
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400, must-revalidate")
 	http.ServeFile(w, r, fullPath)
 }
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"sonantica-core/stems"
+	"sonantica-core/tags"
+)
+
+// mixFormat is the format of mixes when the request does not ask for one
+const mixFormat = "wav"
+
+// streamMix serves the mix of stems the mix parameter of a stream request
+// describes, as WAV or FLAC depending on format
+func streamMix(w http.ResponseWriter, r *http.Request, trackID, gainMode string) {
+	q := r.URL.Query()
+	gains, err := stems.ParseMix(q.Get("mix"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid mix: %v", err), http.StatusBadRequest)
+		return
+	}
+	if q.Get("stem") != "" {
+		http.Error(w, "stem and mix cannot be combined", http.StatusBadRequest)
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = mixFormat
+	}
+	if _, ok := tags.EncoderTypes[format]; !ok {
+		http.Error(w, "Invalid mix format, expected wav or flac", http.StatusBadRequest)
+		return
+	}
+	offset := 0.0
+	if t := q.Get("t"); t != "" {
+		if offset, err = strconv.ParseFloat(t, 64); err != nil || offset < 0 {
+			http.Error(w, "Invalid t, expected a positive number of seconds", http.StatusBadRequest)
+			return
+		}
+	}
+	slog.Info("Mix request", "track_id", trackID, "mix", q.Get("mix"), "format", format)
+
+	src := resolveStream(w, r, trackID, "")
+	if src == nil {
+		return
+	}
+	manifest, err := stems.ForTrack(r.Context(), trackID)
+	if err != nil {
+		slog.Error("Failed to load stem manifest", "error", err, "track_id", trackID)
+		http.Error(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if gainMode != "" {
+		setGainHeaders(w, gainMode, src.gain)
+	}
+	serveMix(w, r, trackID, manifest, gains, format, offset)
+}
+
+// serveMix decodes the stems of a manifest, mixes them with their gains from
+// offset seconds and streams the result. Only WAV, FLAC and AIFF stems can be
+// decoded.
+func serveMix(w http.ResponseWriter, r *http.Request, trackID string, manifest []stems.Stem, gains []stems.Gain, format string, offset float64) {
+	if len(manifest) == 0 {
+		http.Error(w, "Track has no stems", http.StatusNotFound)
+		return
+	}
+
+	var sources []*tags.PCM
+	defer func() {
+		for _, p := range sources {
+			p.Close()
+		}
+	}()
+	var frames int64
+	unknown := false
+	for _, g := range gains {
+		s := stems.Find(manifest, g.Stem)
+		if s == nil {
+			http.Error(w, fmt.Sprintf("Track has no %s stem", g.Stem), http.StatusNotFound)
+			return
+		}
+		if !s.Decodable() {
+			http.Error(w, fmt.Sprintf("Stem %s is %s, only WAV, FLAC and AIFF stems can be mixed", g.Stem, s.Format), http.StatusUnprocessableEntity)
+			return
+		}
+		path := s.File()
+		p, err := tags.OpenPCM(path)
+		if err != nil {
+			slog.Error("Failed to decode stem", "track_id", trackID, "path", path, "error", err)
+			http.Error(w, fmt.Sprintf("Stem decoding error: %v", err), http.StatusInternalServerError)
+			return
+		}
+		sources = append(sources, p)
+		if p.SampleRate != sources[0].SampleRate || p.Channels != sources[0].Channels {
+			http.Error(w, fmt.Sprintf("Stem %s does not match the other stems", g.Stem), http.StatusInternalServerError)
+			return
+		}
+		frames = max(frames, p.Frames)
+		unknown = unknown || p.Frames == 0
+	}
+	if unknown {
+		frames = 0 // Streamed without a length rather than cut short
+	}
+
+	rate, channels := sources[0].SampleRate, sources[0].Channels
+	mixer := stems.NewMixer(channels)
+	for i, g := range gains {
+		if g.Gain > 0 {
+			mixer.Add(sources[i], g.Gain)
+		}
+	}
+	skip := int64(offset * float64(rate))
+	if frames > 0 {
+		skip = min(skip, frames)
+		frames -= skip
+	}
+	if err := mixer.Skip(skip); err != nil {
+		slog.Error("Failed to decode stem", "track_id", trackID, "error", err)
+		http.Error(w, fmt.Sprintf("Stem decoding error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", tags.EncoderTypes[format])
+	if format == "wav" && frames > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(tags.WAVSize(channels, frames), 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	out := &countingWriter{w: w}
+	enc, err := tags.NewEncoder(out, format, rate, channels, frames)
+	if err == nil {
+		err = stems.Encode(enc, mixer, channels, frames)
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // The client went away
+		}
+		slog.Error("Failed to mix stems", "track_id", trackID, "error", err)
+		if out.n == 0 {
+			http.Error(w, fmt.Sprintf("Mix error: %v", err), http.StatusInternalServerError)
+		}
+	}
+}
+
+// accompaniment is the mix of every decodable stem of a manifest but the vocals
+func accompaniment(manifest []stems.Stem) []stems.Gain {
+	var mix []stems.Gain
+	for _, s := range manifest {
+		if s.Name != "vocals" && s.Name != stems.NoVocals && s.Decodable() {
+			mix = append(mix, stems.Gain{Stem: s.Name, Gain: 1})
+		}
+	}
+	return mix
+}
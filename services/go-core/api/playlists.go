@@ -118,7 +118,7 @@ func GetPlaylists(w http.ResponseWriter, r *http.Request) {
 	// Optimized query to get playlists with track counts and covers art in one go
 	query := `
 		SELECT 
-			p.id, p.name, p.type, p.description, p.created_at, p.updated_at, p.snapshot_date,
+			p.id, p.name, p.type, p.description, p.created_at, p.updated_at, p.snapshot_date, p.source_path,
 			(SELECT count(*) FROM playlist_tracks WHERE playlist_id = p.id) as track_count,
 			COALESCE((
 				SELECT string_agg('/api/cover/' || al.cover_art, ',')
@@ -168,7 +168,7 @@ func GetPlaylists(w http.ResponseWriter, r *http.Request) {
 		var trackIDsStr string
 
 		err := rows.Scan(
-			&p.ID, &p.Name, &typeStr, &p.Description, &p.CreatedAt, &p.UpdatedAt, &snapshotDate,
+			&p.ID, &p.Name, &typeStr, &p.Description, &p.CreatedAt, &p.UpdatedAt, &snapshotDate, &p.SourcePath,
 			&p.TrackCount, &coverArtsStr, &trackIDsStr,
 		)
 		if err != nil {
@@ -229,9 +229,9 @@ func GetPlaylist(w http.ResponseWriter, r *http.Request) {
 	var p models.Playlist
 	var typeStr string
 	err = database.DB.QueryRow(r.Context(), `
-		SELECT id, name, type, description, created_at, updated_at 
+		SELECT id, name, type, description, created_at, updated_at, source_path, unresolved
 		FROM playlists WHERE id = $1
-	`, id).Scan(&p.ID, &p.Name, &typeStr, &p.Description, &p.CreatedAt, &p.UpdatedAt)
+	`, id).Scan(&p.ID, &p.Name, &typeStr, &p.Description, &p.CreatedAt, &p.UpdatedAt, &p.SourcePath, &p.Unresolved)
 
 	if err != nil {
 		http.Error(w, "Playlist not found", http.StatusNotFound)
@@ -248,8 +248,8 @@ func GetPlaylist(w http.ResponseWriter, r *http.Request) {
 	query := `
 		SELECT 
 			t.id, t.title, t.album_id, t.artist_id, t.file_path, t.duration_seconds, 
-			t.format, t.bitrate, t.sample_rate, t.channels, t.track_number, t.disc_number, 
-			t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at,
+			t.format, t.bitrate, t.sample_rate, t.channels, t.bit_depth, t.codec, t.container, t.track_number, t.disc_number, 
+			t.genre, t.year, t.play_count, t.is_favorite, t.created_at, t.updated_at, t.status, t.media_kind,
 			a.name as artist_name,
 			al.title as album_title,
 			al.cover_art as album_cover_art
@@ -270,8 +270,8 @@ func GetPlaylist(w http.ResponseWriter, r *http.Request) {
 			var t models.Track
 			err := rows.Scan(
 				&t.ID, &t.Title, &t.AlbumID, &t.ArtistID, &t.FilePath, &t.DurationSeconds,
-				&t.Format, &t.Bitrate, &t.SampleRate, &t.Channels, &t.TrackNumber, &t.DiscNumber,
-				&t.Genre, &t.Year, &t.PlayCount, &t.IsFavorite, &t.CreatedAt, &t.UpdatedAt,
+				&t.Format, &t.Bitrate, &t.SampleRate, &t.Channels, &t.BitDepth, &t.Codec, &t.Container, &t.TrackNumber, &t.DiscNumber,
+				&t.Genre, &t.Year, &t.PlayCount, &t.IsFavorite, &t.CreatedAt, &t.UpdatedAt, &t.Status, &t.MediaKind,
 				&t.ArtistName, &t.AlbumTitle, &t.AlbumCoverArt,
 			)
 			if err != nil {
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"sonantica-core/cache"
+	"sonantica-core/scanner"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment to keep proxies from closing it
+const sseKeepAlive = 15 * time.Second
+
+// StreamScanEvents relays scan events to the client as Server-Sent Events.
+// Every message is a JSON object with a "type" field (scan:start, scan:progress,
+// scan:file_error, scan:file_quarantined, scan:complete). With ?root=name only that root's events are sent.
+func StreamScanEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	rootFilter := r.URL.Query().Get("root")
+	if rootFilter != "" {
+		if _, ok := scanner.LookupRoot(rootFilter); !ok {
+			http.Error(w, fmt.Sprintf("Unknown library root: %s", rootFilter), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pubsub := cache.SubscribeScanEvents(r.Context())
+	if pubsub == nil {
+		http.Error(w, "Event stream unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	defer pubsub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx buffering
+	w.WriteHeader(http.StatusOK)
+
+	// Send the current state first so late subscribers can render a progress bar immediately
+	if status, err := cache.GetScanStatus(r.Context()); err == nil {
+		if data, err := json.Marshal(map[string]interface{}{"type": "scan:status", "status": status}); err == nil {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+	}
+	flusher.Flush()
+
+	slog.Debug("Scan event stream opened", "client_ip", r.RemoteAddr, "root", rootFilter)
+
+	messages := pubsub.Channel()
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.Debug("Scan event stream closed", "client_ip", r.RemoteAddr)
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			// Messages are published as "<event>:<json>"; the JSON already carries the type
+			idx := strings.IndexByte(msg.Payload, '{')
+			if idx < 0 {
+				continue
+			}
+			payload := msg.Payload[idx:]
+
+			if rootFilter != "" {
+				var event scanner.Event
+				if err := json.Unmarshal([]byte(payload), &event); err != nil {
+					continue
+				}
+				if event.Root != rootFilter {
+					continue
+				}
+			}
+
+			fmt.Fprintf(w, "data: %s\n\n", payload)
+			flusher.Flush()
+		}
+	}
+}
+
+// GetScanRuns returns the scan history, newest first (?root=name&limit=20)
+func GetScanRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	runs, err := scanner.ListRuns(r.Context(), r.URL.Query().Get("root"), limit)
+	if err != nil {
+		slog.Error("Failed to query scan runs", "error", err)
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs":  runs,
+		"limit": limit,
+	})
+}
+
+// GetScanRun returns a single scan run with its per-file errors (?limit=100&offset=0)
+func GetScanRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Invalid scan ID format", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := 100, 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		fmt.Sscanf(o, "%d", &offset)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	run, err := scanner.GetRun(r.Context(), id)
+	if err != nil {
+		slog.Error("Failed to query scan run", "error", err, "scan_id", id)
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	errs, err := scanner.ListFileErrors(r.Context(), id, limit, offset)
+	if err != nil {
+		slog.Error("Failed to query scan errors", "error", err, "scan_id", id)
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"run":    run,
+		"errors": errs,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetQuarantine lists the files the scanner refused as unsupported, corrupt or misnamed
+// (?root=name&limit=100&offset=0)
+func GetQuarantine(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var rootPath string
+	if name := r.URL.Query().Get("root"); name != "" {
+		root, ok := scanner.LookupRoot(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown library root: %s", name), http.StatusBadRequest)
+			return
+		}
+		rootPath = root.Path
+	}
+
+	limit, offset := 100, 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		fmt.Sscanf(l, "%d", &limit)
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		fmt.Sscanf(o, "%d", &offset)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	entries, err := scanner.ListQuarantine(r.Context(), rootPath, limit, offset)
+	if err != nil {
+		slog.Error("Failed to query quarantine", "error", err)
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files":  entries,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// ReleaseQuarantine removes a file from quarantine so the next scan probes it again
+// (?root=name&path=relative/path.flac)
+func ReleaseQuarantine(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	name, path := r.URL.Query().Get("root"), r.URL.Query().Get("path")
+	if name == "" || path == "" {
+		http.Error(w, "root and path are required", http.StatusBadRequest)
+		return
+	}
+	root, ok := scanner.LookupRoot(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown library root: %s", name), http.StatusNotFound)
+		return
+	}
+
+	released, err := scanner.ReleaseQuarantine(r.Context(), root, path)
+	if err != nil {
+		slog.Error("Failed to release quarantined file", "error", err, "root", name, "path", path)
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !released {
+		http.NotFound(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "released",
+		"root":   name,
+		"path":   path,
+	})
+}
+
+// CancelScan stops the running scan of ?root=name, or of every root, and drops queued rescans
+func CancelScan(w http.ResponseWriter, r *http.Request) {
+	controlScans(w, r, "cancelled", scanner.CancelScan)
+}
+
+// PauseScan suspends the running scan of ?root=name, or of every root
+func PauseScan(w http.ResponseWriter, r *http.Request) {
+	controlScans(w, r, "paused", scanner.PauseScan)
+}
+
+// ResumeScan continues the paused scan of ?root=name, or of every root
+func ResumeScan(w http.ResponseWriter, r *http.Request) {
+	controlScans(w, r, "resumed", scanner.ResumeScan)
+}
+
+// controlScans applies action to the requested root or to every root with a scan in progress
+func controlScans(w http.ResponseWriter, r *http.Request, status string, action func(name string) bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	targets := scanner.ScanningRoots()
+	if name := r.URL.Query().Get("root"); name != "" {
+		if _, ok := scanner.LookupRoot(name); !ok {
+			http.Error(w, fmt.Sprintf("Unknown library root: %s", name), http.StatusNotFound)
+			return
+		}
+		targets = []string{name}
+	}
+
+	affected := make([]string, 0, len(targets))
+	for _, name := range targets {
+		if action(name) {
+			affected = append(affected, name)
+		}
+	}
+
+	if len(affected) == 0 {
+		http.Error(w, fmt.Sprintf("No scan could be %s", status), http.StatusConflict)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"roots":  affected,
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"sonantica-core/urlsign"
+)
+
+// maxMediaURLTTL bounds the lifetime clients may ask signed URLs for
+const maxMediaURLTTL = 7 * 24 * time.Hour
+
+var (
+	// MediaSigner signs media URLs when media access is signed; nil leaves them open
+	MediaSigner *urlsign.Signer
+	// MediaURLTTL is how long signed URLs stay valid unless the request asks for less or more
+	MediaURLTTL = 6 * time.Hour
+	// MediaSignToken is the bearer token signing requests must carry when
+	// media access is signed; while it is empty nothing is signed
+	MediaSignToken string
+)
+
+// SignMediaURLs returns signed copies of stream and cover URLs. In open mode
+// the URLs come back unchanged, so clients can always go through here; in
+// signed mode the request must carry MediaSignToken.
+func SignMediaURLs(w http.ResponseWriter, r *http.Request) {
+	if MediaSigner != nil {
+		if MediaSignToken == "" {
+			http.Error(w, "Media URL signing is disabled until MEDIA_SIGN_TOKEN is set", http.StatusServiceUnavailable)
+			return
+		}
+		if !bearerToken(r, MediaSignToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		URLs       []string `json:"urls"`
+		TTL        int      `json:"ttl"`        // Seconds
+		BindClient bool     `json:"bindClient"` // Only the requesting address may use the URLs
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.URLs) == 0 {
+		http.Error(w, "urls is required", http.StatusBadRequest)
+		return
+	}
+	ttl := MediaURLTTL
+	if req.TTL < 0 || time.Duration(req.TTL)*time.Second > maxMediaURLTTL {
+		http.Error(w, fmt.Sprintf("ttl must be between 1 and %d seconds", int(maxMediaURLTTL.Seconds())), http.StatusBadRequest)
+		return
+	}
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+
+	if MediaSigner == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"urls":   req.URLs,
+			"signed": false,
+		})
+		return
+	}
+
+	expires := time.Now().Add(ttl)
+	clientIP := ""
+	if req.BindClient {
+		clientIP = urlsign.ClientIP(r)
+	}
+	urls := make([]string, 0, len(req.URLs))
+	for _, u := range req.URLs {
+		signed, err := MediaSigner.Sign(u, expires, clientIP)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Cannot sign %s: %v", u, err), http.StatusBadRequest)
+			return
+		}
+		urls = append(urls, signed)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"urls":      urls,
+		"signed":    true,
+		"expiresAt": expires.UTC().Truncate(time.Second),
+	})
+}
+
+// bearerToken reports whether the request is authorized with token
+func bearerToken(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
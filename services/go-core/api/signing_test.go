@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sonantica-core/urlsign"
+)
+
+func TestSignMediaURLsAuth(t *testing.T) {
+	MediaSigner = urlsign.New("key")
+	defer func() { MediaSigner, MediaSignToken = nil, "" }()
+
+	sign := func(auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/media/sign", strings.NewReader(`{"urls": ["/stream/1"]}`))
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		SignMediaURLs(w, r)
+		return w
+	}
+
+	if w := sign("Bearer anything"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without a configured token: status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	MediaSignToken = "secret"
+	for _, auth := range []string{"", "Bearer wrong", "secret", "Basic c2VjcmV0"} {
+		if w := sign(auth); w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want %d", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	w := sign("Bearer secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("with the token: status %d: %s", w.Code, w.Body)
+	}
+	var res struct {
+		URLs   []string `json:"urls"`
+		Signed bool     `json:"signed"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Signed || len(res.URLs) != 1 || !strings.Contains(res.URLs[0], "sig=") {
+		t.Errorf("signed %v, urls %v", res.Signed, res.URLs)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"sonantica-core/database"
+	"sonantica-core/stems"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// trackStem is a stem of the manifest with the URL streaming it
+type trackStem struct {
+	stems.Stem
+	URL string `json:"url"`
+}
+
+// GetTrackStems lists the stems a separation recorded for a track, each with
+// its stream URL. pending tells a separation job is still to be recorded.
+func GetTrackStems(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	trackID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(trackID); err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var jobID *string
+	err := database.DB.QueryRow(r.Context(), `SELECT stem_job_id FROM tracks WHERE id = $1`, trackID).Scan(&jobID)
+	if err == pgx.ErrNoRows {
+		http.Error(w, "Track not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	manifest, err := stems.ForTrack(r.Context(), trackID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query error: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]trackStem, 0, len(manifest))
+	pending := jobID != nil
+	for _, s := range manifest {
+		list = append(list, trackStem{Stem: s, URL: fmt.Sprintf("/stream/%s?stem=%s", trackID, s.Name)})
+		if jobID != nil && s.JobID == *jobID {
+			pending = false
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"trackId": trackID,
+		"stems":   list,
+		"pending": pending,
+	})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sonantica-core/transcode"
+)
+
+var (
+	// Transcodes converts streams requested in another format; nil when ffmpeg is unavailable
+	Transcodes *transcode.Cache
+	// StreamProfiles are the default transcoding profiles of the clients named by ?client=
+	StreamProfiles = map[string]transcode.Profile{}
+)
+
+// streamProfile reads the transcoding profile of a stream request, the
+// defaults of its ?client= overridden by ?format= and ?maxBitrate= (kbps),
+// and the ?t= offset in seconds transcoded streams start at
+func streamProfile(r *http.Request) (transcode.Profile, float64, error) {
+	q := r.URL.Query()
+	profile := StreamProfiles[strings.ToLower(q.Get("client"))]
+
+	var override transcode.Profile
+	if v := q.Get("format"); v != "" {
+		if _, ok := transcode.Formats[v]; !ok {
+			return profile, 0, fmt.Errorf("format must be opus, mp3 or aac")
+		}
+		override.Format = v
+	}
+	if v := q.Get("maxBitrate"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return profile, 0, fmt.Errorf("maxBitrate must be a positive number of kbps")
+		}
+		override.MaxBitrate = n
+	}
+	profile = profile.Merge(override)
+
+	offset := 0.0
+	if v := q.Get("t"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 {
+			return profile, 0, fmt.Errorf("t must be a positive number of seconds")
+		}
+		offset = t
+	}
+	return profile, offset, nil
+}
+
+// kbps converts a bitrate in bits per second, as tracks store it
+func kbps(bitrate int) int {
+	return (bitrate + 500) / 1000
+}
+
+// serveTranscode streams the job converted to the profile's format
+func serveTranscode(w http.ResponseWriter, r *http.Request, trackID string, profile transcode.Profile, job transcode.Job) {
+	format, bitrate, err := profile.Resolve()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid transcoding profile: %v", err), http.StatusBadRequest)
+		return
+	}
+	job.Format, job.Bitrate = format, bitrate
+	serveJob(w, r, trackID, job)
+}
+
+// serveJob sends the output of a transcoding job. Outputs already in the
+// cache are served with range requests; others are sent as ffmpeg produces
+// them.
+func serveJob(w http.ResponseWriter, r *http.Request, trackID string, job transcode.Job) {
+	if Transcodes == nil {
+		http.Error(w, "Transcoding is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", job.Format.ContentType)
+
+	if path, ok := Transcodes.Lookup(job); ok {
+		slog.Info("Serving cached transcode", "track_id", trackID, "format", job.Format.Name, "bitrate", job.Bitrate, "offset", job.Offset)
+		http.ServeFile(w, r, path)
+		return
+	}
+
+	slog.Info("Transcoding track", "track_id", trackID, "format", job.Format.Name, "bitrate", job.Bitrate, "offset", job.Offset)
+	out := &countingWriter{w: w}
+	if err := Transcodes.Transcode(r.Context(), job, out); err != nil {
+		if r.Context().Err() != nil {
+			return // The client went away
+		}
+		slog.Error("Failed to transcode track", "track_id", trackID, "format", job.Format.Name, "error", err)
+		if out.n == 0 {
+			http.Error(w, fmt.Sprintf("Transcode error: %v", err), http.StatusInternalServerError)
+		}
+	}
+}
+
+// countingWriter tells whether the response has started, after which errors can no longer be reported
+type countingWriter struct {
+	w http.ResponseWriter
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+)
+
+// warmupRequests are the listings clients load on start. Replaying them
+// through the handlers fills the cache under exactly the keys they use.
+var warmupRequests = []struct {
+	target  string
+	handler http.HandlerFunc
+}{
+	{"/api/library/tracks?limit=-1", GetTracks},
+	{"/api/library/artists?limit=-1", GetArtists},
+	{"/api/library/albums?limit=-1", GetAlbums},
+	{"/api/library/alphabet-index?type=tracks", GetAlphabetIndex},
+	{"/api/library/alphabet-index?type=artists", GetAlphabetIndex},
+	{"/api/library/alphabet-index?type=albums", GetAlphabetIndex},
+	{"/api/library/playlists", GetPlaylists},
+	{"/api/scan/status", GetScanStatus},
+}
+
+// WarmCache rebuilds the cached library listings that were invalidated since
+// the last warmup. Listings still in the cache are served from it and cost
+// nothing.
+func WarmCache(ctx context.Context) error {
+	var errs []error
+	for _, req := range warmupRequests {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rec := httptest.NewRecorder()
+		req.handler(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, req.target, nil))
+		if rec.Code >= http.StatusBadRequest {
+			errs = append(errs, fmt.Errorf("%s: status %d", req.target, rec.Code))
+		}
+	}
+	return errors.Join(errs...)
+}
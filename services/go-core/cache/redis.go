@@ -76,15 +76,23 @@ func Invalidate(ctx context.Context, pattern string) error {
 // Library-specific cache functions
 // ============================================
 
+// scopedKey appends a filter scope (e.g. a library root) to a cache key
+func scopedKey(key, scope string) string {
+	if scope == "" {
+		return key
+	}
+	return key + ":" + scope
+}
+
 // SetLibraryStats caches library statistics
-func SetLibraryStats(ctx context.Context, stats map[string]interface{}) error {
-	return Set(ctx, "library:stats", stats, 1*time.Minute)
+func SetLibraryStats(ctx context.Context, scope string, stats map[string]interface{}) error {
+	return Set(ctx, scopedKey("library:stats", scope), stats, 1*time.Minute)
 }
 
 // GetLibraryStats retrieves cached library statistics
-func GetLibraryStats(ctx context.Context) (map[string]interface{}, error) {
+func GetLibraryStats(ctx context.Context, scope string) (map[string]interface{}, error) {
 	var stats map[string]interface{}
-	err := Get(ctx, "library:stats", &stats)
+	err := Get(ctx, scopedKey("library:stats", scope), &stats)
 	return stats, err
 }
 
@@ -106,38 +114,38 @@ func GetScanStatus(ctx context.Context) (map[string]interface{}, error) {
 }
 
 // SetTracks caches tracks list with pagination
-func SetTracks(ctx context.Context, offset, limit int, sort, order string, tracks interface{}) error {
-	key := fmt.Sprintf("library:tracks:%d:%d:%s:%s", offset, limit, sort, order)
+func SetTracks(ctx context.Context, scope string, offset, limit int, sort, order string, tracks interface{}) error {
+	key := scopedKey(fmt.Sprintf("library:tracks:%d:%d:%s:%s", offset, limit, sort, order), scope)
 	return Set(ctx, key, tracks, 5*time.Minute)
 }
 
 // GetTracks retrieves cached tracks list
-func GetTracks(ctx context.Context, offset, limit int, sort, order string, target interface{}) error {
-	key := fmt.Sprintf("library:tracks:%d:%d:%s:%s", offset, limit, sort, order)
+func GetTracks(ctx context.Context, scope string, offset, limit int, sort, order string, target interface{}) error {
+	key := scopedKey(fmt.Sprintf("library:tracks:%d:%d:%s:%s", offset, limit, sort, order), scope)
 	return Get(ctx, key, target)
 }
 
 // SetArtists caches artists list with pagination
-func SetArtists(ctx context.Context, offset, limit int, sort, order string, artists interface{}) error {
-	key := fmt.Sprintf("library:artists:%d:%d:%s:%s", offset, limit, sort, order)
+func SetArtists(ctx context.Context, scope string, offset, limit int, sort, order string, artists interface{}) error {
+	key := scopedKey(fmt.Sprintf("library:artists:%d:%d:%s:%s", offset, limit, sort, order), scope)
 	return Set(ctx, key, artists, 5*time.Minute)
 }
 
 // GetArtists retrieves cached artists list
-func GetArtists(ctx context.Context, offset, limit int, sort, order string, target interface{}) error {
-	key := fmt.Sprintf("library:artists:%d:%d:%s:%s", offset, limit, sort, order)
+func GetArtists(ctx context.Context, scope string, offset, limit int, sort, order string, target interface{}) error {
+	key := scopedKey(fmt.Sprintf("library:artists:%d:%d:%s:%s", offset, limit, sort, order), scope)
 	return Get(ctx, key, target)
 }
 
 // SetAlbums caches albums list with pagination
-func SetAlbums(ctx context.Context, offset, limit int, sort, order string, albums interface{}) error {
-	key := fmt.Sprintf("library:albums:%d:%d:%s:%s", offset, limit, sort, order)
+func SetAlbums(ctx context.Context, scope string, offset, limit int, sort, order string, albums interface{}) error {
+	key := scopedKey(fmt.Sprintf("library:albums:%d:%d:%s:%s", offset, limit, sort, order), scope)
 	return Set(ctx, key, albums, 5*time.Minute)
 }
 
 // GetAlbums retrieves cached albums list
-func GetAlbums(ctx context.Context, offset, limit int, sort, order string, target interface{}) error {
-	key := fmt.Sprintf("library:albums:%d:%d:%s:%s", offset, limit, sort, order)
+func GetAlbums(ctx context.Context, scope string, offset, limit int, sort, order string, target interface{}) error {
+	key := scopedKey(fmt.Sprintf("library:albums:%d:%d:%s:%s", offset, limit, sort, order), scope)
 	return Get(ctx, key, target)
 }
 
@@ -183,33 +191,33 @@ func SubscribeScanEvents(ctx context.Context) *redis.PubSub {
 // ============================================
 
 // SetAllTracks caches the complete tracks library
-func SetAllTracks(ctx context.Context, tracks interface{}) error {
-	return Set(ctx, "library:all:tracks", tracks, 10*time.Minute)
+func SetAllTracks(ctx context.Context, scope string, tracks interface{}) error {
+	return Set(ctx, scopedKey("library:all:tracks", scope), tracks, 10*time.Minute)
 }
 
 // GetAllTracks retrieves the complete tracks library from cache
-func GetAllTracks(ctx context.Context, target interface{}) error {
-	return Get(ctx, "library:all:tracks", target)
+func GetAllTracks(ctx context.Context, scope string, target interface{}) error {
+	return Get(ctx, scopedKey("library:all:tracks", scope), target)
 }
 
 // SetAllArtists caches the complete artists library
-func SetAllArtists(ctx context.Context, artists interface{}) error {
-	return Set(ctx, "library:all:artists", artists, 10*time.Minute)
+func SetAllArtists(ctx context.Context, scope string, artists interface{}) error {
+	return Set(ctx, scopedKey("library:all:artists", scope), artists, 10*time.Minute)
 }
 
 // GetAllArtists retrieves the complete artists library from cache
-func GetAllArtists(ctx context.Context, target interface{}) error {
-	return Get(ctx, "library:all:artists", target)
+func GetAllArtists(ctx context.Context, scope string, target interface{}) error {
+	return Get(ctx, scopedKey("library:all:artists", scope), target)
 }
 
 // SetAllAlbums caches the complete albums library
-func SetAllAlbums(ctx context.Context, albums interface{}) error {
-	return Set(ctx, "library:all:albums", albums, 10*time.Minute)
+func SetAllAlbums(ctx context.Context, scope string, albums interface{}) error {
+	return Set(ctx, scopedKey("library:all:albums", scope), albums, 10*time.Minute)
 }
 
 // GetAllAlbums retrieves the complete albums library from cache
-func GetAllAlbums(ctx context.Context, target interface{}) error {
-	return Get(ctx, "library:all:albums", target)
+func GetAllAlbums(ctx context.Context, scope string, target interface{}) error {
+	return Get(ctx, scopedKey("library:all:albums", scope), target)
 }
 
 // SetAlphabetIndex caches alphabet index for a type
@@ -238,6 +246,14 @@ func GetAlbumCover(ctx context.Context, albumID string) (string, error) {
 	return path, err
 }
 
+// InvalidateAlbumCover drops the cached path to an album's cover art
+func InvalidateAlbumCover(ctx context.Context, albumID string) error {
+	if rdb == nil {
+		return fmt.Errorf("redis client not initialized")
+	}
+	return rdb.Del(ctx, fmt.Sprintf("library:cover:album:%s", albumID)).Err()
+}
+
 // ============================================
 // Playlist-specific cache functions
 // ============================================
@@ -1,30 +1,103 @@
 package config
 
 import (
+	"encoding/json"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Port              string   `mapstructure:"PORT"`
-	PostgresURL       string   `mapstructure:"POSTGRES_URL"`
-	RedisHost         string   `mapstructure:"REDIS_HOST"`
-	RedisPort         string   `mapstructure:"REDIS_PORT"`
-	RedisPassword     string   `mapstructure:"REDIS_PASSWORD"`
-	MediaPath         string   `mapstructure:"MEDIA_PATH"`
-	AllowedOrigins    []string `mapstructure:"ALLOWED_ORIGINS"`
-	LogLevel          string   `mapstructure:"LOG_LEVEL"`
-	LogFormat         string   `mapstructure:"LOG_FORMAT"`
-	LogEnabled        bool     `mapstructure:"LOG_ENABLED"`
-	AnalyticsEnabled  bool     `mapstructure:"ANALYTICS_ENABLED"`
-	CoverPath         string   `mapstructure:"COVER_PATH"`
-	InternalAPISecret string   `mapstructure:"INTERNAL_API_SECRET"`
-	DemucsURL         string   `mapstructure:"DEMUCS_URL"`
-	BrainURL          string   `mapstructure:"BRAIN_URL"`
-	KnowledgeURL      string   `mapstructure:"KNOWLEDGE_URL"`
-	DownloaderURL     string   `mapstructure:"DOWNLOADER_URL"`
+	Port              string        `mapstructure:"PORT"`
+	PostgresURL       string        `mapstructure:"POSTGRES_URL"`
+	RedisHost         string        `mapstructure:"REDIS_HOST"`
+	RedisPort         string        `mapstructure:"REDIS_PORT"`
+	RedisPassword     string        `mapstructure:"REDIS_PASSWORD"`
+	MediaPath         string        `mapstructure:"MEDIA_PATH"`
+	AllowedOrigins    []string      `mapstructure:"ALLOWED_ORIGINS"`
+	LogLevel          string        `mapstructure:"LOG_LEVEL"`
+	LogFormat         string        `mapstructure:"LOG_FORMAT"`
+	LogEnabled        bool          `mapstructure:"LOG_ENABLED"`
+	AnalyticsEnabled  bool          `mapstructure:"ANALYTICS_ENABLED"`
+	CoverPath         string        `mapstructure:"COVER_PATH"`
+	StemsPath         string        `mapstructure:"STEMS_PATH"` // Output directory of the separation plugin
+	InternalAPISecret string        `mapstructure:"INTERNAL_API_SECRET"`
+	MediaAccess       string        `mapstructure:"MEDIA_ACCESS"` // open or signed
+	MediaSigningKey   string        `mapstructure:"MEDIA_SIGNING_KEY"`
+	MediaURLTTL       time.Duration `mapstructure:"MEDIA_URL_TTL"`
+	MediaSignToken    string        `mapstructure:"MEDIA_SIGN_TOKEN"` // Bearer token of signing requests
+	DemucsURL         string        `mapstructure:"DEMUCS_URL"`
+	BrainURL          string        `mapstructure:"BRAIN_URL"`
+	KnowledgeURL      string        `mapstructure:"KNOWLEDGE_URL"`
+	DownloaderURL     string        `mapstructure:"DOWNLOADER_URL"`
+	ScanContentHash   bool          `mapstructure:"SCAN_CONTENT_HASH"`
+	ScanMode          string        `mapstructure:"SCAN_MODE"`
+	ScanWatchDebounce time.Duration `mapstructure:"SCAN_WATCH_DEBOUNCE"`
+	ScanMissingGrace  time.Duration `mapstructure:"SCAN_MISSING_GRACE"`
+	ScanReadTags      bool          `mapstructure:"SCAN_READ_TAGS"`
+	ScanAnalysis      bool          `mapstructure:"SCAN_ANALYSIS"`
+	ScanIntegrity     bool          `mapstructure:"SCAN_VERIFY_INTEGRITY"`
+	ScanFingerprint   bool          `mapstructure:"SCAN_FINGERPRINT"`
+	ScanLoudness      bool          `mapstructure:"SCAN_LOUDNESS"`
+	ScanCovers        bool          `mapstructure:"SCAN_COVERS"`
+	LibraryRoots      []LibraryRoot `mapstructure:"LIBRARY_ROOTS"`
+
+	// Transcoding of streams requested in another format
+	TranscodeFFmpeg    string                   `mapstructure:"TRANSCODE_FFMPEG"`
+	TranscodeCachePath string                   `mapstructure:"TRANSCODE_CACHE_PATH"`
+	TranscodeCacheSize int                      `mapstructure:"TRANSCODE_CACHE_SIZE"` // Megabytes, 0 disables the cache
+	TranscodeProfiles  map[string]StreamProfile `mapstructure:"TRANSCODE_PROFILES"`
+
+	// Cron schedules of the background jobs; "off" leaves a job to manual runs
+	ScheduleLibraryScan      string        `mapstructure:"SCHEDULE_LIBRARY_SCAN"`
+	ScheduleAnalysisBackfill string        `mapstructure:"SCHEDULE_ANALYSIS_BACKFILL"`
+	ScheduleCacheWarmup      string        `mapstructure:"SCHEDULE_CACHE_WARMUP"`
+	ScheduleRetention        string        `mapstructure:"SCHEDULE_RETENTION"`
+	SchedulePluginHealth     string        `mapstructure:"SCHEDULE_PLUGIN_HEALTH"`
+	ScheduleIntegrityCheck   string        `mapstructure:"SCHEDULE_INTEGRITY_CHECK"`
+	ScheduleFingerprint      string        `mapstructure:"SCHEDULE_FINGERPRINT"`
+	ScheduleLoudness         string        `mapstructure:"SCHEDULE_LOUDNESS"`
+	ScheduleCovers           string        `mapstructure:"SCHEDULE_COVERS"`
+	ScheduleStems            string        `mapstructure:"SCHEDULE_STEMS"`
+	ScanRunRetention         time.Duration `mapstructure:"SCAN_RUN_RETENTION"`
+	AnalyticsRetentionDays   int           `mapstructure:"ANALYTICS_RETENTION_DAYS"`
+}
+
+// LibraryRoot describes a named media directory and how it is scanned
+type LibraryRoot struct {
+	Name     string        `mapstructure:"name"`
+	Path     string        `mapstructure:"path"`
+	Include  []string      `mapstructure:"include"`
+	Exclude  []string      `mapstructure:"exclude"`
+	Enabled  *bool         `mapstructure:"enabled"`  // Defaults to true
+	Schedule string        `mapstructure:"schedule"` // Cron expression, defaults to SCHEDULE_LIBRARY_SCAN
+	Interval time.Duration `mapstructure:"interval"` // Older alternative to schedule
+}
+
+// StreamProfile is the transcoding profile a client gets when its stream
+// requests do not name a format or bitrate
+type StreamProfile struct {
+	Format     string `mapstructure:"format"`     // opus, mp3 or aac
+	MaxBitrate int    `mapstructure:"maxBitrate"` // kbps
+}
+
+// IsEnabled reports whether the root should be scanned
+func (r LibraryRoot) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// ScanSchedule returns the cron expression of the root's periodic full scans
+func (r LibraryRoot) ScanSchedule(fallback string) string {
+	switch {
+	case r.Schedule != "":
+		return r.Schedule
+	case r.Interval > 0:
+		return "@every " + r.Interval.String()
+	default:
+		return fallback
+	}
 }
 
 func Load() *Config {
@@ -41,12 +114,40 @@ func Load() *Config {
 	v.SetDefault("LOG_ENABLED", true)
 	v.SetDefault("ANALYTICS_ENABLED", true)
 	v.SetDefault("COVER_PATH", "/covers")
+	v.SetDefault("STEMS_PATH", "/stems")
 	v.SetDefault("ALLOWED_ORIGINS", "http://localhost:5173,http://localhost:3000,http://localhost,capacitor://localhost")
 	v.SetDefault("INTERNAL_API_SECRET", "generate-secure-token-here")
+	v.SetDefault("MEDIA_ACCESS", "open")
+	v.SetDefault("MEDIA_URL_TTL", "6h")
 	v.SetDefault("DEMUCS_URL", "http://sonantica-plugin-demucs:8080")
 	v.SetDefault("BRAIN_URL", "http://sonantica-plugin-brain:8080")
 	v.SetDefault("KNOWLEDGE_URL", "http://sonantica-plugin-knowledge:8080")
 	v.SetDefault("DOWNLOADER_URL", "http://sonantica-plugin-downloader:8080")
+	v.SetDefault("SCAN_CONTENT_HASH", true)
+	v.SetDefault("SCAN_MODE", "auto") // poll, watch or auto
+	v.SetDefault("SCAN_WATCH_DEBOUNCE", "3s")
+	v.SetDefault("SCAN_MISSING_GRACE", "720h") // Missing tracks become deleted after 30 days
+	v.SetDefault("SCAN_READ_TAGS", true)
+	v.SetDefault("SCAN_ANALYSIS", true)
+	v.SetDefault("SCAN_VERIFY_INTEGRITY", false) // Reads every new or changed file in full
+	v.SetDefault("SCAN_FINGERPRINT", true)
+	v.SetDefault("SCAN_LOUDNESS", false) // Reads every new or changed file without ReplayGain tags in full
+	v.SetDefault("SCAN_COVERS", true)
+	v.SetDefault("SCHEDULE_LIBRARY_SCAN", "@hourly")
+	v.SetDefault("SCHEDULE_ANALYSIS_BACKFILL", "0 */6 * * *")
+	v.SetDefault("SCHEDULE_CACHE_WARMUP", "*/10 * * * *")
+	v.SetDefault("SCHEDULE_RETENTION", "30 3 * * *")
+	v.SetDefault("SCHEDULE_PLUGIN_HEALTH", "*/5 * * * *")
+	v.SetDefault("SCHEDULE_INTEGRITY_CHECK", "off")
+	v.SetDefault("SCHEDULE_FINGERPRINT", "0 4 * * *")
+	v.SetDefault("SCHEDULE_LOUDNESS", "30 4 * * *")
+	v.SetDefault("SCHEDULE_COVERS", "0 5 * * *")
+	v.SetDefault("SCHEDULE_STEMS", "*/5 * * * *")
+	v.SetDefault("SCAN_RUN_RETENTION", "2160h") // Scan history is kept for 90 days
+	v.SetDefault("ANALYTICS_RETENTION_DAYS", 90)
+	v.SetDefault("TRANSCODE_FFMPEG", "ffmpeg")
+	v.SetDefault("TRANSCODE_CACHE_PATH", "/transcodes")
+	v.SetDefault("TRANSCODE_CACHE_SIZE", 2048)
 
 	// 2. Read from Environment
 	v.AutomaticEnv()
@@ -65,11 +166,43 @@ func Load() *Config {
 	_ = v.BindEnv("LOG_ENABLED")
 	_ = v.BindEnv("ANALYTICS_ENABLED")
 	_ = v.BindEnv("COVER_PATH")
+	_ = v.BindEnv("STEMS_PATH")
 	_ = v.BindEnv("INTERNAL_API_SECRET")
+	_ = v.BindEnv("MEDIA_ACCESS")
+	_ = v.BindEnv("MEDIA_SIGNING_KEY")
+	_ = v.BindEnv("MEDIA_URL_TTL")
+	_ = v.BindEnv("MEDIA_SIGN_TOKEN")
 	_ = v.BindEnv("DEMUCS_URL")
 	_ = v.BindEnv("BRAIN_URL")
 	_ = v.BindEnv("KNOWLEDGE_URL")
 	_ = v.BindEnv("DOWNLOADER_URL")
+	_ = v.BindEnv("SCAN_CONTENT_HASH")
+	_ = v.BindEnv("SCAN_MODE")
+	_ = v.BindEnv("SCAN_WATCH_DEBOUNCE")
+	_ = v.BindEnv("SCAN_MISSING_GRACE")
+	_ = v.BindEnv("SCAN_READ_TAGS")
+	_ = v.BindEnv("SCAN_ANALYSIS")
+	_ = v.BindEnv("SCAN_VERIFY_INTEGRITY")
+	_ = v.BindEnv("SCAN_FINGERPRINT")
+	_ = v.BindEnv("SCAN_LOUDNESS")
+	_ = v.BindEnv("SCAN_COVERS")
+	_ = v.BindEnv("LIBRARY_ROOTS")
+	_ = v.BindEnv("SCHEDULE_LIBRARY_SCAN")
+	_ = v.BindEnv("SCHEDULE_ANALYSIS_BACKFILL")
+	_ = v.BindEnv("SCHEDULE_CACHE_WARMUP")
+	_ = v.BindEnv("SCHEDULE_RETENTION")
+	_ = v.BindEnv("SCHEDULE_PLUGIN_HEALTH")
+	_ = v.BindEnv("SCHEDULE_INTEGRITY_CHECK")
+	_ = v.BindEnv("SCHEDULE_FINGERPRINT")
+	_ = v.BindEnv("SCHEDULE_LOUDNESS")
+	_ = v.BindEnv("SCHEDULE_COVERS")
+	_ = v.BindEnv("SCHEDULE_STEMS")
+	_ = v.BindEnv("SCAN_RUN_RETENTION")
+	_ = v.BindEnv("ANALYTICS_RETENTION_DAYS")
+	_ = v.BindEnv("TRANSCODE_FFMPEG")
+	_ = v.BindEnv("TRANSCODE_CACHE_PATH")
+	_ = v.BindEnv("TRANSCODE_CACHE_SIZE")
+	_ = v.BindEnv("TRANSCODE_PROFILES")
 
 	// 3. Read from Config File (Optional)
 	v.SetConfigName("config")
@@ -91,9 +224,56 @@ func Load() *Config {
 		v.Set("ALLOWED_ORIGINS", strings.Split(s, ","))
 	}
 
+	// LIBRARY_ROOTS from the environment is a JSON array, the config file uses a YAML list
+	if s, ok := v.Get("LIBRARY_ROOTS").(string); ok && s != "" {
+		var list []map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &list); err != nil {
+			slog.Error("Failed to parse LIBRARY_ROOTS", "error", err)
+		} else {
+			v.Set("LIBRARY_ROOTS", list)
+		}
+	}
+
+	// TRANSCODE_PROFILES from the environment is a JSON object keyed by client name
+	if s, ok := v.Get("TRANSCODE_PROFILES").(string); ok && s != "" {
+		var profiles map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &profiles); err != nil {
+			slog.Error("Failed to parse TRANSCODE_PROFILES", "error", err)
+			v.Set("TRANSCODE_PROFILES", nil)
+		} else {
+			v.Set("TRANSCODE_PROFILES", profiles)
+		}
+	}
+
 	if err := v.Unmarshal(cfg); err != nil {
 		slog.Error("Failed to unmarshal config", "error", err)
 	}
 
+	cfg.LibraryRoots = normalizeLibraryRoots(cfg.LibraryRoots, cfg.MediaPath)
+
 	return cfg
 }
+
+// normalizeLibraryRoots drops invalid entries and falls back to MEDIA_PATH
+// as a single root named "default" when no roots are configured
+func normalizeLibraryRoots(roots []LibraryRoot, mediaPath string) []LibraryRoot {
+	seen := make(map[string]bool)
+	valid := make([]LibraryRoot, 0, len(roots))
+	for _, r := range roots {
+		if r.Name == "" || r.Path == "" {
+			slog.Warn("Ignoring library root without name or path", "name", r.Name, "path", r.Path)
+			continue
+		}
+		if seen[r.Name] {
+			slog.Warn("Ignoring duplicate library root", "name", r.Name)
+			continue
+		}
+		seen[r.Name] = true
+		valid = append(valid, r)
+	}
+
+	if len(valid) == 0 {
+		valid = append(valid, LibraryRoot{Name: "default", Path: mediaPath})
+	}
+	return valid
+}
@@ -0,0 +1,207 @@
+// Package covers picks album cover art among the pictures embedded in audio
+// files and the images next to them, and stores the chosen images under the
+// cover directory, named by their content hash so identical images are kept once.
+package covers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Register the decoders image.DecodeConfig relies on
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sonantica-core/tags"
+)
+
+// Sources of a cover
+const (
+	SourceEmbedded = "embedded"
+	SourceFolder   = "folder"
+)
+
+// maxImageSize skips folder images too large to be artwork
+const maxImageSize = 32 << 20
+
+var (
+	// Dir is where chosen covers are written
+	Dir = "/covers"
+
+	// folderNames are the base names of folder images, without extension
+	folderNames = []string{"cover", "folder", "front"}
+	// folderExtensions are the image formats folder images may use
+	folderExtensions = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+	// ErrNotImage is returned for data no image decoder recognises
+	ErrNotImage = errors.New("not a supported image")
+)
+
+// Image is a candidate cover
+type Image struct {
+	Data   []byte
+	Format string // jpeg, png or gif
+	Width  int
+	Height int
+	Front  bool   // A front cover picture or a cover/folder/front image
+	Source string // embedded or folder
+	Hash   string // SHA-256 of Data
+}
+
+// Decode checks that data is an image and reads its format and dimensions
+func Decode(data []byte, front bool, source string) (*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrNotImage
+	}
+	sum := sha256.Sum256(data)
+	return &Image{
+		Data:   data,
+		Format: format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Front:  front,
+		Source: source,
+		Hash:   hex.EncodeToString(sum[:]),
+	}, nil
+}
+
+// Better reports whether a should be preferred to b: front covers first, then
+// the one with more pixels, then embedded pictures, which travel with the file
+func Better(a, b *Image) bool {
+	if b == nil {
+		return a != nil
+	}
+	if a == nil {
+		return false
+	}
+	if a.Front != b.Front {
+		return a.Front
+	}
+	if pa, pb := a.Width*a.Height, b.Width*b.Height; pa != pb {
+		return pa > pb
+	}
+	return a.Source == SourceEmbedded && b.Source != SourceEmbedded
+}
+
+// Best returns the best of the images, or nil when there are none
+func Best(images ...*Image) *Image {
+	var best *Image
+	for _, img := range images {
+		if Better(img, best) {
+			best = img
+		}
+	}
+	return best
+}
+
+// Embedded decodes the pictures embedded in the audio file at path. Pictures
+// that are not images are left out; files whose format carries no pictures
+// yield none.
+func Embedded(path string) ([]*Image, error) {
+	pics, err := tags.ReadPictures(path)
+	if errors.Is(err, tags.ErrUnsupported) || errors.Is(err, tags.ErrMalformed) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var images []*Image
+	for _, p := range pics {
+		// Untyped pictures are usually the cover too, so only other types lose out
+		front := p.Type == tags.PictureFrontCover || p.Type == 0
+		if img, err := Decode(p.Data, front, SourceEmbedded); err == nil {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+// Folder decodes the cover, folder and front images in dir, matching their
+// names regardless of case
+func Folder(dir string) ([]*Image, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var images []*Image
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !isFolderImage(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.Size() > maxImageSize {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if img, err := Decode(data, true, SourceFolder); err == nil {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+func isFolderImage(name string) bool {
+	name = strings.ToLower(name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for _, e := range folderExtensions {
+		if ext != e {
+			continue
+		}
+		for _, n := range folderNames {
+			if base == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Save writes the image under Dir as <hash>.<format> unless an identical image
+// is already there, and returns its path
+func Save(img *Image) (string, error) {
+	ext := img.Format
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	path := filepath.Join(Dir, img.Hash+"."+ext)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create cover directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see half an image
+	tmp, err := os.CreateTemp(Dir, ".cover-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(img.Data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, nil
+}
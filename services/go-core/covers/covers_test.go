@@ -0,0 +1,141 @@
+package covers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestBest(t *testing.T) {
+	small, _ := Decode(encodePNG(t, 300, 300), true, SourceFolder)
+	large, _ := Decode(encodePNG(t, 1200, 1200), true, SourceEmbedded)
+	back, _ := Decode(encodePNG(t, 3000, 3000), false, SourceEmbedded)
+	sameFolder, _ := Decode(encodePNG(t, 1200, 1200), true, SourceFolder)
+
+	if got := Best(small, back, large); got != large {
+		t.Errorf("Best() = %dx%d front=%v, want the large front cover", got.Width, got.Height, got.Front)
+	}
+	if got := Best(back); got != back {
+		t.Error("Best() should fall back to a picture that is not a front cover")
+	}
+	if got := Best(sameFolder, large); got != large {
+		t.Error("Best() should prefer the embedded picture between equal sizes")
+	}
+	if Best() != nil {
+		t.Error("Best() of nothing should be nil")
+	}
+	if _, err := Decode([]byte("not an image"), true, SourceFolder); err != ErrNotImage {
+		t.Errorf("Decode() error = %v, want ErrNotImage", err)
+	}
+}
+
+func TestFolderAndSave(t *testing.T) {
+	dir := t.TempDir()
+	data := encodePNG(t, 500, 500)
+	for _, name := range []string{"Cover.PNG", "front.png", "back.png", "cover.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	images, err := Folder(dir)
+	if err != nil {
+		t.Fatalf("Folder() error = %v", err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("Folder() found %d images, want Cover.PNG and front.png", len(images))
+	}
+
+	Dir = filepath.Join(t.TempDir(), "covers")
+	first, err := Save(images[0])
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	second, err := Save(images[1])
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if first != second || filepath.Ext(first) != ".png" {
+		t.Errorf("identical images saved as %s and %s", first, second)
+	}
+	entries, _ := os.ReadDir(Dir)
+	if len(entries) != 1 {
+		t.Errorf("cover directory holds %d files, want 1", len(entries))
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			// A checkerboard of black and white pixels averages to mid grey
+			if (x+y)%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+	got := Resize(src, 64)
+	if got.Bounds().Dx() != 64 || got.Bounds().Dy() != 32 {
+		t.Fatalf("Resize() = %v, want 64x32", got.Bounds())
+	}
+	if c := got.RGBAAt(10, 10); c.R < 126 || c.R > 129 || c.A != 255 {
+		t.Errorf("Resize() pixel = %v, want mid grey", c)
+	}
+	if small := Resize(src, 1024); small.Bounds().Dx() != 400 {
+		t.Errorf("Resize() enlarged the image to %v", small.Bounds())
+	}
+}
+
+func TestGetVariant(t *testing.T) {
+	Dir = t.TempDir()
+	img, _ := Decode(encodePNG(t, 800, 600), true, SourceEmbedded)
+	src, err := Save(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := GetVariant("album", src, 256, "")
+	if err != nil {
+		t.Fatalf("GetVariant() error = %v", err)
+	}
+	if filepath.Ext(v.Path) != ".png" || v.ETag != `"`+img.Hash+`-256-png"` {
+		t.Errorf("GetVariant() = %+v, want a PNG tagged with the source hash", v)
+	}
+	f, err := os.Open(v.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil || cfg.Width != 256 || cfg.Height != 192 {
+		t.Errorf("variant is %dx%d (%v), want 256x192", cfg.Width, cfg.Height, err)
+	}
+	if _, err := GetVariant("album", src, 64, FormatJPEG); err != nil {
+		t.Fatalf("GetVariant() error = %v", err)
+	}
+
+	// A new source replaces the variants of the old one
+	other, _ := Decode(encodePNG(t, 900, 600), true, SourceEmbedded)
+	newSrc, _ := Save(other)
+	if _, err := GetVariant("album", newSrc, 64, FormatJPEG); err != nil {
+		t.Fatalf("GetVariant() error = %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(Dir, variantDir, "album"))
+	if len(entries) != 1 {
+		t.Errorf("variant directory holds %d files, want only the new source's", len(entries))
+	}
+}
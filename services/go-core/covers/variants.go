@@ -0,0 +1,215 @@
+package covers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats variants can be encoded in
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+// variantDir is the directory under Dir holding the variants, one directory per album
+const variantDir = "variants"
+
+// jpegQuality keeps thumbnails small without visible artefacts
+const jpegQuality = 85
+
+var (
+	// VariantSizes are the edge lengths variants can be requested at
+	VariantSizes = []int{64, 256, 512, 1024}
+
+	// hashes remembers the hash of cover files outside Dir by path, size and modification time
+	hashes sync.Map
+)
+
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// Variant is a resized or re-encoded copy of a cover
+type Variant struct {
+	Path string
+	ETag string // Quoted, derived from the source hash, size and format
+}
+
+// SourceHash returns the SHA-256 of the cover at path. Covers written by Save
+// are named after it; other files are read once per size and modification time.
+func SourceHash(path string) (string, error) {
+	if filepath.Dir(path) == filepath.Clean(Dir) {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if _, err := hex.DecodeString(name); err == nil && len(name) == sha256.Size*2 {
+			return name, nil
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := hashes.Load(path); ok {
+		if h := v.(fileHash); h.size == info.Size() && h.modTime.Equal(info.ModTime()) {
+			return h.hash, nil
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(sum.Sum(nil))
+	hashes.Store(path, fileHash{size: info.Size(), modTime: info.ModTime(), hash: hash})
+	return hash, nil
+}
+
+// ValidSize reports whether size is one of VariantSizes
+func ValidSize(size int) bool {
+	for _, s := range VariantSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// ETag returns the entity tag of the original cover with the given hash
+func ETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// GetVariant returns the variant of an album's cover at src fitting within
+// size×size (0 keeps the original dimensions) in format, PNG for PNG sources
+// and JPEG otherwise when empty. Variants are generated on first request and
+// kept under Dir; those of an earlier source are removed once the cover changes.
+func GetVariant(albumID, src string, size int, format string) (*Variant, error) {
+	hash, err := SourceHash(src)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		if format, err = defaultFormat(src); err != nil {
+			return nil, err
+		}
+	}
+	dir := filepath.Join(Dir, variantDir, albumID)
+	path := filepath.Join(dir, variantName(hash, size, format))
+	if _, err := os.Stat(path); err == nil {
+		return &Variant{Path: path, ETag: variantETag(hash, size, format)}, nil
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	edge := size
+	if edge == 0 {
+		edge = max(img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	resized := Resize(img, edge)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create variant directory: %w", err)
+	}
+	if err := writeVariant(path, resized, format); err != nil {
+		return nil, err
+	}
+	pruneVariants(dir, hash)
+	return &Variant{Path: path, ETag: variantETag(hash, size, format)}, nil
+}
+
+// RemoveVariants deletes every variant of an album's cover
+func RemoveVariants(albumID string) error {
+	return os.RemoveAll(filepath.Join(Dir, variantDir, albumID))
+}
+
+// defaultFormat keeps PNG sources, which may be transparent, in PNG and turns the others into JPEG
+func defaultFormat(src string) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, format, err := image.DecodeConfig(f); err != nil {
+		return "", ErrNotImage
+	} else if format == FormatPNG {
+		return FormatPNG, nil
+	}
+	return FormatJPEG, nil
+}
+
+func variantName(hash string, size int, format string) string {
+	ext := "png"
+	if format == FormatJPEG {
+		ext = "jpg"
+	}
+	return hash + "-" + strconv.Itoa(size) + "." + ext
+}
+
+func variantETag(hash string, size int, format string) string {
+	return `"` + hash + "-" + strconv.Itoa(size) + "-" + format + `"`
+}
+
+// writeVariant encodes img to a temporary file renamed into place, so
+// concurrent requests never serve half a variant
+func writeVariant(path string, img *image.RGBA, format string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".variant-*")
+	if err != nil {
+		return err
+	}
+	if format == FormatJPEG {
+		err = jpeg.Encode(tmp, flatten(img), &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(tmp, img)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write variant: %w", err)
+	}
+	return nil
+}
+
+// pruneVariants removes the variants in dir generated from another source than hash
+func pruneVariants(dir, hash string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), hash+"-") && !strings.HasPrefix(e.Name(), ".") {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package duplicates finds tracks that hold the same recording, such as an
+// MP3 and a FLAC of the same song or one file copied into two folders, and
+// merges them into a single track.
+package duplicates
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"sonantica-core/tags"
+)
+
+// DefaultTolerance is how far apart, in seconds, the durations of two
+// recordings with the same tags may be
+const DefaultTolerance = 2.0
+
+// Match reasons
+const (
+	MatchContent  = "content"  // Identical file content
+	MatchTags     = "tags"     // Same normalized artist and title, similar duration
+	MatchAcoustic = "acoustic" // Matching acoustic fingerprints
+)
+
+// Track is a candidate with the details used to compare quality
+type Track struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Artist      string   `json:"artist"`
+	Album       string   `json:"album"`
+	FilePath    string   `json:"filePath"`
+	CueTrack    *int     `json:"cueTrack,omitempty"`
+	Duration    float64  `json:"duration"`
+	Format      string   `json:"format"`
+	Codec       string   `json:"codec"`
+	Bitrate     int      `json:"bitrate"`
+	SampleRate  int      `json:"sampleRate"`
+	BitDepth    int      `json:"bitDepth"`
+	Channels    int      `json:"channels"`
+	SizeBytes   int64    `json:"sizeBytes"`
+	Lossless    bool     `json:"lossless"`
+	Integrity   string   `json:"integrity,omitempty"`
+	PlayCount   int      `json:"playCount"`
+	IsFavorite  bool     `json:"isFavorite"`
+	Playlists   int      `json:"playlists"` // Playlists referencing the track
+	ContentHash string   `json:"-"`
+	Acoustic    []string `json:"-"`       // IDs of the acoustically identical tracks
+	Quality     int64    `json:"quality"` // Higher is better; used to rank the group
+	Reasons     []string `json:"-"`
+}
+
+// Group is a set of tracks holding the same recording, best quality first
+type Group struct {
+	Match  []string `json:"match"`  // content and/or tags
+	Keep   string   `json:"keep"`   // Suggested track to keep
+	Wasted int64    `json:"wasted"` // Bytes held by the other tracks' files
+	Tracks []*Track `json:"tracks"`
+}
+
+// quality ranks an encoding: lossless first, then bit depth, sample rate and
+// bitrate. Corrupt files rank below every intact one.
+func quality(t *Track) int64 {
+	var q int64
+	if t.Integrity != "corrupt" {
+		q += 1 << 62
+	}
+	if t.Lossless {
+		q += 1 << 61
+	}
+	q += int64(min(t.BitDepth, 64)) << 50
+	q += int64(min(t.SampleRate, 1<<20)) << 28
+	q += int64(min(t.Bitrate, 1<<27))
+	return q
+}
+
+// normalize reduces a title or artist name to the letters and digits that
+// identify it, lowercased, so "The Beatles" matches "beatles" and
+// "Hey Jude!" matches "hey jude"
+func normalize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		case r == '&':
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString("and")
+			space = true
+		default:
+			space = true
+		}
+	}
+	return strings.TrimPrefix(b.String(), "the ")
+}
+
+// Find groups the tracks holding the same recording. Tracks are linked when
+// their files have the same content hash, when their fingerprints match, or
+// when their normalized artist and title match and their durations are within
+// tolerance of each other. Cue sheet tracks share their image's file and are
+// never matched by content.
+func Find(tracks []*Track, tolerance float64) []Group {
+	parent := make([]int, len(tracks))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	union := func(a, b int) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[rb] = ra
+		}
+	}
+	link := func(a, b int, reason string) {
+		union(a, b)
+		tracks[a].Reasons = appendReason(tracks[a].Reasons, reason)
+		tracks[b].Reasons = appendReason(tracks[b].Reasons, reason)
+	}
+
+	for _, t := range tracks {
+		t.Lossless = tags.IsLossless(t.Codec) // Ranked above any lossy encoding
+		t.Quality = quality(t)
+		t.Reasons = nil
+	}
+
+	byHash := make(map[string]int)
+	byTags := make(map[string][]int)
+	byID := make(map[string]int, len(tracks))
+	for i, t := range tracks {
+		byID[t.ID] = i
+	}
+	for i, t := range tracks {
+		for _, id := range t.Acoustic {
+			if j, ok := byID[id]; ok {
+				link(i, j, MatchAcoustic)
+			}
+		}
+		if t.ContentHash != "" && t.CueTrack == nil {
+			if j, ok := byHash[t.ContentHash]; ok {
+				link(j, i, MatchContent)
+			} else {
+				byHash[t.ContentHash] = i
+			}
+		}
+		title, artist := normalize(t.Title), normalize(t.Artist)
+		if title != "" && artist != "" {
+			key := artist + "\x00" + title
+			byTags[key] = append(byTags[key], i)
+		}
+	}
+	for _, idx := range byTags {
+		sort.Slice(idx, func(a, b int) bool { return tracks[idx[a]].Duration < tracks[idx[b]].Duration })
+		for k := 1; k < len(idx); k++ {
+			if tracks[idx[k]].Duration-tracks[idx[k-1]].Duration <= tolerance {
+				link(idx[k-1], idx[k], MatchTags)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range tracks {
+		if len(tracks[i].Reasons) > 0 {
+			root := find(i)
+			members[root] = append(members[root], i)
+		}
+	}
+
+	groups := make([]Group, 0, len(members))
+	for _, idx := range members {
+		if len(idx) < 2 {
+			continue
+		}
+		g := Group{Tracks: make([]*Track, 0, len(idx))}
+		for _, i := range idx {
+			g.Tracks = append(g.Tracks, tracks[i])
+			for _, r := range tracks[i].Reasons {
+				g.Match = appendReason(g.Match, r)
+			}
+		}
+		sort.SliceStable(g.Tracks, func(a, b int) bool {
+			ta, tb := g.Tracks[a], g.Tracks[b]
+			if ta.Quality != tb.Quality {
+				return ta.Quality > tb.Quality
+			}
+			if ta.PlayCount != tb.PlayCount {
+				return ta.PlayCount > tb.PlayCount
+			}
+			return ta.ID < tb.ID
+		})
+		sort.Strings(g.Match)
+		g.Keep = g.Tracks[0].ID
+		for _, t := range g.Tracks[1:] {
+			if t.CueTrack == nil {
+				g.Wasted += t.SizeBytes
+			}
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(a, b int) bool {
+		if groups[a].Wasted != groups[b].Wasted {
+			return groups[a].Wasted > groups[b].Wasted
+		}
+		return groups[a].Keep < groups[b].Keep
+	})
+	return groups
+}
+
+func appendReason(reasons []string, reason string) []string {
+	for _, r := range reasons {
+		if r == reason {
+			return reasons
+		}
+	}
+	return append(reasons, reason)
+}
@@ -0,0 +1,49 @@
+package duplicates
+
+import "testing"
+
+func TestFind(t *testing.T) {
+	tracks := []*Track{
+		{ID: "mp3", Title: "Hey Jude", Artist: "The Beatles", Duration: 431.2, Codec: "mp3", Bitrate: 320000, SampleRate: 44100, ContentHash: "a"},
+		{ID: "flac", Title: "Hey Jude!", Artist: "Beatles", Duration: 430.5, Codec: "flac", Bitrate: 900000, SampleRate: 44100, BitDepth: 16},
+		{ID: "copy", Title: "hey jude (copy)", Artist: "Unknown", Duration: 431.2, Codec: "mp3", Bitrate: 320000, SampleRate: 44100, ContentHash: "a", SizeBytes: 10},
+		{ID: "live", Title: "Hey Jude", Artist: "The Beatles", Duration: 480, Codec: "flac"},
+		{ID: "other", Title: "Let It Be", Artist: "The Beatles", Duration: 243, Codec: "flac", ContentHash: "b"},
+		{ID: "cue", Title: "Let It Be", Artist: "Someone Else", Duration: 243, Codec: "flac", ContentHash: "b", CueTrack: new(int)},
+		{ID: "untagged", Title: "Track 01", Duration: 431, Codec: "mp3", Bitrate: 128000, Acoustic: []string{"flac"}},
+	}
+	groups := Find(tracks, DefaultTolerance)
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+	g := groups[0]
+	if g.Keep != "flac" {
+		t.Errorf("keep = %s, want flac", g.Keep)
+	}
+	if len(g.Tracks) != 4 || len(g.Match) != 3 {
+		t.Errorf("group = %d tracks matched by %v, want 4 by acoustic, content and tags", len(g.Tracks), g.Match)
+	}
+	if g.Wasted != 10 {
+		t.Errorf("wasted = %d, want 10", g.Wasted)
+	}
+
+	// A corrupt lossless file ranks below an intact lossy one
+	tracks[1].Integrity = "corrupt"
+	if g := Find(tracks[:3], DefaultTolerance)[0]; g.Keep == "flac" {
+		t.Errorf("kept the corrupt track")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"The Beatles":         "beatles",
+		"  Simon & Garfunkel": "simon and garfunkel",
+		"Hey Jude!":           "hey jude",
+		"AC/DC":               "ac dc",
+		"Sigur Rós":           "sigur rós",
+	} {
+		if got := normalize(in); got != want {
+			t.Errorf("normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package duplicates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sonantica-core/cache"
+	"sonantica-core/database"
+)
+
+// Merge errors
+var (
+	ErrTrackNotFound = errors.New("track not found")
+	ErrInvalidMerge  = errors.New("invalid merge")
+)
+
+// Load reads the tracks that are candidates for duplicate detection. where
+// restricts the tracks aliased as t and args are its placeholders.
+func Load(ctx context.Context, where string, args ...any) ([]*Track, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT t.id::text, t.title, COALESCE(ar.name, ''), COALESCE(al.title, ''), t.file_path, t.cue_track,
+			COALESCE(t.duration_seconds, 0), COALESCE(t.format, ''), COALESCE(t.codec, ''),
+			COALESCE(t.bitrate, 0), COALESCE(t.sample_rate, 0), COALESCE(t.bit_depth, 0), COALESCE(t.channels, 0),
+			COALESCE(lf.size_bytes, 0), COALESCE(t.integrity, ''), COALESCE(t.play_count, 0), COALESCE(t.is_favorite, false),
+			(SELECT COUNT(*) FROM playlist_tracks pt WHERE pt.track_id = t.id), COALESCE(lf.content_hash, ''),
+			ARRAY(
+				SELECT (CASE WHEN m.track_id = t.id THEN m.match_id ELSE m.track_id END)::text
+				FROM track_acoustic_matches m WHERE m.track_id = t.id OR m.match_id = t.id
+			)
+		FROM tracks t
+		LEFT JOIN artists ar ON t.artist_id = ar.id
+		LEFT JOIN albums al ON t.album_id = al.id
+		LEFT JOIN LATERAL (
+			SELECT size_bytes, content_hash FROM library_files WHERE track_path = t.file_path LIMIT 1
+		) lf ON true
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tracks: %w", err)
+	}
+	defer rows.Close()
+
+	var tracks []*Track
+	for rows.Next() {
+		t := &Track{}
+		if err := rows.Scan(&t.ID, &t.Title, &t.Artist, &t.Album, &t.FilePath, &t.CueTrack,
+			&t.Duration, &t.Format, &t.Codec,
+			&t.Bitrate, &t.SampleRate, &t.BitDepth, &t.Channels,
+			&t.SizeBytes, &t.Integrity, &t.PlayCount, &t.IsFavorite,
+			&t.Playlists, &t.ContentHash, &t.Acoustic); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks, rows.Err()
+}
+
+// MergeResult reports what a merge moved onto the kept track
+type MergeResult struct {
+	Keep             string   `json:"keep"`
+	Removed          []string `json:"removed"`
+	PlaylistEntries  int64    `json:"playlistEntries"`  // Playlist entries repointed to the kept track
+	PlaybackSessions int64    `json:"playbackSessions"` // Listening history repointed to the kept track
+}
+
+// Merge keeps one track and retires its duplicates in a single transaction.
+// Playlist entries, listening history and statistics of the removed tracks
+// move to the kept track; the removed tracks are marked deleted and remember
+// the track they were merged into so later scans leave them deleted. Their
+// files are not touched.
+func Merge(ctx context.Context, keep string, remove []string) (*MergeResult, error) {
+	remove = dedupe(remove)
+	if len(remove) == 0 {
+		return nil, fmt.Errorf("%w: no tracks to remove", ErrInvalidMerge)
+	}
+	for _, id := range remove {
+		if id == keep {
+			return nil, fmt.Errorf("%w: cannot remove the kept track", ErrInvalidMerge)
+		}
+	}
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the tracks so concurrent merges of the same group serialize
+	var found int
+	ids := append([]string{keep}, remove...)
+	if err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM (
+			SELECT id FROM tracks WHERE id = ANY($1::uuid[]) AND status <> 'deleted' FOR UPDATE
+		) locked
+	`, ids).Scan(&found); err != nil {
+		return nil, fmt.Errorf("failed to lock tracks: %w", err)
+	}
+	if found != len(ids) {
+		return nil, ErrTrackNotFound
+	}
+
+	result := &MergeResult{Keep: keep, Removed: remove}
+
+	// Playlists holding both keep the earliest position of either entry
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO playlist_tracks (playlist_id, track_id, position, added_at)
+		SELECT playlist_id, $1, MIN(position), MIN(added_at)
+		FROM playlist_tracks WHERE track_id = ANY($2::uuid[])
+		GROUP BY playlist_id
+		ON CONFLICT (playlist_id, track_id) DO UPDATE
+		SET position = LEAST(playlist_tracks.position, EXCLUDED.position)
+	`, keep, remove)
+	if err != nil {
+		return nil, fmt.Errorf("failed to repoint playlist entries: %w", err)
+	}
+	result.PlaylistEntries = tag.RowsAffected()
+	if _, err := tx.Exec(ctx, `DELETE FROM playlist_tracks WHERE track_id = ANY($1::uuid[])`, remove); err != nil {
+		return nil, fmt.Errorf("failed to remove playlist entries: %w", err)
+	}
+
+	tag, err = tx.Exec(ctx, `UPDATE playback_sessions SET track_id = $1 WHERE track_id = ANY($2::uuid[])`, keep, remove)
+	if err != nil {
+		return nil, fmt.Errorf("failed to repoint playback sessions: %w", err)
+	}
+	result.PlaybackSessions = tag.RowsAffected()
+
+	// Completion is averaged over the plays of every track
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO track_statistics (track_id, play_count, complete_count, skip_count, total_play_time,
+			average_completion, last_played_at, updated_at)
+		SELECT $1, SUM(COALESCE(play_count, 0)), SUM(COALESCE(complete_count, 0)), SUM(COALESCE(skip_count, 0)),
+			SUM(COALESCE(total_play_time, 0)),
+			COALESCE(SUM(average_completion * play_count) / NULLIF(SUM(play_count), 0), 0),
+			MAX(last_played_at), NOW()
+		FROM track_statistics WHERE track_id = ANY($2::uuid[])
+		HAVING COUNT(*) > 0
+		ON CONFLICT (track_id) DO UPDATE SET
+			average_completion = COALESCE(
+				(track_statistics.average_completion * track_statistics.play_count + EXCLUDED.average_completion * EXCLUDED.play_count)
+				/ NULLIF(track_statistics.play_count + EXCLUDED.play_count, 0), 0),
+			play_count = track_statistics.play_count + EXCLUDED.play_count,
+			complete_count = track_statistics.complete_count + EXCLUDED.complete_count,
+			skip_count = track_statistics.skip_count + EXCLUDED.skip_count,
+			total_play_time = track_statistics.total_play_time + EXCLUDED.total_play_time,
+			last_played_at = GREATEST(track_statistics.last_played_at, EXCLUDED.last_played_at),
+			updated_at = NOW()
+	`, keep, remove); err != nil {
+		return nil, fmt.Errorf("failed to merge track statistics: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM track_statistics WHERE track_id = ANY($1::uuid[])`, remove); err != nil {
+		return nil, fmt.Errorf("failed to remove track statistics: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO track_segments (track_id, segment_start, segment_end, play_count, updated_at)
+		SELECT $1, segment_start, segment_end, SUM(COALESCE(play_count, 0)), NOW()
+		FROM track_segments WHERE track_id = ANY($2::uuid[])
+		GROUP BY segment_start, segment_end
+		ON CONFLICT (track_id, segment_start, segment_end) DO UPDATE
+		SET play_count = track_segments.play_count + EXCLUDED.play_count, updated_at = NOW()
+	`, keep, remove); err != nil {
+		return nil, fmt.Errorf("failed to merge track segments: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM track_segments WHERE track_id = ANY($1::uuid[])`, remove); err != nil {
+		return nil, fmt.Errorf("failed to remove track segments: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE tracks SET
+			play_count = COALESCE(play_count, 0) + (SELECT COALESCE(SUM(play_count), 0) FROM tracks WHERE id = ANY($2::uuid[])),
+			is_favorite = is_favorite OR EXISTS (SELECT 1 FROM tracks WHERE id = ANY($2::uuid[]) AND is_favorite),
+			updated_at = NOW()
+		WHERE id = $1
+	`, keep, remove); err != nil {
+		return nil, fmt.Errorf("failed to update kept track: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE tracks SET status = 'deleted', merged_into = $1, play_count = 0, is_favorite = false, updated_at = NOW()
+		WHERE id = ANY($2::uuid[])
+	`, keep, remove); err != nil {
+		return nil, fmt.Errorf("failed to retire merged tracks: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	_ = cache.InvalidateLibraryCache(context.Background())
+	_ = cache.InvalidatePlaylistCache(context.Background())
+	_ = cache.InvalidateAnalyticsCache(context.Background())
+	return result, nil
+}
+
+func dedupe(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,328 @@
+// Package fingerprint computes Chromaprint compatible acoustic fingerprints
+// without external tools and keeps a local index of them to find tracks
+// holding the same recording whatever their tags say.
+//
+// The pipeline is Chromaprint's default algorithm (TEST2): the audio is mixed
+// down to mono and resampled to 11025 Hz, 4096-sample Hamming windows taken
+// every 1365 samples are folded into 12 chroma bands between 28 Hz and
+// 3520 Hz, smoothed over five frames, normalized, and 16 Haar-like filters
+// over the resulting image are quantized into 2 bits each of a 32-bit
+// subfingerprint per frame. Resampling differs from libav's, so fingerprints
+// of the same file are close to but not bit-identical with fpcalc's.
+package fingerprint
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// Algorithm is the Chromaprint algorithm implemented, stored in compressed fingerprints
+	Algorithm = 1
+	// DefaultLength is how many seconds of audio are fingerprinted, as fpcalc does
+	DefaultLength = 120.0
+
+	sampleRate = 11025
+	frameSize  = 4096
+	frameStep  = frameSize / 3
+	minFreq    = 28
+	maxFreq    = 3520
+	bands      = 12
+	// maxFilterWidth is the widest classifier, in frames
+	maxFilterWidth = 16
+	// sampleScale brings samples to the 16-bit scale Chromaprint works on,
+	// which its silence threshold on the chroma norm assumes
+	sampleScale = 32768
+	// minNorm is the chroma norm below which Chromaprint treats a frame as silent
+	minNorm = 0.01
+)
+
+// ErrTooShort is returned when the audio is too short to fingerprint
+var ErrTooShort = errors.New("audio too short to fingerprint")
+
+// chromaFilter smooths the chroma features over time
+var chromaFilter = []float64{0.25, 0.75, 1.0, 0.75, 0.25}
+
+// filter is a Haar-like filter over a window of the chroma image: width frames
+// from the current one, height bands from band y
+type filter struct {
+	kind, y, height, width int
+}
+
+// quantizer maps a filter response to 0..3
+type quantizer struct {
+	t0, t1, t2 float64
+}
+
+type classifier struct {
+	f filter
+	q quantizer
+}
+
+// classifiers are the TEST2 classifiers trained by Chromaprint
+var classifiers = []classifier{
+	{filter{0, 4, 3, 15}, quantizer{1.98215, 2.35817, 2.63523}},
+	{filter{4, 4, 6, 15}, quantizer{-1.03809, -0.651211, -0.282167}},
+	{filter{1, 0, 4, 16}, quantizer{-0.298702, 0.119262, 0.558497}},
+	{filter{3, 8, 2, 12}, quantizer{-0.105439, 0.0153946, 0.135898}},
+	{filter{3, 4, 4, 8}, quantizer{-0.142891, 0.0258736, 0.200632}},
+	{filter{4, 0, 3, 5}, quantizer{-0.826319, -0.590612, -0.368214}},
+	{filter{1, 2, 2, 9}, quantizer{-0.557409, -0.233035, 0.0534525}},
+	{filter{2, 7, 3, 4}, quantizer{-0.0646826, 0.00620476, 0.0784847}},
+	{filter{2, 6, 2, 16}, quantizer{-0.192387, -0.029699, 0.215855}},
+	{filter{2, 1, 3, 2}, quantizer{-0.0397818, -0.00568076, 0.0292026}},
+	{filter{5, 10, 1, 15}, quantizer{-0.53823, -0.369934, -0.190235}},
+	{filter{3, 6, 2, 10}, quantizer{-0.124877, 0.0296483, 0.139239}},
+	{filter{2, 1, 1, 14}, quantizer{-0.101475, 0.0225617, 0.127831}},
+	{filter{3, 5, 6, 4}, quantizer{-0.0799915, -0.00729616, 0.064262}},
+	{filter{1, 9, 2, 12}, quantizer{-0.272556, 0.019424, 0.323637}},
+	{filter{3, 4, 2, 14}, quantizer{-0.164502, -0.0768611, 0.0390012}},
+}
+
+// grayCode encodes the quantized values so neighbours differ by one bit
+var grayCode = [4]uint32{0, 1, 3, 2}
+
+// Source yields decoded audio, one slice of samples in [-1, 1) per channel,
+// and io.EOF at the end. tags.PCM is a Source.
+type Source interface {
+	Read() ([][]float32, error)
+}
+
+// Calculate fingerprints length seconds of the audio read from src, starting
+// start seconds in; rate is the sample rate of src
+func Calculate(src Source, rate int, start, length float64) ([]uint32, error) {
+	if rate <= 0 {
+		return nil, errors.New("invalid sample rate")
+	}
+	skip := int64(start * float64(rate))
+	remaining := int64(length * float64(rate))
+	fp := newFingerprinter(rate)
+	var mono []float64
+	for remaining > 0 {
+		block, err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(block) == 0 {
+			continue
+		}
+		n := int64(len(block[0]))
+		from := min(skip, n)
+		skip -= from
+		to := min(n, from+remaining)
+		remaining -= to - from
+
+		mono = mono[:0]
+		scale := sampleScale / float64(len(block))
+		for i := from; i < to; i++ {
+			var sum float64
+			for _, ch := range block {
+				sum += float64(ch[i])
+			}
+			mono = append(mono, sum*scale)
+		}
+		fp.consume(mono)
+	}
+	if len(fp.subfingerprints) == 0 {
+		return nil, ErrTooShort
+	}
+	return fp.subfingerprints, nil
+}
+
+// fingerprinter runs the pipeline over mono samples as they arrive
+type fingerprinter struct {
+	resample *resampler // nil when the input is already at sampleRate
+	pending  []float64  // Samples at sampleRate not yet framed
+	window   []float64
+	spectrum []complex128
+	notes    []int // Chroma band of each FFT bin between minIndex and maxIndex
+	minIndex int
+
+	history  [][bands]float64 // Last chroma vectors, for the smoothing filter
+	frames   int
+	integral [][bands + 1]float64 // Cumulative sums of the chroma image, one leading row and column of zeros
+
+	subfingerprints []uint32
+}
+
+func newFingerprinter(rate int) *fingerprinter {
+	f := &fingerprinter{
+		window:   make([]float64, frameSize),
+		spectrum: make([]complex128, frameSize),
+		integral: make([][bands + 1]float64, 1, 1024),
+	}
+	if rate != sampleRate {
+		f.resample = newResampler(rate, sampleRate)
+	}
+	for i := range f.window {
+		f.window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(frameSize-1))
+	}
+
+	index := func(freq float64) int { return int(math.Round(frameSize * freq / sampleRate)) }
+	f.minIndex = max(1, index(minFreq))
+	maxIndex := min(frameSize/2, index(maxFreq))
+	for i := f.minIndex; i < maxIndex; i++ {
+		freq := float64(i) * sampleRate / frameSize
+		octave := math.Log2(freq / (440.0 / 16))
+		f.notes = append(f.notes, int(bands*(octave-math.Floor(octave))))
+	}
+	return f
+}
+
+func (f *fingerprinter) consume(samples []float64) {
+	if f.resample != nil {
+		samples = f.resample.process(samples)
+	}
+	f.pending = append(f.pending, samples...)
+	start := 0
+	for ; len(f.pending)-start >= frameSize; start += frameStep {
+		f.frame(f.pending[start : start+frameSize])
+	}
+	f.pending = append(f.pending[:0], f.pending[start:]...)
+}
+
+// frame turns one window of audio into a chroma vector and feeds the image
+func (f *fingerprinter) frame(samples []float64) {
+	for i, s := range samples {
+		f.spectrum[i] = complex(s*f.window[i], 0)
+	}
+	fft(f.spectrum)
+
+	var chroma [bands]float64
+	for k, note := range f.notes {
+		c := f.spectrum[f.minIndex+k]
+		chroma[note] += real(c)*real(c) + imag(c)*imag(c)
+	}
+
+	// Smoothing starts once the history holds one frame more than the filter
+	f.frames++
+	f.history = append(f.history, chroma)
+	if len(f.history) > len(chromaFilter) {
+		f.history = f.history[1:]
+	}
+	if f.frames <= len(chromaFilter) {
+		return
+	}
+	var smoothed [bands]float64
+	for j, coef := range chromaFilter {
+		for b := range smoothed {
+			smoothed[b] += f.history[j][b] * coef
+		}
+	}
+
+	var norm float64
+	for _, v := range smoothed {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for b := range smoothed {
+		if norm < minNorm {
+			smoothed[b] = 0
+		} else {
+			smoothed[b] /= norm
+		}
+	}
+	f.addRow(smoothed)
+}
+
+func (f *fingerprinter) addRow(row [bands]float64) {
+	prev := f.integral[len(f.integral)-1]
+	var next [bands + 1]float64
+	var sum float64
+	for b, v := range row {
+		sum += v
+		next[b+1] = prev[b+1] + sum
+	}
+	f.integral = append(f.integral, next)
+
+	rows := len(f.integral) - 1
+	if rows >= maxFilterWidth {
+		f.subfingerprints = append(f.subfingerprints, f.subfingerprint(rows-maxFilterWidth))
+	}
+}
+
+// area sums the image over frames [r1, r2) and bands [c1, c2)
+func (f *fingerprinter) area(r1, c1, r2, c2 int) float64 {
+	return f.integral[r2][c2] - f.integral[r1][c2] - f.integral[r2][c1] + f.integral[r1][c1]
+}
+
+func (f *fingerprinter) subfingerprint(x int) uint32 {
+	var bits uint32
+	for _, c := range classifiers {
+		v := c.f.apply(f, x)
+		var q int
+		switch {
+		case v < c.q.t1 && v < c.q.t0:
+			q = 0
+		case v < c.q.t1:
+			q = 1
+		case v < c.q.t2:
+			q = 2
+		default:
+			q = 3
+		}
+		bits = bits<<2 | grayCode[q]
+	}
+	return bits
+}
+
+func (flt filter) apply(f *fingerprinter, x int) float64 {
+	y, w, h := flt.y, flt.width, flt.height
+	var a, b float64
+	switch flt.kind {
+	case 0:
+		a = f.area(x, y, x+w, y+h)
+	case 1: // Upper bands against lower bands
+		h2 := h / 2
+		a = f.area(x, y+h2, x+w, y+h)
+		b = f.area(x, y, x+w, y+h2)
+	case 2: // Later frames against earlier frames
+		w2 := w / 2
+		a = f.area(x+w2, y, x+w, y+h)
+		b = f.area(x, y, x+w2, y+h)
+	case 3: // Diagonal quadrants
+		w2, h2 := w/2, h/2
+		a = f.area(x, y, x+w2, y+h2) + f.area(x+w2, y+h2, x+w, y+h)
+		b = f.area(x, y+h2, x+w2, y+h) + f.area(x+w2, y, x+w, y+h2)
+	case 4: // Middle third of the bands against the outer thirds
+		h3 := h / 3
+		a = f.area(x, y+h3, x+w, y+2*h3)
+		b = f.area(x, y, x+w, y+h3) + f.area(x, y+2*h3, x+w, y+h)
+	case 5: // Middle third of the frames against the outer thirds
+		w3 := w / 3
+		a = f.area(x+w3, y, x+2*w3, y+h)
+		b = f.area(x, y, x+w3, y+h) + f.area(x+2*w3, y, x+w, y+h)
+	}
+	return math.Log1p(a) - math.Log1p(b)
+}
+
+// fft transforms x in place; len(x) must be a power of two
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, -2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u, v := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = u+v, u-v
+				w *= step
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package fingerprint
+
+import (
+	"encoding/base64"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// DefaultThreshold is the similarity from which two fingerprints are taken
+	// for the same recording. Different encodes of a recording score above 0.9;
+	// unrelated audio scores around 0.5.
+	DefaultThreshold = 0.8
+
+	// maxAlign is how far, in subfingerprints (about 0.124s each), two
+	// fingerprints are shifted against each other looking for the best match
+	maxAlign = 120
+	// minOverlap is the fewest subfingerprints compared at any alignment
+	minOverlap = 40
+	// keyShift drops the low bits of a subfingerprint to make an index key;
+	// the top classifiers are the most robust to encoding noise
+	keyShift = 12
+)
+
+// Compress encodes a fingerprint the way Chromaprint does: the positions of
+// the bits that change between subfingerprints, packed in 3-bit and 5-bit
+// values behind a 4-byte header, in URL-safe base64 without padding
+func Compress(fp []uint32) string {
+	var normal, exceptional []uint32
+	var last uint32
+	for i, x := range fp {
+		if i > 0 {
+			x ^= last
+		}
+		last = fp[i]
+		bit, lastBit := uint32(1), uint32(0)
+		for ; x != 0; x >>= 1 {
+			if x&1 != 0 {
+				normal = append(normal, bit-lastBit)
+				lastBit = bit
+			}
+			bit++
+		}
+		normal = append(normal, 0)
+	}
+	for i, v := range normal {
+		if v >= 7 {
+			exceptional = append(exceptional, v-7)
+			normal[i] = 7
+		}
+	}
+
+	out := []byte{Algorithm, byte(len(fp) >> 16), byte(len(fp) >> 8), byte(len(fp))}
+	out = packBits(out, normal, 3)
+	out = packBits(out, exceptional, 5)
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+// packBits appends the low n bits of every value, least significant first
+func packBits(out []byte, values []uint32, n uint) []byte {
+	var acc uint32
+	var used uint
+	for _, v := range values {
+		acc |= (v & (1<<n - 1)) << used
+		used += n
+		for used >= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+			used -= 8
+		}
+	}
+	if used > 0 {
+		out = append(out, byte(acc))
+	}
+	return out
+}
+
+// Similarity returns the share of identical bits between a and b at the
+// alignment where they agree most, from 0 to 1. Fingerprints of the same
+// recording offset by a few seconds of leading silence still match.
+func Similarity(a, b []uint32) float64 {
+	best := 0.0
+	for offset := -maxAlign; offset <= maxAlign; offset++ {
+		x, y := a, b
+		if offset > 0 {
+			if offset >= len(x) {
+				continue
+			}
+			x = x[offset:]
+		} else if offset < 0 {
+			if -offset >= len(y) {
+				continue
+			}
+			y = y[-offset:]
+		}
+		n := min(len(x), len(y))
+		if n < min(minOverlap, len(a), len(b)) {
+			continue
+		}
+		diff := 0
+		for i := 0; i < n; i++ {
+			diff += bits.OnesCount32(x[i] ^ y[i])
+		}
+		if s := 1 - float64(diff)/float64(32*n); s > best {
+			best = s
+		}
+	}
+	return best
+}
+
+// IndexKeys returns the distinct keys under which a fingerprint is indexed
+func IndexKeys(fp []uint32) []int32 {
+	seen := make(map[int32]bool, len(fp))
+	keys := make([]int32, 0, len(fp))
+	for _, x := range fp {
+		k := int32(x >> keyShift)
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
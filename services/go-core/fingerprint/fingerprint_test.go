@@ -0,0 +1,118 @@
+package fingerprint
+
+import (
+	"encoding/base64"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// chords is a Source playing a random sequence of three-note chords
+type chords struct {
+	rate     int
+	seed     int64
+	silence  float64 // Seconds of silence before the music
+	noise    float64
+	level    float64 // Amplitude of each note, 0.2 when 0
+	length   float64
+	position int
+	rng      *rand.Rand
+	notes    [][3]float64
+}
+
+func (c *chords) Read() ([][]float32, error) {
+	if c.rng == nil {
+		c.rng = rand.New(rand.NewSource(c.seed))
+		seq := rand.New(rand.NewSource(c.seed))
+		for i := 0; i < int(c.length*2)+1; i++ {
+			root := 48 + seq.Intn(24)
+			c.notes = append(c.notes, [3]float64{float64(root), float64(root + 4), float64(root + 7)})
+		}
+	}
+	total := int(c.length * float64(c.rate))
+	if c.position >= total {
+		return nil, io.EOF
+	}
+	n := min(4096, total-c.position)
+	left, right := make([]float32, n), make([]float32, n)
+	for i := range left {
+		t := float64(c.position+i)/float64(c.rate) - c.silence
+		level := c.level
+		if level == 0 {
+			level = 0.2
+		}
+		var v float64
+		if t >= 0 {
+			for _, note := range c.notes[int(t*2)] {
+				v += level * math.Sin(2*math.Pi*440*math.Pow(2, (note-69)/12)*t)
+			}
+		}
+		v += c.noise * c.rng.NormFloat64()
+		left[i], right[i] = float32(v), float32(v*0.9)
+	}
+	c.position += n
+	return [][]float32{left, right}, nil
+}
+
+func TestCalculate(t *testing.T) {
+	fingerprint := func(c *chords) []uint32 {
+		fp, err := Calculate(c, c.rate, 0, DefaultLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+	original := fingerprint(&chords{rate: 44100, seed: 1, length: 30})
+	if want := (30*sampleRate-frameSize)/frameStep + 1 - len(chromaFilter) - maxFilterWidth + 1; abs(len(original)-want) > 2 {
+		t.Errorf("%d subfingerprints, want about %d", len(original), want)
+	}
+
+	tests := []struct {
+		name    string
+		audio   *chords
+		similar bool
+	}{
+		{"resampled with noise", &chords{rate: 48000, seed: 1, length: 30, noise: 0.01}, true},
+		{"leading silence", &chords{rate: 22050, seed: 1, length: 32, silence: 2}, true},
+		{"quiet", &chords{rate: 44100, seed: 1, length: 30, level: 0.00003}, true}, // About one 16-bit step per note
+		{"other recording", &chords{rate: 44100, seed: 2, length: 30}, false},
+	}
+	for _, tt := range tests {
+		s := Similarity(original, fingerprint(tt.audio))
+		if tt.similar != (s >= DefaultThreshold) {
+			t.Errorf("%s: similarity %.3f", tt.name, s)
+		}
+	}
+
+	if _, err := Calculate(&chords{rate: 44100, seed: 1, length: 1}, 44100, 0, DefaultLength); err != ErrTooShort {
+		t.Errorf("1s of audio: %v", err)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Expected outputs of Chromaprint's compressor tests
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		fp   []uint32
+		want string
+	}{
+		{[]uint32{1}, "\x01\x00\x00\x01\x01"},
+		{[]uint32{7}, "\x01\x00\x00\x01\x49\x00"},
+		{[]uint32{1 << 6}, "\x01\x00\x00\x01\x07\x00"},
+		{[]uint32{1 << 8}, "\x01\x00\x00\x01\x07\x02"},
+		{[]uint32{0, 1}, "\x01\x00\x00\x02\x08\x00"},
+	}
+	for _, tt := range tests {
+		got, _ := base64.RawURLEncoding.DecodeString(Compress(tt.fp))
+		if string(got) != tt.want {
+			t.Errorf("Compress(%v) = %q, want %q", tt.fp, got, tt.want)
+		}
+	}
+}
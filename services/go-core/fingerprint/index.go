@@ -0,0 +1,114 @@
+package fingerprint
+
+import (
+	"context"
+	"fmt"
+
+	"sonantica-core/database"
+)
+
+// minSharedKeys is how many index keys a candidate must share with a
+// fingerprint before the two are compared; unrelated tracks share about one
+const minSharedKeys = 10
+
+// Match is a track acoustically identical to another
+type Match struct {
+	TrackID    string  `json:"trackId"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Save stores the fingerprint of a track and links the track to the indexed
+// tracks holding the same recording. It returns those tracks.
+func Save(ctx context.Context, trackID string, fp []uint32) ([]Match, error) {
+	raw := make([]int32, len(fp))
+	for i, x := range fp {
+		raw[i] = int32(x)
+	}
+	keys := IndexKeys(fp)
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO track_fingerprints (track_id, algorithm, fingerprint, index_keys, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (track_id) DO UPDATE SET
+			algorithm = EXCLUDED.algorithm, fingerprint = EXCLUDED.fingerprint,
+			index_keys = EXCLUDED.index_keys, created_at = NOW()
+	`, trackID, Algorithm, raw, keys); err != nil {
+		return nil, fmt.Errorf("failed to store fingerprint: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT f.track_id::text, f.fingerprint
+		FROM track_fingerprints f
+		JOIN tracks t ON t.id = f.track_id
+		WHERE f.index_keys && $1 AND f.track_id <> $2 AND f.algorithm = $3 AND t.status <> 'deleted'
+		  AND cardinality(ARRAY(SELECT unnest(f.index_keys) INTERSECT SELECT unnest($1::integer[]))) >= $4
+	`, keys, trackID, Algorithm, minSharedKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fingerprint index: %w", err)
+	}
+	var matches []Match
+	for rows.Next() {
+		var id string
+		var other []int32
+		if err := rows.Scan(&id, &other); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidate := make([]uint32, len(other))
+		for i, x := range other {
+			candidate[i] = uint32(x)
+		}
+		if s := Similarity(fp, candidate); s >= DefaultThreshold {
+			matches = append(matches, Match{TrackID: id, Similarity: s})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM track_acoustic_matches WHERE track_id = $1 OR match_id = $1`, trackID); err != nil {
+		return nil, fmt.Errorf("failed to clear acoustic matches: %w", err)
+	}
+	for _, m := range matches {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO track_acoustic_matches (track_id, match_id, similarity)
+			VALUES (LEAST($1::uuid, $2::uuid), GREATEST($1::uuid, $2::uuid), $3)
+		`, trackID, m.TrackID, m.Similarity); err != nil {
+			return nil, fmt.Errorf("failed to record acoustic match: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE tracks SET fingerprinted_at = NOW() WHERE id = $1`, trackID); err != nil {
+		return nil, err
+	}
+	return matches, tx.Commit(ctx)
+}
+
+// Skip records that a track cannot be fingerprinted, e.g. because its audio
+// is damaged or too short, so the backlog does not retry it until its file changes
+func Skip(ctx context.Context, trackID string) error {
+	_, err := database.DB.Exec(ctx, `UPDATE tracks SET fingerprinted_at = NOW() WHERE id = $1`, trackID)
+	return err
+}
+
+// Get returns the fingerprint of a track, or nil when it has none
+func Get(ctx context.Context, trackID string) ([]uint32, error) {
+	var raw []int32
+	err := database.DB.QueryRow(ctx, `
+		SELECT COALESCE((SELECT fingerprint FROM track_fingerprints WHERE track_id = $1 AND algorithm = $2), '{}')
+	`, trackID, Algorithm).Scan(&raw)
+	if err != nil || len(raw) == 0 {
+		return nil, err
+	}
+	fp := make([]uint32, len(raw))
+	for i, x := range raw {
+		fp[i] = uint32(x)
+	}
+	return fp, nil
+}
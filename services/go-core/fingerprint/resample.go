@@ -0,0 +1,90 @@
+package fingerprint
+
+import "math"
+
+const (
+	// resamplePhases is how finely the position between two input samples is resolved
+	resamplePhases = 256
+	// resampleTaps is the half length of the filter, in samples at the lower rate
+	resampleTaps = 16
+	// resampleCutoff is the pass band, relative to the output Nyquist frequency
+	resampleCutoff = 0.8
+)
+
+// resampler converts a stream of samples to another rate with a windowed sinc
+// low-pass filter, as libav's resampler does for Chromaprint
+type resampler struct {
+	step   float64 // Input samples per output sample
+	half   int     // Half length of the filter, in input samples
+	kernel [][]float64
+	input  []float64 // Input not consumed yet; input[0] is sample base
+	base   int64
+	next   float64 // Position of the next output sample in the input
+	out    []float64
+}
+
+func newResampler(from, to int) *resampler {
+	r := &resampler{step: float64(from) / float64(to)}
+	cutoff := resampleCutoff * min(1, 1/r.step) // Relative to the input Nyquist frequency
+	r.half = int(math.Ceil(resampleTaps * max(1, r.step)))
+
+	r.kernel = make([][]float64, resamplePhases)
+	for p := range r.kernel {
+		phase := float64(p) / resamplePhases
+		taps := make([]float64, 2*r.half)
+		var sum float64
+		for i := range taps {
+			d := float64(i-r.half+1) - phase // Distance from the output position
+			window := 0.42 + 0.5*math.Cos(math.Pi*d/float64(r.half)) + 0.08*math.Cos(2*math.Pi*d/float64(r.half))
+			if math.Abs(d) >= float64(r.half) {
+				window = 0
+			}
+			taps[i] = sinc(cutoff*d) * window
+			sum += taps[i]
+		}
+		for i := range taps {
+			taps[i] /= sum // Unity gain at DC
+		}
+		r.kernel[p] = taps
+	}
+	return r
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// process consumes samples and returns the output available so far. The
+// returned slice is reused by the next call.
+func (r *resampler) process(samples []float64) []float64 {
+	r.input = append(r.input, samples...)
+	end := r.base + int64(len(r.input))
+	r.out = r.out[:0]
+	for {
+		pos := int64(math.Floor(r.next))
+		if pos+int64(r.half) >= end {
+			break
+		}
+		taps := r.kernel[int((r.next-float64(pos))*resamplePhases)%resamplePhases]
+		var v float64
+		for i, t := range taps {
+			k := pos - int64(r.half) + 1 + int64(i) - r.base
+			if k >= 0 {
+				v += r.input[k] * t
+			}
+		}
+		r.out = append(r.out, v)
+		r.next += r.step
+	}
+
+	// Keep what the next output samples still need
+	if drop := int64(math.Floor(r.next)) - int64(r.half) + 1 - r.base; drop > 0 {
+		drop = min(drop, int64(len(r.input)))
+		r.input = append(r.input[:0], r.input[drop:]...)
+		r.base += drop
+	}
+	return r.out
+}
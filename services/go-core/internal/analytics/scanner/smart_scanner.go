@@ -66,6 +66,12 @@ func (s *SmartScanner) TriggerScan(ctx context.Context, priority ScanPriority, s
 	}()
 }
 
+// Backfill queues a batch of tracks still missing analysis and returns once
+// they are dispatched. It is the scheduled counterpart of a low priority TriggerScan.
+func (s *SmartScanner) Backfill(ctx context.Context) {
+	s.scanLibrary(ctx)
+}
+
 // PrioritizeTrack interrupts background flow to process a specific track immediately
 func (s *SmartScanner) PrioritizeTrack(ctx context.Context, trackID uuid.UUID) {
 	slog.Info("🚨 Prioritizing track analysis", "track_id", trackID)
@@ -10,6 +10,7 @@ import (
 
 	"sonantica-core/internal/analytics/scanner"
 	"sonantica-core/internal/plugins/domain"
+	"sonantica-core/stems"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -243,10 +244,11 @@ func (m *Manager) processScope(plugin *domain.AIPlugin, scope PluginScope, track
 		if plugin.Manifest.Capability == domain.CapabilityStemSeparation {
 			// Fire and forget (or rather, dont wait for completion)
 			// But createJob is sync HTTP call? usually it returns quickly with JobID.
-			_, err := m.client.CreateJob(ctx, plugin.BaseURL, idStr, path, priority, []string{"vocals", "drums", "bass", "other"})
+			job, err := m.client.CreateJob(ctx, plugin.BaseURL, idStr, path, priority, []string{"vocals", "drums", "bass", "other"})
 			if err != nil {
 				slog.Error("Failed to dispatch job", "plugin", plugin.Manifest.Name, "track", idStr, "error", err)
 			} else {
+				m.stemJobDispatched(ctx, job)
 				count++
 			}
 		} else {
@@ -266,22 +268,9 @@ func (m *Manager) processScope(plugin *domain.AIPlugin, scope PluginScope, track
 	slog.Info("Batch processing started", "plugin", plugin.Manifest.Name, "scope", scope, "jobs_dispatched", count)
 }
 
-// StartMonitoring inicia el chequeo periódico de salud
-func (m *Manager) StartMonitoring(ctx context.Context, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				m.checkHealth(ctx)
-			}
-		}
-	}()
-}
-
-func (m *Manager) checkHealth(ctx context.Context) {
+// CheckHealth polls every registered plugin and records its health.
+// The scheduler runs it periodically.
+func (m *Manager) CheckHealth(ctx context.Context) {
 	m.mu.RLock()
 	// Copy to avoid holding lock during network calls
 	pluginList := make([]*domain.AIPlugin, 0, len(m.plugins))
@@ -354,8 +343,12 @@ func (m *Manager) SeparateStems(ctx context.Context, trackID, filePath string) (
 	}
 
 	// Por defecto pedimos todos los stems
-	// Por defecto pedimos todos los stems
-	return m.client.CreateJob(ctx, p.BaseURL, trackID, filePath, domain.PriorityNormal, []string{"vocals", "drums", "bass", "other"})
+	job, err := m.client.CreateJob(ctx, p.BaseURL, trackID, filePath, domain.PriorityNormal, []string{"vocals", "drums", "bass", "other"})
+	if err != nil {
+		return nil, err
+	}
+	m.stemJobDispatched(ctx, job)
+	return job, nil
 }
 
 // GetJobStatus consulta el estado de un trabajo en un plugin específico
@@ -365,7 +358,19 @@ func (m *Manager) GetJobStatus(ctx context.Context, cap domain.PluginCapability,
 		return nil, err
 	}
 
-	return m.client.GetJobStatus(ctx, p.BaseURL, jobID)
+	job, err := m.client.GetJobStatus(ctx, p.BaseURL, jobID)
+	if err != nil {
+		return nil, err
+	}
+	// The first poll that sees a separation finished writes its stem manifest
+	if cap == domain.CapabilityStemSeparation && job.Status == domain.JobCompleted && len(job.Result) > 0 {
+		if done, err := stems.Recorded(ctx, job.TrackID, job.ID); err != nil || !done {
+			if err := m.recordStems(ctx, p, job); err != nil {
+				slog.Error("Failed to record stem manifest", "track_id", job.TrackID, "job_id", job.ID, "error", err)
+			}
+		}
+	}
+	return job, nil
 }
 
 // TogglePlugin permite activar/desactivar un plugin
@@ -469,7 +474,12 @@ func (m *Manager) AnalyzeTrack(ctx context.Context, trackID uuid.UUID, cap domai
 
 	// 3. Dispatch to plugin (Priority Streaming since it's a direct manual analysis)
 	if cap == domain.CapabilityStemSeparation {
-		return m.client.CreateJob(ctx, p.BaseURL, trackID.String(), filePath, domain.PriorityStreaming, []string{"vocals", "drums", "bass", "other"})
+		job, err := m.client.CreateJob(ctx, p.BaseURL, trackID.String(), filePath, domain.PriorityStreaming, []string{"vocals", "drums", "bass", "other"})
+		if err != nil {
+			return nil, err
+		}
+		m.stemJobDispatched(ctx, job)
+		return job, nil
 	}
 	return m.client.CreateJob(ctx, p.BaseURL, trackID.String(), filePath, domain.PriorityStreaming, nil)
 }
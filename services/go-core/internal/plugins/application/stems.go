@@ -0,0 +1,94 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"sonantica-core/internal/plugins/domain"
+	"sonantica-core/stems"
+)
+
+// stemJobDispatched remembers the separation job of a track, so its stems
+// are recorded once it finishes
+func (m *Manager) stemJobDispatched(ctx context.Context, job *domain.JobResponse) {
+	if job == nil || job.ID == "" || job.TrackID == "" {
+		return
+	}
+	if err := stems.Dispatched(ctx, job.TrackID, job.ID); err != nil {
+		slog.Error("Failed to record stem separation job", "track_id", job.TrackID, "job_id", job.ID, "error", err)
+	}
+}
+
+// recordStems writes the stem manifest of a finished separation job. Jobs
+// that do not name their model are credited to the plugin's.
+func (m *Manager) recordStems(ctx context.Context, p *domain.AIPlugin, job *domain.JobResponse) error {
+	model := job.Model
+	if model == "" && p != nil {
+		model = p.Manifest.Model
+	}
+	manifest, err := stems.Record(ctx, job.TrackID, job.ID, model, job.Result)
+	if err != nil {
+		return err
+	}
+	slog.Info("Recorded stem manifest", "track_id", job.TrackID, "job_id", job.ID, "stems", len(manifest))
+	return nil
+}
+
+// SyncStems records the manifests of finished separation jobs nobody polled
+// and imports the stems of jobs the plugin no longer knows about from disk.
+// The scheduler runs it periodically.
+func (m *Manager) SyncStems(ctx context.Context) (int, error) {
+	jobs, err := stems.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Without an active plugin, stems already on disk are still imported
+	p, _ := m.GetPluginByCapability(domain.CapabilityStemSeparation)
+
+	recorded := 0
+	var errs []error
+	for _, j := range jobs {
+		if ctx.Err() != nil {
+			return recorded, ctx.Err()
+		}
+		job := &domain.JobResponse{ID: j.JobID, Status: domain.JobCompleted}
+		if p != nil {
+			status, err := m.client.GetJobStatus(ctx, p.BaseURL, j.JobID)
+			switch {
+			case errors.Is(err, domain.ErrJobNotFound):
+			case err != nil:
+				errs = append(errs, fmt.Errorf("job %s: %w", j.JobID, err))
+				continue
+			default:
+				job = status
+			}
+		}
+		job.TrackID = j.TrackID
+
+		switch job.Status {
+		case domain.JobFailed, domain.JobCancelled:
+			slog.Warn("Stem separation job did not finish", "track_id", j.TrackID, "job_id", j.JobID, "status", job.Status, "error", job.Error)
+			if err := stems.Abandon(ctx, j.TrackID, j.JobID); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		case domain.JobCompleted:
+		default:
+			continue // Still running
+		}
+		if job.Result == nil {
+			job.Result = stems.Scan(j.JobID)
+		}
+		if len(job.Result) == 0 {
+			continue
+		}
+		if err := m.recordStems(ctx, p, job); err != nil {
+			errs = append(errs, fmt.Errorf("job %s: %w", j.JobID, err))
+			continue
+		}
+		recorded++
+	}
+	return recorded, errors.Join(errs...)
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -50,6 +51,9 @@ type HealthStatus struct {
 	StorageUsage int64     `json:"storage_usage_bytes"` // New field
 }
 
+// ErrJobNotFound is returned for jobs the plugin does not know, e.g. expired ones
+var ErrJobNotFound = errors.New("job not found")
+
 // JobPriority representa la prioridad de un trabajo
 type JobPriority int
 
@@ -64,6 +68,7 @@ type JobResponse struct {
 	ID        string            `json:"id"`
 	TrackID   string            `json:"track_id"`
 	Status    JobStatus         `json:"status"`
+	Model     string            `json:"model,omitempty"`
 	Priority  JobPriority       `json:"priority"`
 	Progress  float64           `json:"progress"`
 	Result    map[string]string `json:"result,omitempty"`
@@ -137,6 +137,9 @@ func (c *PluginClient) GetJobStatus(ctx context.Context, baseURL string, jobID s
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", domain.ErrJobNotFound, jobID)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("status check failed: %d", resp.StatusCode)
 	}
@@ -0,0 +1,119 @@
+package loudness
+
+import "math"
+
+// truePeakTaps is the length of each phase of the oversampling filter
+const truePeakTaps = 12
+
+// biquad is a second order IIR filter in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// channel holds the K-weighting filter and the true peak oversampler of one channel
+type channel struct {
+	shelf, highpass biquad
+	phases          [][]float64 // Oversampling filter, one set of taps per output phase
+	history         []float64   // Last input samples, newest first
+}
+
+// newChannel designs the BS.1770 pre-filter (a high shelf modelling the head)
+// and RLB high-pass for the sample rate, as libebur128 does for rates other than 48 kHz
+func newChannel(rate int) *channel {
+	c := &channel{}
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / float64(rate))
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	c.shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / float64(rate))
+	a0 = 1 + k/q + k*k
+	c.highpass = biquad{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// BS.1770 oversamples to at least 192 kHz
+	factor := 1
+	switch {
+	case rate < 96000:
+		factor = 4
+	case rate < 192000:
+		factor = 2
+	}
+	c.phases = oversampler(factor)
+	c.history = make([]float64, truePeakTaps)
+	return c
+}
+
+// weight applies the K-weighting filter
+func (c *channel) weight(x float64) float64 {
+	return c.highpass.process(c.shelf.process(x))
+}
+
+// peak returns the largest absolute value of the samples interpolated up to x
+func (c *channel) peak(x float64) float64 {
+	copy(c.history[1:], c.history)
+	c.history[0] = x
+	p := math.Abs(x)
+	for _, taps := range c.phases {
+		var y float64
+		for i, t := range taps {
+			y += t * c.history[i]
+		}
+		p = max(p, math.Abs(y))
+	}
+	return p
+}
+
+// oversampler designs a windowed sinc interpolation filter for the factor,
+// split into its polyphase components
+func oversampler(factor int) [][]float64 {
+	if factor == 1 {
+		return nil
+	}
+	length := factor * truePeakTaps
+	center := float64(length-1) / 2
+	phases := make([][]float64, factor)
+	for p := range phases {
+		phases[p] = make([]float64, truePeakTaps)
+	}
+	for n := 0; n < length; n++ {
+		d := (float64(n) - center) / float64(factor)
+		h := 1.0
+		if d != 0 {
+			h = math.Sin(math.Pi*d) / (math.Pi * d)
+		}
+		window := 0.42 - 0.5*math.Cos(2*math.Pi*float64(n)/float64(length-1)) + 0.08*math.Cos(4*math.Pi*float64(n)/float64(length-1))
+		phases[n%factor][n/factor] = h * window
+	}
+	for _, taps := range phases {
+		var sum float64
+		for _, t := range taps {
+			sum += t
+		}
+		for i := range taps {
+			taps[i] /= sum
+		}
+	}
+	return phases
+}
@@ -0,0 +1,229 @@
+// Package loudness measures audio loudness as ITU-R BS.1770-4 and EBU R128
+// define it: K-weighted integrated loudness over gated 400 ms blocks and the
+// true peak of 4x oversampled audio. Gains follow ReplayGain 2.0, which
+// normalizes to -18 LUFS.
+package loudness
+
+import (
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	// Reference is the loudness, in LUFS, ReplayGain 2.0 gains bring audio to
+	Reference = -18.0
+
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU below the loudness of the blocks above the absolute gate
+	blockSteps   = 4     // A 400 ms block spans four 100 ms steps
+)
+
+var (
+	// ErrTooShort is returned for audio shorter than one 400 ms block
+	ErrTooShort = errors.New("audio too short to measure loudness")
+	// ErrSilent is returned when no block is louder than the absolute gate
+	ErrSilent = errors.New("audio is silent")
+)
+
+// Source yields decoded audio, one slice of samples in [-1, 1) per channel,
+// and io.EOF at the end. tags.PCM is a Source.
+type Source interface {
+	Read() ([][]float32, error)
+}
+
+// Result is the loudness of a stretch of audio
+type Result struct {
+	Integrated float64 // LUFS
+	TruePeak   float64 // Linear amplitude of the oversampled audio; may exceed 1
+	Duration   float64 // Seconds measured
+}
+
+// Gain returns the ReplayGain 2.0 gain in dB
+func (r Result) Gain() float64 {
+	return Reference - r.Integrated
+}
+
+// TruePeakDB returns the true peak in dBTP
+func (r Result) TruePeakDB() float64 {
+	return 20 * math.Log10(r.TruePeak)
+}
+
+// Measure reads length seconds of src, starting start seconds in; length <= 0
+// reads to the end. rate is the sample rate of src.
+func Measure(src Source, rate int, start, length float64) (*Result, error) {
+	if rate <= 0 {
+		return nil, errors.New("invalid sample rate")
+	}
+	skip := int64(start * float64(rate))
+	remaining := int64(math.MaxInt64)
+	if length > 0 {
+		remaining = int64(length * float64(rate))
+	}
+
+	m := &meter{rate: rate, step: max(rate/10, 1)}
+	for remaining > 0 {
+		block, err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(block) == 0 {
+			continue
+		}
+		n := int64(len(block[0]))
+		from := min(skip, n)
+		skip -= from
+		to := min(n, from+remaining)
+		remaining -= to - from
+		if from < to {
+			m.consume(block, int(from), int(to))
+		}
+	}
+	return m.result()
+}
+
+// meter accumulates the K-weighted energy of 100 ms steps and the true peak
+type meter struct {
+	rate     int
+	step     int // Samples per 100 ms step
+	channels []*channel
+	weights  []float64
+
+	stepEnergy float64 // Weighted sum of squares of the current step
+	stepFill   int
+	steps      []float64 // Mean energy of the last steps, up to blockSteps
+	blocks     []float64 // Energy of every 400 ms block
+	samples    int64
+	peak       float64
+}
+
+func (m *meter) consume(block [][]float32, from, to int) {
+	if m.channels == nil {
+		m.weights = channelWeights(len(block))
+		for range block {
+			m.channels = append(m.channels, newChannel(m.rate))
+		}
+	}
+	for i := from; i < to; i++ {
+		for ch, c := range m.channels {
+			if ch >= len(block) {
+				break
+			}
+			x := float64(block[ch][i])
+			y := c.weight(x)
+			m.stepEnergy += m.weights[ch] * y * y
+			if p := c.peak(x); p > m.peak {
+				m.peak = p
+			}
+		}
+		m.samples++
+		if m.stepFill++; m.stepFill == m.step {
+			m.endStep()
+		}
+	}
+}
+
+// endStep closes a 100 ms step and the 400 ms block ending with it
+func (m *meter) endStep() {
+	m.steps = append(m.steps, m.stepEnergy/float64(m.step))
+	m.stepEnergy, m.stepFill = 0, 0
+	if len(m.steps) > blockSteps {
+		m.steps = m.steps[1:]
+	}
+	if len(m.steps) == blockSteps {
+		var sum float64
+		for _, e := range m.steps {
+			sum += e
+		}
+		m.blocks = append(m.blocks, sum/blockSteps)
+	}
+}
+
+func (m *meter) result() (*Result, error) {
+	if len(m.blocks) == 0 {
+		return nil, ErrTooShort
+	}
+	integrated, ok := gatedLoudness(m.blocks)
+	if !ok {
+		return nil, ErrSilent
+	}
+	return &Result{
+		Integrated: integrated,
+		TruePeak:   m.peak,
+		Duration:   float64(m.samples) / float64(m.rate),
+	}, nil
+}
+
+// gatedLoudness applies the absolute and relative gates to the block energies
+func gatedLoudness(blocks []float64) (float64, bool) {
+	mean := func(threshold float64) (float64, bool) {
+		var sum float64
+		n := 0
+		for _, e := range blocks {
+			if energyToLoudness(e) > threshold {
+				sum += e
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, false
+		}
+		return sum / float64(n), true
+	}
+	ungated, ok := mean(absoluteGate)
+	if !ok {
+		return 0, false
+	}
+	gated, ok := mean(max(absoluteGate, energyToLoudness(ungated)+relativeGate))
+	if !ok {
+		return 0, false
+	}
+	return energyToLoudness(gated), true
+}
+
+func energyToLoudness(e float64) float64 {
+	return -0.691 + 10*math.Log10(e)
+}
+
+func loudnessToEnergy(l float64) float64 {
+	return math.Pow(10, (l+0.691)/10)
+}
+
+// channelWeights returns the BS.1770 weights of the channels in WAVE order:
+// surround channels count 1.41 and the LFE channel of 5.1 audio is ignored
+func channelWeights(n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 1
+	}
+	if n == 6 {
+		w[3], w[4], w[5] = 0, 1.41, 1.41
+	}
+	return w
+}
+
+// Track is the loudness of one track of an album
+type Track struct {
+	Loudness float64 // LUFS
+	Duration float64 // Seconds
+}
+
+// AlbumLoudness combines the loudness of an album's tracks, weighting the
+// energy of each by its duration, as if the album were measured in one piece
+func AlbumLoudness(tracks []Track) (float64, bool) {
+	var energy, duration float64
+	for _, t := range tracks {
+		if t.Duration <= 0 {
+			continue
+		}
+		energy += loudnessToEnergy(t.Loudness) * t.Duration
+		duration += t.Duration
+	}
+	if duration == 0 {
+		return 0, false
+	}
+	return energyToLoudness(energy / duration), true
+}
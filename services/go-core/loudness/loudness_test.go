@@ -0,0 +1,81 @@
+package loudness
+
+import (
+	"io"
+	"math"
+	"testing"
+)
+
+// tone is a Source playing a sine on every channel, after some silence
+type tone struct {
+	rate, channels    int
+	freq, amplitude   float64
+	phase             float64
+	silence, duration float64
+	pos               int
+}
+
+func (s *tone) Read() ([][]float32, error) {
+	total := int((s.silence + s.duration) * float64(s.rate))
+	if s.pos >= total {
+		return nil, io.EOF
+	}
+	n := min(4096, total-s.pos)
+	block := make([][]float32, s.channels)
+	for ch := range block {
+		block[ch] = make([]float32, n)
+		for i := range block[ch] {
+			t := float64(s.pos+i)/float64(s.rate) - s.silence
+			if t >= 0 {
+				block[ch][i] = float32(s.amplitude * math.Sin(2*math.Pi*s.freq*t+s.phase))
+			}
+		}
+	}
+	s.pos += n
+	return block, nil
+}
+
+func TestMeasure(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      *tone
+		lufs     float64
+		truePeak float64 // dBTP
+	}{
+		// EBU Tech 3341 case 1: a stereo 1 kHz sine peaking at -23 dBFS measures -23 LUFS
+		{"48 kHz", &tone{rate: 48000, channels: 2, freq: 1000, amplitude: math.Pow(10, -23.0/20), duration: 20}, -23, -23},
+		{"44.1 kHz", &tone{rate: 44100, channels: 2, freq: 1000, amplitude: math.Pow(10, -23.0/20), duration: 20}, -23, -23},
+		// Silence is gated out
+		{"leading silence", &tone{rate: 48000, channels: 2, freq: 1000, amplitude: math.Pow(10, -23.0/20), silence: 10, duration: 20}, -23, -23},
+		// Samples of a quarter rate sine at 45° miss its crests by 3 dB
+		{"intersample peak", &tone{rate: 44100, channels: 1, freq: 11025, amplitude: 1, phase: math.Pi / 4, duration: 5}, math.NaN(), 0},
+	}
+	for _, tt := range tests {
+		r, err := Measure(tt.src, tt.src.rate, 0, 0)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !math.IsNaN(tt.lufs) && math.Abs(r.Integrated-tt.lufs) > 0.1 {
+			t.Errorf("%s: %.2f LUFS, want %.1f", tt.name, r.Integrated, tt.lufs)
+		}
+		if math.Abs(r.TruePeakDB()-tt.truePeak) > 0.5 {
+			t.Errorf("%s: true peak %.2f dBTP, want %.1f", tt.name, r.TruePeakDB(), tt.truePeak)
+		}
+	}
+
+	if _, err := Measure(&tone{rate: 48000, channels: 2, duration: 5}, 48000, 0, 0); err != ErrSilent {
+		t.Errorf("silence: %v", err)
+	}
+	if _, err := Measure(&tone{rate: 48000, channels: 2, freq: 1000, amplitude: 0.5, duration: 0.3}, 48000, 0, 0); err != ErrTooShort {
+		t.Errorf("300 ms: %v", err)
+	}
+}
+
+func TestAlbumLoudness(t *testing.T) {
+	l, ok := AlbumLoudness([]Track{{-10, 100}, {-20, 100}, {-99, 0}})
+	// Energies average to (10 + 1) / 2 of -20 LUFS
+	if want := -20 + 10*math.Log10(5.5); !ok || math.Abs(l-want) > 1e-9 {
+		t.Errorf("album loudness = %v, want %v", l, want)
+	}
+}
@@ -2,26 +2,36 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"sonantica-core/analytics"
 	"sonantica-core/analytics/handlers"
+	"sonantica-core/analytics/storage"
 	"sonantica-core/api"
 	"sonantica-core/cache"
 	"sonantica-core/config"
+	"sonantica-core/covers"
 	"sonantica-core/database"
 	smart_scanner "sonantica-core/internal/analytics/scanner"
 	"sonantica-core/internal/plugins/application"
 	domain "sonantica-core/internal/plugins/domain"
 	"sonantica-core/internal/plugins/infrastructure"
 	"sonantica-core/scanner"
+	"sonantica-core/scheduler"
 	"sonantica-core/shared"
 	"sonantica-core/shared/logger"
 	"sonantica-core/shared/metrics"
+	"sonantica-core/stems"
+	"sonantica-core/transcode"
+	"sonantica-core/urlsign"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -37,6 +47,11 @@ func main() {
 	// 2. Initialize Logger
 	logger.Init(cfg.LogLevel, cfg.LogFormat, cfg.LogEnabled)
 	slog.Info("🚀 Starting Sonántica Core", "version", "0.2.0")
+	if cfg.MediaAccess != "open" && cfg.MediaSignToken == "" {
+		// Without it no media URL could be signed, so nothing could be played
+		slog.Error("MEDIA_SIGN_TOKEN is required unless MEDIA_ACCESS is open")
+		os.Exit(1)
+	}
 
 	// 3. Initialize Database
 	if err := database.Connect(cfg.PostgresURL); err != nil {
@@ -57,8 +72,35 @@ func main() {
 	scanner.InitRedis(cfg.RedisHost, cfg.RedisPort, cfg.RedisPassword)
 
 	// 6. Start Scanner
-	slog.Info("Starting Scanner Scheduler", "path", cfg.MediaPath, "interval", "1h")
-	scanner.StartScanner(cfg.MediaPath, 1*time.Hour)
+	slog.Info("Starting Scanner Scheduler", "roots", len(cfg.LibraryRoots), "mode", cfg.ScanMode, "content_hash", cfg.ScanContentHash, "read_tags", cfg.ScanReadTags, "analysis", cfg.ScanAnalysis, "integrity", cfg.ScanIntegrity, "fingerprint", cfg.ScanFingerprint, "loudness", cfg.ScanLoudness, "covers", cfg.ScanCovers)
+	scanner.MediaPath = cfg.MediaPath
+	scanner.HashContent = cfg.ScanContentHash
+	scanner.MissingGracePeriod = cfg.ScanMissingGrace
+	scanner.ReadTags = cfg.ScanReadTags
+	scanner.DispatchAnalysis = cfg.ScanAnalysis
+	scanner.VerifyIntegrity = cfg.ScanIntegrity
+	scanner.Fingerprint = cfg.ScanFingerprint
+	scanner.MeasureLoudness = cfg.ScanLoudness
+	scanner.ExtractCovers = cfg.ScanCovers
+	// ffmpeg decodes the lossy files scans fingerprint and measure, and transcodes streams
+	ffmpeg := &transcode.FFmpeg{Binary: cfg.TranscodeFFmpeg}
+	if ffmpeg.Available() {
+		scanner.FFmpeg = ffmpeg
+	}
+	covers.Dir = cfg.CoverPath
+	stems.Dir = cfg.StemsPath
+	roots := make([]scanner.Root, 0, len(cfg.LibraryRoots))
+	for _, r := range cfg.LibraryRoots {
+		roots = append(roots, scanner.Root{
+			Name:     r.Name,
+			Path:     r.Path,
+			Include:  r.Include,
+			Exclude:  r.Exclude,
+			Enabled:  r.IsEnabled(),
+			Schedule: r.ScanSchedule(cfg.ScheduleLibraryScan),
+		})
+	}
+	scanner.StartScanner(roots, scanner.ParseMode(cfg.ScanMode), cfg.ScanWatchDebounce)
 
 	// 6.0 Initialize Smart Scanner
 	smartScanner := smart_scanner.NewSmartScanner(database.DB, cache.GetClient())
@@ -118,8 +160,48 @@ func main() {
 		}
 	}
 
-	// Start health monitoring (every 5 minutes)
-	pluginManager.StartMonitoring(ctx, 5*time.Minute)
+	// 6.2 Start Background Jobs
+	registerJobs(cfg, roots, smartScanner, pluginManager)
+	scheduler.Start(ctx)
+
+	// 6.3 Transcoding, which needs ffmpeg; without it streams are sent as they are stored
+	if ffmpeg.Available() {
+		api.Transcodes = transcode.NewCache(ffmpeg, cfg.TranscodeCachePath, int64(cfg.TranscodeCacheSize)<<20)
+	} else {
+		slog.Warn("ffmpeg not found, transcoding is disabled", "binary", cfg.TranscodeFFmpeg)
+	}
+	for client, p := range cfg.TranscodeProfiles {
+		if _, ok := transcode.Formats[p.Format]; p.Format != "" && !ok {
+			slog.Warn("Ignoring transcoding profile with an unknown format", "client", client, "format", p.Format)
+			continue
+		}
+		api.StreamProfiles[strings.ToLower(client)] = transcode.Profile{Format: p.Format, MaxBitrate: p.MaxBitrate}
+	}
+
+	// 6.4 Media access; stream and cover URLs need a signature unless access is open
+	var signer *urlsign.Signer
+	if cfg.MediaAccess != "open" {
+		if cfg.MediaAccess != "signed" {
+			slog.Warn("Unknown MEDIA_ACCESS, requiring signed media URLs", "media_access", cfg.MediaAccess)
+		}
+		key := cfg.MediaSigningKey
+		if key == "" {
+			b := make([]byte, 32)
+			_, _ = rand.Read(b)
+			key = hex.EncodeToString(b)
+			slog.Warn("MEDIA_SIGNING_KEY is not set, signed media URLs will not survive a restart")
+		}
+		signer = urlsign.New(key)
+		api.MediaSigner = signer
+		api.MediaURLTTL = cfg.MediaURLTTL
+		api.MediaSignToken = cfg.MediaSignToken
+	}
+	protectMedia := func(h http.Handler) http.Handler {
+		if signer == nil {
+			return h
+		}
+		return signer.Middleware(h)
+	}
 
 	// 7. Initialize Router
 	r := chi.NewRouter()
@@ -136,7 +218,7 @@ func main() {
 		AllowedOrigins:   cfg.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Range", "Origin"},
-		ExposedHeaders:   []string{"Link", "Content-Length", "Content-Range", "Accept-Ranges"},
+		ExposedHeaders:   []string{"Link", "Content-Length", "Content-Range", "Accept-Ranges", "X-ReplayGain-Mode", "X-ReplayGain-Gain", "X-ReplayGain-Peak"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -148,8 +230,15 @@ func main() {
 	// 9. Routes
 	r.HandleFunc("/metrics", promhttp.Handler().ServeHTTP)
 	r.Get("/health", healthCheck)
-	r.Get("/stream/{id}", api.StreamTrack)
-	r.Get("/api/cover/*", api.GetAlbumCover)
+	r.Group(func(r chi.Router) {
+		r.Use(protectMedia)
+		r.Get("/stream/{id}", api.StreamTrack)
+		r.Get("/stream/{id}/hls/master.m3u8", api.GetHLSMaster)
+		r.Get("/stream/{id}/hls/{bitrate}/index.m3u8", api.GetHLSPlaylist)
+		r.Get("/stream/{id}/hls/{bitrate}/{segment:[0-9]+}.ts", api.GetHLSSegment)
+		r.Get("/api/cover/*", api.GetAlbumCover)
+	})
+	r.Post("/api/media/sign", api.SignMediaURLs)
 
 	// Analytics Routes
 	analyticsHandler := handlers.NewAnalyticsHandler()
@@ -169,11 +258,16 @@ func main() {
 
 	r.Route("/api/library", func(r chi.Router) {
 		r.Get("/tracks", api.GetTracks)
+		r.Get("/tracks/{id}/acoustic-matches", api.GetAcousticMatches)
+		r.Get("/tracks/{id}/stems", api.GetTrackStems)
 		r.Get("/artists", api.GetArtists)
 		r.Get("/artists/{id}/tracks", api.GetTracksByArtist)
 		r.Get("/albums", api.GetAlbums)
 		r.Get("/albums/{id}/tracks", api.GetTracksByAlbum)
 		r.Get("/alphabet-index", api.GetAlphabetIndex)
+		r.Get("/roots", api.GetLibraryRoots)
+		r.Get("/duplicates", api.GetDuplicates)
+		r.Post("/duplicates/merge", api.MergeDuplicates)
 
 		// Playlists
 		r.Get("/playlists", api.GetPlaylists)
@@ -182,9 +276,23 @@ func main() {
 		r.Delete("/playlists/{id}", api.DeletePlaylist)
 	})
 
+	r.Route("/api/admin/jobs", func(r chi.Router) {
+		r.Get("/", api.GetJobs)
+		r.Get("/{name}", api.GetJob)
+		r.Post("/{name}/run", api.RunJob)
+	})
+
 	r.Route("/api/scan", func(r chi.Router) {
 		r.Post("/start", api.ScanLibrary)
+		r.Post("/cancel", api.CancelScan)
+		r.Post("/pause", api.PauseScan)
+		r.Post("/resume", api.ResumeScan)
 		r.Get("/status", api.GetScanStatus)
+		r.Get("/events", api.StreamScanEvents)
+		r.Get("/runs", api.GetScanRuns)
+		r.Get("/runs/{id}", api.GetScanRun)
+		r.Get("/quarantine", api.GetQuarantine)
+		r.Delete("/quarantine", api.ReleaseQuarantine)
 	})
 
 	// Static Assets
@@ -195,8 +303,8 @@ func main() {
 			h.ServeHTTP(w, r)
 		})
 	}
-	r.Handle("/covers/*", http.StripPrefix("/covers/", staticWithCache(coverServer)))
-	r.Handle("/api/covers/*", http.StripPrefix("/api/covers/", staticWithCache(coverServer)))
+	r.Handle("/covers/*", protectMedia(http.StripPrefix("/covers/", staticWithCache(coverServer))))
+	r.Handle("/api/covers/*", protectMedia(http.StripPrefix("/api/covers/", staticWithCache(coverServer))))
 
 	// 10. Start Server
 	slog.Info("Sonántica High-Performance Core Listening", "port", cfg.Port)
@@ -205,6 +313,95 @@ func main() {
 	}
 }
 
+// registerJobs schedules the periodic background work of the service.
+// Jobs with an invalid schedule are logged and left out.
+func registerJobs(cfg *config.Config, roots []scanner.Root, smartScanner *smart_scanner.SmartScanner, pluginManager *application.Manager) {
+	register := func(name, spec, description string, run func(context.Context) error) {
+		if err := scheduler.Register(name, spec, description, run); err != nil {
+			slog.Error("Failed to register job", "job", name, "error", err)
+		}
+	}
+
+	for _, root := range roots {
+		if !root.Enabled {
+			continue
+		}
+		register(scanner.JobName(root.Name), root.Schedule, "Full scan of library root "+root.Name, func(ctx context.Context) error {
+			scanner.ScheduledScan(root)
+			return nil
+		})
+	}
+	register("analysis-backfill", cfg.ScheduleAnalysisBackfill, "Queue tracks still missing analysis", func(ctx context.Context) error {
+		smartScanner.Backfill(ctx)
+		return nil
+	})
+	register("cache-warmup", cfg.ScheduleCacheWarmup, "Rebuild invalidated library listings in the cache", api.WarmCache)
+	register("retention", cfg.ScheduleRetention, "Delete scan history and analytics events past their retention", func(ctx context.Context) error {
+		return runRetention(ctx, cfg)
+	})
+	register("integrity-check", cfg.ScheduleIntegrityCheck, "Verify the audio of tracks never checked for corruption", func(ctx context.Context) error {
+		checked, corrupt, err := scanner.VerifyBacklog(ctx)
+		if checked > 0 {
+			slog.Info("Verified track integrity", "files", checked, "corrupt", corrupt)
+		}
+		return err
+	})
+	register("fingerprint", cfg.ScheduleFingerprint, "Fingerprint tracks missing an acoustic fingerprint", func(ctx context.Context) error {
+		files, matched, err := scanner.FingerprintBacklog(ctx)
+		if files > 0 {
+			slog.Info("Fingerprinted tracks", "files", files, "matches", matched)
+		}
+		return err
+	})
+	register("loudness", cfg.ScheduleLoudness, "Measure the loudness of tracks without ReplayGain tags", func(ctx context.Context) error {
+		measured, err := scanner.LoudnessBacklog(ctx)
+		if measured > 0 {
+			slog.Info("Measured track loudness", "tracks", measured)
+		}
+		return err
+	})
+	register("covers", cfg.ScheduleCovers, "Extract the cover art of albums never checked", func(ctx context.Context) error {
+		checked, found, err := scanner.CoverBacklog(ctx)
+		if checked > 0 {
+			slog.Info("Checked album cover art", "albums", checked, "covers", found)
+		}
+		return err
+	})
+	register("stems", cfg.ScheduleStems, "Record the stems of finished separation jobs", func(ctx context.Context) error {
+		recorded, err := pluginManager.SyncStems(ctx)
+		if recorded > 0 {
+			slog.Info("Recorded stem manifests", "tracks", recorded)
+		}
+		return err
+	})
+	register("plugin-health", cfg.SchedulePluginHealth, "Poll the health of registered plugins", func(ctx context.Context) error {
+		pluginManager.CheckHealth(ctx)
+		return nil
+	})
+}
+
+// runRetention prunes the histories that have a retention period; zero keeps them forever
+func runRetention(ctx context.Context, cfg *config.Config) error {
+	var errs []error
+	if cfg.ScanRunRetention > 0 {
+		n, err := scanner.PruneRuns(ctx, time.Now().Add(-cfg.ScanRunRetention))
+		if err != nil {
+			errs = append(errs, err)
+		} else if n > 0 {
+			slog.Info("Pruned scan runs", "count", n, "retention", cfg.ScanRunRetention.String())
+		}
+	}
+	if cfg.AnalyticsRetentionDays > 0 {
+		n, err := storage.NewAnalyticsStorage().PruneEvents(ctx, time.Now().AddDate(0, 0, -cfg.AnalyticsRetentionDays))
+		if err != nil {
+			errs = append(errs, err)
+		} else if n > 0 {
+			slog.Info("Pruned analytics events", "count", n, "retention_days", cfg.AnalyticsRetentionDays)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func healthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
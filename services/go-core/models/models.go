@@ -17,6 +17,15 @@ type Track struct {
 	Bitrate         *int       `json:"bitrate" db:"bitrate"`
 	SampleRate      *int       `json:"sampleRate" db:"sample_rate"`
 	Channels        *int       `json:"channels" db:"channels"`
+	BitDepth        *int       `json:"bitDepth" db:"bit_depth"`
+	Codec           *string    `json:"codec" db:"codec"`                // Detected from the content, e.g. alac or aac for .m4a
+	Container       *string    `json:"container" db:"container"`        // flac, mpeg, mp4, ogg, wav or aiff
+	CodecProfile    *string    `json:"codecProfile" db:"codec_profile"` // CBR/ABR/VBR for MP3, LC/HE-AAC/... for AAC
+	Lossless        *bool      `json:"lossless" db:"lossless"`
+	Encoder         *string    `json:"encoder" db:"encoder"`
+	FileSize        *int64     `json:"fileSize" db:"file_size"`
+	FileModTime     *time.Time `json:"fileModTime" db:"file_mtime"`
+	ContentHash     *string    `json:"contentHash,omitempty" db:"content_hash"`
 	TrackNumber     *int       `json:"trackNumber" db:"track_number"`
 	DiscNumber      *int       `json:"discNumber" db:"disc_number"`
 	Genre           *string    `json:"genre" db:"genre"`
@@ -28,6 +37,16 @@ type Track struct {
 	AIMetadata      any        `json:"aiMetadata,omitempty" db:"ai_metadata"`
 	HasStems        bool       `json:"hasStems" db:"has_stems"`
 	HasEmbeddings   bool       `json:"hasEmbeddings" db:"has_embeddings"`
+	Status          string     `json:"status" db:"status"`        // active, missing, invalid (the file failed validation) or deleted
+	MediaKind       string     `json:"mediaKind" db:"media_kind"` // music, audiobook or podcast
+	Integrity       *string    `json:"integrity" db:"integrity"`  // ok, corrupt or unverified; nil until checked
+	IntegrityIssues []string   `json:"integrityIssues,omitempty" db:"integrity_issues"`
+	Loudness        *float64   `json:"loudness" db:"loudness_lufs"`          // Integrated loudness in LUFS
+	TruePeak        *float64   `json:"truePeak" db:"true_peak"`              // dBTP
+	TrackGain       *float64   `json:"trackGain" db:"replaygain_track_gain"` // ReplayGain 2.0, dB to -18 LUFS
+	TrackPeak       *float64   `json:"trackPeak" db:"replaygain_track_peak"` // Linear, 1.0 is full scale
+	AlbumGain       *float64   `json:"albumGain" db:"replaygain_album_gain"`
+	AlbumPeak       *float64   `json:"albumPeak" db:"replaygain_album_peak"`
 	// Joined fields for API response
 	ArtistName    *string `json:"artist,omitempty" db:"artist_name"`
 	AlbumTitle    *string `json:"album,omitempty" db:"album_title"`
@@ -41,6 +60,7 @@ type Album struct {
 	ReleaseDate *string    `json:"releaseDate" db:"release_date"`
 	CoverArt    *string    `json:"coverArt" db:"cover_art"`
 	Genre       *string    `json:"genre" db:"genre"`
+	Compilation bool       `json:"isCompilation" db:"is_compilation"`
 	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
 	// Joined fields
 	ArtistName *string `json:"artist,omitempty" db:"artist_name"`
@@ -23,7 +23,9 @@ type Playlist struct {
 	CreatedAt    time.Time    `json:"createdAt" db:"created_at"`
 	UpdatedAt    time.Time    `json:"updatedAt" db:"updated_at"`
 	SnapshotDate *time.Time   `json:"snapshotDate,omitempty" db:"snapshot_date"`
-	Rules        *string      `json:"rules,omitempty" db:"rules"` // Stored as JSON string
+	Rules        *string      `json:"rules,omitempty" db:"rules"`            // Stored as JSON string
+	SourcePath   *string      `json:"sourcePath,omitempty" db:"source_path"` // Playlist file it was imported from
+	Unresolved   []string     `json:"unresolved,omitempty" db:"unresolved"`  // Entries of the file not found in the library
 
 	// Enriched fields
 	TrackCount int         `json:"trackCount,omitempty"`
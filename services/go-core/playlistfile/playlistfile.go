@@ -0,0 +1,259 @@
+// Package playlistfile reads the playlist files found next to music
+// libraries: M3U/M3U8, PLS and XSPF. It only decodes the files; resolving
+// their entries against the library is up to the caller.
+package playlistfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrEmpty is returned for playlists without a single entry
+var ErrEmpty = errors.New("playlist has no entries")
+
+// Playlist is the decoded content of a playlist file
+type Playlist struct {
+	Name    string // Title stored in the file, empty when it has none
+	Entries []Entry
+}
+
+// Entry is a single item of a playlist
+type Entry struct {
+	// Location as written in the file: a relative or absolute path, possibly
+	// using Windows separators, or a URL for remote streams. file:// URLs are
+	// decoded into plain paths.
+	Location string
+	Title    string
+	Artist   string
+	Duration float64 // Seconds, 0 when unknown
+}
+
+// Remote reports whether the entry points at a stream rather than a file
+func (e Entry) Remote() bool {
+	return strings.Contains(e.Location, "://")
+}
+
+// IsPlaylist reports whether a file name has a supported playlist extension
+func IsPlaylist(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8", ".pls", ".xspf":
+		return true
+	}
+	return false
+}
+
+// Parse decodes a playlist, choosing the format by the file extension
+func Parse(name string, data []byte) (*Playlist, error) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+
+	var pl *Playlist
+	var err error
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8":
+		pl = parseM3U(decodeText(data))
+	case ".pls":
+		pl = parsePLS(decodeText(data))
+	case ".xspf":
+		pl, err = parseXSPF(data)
+	default:
+		return nil, fmt.Errorf("unsupported playlist format: %s", filepath.Ext(name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(pl.Entries) == 0 {
+		return nil, ErrEmpty
+	}
+	return pl, nil
+}
+
+// decodeText returns the text of a playlist. Plain .m3u and .pls files carry
+// no encoding; those that are not valid UTF-8 are decoded as Latin-1.
+func decodeText(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// parseM3U reads plain and extended M3U. #EXTINF lines describe the entry
+// that follows them; other directives and comments are skipped.
+func parseM3U(text string) *Playlist {
+	pl := &Playlist{}
+	var pending Entry
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			pending = parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			pl.Name = strings.TrimSpace(strings.TrimPrefix(line, "#PLAYLIST:"))
+		case strings.HasPrefix(line, "#"):
+		default:
+			pending.Location = decodeLocation(line, false)
+			pl.Entries = append(pl.Entries, pending)
+			pending = Entry{}
+		}
+	}
+	return pl
+}
+
+// parseExtInf reads "duration[ attributes],Artist - Title"
+func parseExtInf(value string) Entry {
+	var e Entry
+	info, display, _ := strings.Cut(value, ",")
+	if fields := strings.Fields(info); len(fields) > 0 {
+		if d, err := strconv.ParseFloat(fields[0], 64); err == nil && d > 0 {
+			e.Duration = d
+		}
+	}
+	e.Artist, e.Title = splitDisplay(display)
+	return e
+}
+
+// splitDisplay splits the "Artist - Title" display names written by most players
+func splitDisplay(display string) (artist, title string) {
+	display = strings.TrimSpace(display)
+	if artist, title, ok := strings.Cut(display, " - "); ok {
+		return strings.TrimSpace(artist), strings.TrimSpace(title)
+	}
+	return "", display
+}
+
+// parsePLS reads the [playlist] section of a PLS file. Entries are ordered
+// by their number rather than by the order of the lines.
+func parsePLS(text string) *Playlist {
+	entries := make(map[int]*Entry)
+	sc := bufio.NewScanner(strings.NewReader(text))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if field == "" || err != nil {
+			continue
+		}
+		e, ok := entries[n]
+		if !ok {
+			e = &Entry{}
+			entries[n] = e
+		}
+		switch field {
+		case "file":
+			e.Location = decodeLocation(value, false)
+		case "title":
+			e.Artist, e.Title = splitDisplay(value)
+		case "length":
+			if d, err := strconv.ParseFloat(value, 64); err == nil && d > 0 {
+				e.Duration = d
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(entries))
+	for n, e := range entries {
+		if e.Location != "" {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	pl := &Playlist{}
+	for _, n := range numbers {
+		pl.Entries = append(pl.Entries, *entries[n])
+	}
+	return pl
+}
+
+type xspfDocument struct {
+	Title  string `xml:"title"`
+	Tracks []struct {
+		Locations []string `xml:"location"`
+		Title     string   `xml:"title"`
+		Creator   string   `xml:"creator"`
+		Duration  int64    `xml:"duration"` // Milliseconds
+	} `xml:"trackList>track"`
+}
+
+// parseXSPF reads an XSPF document. Tracks may list several locations; the
+// first one is used.
+func parseXSPF(data []byte) (*Playlist, error) {
+	var doc xspfDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid XSPF: %w", err)
+	}
+
+	pl := &Playlist{Name: strings.TrimSpace(doc.Title)}
+	for _, t := range doc.Tracks {
+		if len(t.Locations) == 0 {
+			continue
+		}
+		pl.Entries = append(pl.Entries, Entry{
+			Location: decodeLocation(strings.TrimSpace(t.Locations[0]), true),
+			Title:    strings.TrimSpace(t.Title),
+			Artist:   strings.TrimSpace(t.Creator),
+			Duration: float64(t.Duration) / 1000,
+		})
+	}
+	return pl, nil
+}
+
+// decodeLocation turns file:// URLs into paths. escaped marks formats whose
+// relative locations are URIs (XSPF) and need unescaping; M3U and PLS paths
+// are taken literally. Other URLs are kept as they are.
+func decodeLocation(loc string, escaped bool) string {
+	lower := strings.ToLower(loc)
+	if strings.HasPrefix(lower, "file:") {
+		u, err := url.Parse(loc)
+		if err != nil {
+			return loc
+		}
+		p := u.Path
+		if u.Host != "" && u.Host != "localhost" {
+			// UNC share: file://server/share/file.flac
+			p = "//" + u.Host + p
+		}
+		// file:///C:/Music/... carries a drive letter after the leading slash
+		if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+			p = p[1:]
+		}
+		return p
+	}
+	if strings.Contains(loc, "://") {
+		return loc
+	}
+	if escaped {
+		if p, err := url.PathUnescape(loc); err == nil {
+			return p
+		}
+	}
+	return loc
+}
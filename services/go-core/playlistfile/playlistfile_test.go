@@ -0,0 +1,98 @@
+package playlistfile
+
+import "testing"
+
+func TestParseM3U(t *testing.T) {
+	data := "\xEF\xBB\xBF#EXTM3U\r\n" +
+		"#PLAYLIST:Road Trip\r\n" +
+		"#EXTINF:354,Pink Floyd - Time\r\n" +
+		"..\\Pink Floyd\\The Dark Side of the Moon\\04 - Time.flac\r\n" +
+		"\r\n" +
+		"# a comment\r\n" +
+		"/media/Queen/Innuendo/01 Innuendo.mp3\r\n" +
+		"http://radio.example.com/stream\r\n"
+
+	pl, err := Parse("trip.m3u8", []byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if pl.Name != "Road Trip" || len(pl.Entries) != 3 {
+		t.Fatalf("playlist = %+v", pl)
+	}
+	first := pl.Entries[0]
+	if first.Location != `..\Pink Floyd\The Dark Side of the Moon\04 - Time.flac` || first.Artist != "Pink Floyd" || first.Title != "Time" || first.Duration != 354 {
+		t.Errorf("entry 1 = %+v", first)
+	}
+	if pl.Entries[1].Title != "" || pl.Entries[1].Remote() || !pl.Entries[2].Remote() {
+		t.Errorf("entries = %+v", pl.Entries)
+	}
+
+	// Latin-1 is decoded rather than mangled
+	pl, err = Parse("old.m3u", []byte("Bj\xF6rk/Debut/01 Human Behaviour.mp3\n"))
+	if err != nil || pl.Entries[0].Location != "Björk/Debut/01 Human Behaviour.mp3" {
+		t.Errorf("Latin-1 entry = %+v, %v", pl, err)
+	}
+
+	if _, err := Parse("empty.m3u", []byte("#EXTM3U\n")); err != ErrEmpty {
+		t.Errorf("err = %v, want ErrEmpty", err)
+	}
+}
+
+func TestParsePLS(t *testing.T) {
+	data := "[playlist]\n" +
+		"File2=Queen/Innuendo/02 I'm Going Slightly Mad.mp3\n" +
+		"Title2=Queen - I'm Going Slightly Mad\n" +
+		"File1=Queen/Innuendo/01 Innuendo.mp3\n" +
+		"Length1=392\n" +
+		"NumberOfEntries=2\n" +
+		"Version=2\n"
+
+	pl, err := Parse("queen.pls", []byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(pl.Entries) != 2 || pl.Entries[0].Location != "Queen/Innuendo/01 Innuendo.mp3" || pl.Entries[0].Duration != 392 {
+		t.Fatalf("entries = %+v", pl.Entries)
+	}
+	if e := pl.Entries[1]; e.Artist != "Queen" || e.Title != "I'm Going Slightly Mad" {
+		t.Errorf("entry 2 = %+v", e)
+	}
+}
+
+func TestParseXSPF(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Favourites</title>
+  <trackList>
+    <track>
+      <location>file:///media/Bj%C3%B6rk/Debut/01%20Human%20Behaviour.flac</location>
+      <creator>Björk</creator>
+      <title>Human Behaviour</title>
+      <duration>252000</duration>
+    </track>
+    <track>
+      <location>file:///C:/Music/Queen/Innuendo/01%20Innuendo.mp3</location>
+    </track>
+    <track>
+      <location>Queen/Innuendo/02%20Headlong.mp3</location>
+    </track>
+  </trackList>
+</playlist>`
+
+	pl, err := Parse("favourites.xspf", []byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if pl.Name != "Favourites" || len(pl.Entries) != 3 {
+		t.Fatalf("playlist = %+v", pl)
+	}
+	want := []string{"/media/Björk/Debut/01 Human Behaviour.flac", "C:/Music/Queen/Innuendo/01 Innuendo.mp3", "Queen/Innuendo/02 Headlong.mp3"}
+	for i, loc := range want {
+		if pl.Entries[i].Location != loc {
+			t.Errorf("entry %d location = %q, want %q", i+1, pl.Entries[i].Location, loc)
+		}
+	}
+	if e := pl.Entries[0]; e.Artist != "Björk" || e.Duration != 252 {
+		t.Errorf("entry 1 = %+v", e)
+	}
+}
@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+
+	"sonantica-core/tags"
+	"sonantica-core/transcode"
+)
+
+// FFmpeg decodes the files tags.OpenPCM cannot, such as lossy ones, to
+// fingerprint and measure them; nil when ffmpeg is not available
+var FFmpeg *transcode.FFmpeg
+
+// audio is a decoded file, a tags.PCM or a transcode.Audio
+type audio interface {
+	Read() ([][]float32, error)
+	Close() error
+}
+
+// openAudio opens the file at path for decoding and returns its sample rate.
+// FLAC, WAV and AIFF are decoded natively, anything else through FFmpeg;
+// without it those return tags.ErrUnsupported.
+func openAudio(ctx context.Context, path string) (audio, int, error) {
+	pcm, err := tags.OpenPCM(path)
+	if err == nil {
+		return pcm, pcm.SampleRate, nil
+	}
+	if !errors.Is(err, tags.ErrUnsupported) || FFmpeg == nil {
+		return nil, 0, err
+	}
+	m, err := tags.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	rate, channels := m.SampleRate, m.Channels
+	if rate <= 0 {
+		rate = 44100
+	}
+	if channels <= 0 {
+		channels = 2
+	}
+	a, err := FFmpeg.Decode(ctx, path, rate, channels)
+	if err != nil {
+		return nil, 0, err
+	}
+	return a, rate, nil
+}
@@ -0,0 +1,222 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"sonantica-core/cache"
+	"sonantica-core/covers"
+	"sonantica-core/database"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// coverBatch is how many albums CoverBacklog loads per query
+const coverBatch = 50
+
+// extractCovers looks for artwork in a new or changed file and its folder and
+// gives the albums of its tracks the best cover found
+func (dbSink) extractCovers(p *scanPass, entry ManifestEntry, trackPath string) {
+	path := filepath.Join(p.root.Path, entry.FilePath)
+	best, err := p.coverCandidate(path)
+	if err != nil {
+		slog.Warn("Failed to read cover art", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(entry.FilePath, "covers", err)
+		return
+	}
+	albums, err := fileAlbums(p.ctx, trackPath)
+	if err != nil {
+		slog.Warn("Failed to load albums for cover art", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(entry.FilePath, "covers", err)
+		return
+	}
+	for _, albumID := range albums {
+		if _, err := updateAlbumCover(p.ctx, albumID, best); err != nil {
+			slog.Warn("Failed to record album cover", "file", entry.FilePath, "album_id", albumID, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(entry.FilePath, "covers", err)
+		}
+	}
+}
+
+// coverCandidate returns the best of the pictures embedded in the file at path
+// and the images in its folder. Folder images are read once per directory,
+// since a pass walks an album's files one after another.
+func (p *scanPass) coverCandidate(path string) (*covers.Image, error) {
+	embedded, err := covers.Embedded(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	if dir != p.lastCoverDir {
+		folder, err := covers.Folder(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		p.lastCoverDir, p.lastCoverImages = dir, folder
+	}
+	return covers.Best(append(embedded, p.lastCoverImages...)...), nil
+}
+
+// fileAlbums returns the albums of the tracks read from a file
+func fileAlbums(ctx context.Context, trackPath string) ([]string, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT DISTINCT album_id::text FROM tracks
+		WHERE file_path = $1 AND album_id IS NOT NULL AND status <> 'deleted'
+	`, trackPath)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// updateAlbumCover stores img and makes it the album's cover unless the
+// current one is better. Covers set by the analysis worker carry no details
+// and are always replaced. A nil img only records that the album was checked.
+// It reports whether the cover changed.
+func updateAlbumCover(ctx context.Context, albumID string, img *covers.Image) (bool, error) {
+	var hasCover bool
+	var source, hash *string
+	var width, height *int
+	var front *bool
+	err := database.DB.QueryRow(ctx, `
+		SELECT cover_art IS NOT NULL AND cover_art <> '', cover_source, cover_hash, cover_width, cover_height, cover_front
+		FROM albums WHERE id = $1
+	`, albumID).Scan(&hasCover, &source, &hash, &width, &height, &front)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load album cover: %w", err)
+	}
+
+	replace := img != nil && (!hasCover || source == nil)
+	if img != nil && !replace && (hash == nil || *hash != img.Hash) {
+		current := &covers.Image{Source: *source}
+		if width != nil && height != nil {
+			current.Width, current.Height = *width, *height
+		}
+		if front != nil {
+			current.Front = *front
+		}
+		replace = covers.Better(img, current)
+	}
+	if !replace {
+		_, err := database.DB.Exec(ctx, `UPDATE albums SET cover_checked_at = NOW() WHERE id = $1`, albumID)
+		return false, err
+	}
+
+	path, err := covers.Save(img)
+	if err != nil {
+		return false, fmt.Errorf("failed to save cover: %w", err)
+	}
+	// Only replace the cover read above, in case another pass got there first
+	tag, err := database.DB.Exec(ctx, `
+		UPDATE albums SET
+			cover_art = $2, cover_source = $3, cover_hash = $4, cover_width = $5, cover_height = $6,
+			cover_front = $7, cover_checked_at = NOW()
+		WHERE id = $1 AND cover_hash IS NOT DISTINCT FROM $8
+	`, albumID, path, img.Source, img.Hash, img.Width, img.Height, img.Front, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to record album cover: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	_ = cache.InvalidateAlbumCover(ctx, albumID)
+	if err := covers.RemoveVariants(albumID); err != nil {
+		slog.Warn("Failed to remove cover variants", "album_id", albumID, "error", err)
+	}
+	return true, nil
+}
+
+// CoverBacklog looks for the artwork of albums never checked, such as those
+// indexed before cover extraction was enabled, reading the files of their
+// active tracks and their folders. It stops when ctx is cancelled and reports
+// how many albums were checked and how many got a new cover.
+func CoverBacklog(ctx context.Context) (checked, found int, err error) {
+	defer func() {
+		if found > 0 {
+			_ = cache.InvalidateLibraryCache(context.Background())
+		}
+	}()
+
+	// Albums whose files could not be read are retried on the next run
+	skipped := []string{}
+	for {
+		rows, err := database.DB.Query(ctx, `
+			SELECT id::text FROM albums
+			WHERE cover_checked_at IS NULL AND id::text <> ALL($2)
+			ORDER BY id
+			LIMIT $1
+		`, coverBatch, skipped)
+		if err != nil {
+			return checked, found, fmt.Errorf("failed to load albums without covers: %w", err)
+		}
+		albums, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return checked, found, err
+		}
+		if len(albums) == 0 {
+			return checked, found, nil
+		}
+
+		for _, albumID := range albums {
+			if err := ctx.Err(); err != nil {
+				return checked, found, err
+			}
+			best, err := albumCoverCandidate(ctx, albumID)
+			if err == nil {
+				var changed bool
+				changed, err = updateAlbumCover(ctx, albumID, best)
+				if changed {
+					found++
+				}
+			}
+			if err != nil {
+				slog.Warn("Failed to extract album cover", "album_id", albumID, "error", err)
+				skipped = append(skipped, albumID)
+				continue
+			}
+			checked++
+		}
+	}
+}
+
+// albumCoverCandidate returns the best artwork among the files of an album's
+// active tracks and their folders
+func albumCoverCandidate(ctx context.Context, albumID string) (*covers.Image, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT DISTINCT file_path FROM tracks WHERE album_id = $1 AND status = 'active' ORDER BY file_path
+	`, albumID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load album tracks: %w", err)
+	}
+	paths, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	var best *covers.Image
+	dirs := make(map[string]bool)
+	for _, trackPath := range paths {
+		path := absTrackPath(trackPath)
+		embedded, err := covers.Embedded(path)
+		if err != nil {
+			return nil, err
+		}
+		best = covers.Best(append(embedded, best)...)
+		if dir := filepath.Dir(path); !dirs[dir] {
+			dirs[dir] = true
+			folder, err := covers.Folder(dir)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			best = covers.Best(append(folder, best)...)
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sonantica-core/tags"
+)
+
+// maxCueSize bounds the cue sheets read into memory; real sheets are a few kilobytes
+const maxCueSize = 1 << 20
+
+// cueEntry is a parsed cue sheet and the fingerprint stored in the manifest of the files it splits
+type cueEntry struct {
+	sheet *tags.CueSheet
+	hash  string
+}
+
+// cueSet parses and caches the cue sheets of each directory of a tree
+type cueSet struct {
+	root  string
+	dirs  map[string][]cueEntry // Keyed by slash-separated directory relative to root
+	onErr func(file string, err error)
+}
+
+func newCueSet(root string, onErr func(string, error)) *cueSet {
+	return &cueSet{root: root, dirs: make(map[string][]cueEntry), onErr: onErr}
+}
+
+// forFile returns the cue sheet that splits a file relative to the root into
+// several tracks, with its fingerprint. Sheets describing a single track per
+// file add nothing over the file's own tags and are ignored.
+func (s *cueSet) forFile(rel string) (*tags.CueSheet, *tags.CueFile, string) {
+	rel = filepath.ToSlash(rel)
+	for _, e := range s.load(path.Dir(rel)) {
+		if f := e.sheet.File(path.Base(rel)); f != nil && len(f.Tracks) > 1 {
+			return e.sheet, f, e.hash
+		}
+	}
+	return nil, nil, ""
+}
+
+func (s *cueSet) load(dir string) []cueEntry {
+	if entries, ok := s.dirs[dir]; ok {
+		return entries
+	}
+
+	var entries []cueEntry
+	abs := filepath.Join(s.root, filepath.FromSlash(dir))
+	files, _ := os.ReadDir(abs)
+	for _, f := range files {
+		if f.IsDir() || !isCueSheet(f.Name()) {
+			continue
+		}
+		name := filepath.Join(abs, f.Name())
+		if info, err := f.Info(); err != nil || info.Size() > maxCueSize {
+			continue
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			s.onErr(name, err)
+			continue
+		}
+		sheet, err := tags.ParseCue(data)
+		if err != nil {
+			s.onErr(name, err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		entries = append(entries, cueEntry{sheet: sheet, hash: hex.EncodeToString(sum[:16])})
+	}
+	s.dirs[dir] = entries
+	return entries
+}
+
+// isCueSheet reports whether a file name is a cue sheet
+func isCueSheet(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".cue")
+}
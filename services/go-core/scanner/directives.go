@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DirectiveFile holds "key = value" scan hints for the directory it is in and everything below it.
+// Deeper directive files override the keys they set.
+//
+//	compilation  = true              # Group the albums under "Various Artists"
+//	album_artist = Ennio Morricone   # Force the album artist
+//	kind         = audiobook         # music, audiobook or podcast
+const DirectiveFile = ".sonantica"
+
+// Media kinds stored in tracks.media_kind
+const (
+	KindMusic     = "music"
+	KindAudiobook = "audiobook"
+	KindPodcast   = "podcast"
+)
+
+// variousArtists owns the albums of compilations without an explicit album artist
+const variousArtists = "Various Artists"
+
+// IsMediaKind reports whether kind is a known media kind
+func IsMediaKind(kind string) bool {
+	switch kind {
+	case KindMusic, KindAudiobook, KindPodcast:
+		return true
+	}
+	return false
+}
+
+// Directives are the hints that apply to a file, merged from the directive files above it.
+// They are sent to the analysis worker with the job so both writers agree.
+type Directives struct {
+	Compilation bool   `json:"compilation,omitempty"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	MediaKind   string `json:"media_kind,omitempty"`
+}
+
+// IsZero reports whether no directive applies
+func (d Directives) IsZero() bool {
+	return d == Directives{}
+}
+
+// fingerprint identifies the directives in the manifest so files are
+// re-indexed when the hints above them change. Empty when none apply.
+func (d Directives) fingerprint() string {
+	if d.IsZero() {
+		return ""
+	}
+	b, _ := json.Marshal(d)
+	return string(b)
+}
+
+// parseDirectives applies the lines of a directive file on top of the inherited directives.
+// Invalid lines are skipped and reported in the returned error.
+func parseDirectives(data []byte, inherited Directives) (Directives, error) {
+	d := inherited
+	var errs []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			key, value, ok = strings.Cut(line, ":")
+		}
+		if !ok {
+			errs = append(errs, fmt.Sprintf("line %d: expected key = value", n))
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "compilation":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("line %d: compilation must be true or false", n))
+				continue
+			}
+			d.Compilation = b
+		case "album_artist", "albumartist":
+			d.AlbumArtist = value
+		case "kind", "type":
+			value = strings.ToLower(value)
+			if !IsMediaKind(value) {
+				errs = append(errs, fmt.Sprintf("line %d: unknown kind %q", n, value))
+				continue
+			}
+			d.MediaKind = value
+			if value == KindMusic {
+				d.MediaKind = "" // Music is the default
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("line %d: unknown directive %q", n, key))
+		}
+	}
+	if len(errs) > 0 {
+		return d, fmt.Errorf("invalid %s: %s", DirectiveFile, strings.Join(errs, "; "))
+	}
+	return d, nil
+}
+
+// directiveSet resolves and caches the directives of each directory of a tree
+type directiveSet struct {
+	root  string
+	dirs  map[string]Directives // Keyed by slash-separated directory relative to root
+	read  func(name string) ([]byte, error)
+	onErr func(file string, err error)
+}
+
+func newDirectiveSet(root string, read func(string) ([]byte, error), onErr func(string, error)) *directiveSet {
+	return &directiveSet{root: root, dirs: make(map[string]Directives), read: read, onErr: onErr}
+}
+
+// forFile returns the directives that apply to a file relative to the root
+func (s *directiveSet) forFile(rel string) Directives {
+	return s.forDir(path.Dir(filepath.ToSlash(rel)))
+}
+
+func (s *directiveSet) forDir(dir string) Directives {
+	if d, ok := s.dirs[dir]; ok {
+		return d
+	}
+
+	var inherited Directives
+	if dir != "." {
+		inherited = s.forDir(path.Dir(dir))
+	}
+	d := inherited
+	name := filepath.Join(s.root, filepath.FromSlash(dir), DirectiveFile)
+	if data, err := s.read(name); err == nil {
+		var perr error
+		if d, perr = parseDirectives(data, inherited); perr != nil && s.onErr != nil {
+			s.onErr(name, perr)
+		}
+	}
+	s.dirs[dir] = d
+	return d
+}
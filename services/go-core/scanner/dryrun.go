@@ -0,0 +1,243 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"sonantica-core/tags"
+)
+
+// DryRunReport is the diff a full scan of a root would apply to the library
+type DryRunReport struct {
+	Root        string          `json:"root"`
+	Path        string          `json:"path"`
+	DurationMs  int64           `json:"durationMs"`
+	Summary     DryRunSummary   `json:"summary"`
+	Directories []DirectoryDiff `json:"directories"`
+	Errors      []FileError     `json:"errors,omitempty"`
+	Warnings    []string        `json:"warnings,omitempty"`
+}
+
+// DryRunSummary counts the files of each kind across the root
+type DryRunSummary struct {
+	Seen      int `json:"filesSeen"`
+	New       int `json:"new"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+	Moved     int `json:"moved"`
+	Missing   int `json:"missing"`
+	Restored  int `json:"restored"`
+	Rejected  int `json:"rejected"`
+	Playlists int `json:"playlists"`
+	Unprobed  int `json:"unprobed"`
+}
+
+// DirectoryDiff lists the files of one directory that a scan would touch.
+// Files are named by their base name; Path is relative to the root.
+type DirectoryDiff struct {
+	Path      string         `json:"path"`
+	New       []string       `json:"new,omitempty"`
+	Changed   []string       `json:"changed,omitempty"`
+	Moved     []MovedFile    `json:"moved,omitempty"` // Listed under their destination
+	Missing   []string       `json:"missing,omitempty"`
+	Restored  []string       `json:"restored,omitempty"`
+	Rejected  []RejectedFile `json:"rejected,omitempty"`
+	Playlists []string       `json:"playlists,omitempty"` // Playlist files that would be imported
+	Unprobed  []string       `json:"unprobed,omitempty"`  // New or changed files past the probe limit
+}
+
+// MovedFile is a new file recognised as a vanished one
+type MovedFile struct {
+	From string `json:"from"` // Previous path relative to the root
+	To   string `json:"to"`
+}
+
+// RejectedFile is a file that would be quarantined
+type RejectedFile struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// dryRun is the sink of dry runs: it records what a pass would do instead of
+// doing it. Only the manifest and the tracks are read from the database.
+type dryRun struct {
+	manifestDB
+	dirs    map[string]*DirectoryDiff
+	summary DryRunSummary
+	errors  []FileError
+	// movedTo holds the destinations of the files matched as moves
+	movedTo map[string]struct{}
+}
+
+// DryRunLimit is how many new or changed files a dry run probes unless asked otherwise
+const DryRunLimit = 1000
+
+// DryRun walks a root like a full scan, hashing and probing at most limit new
+// or changed files, and reports the diff without writing to the database, the
+// cache or the worker queue. The files past the limit are listed as unprobed,
+// which keeps the run short on a new or remounted tree. Ignore files,
+// directives, move detection and playlist imports apply as in a real scan,
+// since the pass is the same and only its sink differs.
+func DryRun(ctx context.Context, root Root, limit int) (*DryRunReport, error) {
+	d := &dryRun{dirs: make(map[string]*DirectoryDiff), movedTo: make(map[string]struct{})}
+	p := newPass(ctx, ctx, newPauseGate(), root, TriggerDryRun, d)
+	p.probeLimit = limit
+
+	manifest, err := d.loadManifest(ctx, root.Path, "")
+	if err != nil {
+		return nil, err
+	}
+	p.manifest = manifest
+	if p.quarantine, err = loadQuarantine(ctx, root.Path); err != nil {
+		return nil, err
+	}
+
+	if err := p.walk(root.Path); err != nil {
+		return nil, err
+	}
+	p.reconcile(p.unseen())
+	if err := p.dispatchPending(); err != nil {
+		return nil, err
+	}
+	if err := p.syncPlaylists(); err != nil {
+		return nil, err
+	}
+	// Files still refused since an earlier scan are re-probed to report why
+	for _, rel := range p.quarantined {
+		if !p.mayProbe(rel) {
+			continue
+		}
+		md, reason, err := probeFile(filepath.Join(root.Path, rel))
+		if reason != "" {
+			d.quarantine(p, ManifestEntry{FilePath: rel}, reason, err, md)
+		} else if err != nil {
+			p.fileError(rel, "probe", err)
+		}
+	}
+
+	report := &DryRunReport{
+		Root:       root.Name,
+		Path:       root.Path,
+		DurationMs: time.Since(p.result.StartedAt).Milliseconds(),
+		Errors:     d.errors,
+	}
+	if len(p.seen) == 0 && len(p.manifest) > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"no files found but %d are known; a scan would leave them untouched instead of marking them missing", len(p.manifest)))
+	}
+
+	if len(p.unprobed) > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf(
+			"probe limit of %d files reached, %d were not probed; files moved onto them are reported missing", limit, len(p.unprobed)))
+	}
+	for _, rel := range p.unprobed {
+		d.dir(rel).Unprobed = append(d.dir(rel).Unprobed, path.Base(filepath.ToSlash(rel)))
+		d.summary.Unprobed++
+	}
+	for _, rel := range p.restored {
+		d.dir(rel).Restored = append(d.dir(rel).Restored, path.Base(filepath.ToSlash(rel)))
+		d.summary.Restored++
+	}
+	d.summary.Seen = p.result.Seen
+	d.summary.Unchanged = p.result.Unchanged
+	report.Summary = d.summary
+
+	report.Directories = make([]DirectoryDiff, 0, len(d.dirs))
+	for _, diff := range d.dirs {
+		sort.Strings(diff.New)
+		sort.Strings(diff.Changed)
+		sort.Strings(diff.Missing)
+		sort.Strings(diff.Restored)
+		sort.Strings(diff.Playlists)
+		sort.Strings(diff.Unprobed)
+		sort.Slice(diff.Moved, func(a, b int) bool { return diff.Moved[a].To < diff.Moved[b].To })
+		sort.Slice(diff.Rejected, func(a, b int) bool { return diff.Rejected[a].File < diff.Rejected[b].File })
+		report.Directories = append(report.Directories, *diff)
+	}
+	sort.Slice(report.Directories, func(a, b int) bool { return report.Directories[a].Path < report.Directories[b].Path })
+	return report, nil
+}
+
+// dir returns the diff of the directory holding a file relative to the root
+func (d *dryRun) dir(rel string) *DirectoryDiff {
+	dir := path.Dir(filepath.ToSlash(rel))
+	diff, ok := d.dirs[dir]
+	if !ok {
+		diff = &DirectoryDiff{Path: dir}
+		d.dirs[dir] = diff
+	}
+	return diff
+}
+
+func (d *dryRun) start(p *scanPass) {}
+
+// index lists a file that passed validation as new or changed. Files moved
+// under different directives are re-indexed by a real scan, so they are
+// listed as changed next to their move.
+func (d *dryRun) index(p *scanPass, entry ManifestEntry, md *tags.Metadata) {
+	name := path.Base(filepath.ToSlash(entry.FilePath))
+	diff := d.dir(entry.FilePath)
+	_, known := p.manifest[entry.FilePath]
+	if _, moved := d.movedTo[entry.FilePath]; known || moved {
+		diff.Changed = append(diff.Changed, name)
+		d.summary.Changed++
+		return
+	}
+	diff.New = append(diff.New, name)
+	d.summary.New++
+}
+
+func (d *dryRun) quarantine(p *scanPass, entry ManifestEntry, reason string, cause error, md *tags.Metadata) {
+	diff := d.dir(entry.FilePath)
+	diff.Rejected = append(diff.Rejected, RejectedFile{File: path.Base(filepath.ToSlash(entry.FilePath)), Reason: reason, Detail: cause.Error()})
+	d.summary.Rejected++
+}
+
+// move lists a move only when a real scan would relink a track; otherwise
+// the file is indexed under its new name and listed as new
+func (d *dryRun) move(p *scanPass, old, moved ManifestEntry) (bool, error) {
+	ok, err := relinkable(p.ctx, p.root, old)
+	if err != nil || !ok {
+		return false, err
+	}
+	diff := d.dir(moved.FilePath)
+	diff.Moved = append(diff.Moved, MovedFile{From: filepath.ToSlash(old.FilePath), To: path.Base(filepath.ToSlash(moved.FilePath))})
+	d.summary.Moved++
+	d.movedTo[moved.FilePath] = struct{}{}
+	return true, nil
+}
+
+// missing lists the files that go missing with this scan
+func (d *dryRun) missing(p *scanPass, gone map[string]ManifestEntry) error {
+	for rel, e := range gone {
+		if e.MissingSince != nil {
+			continue
+		}
+		d.dir(rel).Missing = append(d.dir(rel).Missing, path.Base(filepath.ToSlash(rel)))
+		d.summary.Missing++
+	}
+	return nil
+}
+
+func (d *dryRun) importPlaylist(p *scanPass, rel, name, hash string, trackIDs, unresolved []string) error {
+	d.dir(rel).Playlists = append(d.dir(rel).Playlists, path.Base(filepath.ToSlash(rel)))
+	d.summary.Playlists++
+	return nil
+}
+
+func (d *dryRun) removePlaylists(p *scanPass, rel string) (int, error) { return 0, nil }
+
+func (d *dryRun) prune(p *scanPass) {}
+
+func (d *dryRun) fileError(p *scanPass, fe FileError) {
+	d.errors = append(d.errors, fe)
+}
+
+func (d *dryRun) progress(p *scanPass) {}
+
+func (d *dryRun) finish(p *scanPass) {}
@@ -0,0 +1,34 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProbeLimit(t *testing.T) {
+	root := Root{Name: "test", Path: t.TempDir(), Enabled: true}
+	for i := range 3 {
+		if err := os.WriteFile(filepath.Join(root.Path, fmt.Sprintf("%02d.mp3", i)), []byte("not audio"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink := &memorySink{manifest: make(map[string]ManifestEntry), tracks: make(map[string]bool)}
+	p := newPass(context.Background(), context.Background(), newPauseGate(), root, TriggerDryRun, sink)
+	p.probeLimit = 1
+	if err := p.walk(root.Path); err != nil {
+		t.Fatal(err)
+	}
+	p.reconcile(p.unseen())
+	if err := p.dispatchPending(); err != nil {
+		t.Fatal(err)
+	}
+	if p.result.Seen != 3 || len(p.unprobed) != 2 {
+		t.Errorf("seen %d, unprobed %v; want 3 seen and 2 unprobed", p.result.Seen, p.unprobed)
+	}
+	if probed := p.result.Quarantined + len(sink.indexed); probed != 1 {
+		t.Errorf("%d files probed, want 1", probed)
+	}
+}
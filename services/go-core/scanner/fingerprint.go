@@ -0,0 +1,158 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"sonantica-core/database"
+	"sonantica-core/fingerprint"
+	"sonantica-core/tags"
+)
+
+// fingerprintBatch is how many files FingerprintBacklog loads per query
+const fingerprintBatch = 100
+
+// fingerprintTracks fingerprints the tracks of a new or changed file
+func (dbSink) fingerprintTracks(p *scanPass, entry ManifestEntry, trackPath string) {
+	matched, err := fingerprintFile(p.ctx, filepath.Join(p.root.Path, entry.FilePath), trackPath)
+	if err != nil {
+		slog.Warn("Failed to fingerprint file", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(entry.FilePath, "fingerprint", err)
+		return
+	}
+	if matched > 0 {
+		slog.Info("Found acoustically identical tracks", "file", entry.FilePath, "matches", matched, "scan_id", p.result.ScanID)
+	}
+}
+
+// fingerprintFile fingerprints every track of the file at path, each cue sheet
+// track from its own offset, and returns how many matches the index found.
+// Damaged or too short audio is recorded as done. Tracks in formats that
+// need ffmpeg are left pending without it, for FingerprintBacklog to pick up once
+// it is installed. Only I/O failures and database errors are returned.
+func fingerprintFile(ctx context.Context, path, trackPath string) (int, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT id::text, COALESCE(start_offset, 0), COALESCE(end_offset, 0)
+		FROM tracks WHERE file_path = $1 AND status <> 'deleted'
+	`, trackPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load tracks: %w", err)
+	}
+	type track struct {
+		id         string
+		start, end float64
+	}
+	var tracks []track
+	for rows.Next() {
+		var t track
+		if err := rows.Scan(&t.id, &t.start, &t.end); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tracks = append(tracks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	matched := 0
+	for _, t := range tracks {
+		length := fingerprint.DefaultLength
+		if t.end > t.start {
+			length = min(length, t.end-t.start)
+		}
+		fp, err := calculateFingerprint(ctx, path, t.start, length)
+		if errors.Is(err, tags.ErrUnsupported) {
+			slog.Debug("Track cannot be decoded without ffmpeg", "file", trackPath, "track_id", t.id, "reason", err)
+			continue
+		}
+		if errors.Is(err, tags.ErrMalformed) || errors.Is(err, fingerprint.ErrTooShort) {
+			slog.Debug("Track cannot be fingerprinted", "file", trackPath, "track_id", t.id, "reason", err)
+			if err := fingerprint.Skip(ctx, t.id); err != nil {
+				return matched, err
+			}
+			continue
+		}
+		if err != nil {
+			return matched, err
+		}
+		matches, err := fingerprint.Save(ctx, t.id, fp)
+		if err != nil {
+			return matched, err
+		}
+		matched += len(matches)
+	}
+	return matched, nil
+}
+
+func calculateFingerprint(ctx context.Context, path string, start, length float64) ([]uint32, error) {
+	src, rate, err := openAudio(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return fingerprint.Calculate(src, rate, start, length)
+}
+
+// FingerprintBacklog fingerprints the tracks that never were, such as those
+// indexed before fingerprinting was enabled. It stops when ctx is cancelled
+// and reports how many files were fingerprinted and the matches found.
+func FingerprintBacklog(ctx context.Context) (files, matched int, err error) {
+	// Each file is tried once per run, in order; those that could not be read
+	// or decoded are retried on the next
+	after := ""
+	for {
+		rows, err := database.DB.Query(ctx, `
+			SELECT DISTINCT file_path FROM tracks
+			WHERE fingerprinted_at IS NULL AND status = 'active' AND file_path > $2
+			ORDER BY file_path
+			LIMIT $1
+		`, fingerprintBatch, after)
+		if err != nil {
+			return files, matched, fmt.Errorf("failed to load tracks without fingerprint: %w", err)
+		}
+		var paths []string
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				rows.Close()
+				return files, matched, err
+			}
+			paths = append(paths, path)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return files, matched, err
+		}
+		if len(paths) == 0 {
+			return files, matched, nil
+		}
+
+		for _, trackPath := range paths {
+			if err := ctx.Err(); err != nil {
+				return files, matched, err
+			}
+			after = trackPath
+			n, err := fingerprintFile(ctx, absTrackPath(trackPath), trackPath)
+			matched += n
+			if err != nil {
+				slog.Warn("Failed to fingerprint file", "file", trackPath, "error", err)
+				continue
+			}
+			files++
+		}
+	}
+}
+
+// absTrackPath resolves a tracks.file_path, relative to MediaPath unless it
+// belongs to a root outside it
+func absTrackPath(trackPath string) string {
+	if filepath.IsAbs(trackPath) {
+		return trackPath
+	}
+	return filepath.Join(MediaPath, trackPath)
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package scanner
+
+import "syscall"
+
+// Filesystem magic numbers (see statfs(2)) for volumes where inotify does not
+// observe changes made by other hosts or by the Docker Desktop file sharing layer
+var unreliableFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x013111a8: "ibrix",
+	0x00c36400: "ceph",
+}
+
+// supportsReliableEvents reports whether inotify can be trusted on the volume holding path
+func supportsReliableEvents(path string) (bool, string) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false, "unknown"
+	}
+	if name, ok := unreliableFilesystems[uint32(st.Type)]; ok {
+		return false, name
+	}
+	return true, "local"
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package scanner
+
+// supportsReliableEvents assumes native filesystem events are reliable on
+// non-Linux development hosts
+func supportsReliableEvents(path string) (bool, string) {
+	return true, "local"
+}
@@ -0,0 +1,128 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile lists gitignore-style patterns for files and directories the scanner must skip.
+// It may appear in any directory; its patterns are relative to that directory.
+const IgnoreFile = ".sonanticaignore"
+
+// errIgnored marks a changed path that an ignore file excludes from the library
+var errIgnored = errors.New("excluded by " + IgnoreFile)
+
+// ignoreRule is a single line of an ignore file
+type ignoreRule struct {
+	pattern  []string // Slash-separated segments; a single segment matches the name at any depth
+	negate   bool     // "!pattern" re-includes what an earlier rule ignored
+	dirOnly  bool     // "pattern/" only matches directories
+	anchored bool     // Patterns with a leading or inner slash are relative to the ignore file's directory
+}
+
+// parseIgnore reads the rules of an ignore file. Blank lines and lines
+// starting with "#" are skipped; a leading backslash escapes "#" or "!".
+func parseIgnore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		rule.pattern = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// match reports whether rel, a slash-separated path relative to the ignore file's directory, matches the rule
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern[0], path.Base(rel))
+		return ok
+	}
+	return matchSegments(r.pattern, strings.Split(rel, "/"))
+}
+
+// ignoreSet caches the ignore files of a tree so each is read once per pass
+type ignoreSet struct {
+	root  string
+	rules map[string][]ignoreRule // Keyed by slash-separated directory relative to root
+	read  func(name string) ([]byte, error)
+}
+
+func newIgnoreSet(root string, read func(string) ([]byte, error)) *ignoreSet {
+	return &ignoreSet{root: root, rules: make(map[string][]ignoreRule), read: read}
+}
+
+// dirRules returns the rules of the ignore file in dir, if any
+func (s *ignoreSet) dirRules(dir string) []ignoreRule {
+	rules, ok := s.rules[dir]
+	if !ok {
+		if data, err := s.read(filepath.Join(s.root, filepath.FromSlash(dir), IgnoreFile)); err == nil {
+			rules = parseIgnore(data)
+		}
+		s.rules[dir] = rules
+	}
+	return rules
+}
+
+// match reports whether rel itself is ignored by the ignore files of its
+// ancestors. Deeper files override shallower ones and the last matching rule wins.
+// Parent directories are not checked; see ignored.
+func (s *ignoreSet) match(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	if rel == "." || rel == "" {
+		return false
+	}
+
+	ignored := false
+	dir := "."
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		for _, rule := range s.dirRules(dir) {
+			if rule.match(strings.Join(parts[i:], "/"), isDir) {
+				ignored = !rule.negate
+			}
+		}
+		dir = path.Join(dir, parts[i])
+	}
+	return ignored
+}
+
+// ignored reports whether rel or any directory above it is ignored.
+// As with git, a file inside an ignored directory cannot be re-included.
+func (s *ignoreSet) ignored(rel string, isDir bool) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i < len(parts); i++ {
+		if s.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return s.match(rel, isDir)
+}
@@ -0,0 +1,70 @@
+package scanner
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreSet(t *testing.T) {
+	files := map[string]string{
+		"/lib/" + IgnoreFile:         "# Rips in progress\n*.part\nIncoming/\n/Scans\n!keep.part\n",
+		"/lib/Artist/" + IgnoreFile:  "Bonus/**/*.flac\n\\!odd.mp3\n",
+		"/lib/Various/" + IgnoreFile: "!*.part\n",
+	}
+	set := newIgnoreSet("/lib", func(name string) ([]byte, error) {
+		if data, ok := files[filepath.ToSlash(name)]; ok {
+			return []byte(data), nil
+		}
+		return nil, fs.ErrNotExist
+	})
+
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"Artist/01.part", false, true},
+		{"Artist/keep.part", false, false},
+		{"Various/01.part", false, false},
+		{"Incoming", true, true},
+		{"Artist/Incoming", true, true},
+		{"Incoming", false, false},
+		{"Incoming/01.flac", false, true},
+		{"Scans", true, true},
+		{"Artist/Scans", true, false},
+		{"Artist/Bonus/CD1/01.flac", false, true},
+		{"Artist/Bonus/01.mp3", false, false},
+		{"Bonus/CD1/01.flac", false, false},
+		{"Artist/!odd.mp3", false, true},
+		{"Artist/01.flac", false, false},
+	}
+
+	for _, c := range cases {
+		if got := set.ignored(c.rel, c.isDir); got != c.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", c.rel, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestParseDirectives(t *testing.T) {
+	parent, err := parseDirectives([]byte("compilation = true\nkind: audiobook # narrated\n"), Directives{})
+	if err != nil {
+		t.Fatalf("parseDirectives: %v", err)
+	}
+	if !parent.Compilation || parent.MediaKind != KindAudiobook {
+		t.Errorf("parent = %+v", parent)
+	}
+
+	child, err := parseDirectives([]byte("album_artist = Ennio Morricone\nkind = music\nrating = 5\n"), parent)
+	if err == nil {
+		t.Error("expected an error for the unknown directive")
+	}
+	want := Directives{Compilation: true, AlbumArtist: "Ennio Morricone"}
+	if child != want {
+		t.Errorf("child = %+v, want %+v", child, want)
+	}
+	if (Directives{}).fingerprint() != "" {
+		t.Error("empty directives must have an empty fingerprint")
+	}
+}
@@ -0,0 +1,308 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"sonantica-core/database"
+	"sonantica-core/tags"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Placeholder names used by the analysis worker for untagged files
+const (
+	unknownArtist = "Unknown Artist"
+	unknownAlbum  = "Unknown Album"
+)
+
+// trackInfo is one track of a file: the whole file, or a track of its cue sheet
+type trackInfo struct {
+	cueTrack    *int     // Cue sheet track number; nil for a whole file
+	start, end  *float64 // Offsets within the file for cue sheet tracks; end is nil for the last one
+	title       string
+	artist      string
+	albumArtist string
+	album       string
+	trackNumber int
+	discNumber  int
+	genre       string
+	year        int
+	duration    float64
+	gain        tags.ReplayGain
+}
+
+// upsertTrack writes the track at trackPath from its tags and the file's
+// manifest entry, creating its artist and album when needed, so new files are
+// browsable without waiting for the analysis worker. Directives override the
+// album artist and media kind. The track keeps its ID, play count and analysis
+// results across rescans.
+func upsertTrack(ctx context.Context, trackPath string, entry ManifestEntry, md *tags.Metadata, d Directives) error {
+	title := md.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(trackPath), filepath.Ext(trackPath))
+	}
+	return indexTracks(ctx, trackPath, entry, md, d, []trackInfo{{
+		title:       title,
+		artist:      md.Artist(),
+		albumArtist: md.AlbumArtist,
+		album:       md.Album,
+		trackNumber: md.TrackNumber,
+		discNumber:  md.DiscNumber,
+		genre:       md.Genre,
+		year:        md.Year,
+		duration:    md.Duration,
+		gain:        md.ReplayGain(),
+	}})
+}
+
+// upsertCueTracks writes one track per cue sheet entry of a single-file rip.
+// The sheet takes precedence over the file's own tags.
+func upsertCueTracks(ctx context.Context, trackPath string, entry ManifestEntry, md *tags.Metadata, sheet *tags.CueSheet, file *tags.CueFile, d Directives) error {
+	// The image's own gain covers the whole rip, so it stands in for the album gain
+	albumGain, albumPeak := sheet.Gain.AlbumGain, sheet.Gain.AlbumPeak
+	if albumGain == nil {
+		rg := md.ReplayGain()
+		albumGain, albumPeak = rg.AlbumGain, rg.AlbumPeak
+		if albumGain == nil {
+			albumGain, albumPeak = rg.TrackGain, rg.TrackPeak
+		}
+	}
+
+	infos := make([]trackInfo, 0, len(file.Tracks))
+	for _, t := range file.Tracks {
+		info := trackInfo{
+			cueTrack:    &t.Number,
+			start:       &t.Start,
+			title:       firstNonEmpty(t.Title, fmt.Sprintf("Track %02d", t.Number)),
+			artist:      firstNonEmpty(t.Performer, sheet.Performer, md.Artist()),
+			albumArtist: firstNonEmpty(sheet.Performer, md.AlbumArtist),
+			album:       firstNonEmpty(sheet.Title, md.Album),
+			trackNumber: t.Number,
+			discNumber:  md.DiscNumber,
+			genre:       firstNonEmpty(sheet.Genre, md.Genre),
+			year:        md.Year,
+			duration:    max(md.Duration-t.Start, 0),
+			gain:        t.Gain,
+		}
+		info.gain.AlbumGain, info.gain.AlbumPeak = albumGain, albumPeak
+		if t.End > 0 {
+			info.end = &t.End
+			info.duration = t.End - t.Start
+		}
+		if sheet.Disc > 0 {
+			info.discNumber = sheet.Disc
+		}
+		if sheet.Year > 0 {
+			info.year = sheet.Year
+		}
+		infos = append(infos, info)
+	}
+	return indexTracks(ctx, trackPath, entry, md, d, infos)
+}
+
+// indexTracks writes the tracks of the file at trackPath in one transaction and
+// removes rows left over from another layout of the same file, such as the
+// whole-file track once a cue sheet splits it
+func indexTracks(ctx context.Context, trackPath string, entry ManifestEntry, md *tags.Metadata, d Directives, infos []trackInfo) error {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('track:' || $1))`, trackPath); err != nil {
+		return err
+	}
+
+	compilation := d.Compilation || isCompilationTag(md.Get("COMPILATION"))
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(trackPath)), ".")
+	kind := d.MediaKind
+	if kind == "" {
+		kind = KindMusic
+		if format == "m4b" {
+			kind = KindAudiobook // The extension is reserved for audiobooks
+		}
+	}
+
+	keep := make([]int, 0, len(infos))
+	for _, info := range infos {
+		if err := writeTrack(ctx, tx, trackPath, format, kind, compilation, entry, md, d, info); err != nil {
+			return err
+		}
+		if info.cueTrack != nil {
+			keep = append(keep, *info.cueTrack)
+		} else {
+			keep = append(keep, 0)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM tracks WHERE file_path = $1 AND COALESCE(cue_track, 0) <> ALL($2)
+	`, trackPath, keep); err != nil {
+		return fmt.Errorf("failed to remove stale tracks: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// writeTrack updates or inserts a single track row
+func writeTrack(ctx context.Context, tx pgx.Tx, trackPath, format, kind string, compilation bool, entry ManifestEntry, md *tags.Metadata, d Directives, info trackInfo) error {
+	artist := info.artist
+	if artist == "" {
+		artist = unknownArtist
+	}
+	artistID, err := findOrCreateArtist(ctx, tx, artist)
+	if err != nil {
+		return err
+	}
+
+	albumArtist := info.albumArtist
+	switch {
+	case d.AlbumArtist != "":
+		albumArtist = d.AlbumArtist
+	case compilation && albumArtist == "":
+		albumArtist = variousArtists
+	}
+	albumArtistID := artistID
+	if albumArtist != "" && albumArtist != artist {
+		if albumArtistID, err = findOrCreateArtist(ctx, tx, albumArtist); err != nil {
+			return err
+		}
+	}
+
+	album := info.album
+	if album == "" {
+		album = unknownAlbum
+	}
+	albumID, err := findOrCreateAlbum(ctx, tx, album, albumArtistID, compilation, info.year, info.genre)
+	if err != nil {
+		return err
+	}
+
+	args := []any{trackPath, info.title, artistID, albumID, info.duration, format,
+		nullInt(md.Bitrate), nullInt(md.SampleRate), nullInt(md.Channels), nullInt(md.BitDepth),
+		nullInt(info.trackNumber), nullInt(info.discNumber), nullString(info.genre), nullInt(info.year),
+		nullString(md.Codec), nullString(md.Container), kind, info.cueTrack, info.start, info.end}
+	args = append(args, tagLoudness(info.gain)...)
+	args = append(args, nullString(md.Profile), md.Lossless(), nullString(md.Encoder),
+		entry.SizeBytes, entry.ModTime, entry.ContentHash)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE tracks SET
+			title = $2, artist_id = $3, album_id = $4, duration_seconds = $5, format = $6,
+			bitrate = $7, sample_rate = $8, channels = $9, bit_depth = $10,
+			track_number = $11, disc_number = $12, genre = $13, year = $14,
+			codec = $15, container = $16, media_kind = $17, start_offset = $19, end_offset = $20,
+			integrity = NULL, integrity_issues = NULL, integrity_checked_at = NULL, fingerprinted_at = NULL,
+			replaygain_track_gain = $21, replaygain_track_peak = $22, replaygain_album_gain = $23, replaygain_album_peak = $24,
+			loudness_lufs = $25, true_peak = $26, loudness_source = $27, album_gain_source = $28,
+			loudness_checked_at = CASE WHEN $27::text IS NULL THEN NULL ELSE NOW() END,
+			codec_profile = $29, lossless = $30, encoder = $31, file_size = $32, file_mtime = $33, content_hash = $34,
+			status = CASE WHEN merged_into IS NULL THEN 'active' ELSE status END,
+			missing_since = NULL, updated_at = NOW()
+		WHERE file_path = $1 AND cue_track IS NOT DISTINCT FROM $18::integer
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update track: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO tracks (file_path, title, artist_id, album_id, duration_seconds, format,
+				bitrate, sample_rate, channels, bit_depth, track_number, disc_number, genre, year, codec, container, media_kind,
+				cue_track, start_offset, end_offset,
+				replaygain_track_gain, replaygain_track_peak, replaygain_album_gain, replaygain_album_peak,
+				loudness_lufs, true_peak, loudness_source, album_gain_source, loudness_checked_at,
+				codec_profile, lossless, encoder, file_size, file_mtime, content_hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20,
+				$21, $22, $23, $24, $25, $26, $27, $28, CASE WHEN $27::text IS NULL THEN NULL ELSE NOW() END,
+				$29, $30, $31, $32, $33, $34)
+		`, args...); err != nil {
+			return fmt.Errorf("failed to insert track: %w", err)
+		}
+	}
+	return nil
+}
+
+// findOrCreateArtist returns the ID of the artist with the given name.
+// An advisory lock keeps concurrent scans from creating duplicates.
+func findOrCreateArtist(ctx context.Context, tx pgx.Tx, name string) (string, error) {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('artist:' || $1))`, name); err != nil {
+		return "", err
+	}
+
+	var id string
+	err := tx.QueryRow(ctx, `SELECT id FROM artists WHERE name = $1 ORDER BY created_at LIMIT 1`, name).Scan(&id)
+	if err == pgx.ErrNoRows {
+		err = tx.QueryRow(ctx, `INSERT INTO artists (name) VALUES ($1) RETURNING id`, name).Scan(&id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to upsert artist %q: %w", name, err)
+	}
+	return id, nil
+}
+
+// findOrCreateAlbum returns the ID of the album with the given title and artist,
+// filling in its release year and genre when they are still unknown
+func findOrCreateAlbum(ctx context.Context, tx pgx.Tx, title, artistID string, compilation bool, year int, genre string) (string, error) {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('album:' || $1 || ':' || $2))`, title, artistID); err != nil {
+		return "", err
+	}
+
+	var releaseDate *string
+	if year > 0 {
+		date := fmt.Sprintf("%04d-01-01", year)
+		releaseDate = &date
+	}
+
+	var id string
+	err := tx.QueryRow(ctx, `
+		UPDATE albums SET
+			release_date = COALESCE(release_date, $3::date),
+			genre = COALESCE(genre, $4),
+			is_compilation = $5
+		WHERE id = (SELECT id FROM albums WHERE title = $1 AND artist_id = $2 ORDER BY created_at LIMIT 1)
+		RETURNING id
+	`, title, artistID, releaseDate, nullString(genre), compilation).Scan(&id)
+	if err == pgx.ErrNoRows {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO albums (title, artist_id, release_date, genre, is_compilation) VALUES ($1, $2, $3::date, $4, $5) RETURNING id
+		`, title, artistID, releaseDate, nullString(genre), compilation).Scan(&id)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to upsert album %q: %w", title, err)
+	}
+	return id, nil
+}
+
+// isCompilationTag reports whether a COMPILATION, TCMP or cpil value flags a compilation
+func isCompilationTag(value string) bool {
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	return err == nil && b
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func nullInt(n int) *int {
+	if n <= 0 {
+		return nil
+	}
+	return &n
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,115 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"sonantica-core/cache"
+	"sonantica-core/database"
+	"sonantica-core/tags"
+)
+
+// integrityBatch is how many files VerifyBacklog loads per query
+const integrityBatch = 200
+
+// verifyIntegrity reads the whole file and records the outcome on its tracks
+func (dbSink) verifyIntegrity(p *scanPass, entry ManifestEntry, trackPath string) {
+	v, err := verifyFile(filepath.Join(p.root.Path, entry.FilePath))
+	if err != nil {
+		slog.Warn("Failed to verify file integrity", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(entry.FilePath, "integrity", err)
+		return
+	}
+	if v.Status == tags.IntegrityCorrupt {
+		p.result.Corrupt++
+		slog.Warn("Corrupt audio file", "file", entry.FilePath, "issues", v.Issues, "scan_id", p.result.ScanID)
+	}
+	if err := recordIntegrity(p.ctx, trackPath, v); err != nil {
+		slog.Warn("Failed to record file integrity", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+	}
+}
+
+// verifyFile checks a file, reporting files that cannot be parsed as corrupt.
+// Only I/O failures are returned as errors.
+func verifyFile(path string) (*tags.Integrity, error) {
+	v, err := tags.Verify(path)
+	switch {
+	case errors.Is(err, tags.ErrMalformed):
+		return &tags.Integrity{Status: tags.IntegrityCorrupt, Issues: []string{err.Error()}}, nil
+	case errors.Is(err, tags.ErrUnsupported):
+		return &tags.Integrity{Status: tags.IntegrityUnverified}, nil
+	}
+	return v, err
+}
+
+// recordIntegrity stores the outcome of a check on every track of the file
+func recordIntegrity(ctx context.Context, trackPath string, v *tags.Integrity) error {
+	_, err := database.DB.Exec(ctx, `
+		UPDATE tracks SET integrity = $2, integrity_issues = $3, integrity_checked_at = NOW()
+		WHERE file_path = $1
+	`, trackPath, v.Status, v.Issues)
+	return err
+}
+
+// VerifyBacklog checks the files of the tracks that were never verified, such
+// as those indexed before integrity checks were enabled or by the analysis
+// worker. It stops when ctx is cancelled and reports how many files were checked.
+func VerifyBacklog(ctx context.Context) (checked, corrupt int, err error) {
+	defer func() {
+		if checked > 0 {
+			_ = cache.InvalidateLibraryCache(context.Background())
+		}
+	}()
+
+	// Files that could not be read are retried on the next run
+	skipped := []string{}
+	for {
+		rows, err := database.DB.Query(ctx, `
+			SELECT DISTINCT file_path FROM tracks
+			WHERE integrity_checked_at IS NULL AND status = 'active' AND file_path <> ALL($2)
+			ORDER BY file_path
+			LIMIT $1
+		`, integrityBatch, skipped)
+		if err != nil {
+			return checked, corrupt, fmt.Errorf("failed to load unverified tracks: %w", err)
+		}
+		var paths []string
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				rows.Close()
+				return checked, corrupt, err
+			}
+			paths = append(paths, path)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return checked, corrupt, err
+		}
+		if len(paths) == 0 {
+			return checked, corrupt, nil
+		}
+
+		for _, trackPath := range paths {
+			if err := ctx.Err(); err != nil {
+				return checked, corrupt, err
+			}
+			v, err := verifyFile(absTrackPath(trackPath))
+			if err != nil {
+				slog.Warn("Failed to verify file integrity", "file", trackPath, "error", err)
+				skipped = append(skipped, trackPath)
+				continue
+			}
+			if v.Status == tags.IntegrityCorrupt {
+				corrupt++
+			}
+			if err := recordIntegrity(ctx, trackPath, v); err != nil {
+				return checked, corrupt, fmt.Errorf("failed to record file integrity: %w", err)
+			}
+			checked++
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"path/filepath"
+
+	"sonantica-core/cache"
+	"sonantica-core/database"
+	"sonantica-core/loudness"
+	"sonantica-core/tags"
+)
+
+// loudnessBatch is how many files LoudnessBacklog loads per query
+const loudnessBatch = 50
+
+// tagLoudness returns the loudness columns writeTrack stores for a track's
+// ReplayGain tags: the gains and peaks, the loudness and peak in dB they imply,
+// and the sources of the track and album values. The track values are nil
+// without a track gain, so the track is measured.
+func tagLoudness(rg tags.ReplayGain) []any {
+	var albumSource any
+	if rg.AlbumGain != nil {
+		albumSource = "tags"
+	}
+	if !rg.HasTrack() {
+		return []any{nil, nil, rg.AlbumGain, rg.AlbumPeak, nil, nil, nil, albumSource}
+	}
+	lufs := loudness.Reference - *rg.TrackGain
+	var peakDB *float64
+	if rg.TrackPeak != nil && *rg.TrackPeak > 0 {
+		db := 20 * math.Log10(*rg.TrackPeak)
+		peakDB = &db
+	}
+	return []any{rg.TrackGain, rg.TrackPeak, rg.AlbumGain, rg.AlbumPeak, lufs, peakDB, "tags", albumSource}
+}
+
+// measureLoudness measures the tracks of a new or changed file that have no ReplayGain tags
+func (dbSink) measureLoudness(p *scanPass, entry ManifestEntry, trackPath string) {
+	if _, err := measureFile(p.ctx, filepath.Join(p.root.Path, entry.FilePath), trackPath); err != nil {
+		slog.Warn("Failed to measure loudness", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(entry.FilePath, "loudness", err)
+	}
+}
+
+// measureFile measures every unchecked track of the file at path, each cue
+// sheet track between its own offsets, then fills in the album gain of the
+// albums they belong to. It returns how many tracks were measured. Damaged,
+// too short or silent audio is recorded as checked. Tracks in formats that
+// need ffmpeg are left pending without it, for LoudnessBacklog to pick up once
+// it is installed. Only I/O failures and database errors are returned.
+func measureFile(ctx context.Context, path, trackPath string) (int, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT id::text, album_id::text, COALESCE(start_offset, 0), COALESCE(end_offset, 0)
+		FROM tracks WHERE file_path = $1 AND status <> 'deleted' AND loudness_checked_at IS NULL
+	`, trackPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load tracks: %w", err)
+	}
+	type track struct {
+		id         string
+		albumID    *string
+		start, end float64
+	}
+	var tracks []track
+	for rows.Next() {
+		var t track
+		if err := rows.Scan(&t.id, &t.albumID, &t.start, &t.end); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tracks = append(tracks, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	measured := 0
+	albums := make(map[string]bool)
+	for _, t := range tracks {
+		length := 0.0
+		if t.end > t.start {
+			length = t.end - t.start
+		}
+		res, err := measureTrack(ctx, path, t.start, length)
+		if errors.Is(err, tags.ErrUnsupported) {
+			slog.Debug("Track cannot be decoded without ffmpeg", "file", trackPath, "track_id", t.id, "reason", err)
+			continue
+		}
+		if errors.Is(err, tags.ErrMalformed) ||
+			errors.Is(err, loudness.ErrTooShort) || errors.Is(err, loudness.ErrSilent) {
+			slog.Debug("Track loudness cannot be measured", "file", trackPath, "track_id", t.id, "reason", err)
+			if _, err := database.DB.Exec(ctx, `UPDATE tracks SET loudness_checked_at = NOW() WHERE id = $1`, t.id); err != nil {
+				return measured, err
+			}
+			continue
+		}
+		if err != nil {
+			return measured, err
+		}
+		if _, err := database.DB.Exec(ctx, `
+			UPDATE tracks SET
+				loudness_lufs = $2, true_peak = $3, replaygain_track_gain = $4, replaygain_track_peak = $5,
+				loudness_source = 'analysis', loudness_checked_at = NOW()
+			WHERE id = $1
+		`, t.id, res.Integrated, res.TruePeakDB(), res.Gain(), res.TruePeak); err != nil {
+			return measured, fmt.Errorf("failed to record loudness: %w", err)
+		}
+		measured++
+		if t.albumID != nil {
+			albums[*t.albumID] = true
+		}
+	}
+
+	for albumID := range albums {
+		if err := updateAlbumGain(ctx, albumID); err != nil {
+			return measured, err
+		}
+	}
+	return measured, nil
+}
+
+func measureTrack(ctx context.Context, path string, start, length float64) (*loudness.Result, error) {
+	src, rate, err := openAudio(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return loudness.Measure(src, rate, start, length)
+}
+
+// updateAlbumGain computes the album gain and peak once every active track of
+// the album has been checked. Albums whose tags carry an album gain keep it.
+func updateAlbumGain(ctx context.Context, albumID string) error {
+	rows, err := database.DB.Query(ctx, `
+		SELECT loudness_lufs, duration_seconds, replaygain_track_peak,
+			album_gain_source = 'tags', loudness_checked_at IS NOT NULL
+		FROM tracks WHERE album_id = $1 AND status = 'active'
+	`, albumID)
+	if err != nil {
+		return fmt.Errorf("failed to load album tracks: %w", err)
+	}
+	var tracks []loudness.Track
+	peak, complete := 0.0, true
+	for rows.Next() {
+		var lufs, trackPeak *float64
+		var duration float64
+		var tagged *bool
+		var checked bool
+		if err := rows.Scan(&lufs, &duration, &trackPeak, &tagged, &checked); err != nil {
+			rows.Close()
+			return err
+		}
+		if tagged != nil && *tagged {
+			rows.Close()
+			return nil
+		}
+		if !checked {
+			complete = false
+		}
+		if lufs == nil {
+			continue // Not measured yet, or silent and left out
+		}
+		tracks = append(tracks, loudness.Track{Loudness: *lufs, Duration: duration})
+		if trackPeak != nil {
+			peak = max(peak, *trackPeak)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !complete {
+		return nil
+	}
+
+	album, ok := loudness.AlbumLoudness(tracks)
+	if !ok {
+		return nil
+	}
+	var albumPeak *float64
+	if peak > 0 {
+		albumPeak = &peak
+	}
+	if _, err := database.DB.Exec(ctx, `
+		UPDATE tracks SET replaygain_album_gain = $2, replaygain_album_peak = $3, album_gain_source = 'analysis'
+		WHERE album_id = $1 AND status = 'active'
+	`, albumID, loudness.Reference-album, albumPeak); err != nil {
+		return fmt.Errorf("failed to record album gain: %w", err)
+	}
+	return nil
+}
+
+// LoudnessBacklog measures the tracks whose loudness was never read or
+// measured, such as those indexed before measuring was enabled. It stops when
+// ctx is cancelled and reports how many tracks were measured.
+func LoudnessBacklog(ctx context.Context) (measured int, err error) {
+	defer func() {
+		if measured > 0 {
+			_ = cache.InvalidateLibraryCache(context.Background())
+		}
+	}()
+
+	// Each file is tried once per run, in order; those that could not be read
+	// or decoded are retried on the next
+	after := ""
+	for {
+		rows, err := database.DB.Query(ctx, `
+			SELECT DISTINCT file_path FROM tracks
+			WHERE loudness_checked_at IS NULL AND status = 'active' AND file_path > $2
+			ORDER BY file_path
+			LIMIT $1
+		`, loudnessBatch, after)
+		if err != nil {
+			return measured, fmt.Errorf("failed to load tracks without loudness: %w", err)
+		}
+		var paths []string
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				rows.Close()
+				return measured, err
+			}
+			paths = append(paths, path)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return measured, err
+		}
+		if len(paths) == 0 {
+			return measured, pendingAlbumGains(ctx)
+		}
+
+		for _, trackPath := range paths {
+			if err := ctx.Err(); err != nil {
+				return measured, err
+			}
+			after = trackPath
+			n, err := measureFile(ctx, absTrackPath(trackPath), trackPath)
+			measured += n
+			if err != nil {
+				slog.Warn("Failed to measure loudness", "file", trackPath, "error", err)
+			}
+		}
+	}
+}
+
+// pendingAlbumGains fills in the album gain of albums whose tracks all carry
+// a loudness but no album gain, such as albums tagged with track gains only
+func pendingAlbumGains(ctx context.Context) error {
+	rows, err := database.DB.Query(ctx, `
+		SELECT DISTINCT album_id::text FROM tracks
+		WHERE replaygain_album_gain IS NULL AND loudness_lufs IS NOT NULL AND album_id IS NOT NULL AND status = 'active'
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to load albums without gain: %w", err)
+	}
+	var albums []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		albums = append(albums, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range albums {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := updateAlbumGain(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sonantica-core/database"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// manifestBatchSize bounds the number of paths sent in a single UPDATE
+const manifestBatchSize = 1000
+
+// ManifestEntry is the scanner's record of a file it has already dispatched
+type ManifestEntry struct {
+	FilePath     string
+	SizeBytes    int64
+	ModTime      time.Time
+	ContentHash  *string
+	MissingSince *time.Time
+	Directives   string // Fingerprint of the directives the file was indexed with
+	CueHash      string // Fingerprint of the cue sheet that split the file into tracks
+}
+
+// Matches reports whether the file on disk still looks like the recorded entry.
+// Postgres stores timestamps with microsecond precision, so mtimes are compared at that resolution.
+func (e ManifestEntry) Matches(size int64, modTime time.Time) bool {
+	return e.SizeBytes == size && e.ModTime.Truncate(time.Microsecond).Equal(modTime.Truncate(time.Microsecond))
+}
+
+// manifestColumns is the column list shared by every manifest query
+const manifestColumns = `file_path, size_bytes, mtime, content_hash, missing_since, COALESCE(directives, ''), COALESCE(cue_hash, '')`
+
+// loadManifest returns the manifest entries recorded for a root, keyed by file path.
+// A non-empty prefix restricts the result to files below that relative directory.
+func loadManifest(ctx context.Context, root, prefix string) (map[string]ManifestEntry, error) {
+	pattern := "%"
+	if prefix != "" && prefix != "." {
+		pattern = escapeLike(filepath.ToSlash(prefix)) + "/%"
+	}
+
+	return queryManifest(ctx,
+		`SELECT `+manifestColumns+` FROM library_files WHERE root = $1 AND file_path LIKE $2`,
+		root, pattern)
+}
+
+// hasManifestDir reports whether the manifest records files below a relative directory
+func hasManifestDir(ctx context.Context, root, dir string) (bool, error) {
+	if dir == "" || dir == "." {
+		return false, nil
+	}
+	var ok bool
+	err := database.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM library_files WHERE root = $1 AND file_path LIKE $2)`,
+		root, escapeLike(filepath.ToSlash(dir))+"/%").Scan(&ok)
+	return ok, err
+}
+
+// loadManifestEntries returns the manifest entries for a specific set of paths
+func loadManifestEntries(ctx context.Context, root string, paths []string) (map[string]ManifestEntry, error) {
+	if len(paths) == 0 {
+		return map[string]ManifestEntry{}, nil
+	}
+
+	return queryManifest(ctx,
+		`SELECT `+manifestColumns+` FROM library_files WHERE root = $1 AND file_path = ANY($2)`,
+		root, paths)
+}
+
+func queryManifest(ctx context.Context, query string, args ...any) (map[string]ManifestEntry, error) {
+	rows, err := database.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest: %w", err)
+	}
+	defer rows.Close()
+
+	manifest := make(map[string]ManifestEntry)
+	for rows.Next() {
+		var e ManifestEntry
+		if err := rows.Scan(&e.FilePath, &e.SizeBytes, &e.ModTime, &e.ContentHash, &e.MissingSince, &e.Directives, &e.CueHash); err != nil {
+			return nil, fmt.Errorf("failed to scan manifest row: %w", err)
+		}
+		manifest[e.FilePath] = e
+	}
+
+	return manifest, rows.Err()
+}
+
+// execer is satisfied by both the connection pool and a transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// upsertManifestEntry records a new or changed file after it has been dispatched
+func upsertManifestEntry(ctx context.Context, db execer, root, scanID, trackPath string, e ManifestEntry) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO library_files (root, file_path, track_path, size_bytes, mtime, content_hash, last_scan_id, directives, cue_hash, last_seen_at, updated_at)
+		VALUES ($1, $2, $7, $3, $4, $5, $6, $8, $9, NOW(), NOW())
+		ON CONFLICT (root, file_path) DO UPDATE SET
+			track_path = EXCLUDED.track_path,
+			size_bytes = EXCLUDED.size_bytes,
+			mtime = EXCLUDED.mtime,
+			content_hash = EXCLUDED.content_hash,
+			last_scan_id = EXCLUDED.last_scan_id,
+			directives = EXCLUDED.directives,
+			cue_hash = EXCLUDED.cue_hash,
+			missing_since = NULL,
+			last_seen_at = NOW(),
+			updated_at = NOW()
+	`, root, e.FilePath, e.SizeBytes, e.ModTime, e.ContentHash, scanID, trackPath, nullString(e.Directives), nullString(e.CueHash))
+	return err
+}
+
+// touchManifestEntries marks unchanged files as seen by the given scan
+func touchManifestEntries(ctx context.Context, root, scanID string, paths []string) error {
+	for start := 0; start < len(paths); start += manifestBatchSize {
+		end := min(start+manifestBatchSize, len(paths))
+		_, err := database.DB.Exec(ctx, `
+			UPDATE library_files SET last_seen_at = NOW(), last_scan_id = $1
+			WHERE root = $2 AND file_path = ANY($3)
+		`, scanID, root, paths[start:end])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeLike escapes LIKE wildcards so a path can be used as a literal prefix
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// hashFile computes the SHA-256 of a file's contents
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
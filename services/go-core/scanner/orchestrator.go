@@ -0,0 +1,309 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// job is a requested scan. A nil paths set means a full scan of the root.
+type job struct {
+	trigger Trigger
+	paths   map[string]struct{}
+}
+
+// merge coalesces another request into j. A full scan absorbs any targeted one.
+func (j *job) merge(other job) {
+	if other.paths == nil {
+		j.paths = nil
+		j.trigger = other.trigger
+		return
+	}
+	if j.paths != nil {
+		maps.Copy(j.paths, other.paths)
+	}
+}
+
+// runner owns the scans of a single root: at most one runs at a time and
+// requests arriving meanwhile are coalesced into a single follow-up scan
+type runner struct {
+	root Root
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	gate    *pauseGate
+	pending *job
+}
+
+var (
+	runnersMu sync.Mutex
+	runners   = make(map[string]*runner)
+)
+
+func runnerFor(root Root) *runner {
+	runnersMu.Lock()
+	defer runnersMu.Unlock()
+
+	r, ok := runners[root.Name]
+	if !ok {
+		r = &runner{root: root}
+		runners[root.Name] = r
+	}
+	return r
+}
+
+func lookupRunner(name string) (*runner, bool) {
+	runnersMu.Lock()
+	defer runnersMu.Unlock()
+	r, ok := runners[name]
+	return r, ok
+}
+
+func allRunners() []*runner {
+	runnersMu.Lock()
+	defer runnersMu.Unlock()
+	return slices.Collect(maps.Values(runners))
+}
+
+// enqueue starts a scan, or queues it behind the running one.
+// It reports whether the request was queued.
+func (r *runner) enqueue(j job) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running {
+		if r.pending == nil {
+			r.pending = &j
+		} else {
+			r.pending.merge(j)
+		}
+		return true
+	}
+
+	r.running = true
+	ctx, gate := r.prepare()
+	go r.loop(ctx, gate, j)
+	return false
+}
+
+// prepare creates the cancellation context and pause gate of the next scan.
+// The caller must hold r.mu.
+func (r *runner) prepare() (context.Context, *pauseGate) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.gate = newPauseGate()
+	return ctx, r.gate
+}
+
+// loop runs j and then any request that was queued while it ran
+func (r *runner) loop(ctx context.Context, gate *pauseGate, j job) {
+	for {
+		if j.paths == nil {
+			scan(ctx, gate, r.root, j.trigger)
+		} else {
+			scanPaths(ctx, gate, r.root, j.trigger, slices.Collect(maps.Keys(j.paths)))
+		}
+
+		r.mu.Lock()
+		r.cancel()
+		if r.pending == nil {
+			r.running = false
+			r.cancel = nil
+			r.gate = nil
+			r.mu.Unlock()
+			return
+		}
+		j = *r.pending
+		r.pending = nil
+		ctx, gate = r.prepare()
+		r.mu.Unlock()
+	}
+}
+
+// stop cancels the running scan and drops queued requests
+func (r *runner) stop() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.running {
+		return false
+	}
+	r.pending = nil
+	r.cancel()
+	return true
+}
+
+func (r *runner) setPaused(paused bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.running {
+		return false
+	}
+	return r.gate.set(paused)
+}
+
+func (r *runner) state() (running, paused bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.running, r.gate != nil && r.gate.isPaused()
+}
+
+// pauseGate blocks a scan at its next checkpoint while paused
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{}
+}
+
+// set changes the paused state and reports whether it changed
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == paused {
+		return false
+	}
+	g.paused = paused
+	if paused {
+		g.resume = make(chan struct{})
+	} else {
+		close(g.resume)
+	}
+	return true
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait blocks while the gate is paused, returning early when ctx is cancelled
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return ctx.Err()
+	}
+	resume := g.resume
+	g.mu.Unlock()
+
+	select {
+	case <-resume:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestScan schedules a scan of root, coalescing it with any scan already queued.
+// It reports whether the request was queued behind a running scan.
+func requestScan(root Root, j job) bool {
+	queued := runnerFor(root).enqueue(j)
+	if queued {
+		slog.Debug("Scan already running, request coalesced", "root", root.Name, "trigger", j.trigger, "full", j.paths == nil)
+	}
+	return queued
+}
+
+// TriggerScan requests a full scan of a library root.
+// It reports whether the scan was queued behind one already in progress.
+func TriggerScan(root Root) bool {
+	slog.Info("Manual scan triggered", "root", root.Name, "path", root.Path)
+	return requestScan(root, job{trigger: TriggerManual})
+}
+
+// JobName is the name of the scheduler job running the periodic scans of a root
+func JobName(root string) string {
+	return "scan:" + root
+}
+
+// ScheduledScan requests the periodic full scan of a library root.
+// It reports whether the scan was queued behind one already in progress.
+func ScheduledScan(root Root) bool {
+	return requestScan(root, job{trigger: TriggerSchedule})
+}
+
+// CancelScan stops the running scan of a root and drops its queued rescans
+func CancelScan(name string) bool {
+	r, ok := lookupRunner(name)
+	if !ok || !r.stop() {
+		return false
+	}
+	slog.Info("Scan cancellation requested", "root", name)
+	return true
+}
+
+// PauseScan suspends the running scan of a root at its next checkpoint
+func PauseScan(name string) bool {
+	r, ok := lookupRunner(name)
+	if !ok || !r.setPaused(true) {
+		return false
+	}
+	slog.Info("Scan paused", "root", name)
+	publish(context.Background(), Event{Type: EventScanPaused, Root: name})
+	return true
+}
+
+// ResumeScan continues a paused scan
+func ResumeScan(name string) bool {
+	r, ok := lookupRunner(name)
+	if !ok || !r.setPaused(false) {
+		return false
+	}
+	slog.Info("Scan resumed", "root", name)
+	publish(context.Background(), Event{Type: EventScanResumed, Root: name})
+	return true
+}
+
+// IsScanning returns whether a scan is in progress on any root
+func IsScanning() bool {
+	return len(ScanningRoots()) > 0
+}
+
+// IsRootScanning returns whether a scan of the named root is in progress
+func IsRootScanning(name string) bool {
+	r, ok := lookupRunner(name)
+	if !ok {
+		return false
+	}
+	running, _ := r.state()
+	return running
+}
+
+// IsRootPaused returns whether the running scan of the named root is paused
+func IsRootPaused(name string) bool {
+	r, ok := lookupRunner(name)
+	if !ok {
+		return false
+	}
+	_, paused := r.state()
+	return paused
+}
+
+// ScanningRoots returns the names of the roots with a scan in progress
+func ScanningRoots() []string {
+	names := make([]string, 0)
+	for _, r := range allRunners() {
+		if running, _ := r.state(); running {
+			names = append(names, r.root.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// otherScansRunning reports whether a root other than name is being scanned
+func otherScansRunning(name string) bool {
+	for _, root := range ScanningRoots() {
+		if root != name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sonantica-core/covers"
+	"sonantica-core/playlistfile"
+	"sonantica-core/tags"
+
+	"github.com/google/uuid"
+)
+
+// scanPass holds the state of a single scan, whether it covers the whole
+// root or only the paths reported by the watcher
+type scanPass struct {
+	ctx context.Context
+	// ctl is cancelled to stop the pass; database writes use ctx so the outcome is still recorded
+	ctl       context.Context
+	gate      *pauseGate
+	root      Root
+	result    *ScanResult
+	manifest  map[string]ManifestEntry
+	seen      map[string]struct{}
+	unchanged []string
+	restored  []string
+	// quarantine holds the files refused by earlier scans, with the size and mtime they were probed at
+	quarantine  map[string]ManifestEntry
+	quarantined []string
+	ignores     *ignoreSet
+	directives  *directiveSet
+	cues        *cueSet
+	// playlists holds the playlist files found by the pass, imported once the audio files are indexed
+	playlists []string
+	// added holds new files until reconciliation has had a chance to match them as moves
+	added []pendingFile
+	// probeLimit caps how many new or changed files the pass hashes and probes, 0 for no cap;
+	// the files past it are left in unprobed
+	probeLimit int
+	probed     int
+	unprobed   []string
+	// sink applies or, for dry runs, records every side effect of the pass
+	sink sink
+	// lastCoverDir and lastCoverImages hold the folder images of the directory read last
+	lastCoverDir    string
+	lastCoverImages []*covers.Image
+
+	lastProgress time.Time
+}
+
+// pendingFile is a new file waiting to be dispatched
+type pendingFile struct {
+	path  string
+	entry ManifestEntry
+}
+
+// newScanPass creates a real pass, records the run and announces it to subscribers
+func newScanPass(ctl context.Context, gate *pauseGate, root Root, trigger Trigger) *scanPass {
+	p := newPass(context.Background(), ctl, gate, root, trigger, dbSink{})
+	p.sink.start(p)
+	return p
+}
+
+// newPass creates the state of a pass without starting it
+func newPass(ctx, ctl context.Context, gate *pauseGate, root Root, trigger Trigger, s sink) *scanPass {
+	p := &scanPass{
+		ctx:  ctx,
+		ctl:  ctl,
+		gate: gate,
+		root: root,
+		sink: s,
+		seen: make(map[string]struct{}),
+		result: &ScanResult{
+			ScanID:    uuid.New().String(),
+			Root:      root.Name,
+			Path:      root.Path,
+			Trigger:   trigger,
+			Status:    RunRunning,
+			StartedAt: time.Now(),
+		},
+		lastProgress: time.Now(),
+	}
+	p.ignores = newIgnoreSet(root.Path, os.ReadFile)
+	p.directives = newDirectiveSet(root.Path, os.ReadFile, func(file string, err error) {
+		slog.Warn("Invalid directive file", "file", file, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(file, "directives", err)
+	})
+	p.cues = newCueSet(root.Path, func(file string, err error) {
+		slog.Warn("Invalid cue sheet", "file", file, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(file, "cue", err)
+	})
+	return p
+}
+
+// walk traverses dir and visits every allowed audio and playlist file below it, skipping ignored directories
+func (p *scanPass) walk(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err := p.checkpoint(); err != nil {
+			return err
+		}
+		if err != nil {
+			slog.Warn("Error accessing path", "path", path, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(path, "access", err)
+			return nil // Continue walking
+		}
+
+		if d.IsDir() {
+			// Security: Skip hidden directories (e.g. .git, .trash)
+			if isHiddenDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			if rel, err := filepath.Rel(p.root.Path, path); err == nil && rel != "." && (p.root.excluded(rel) || p.ignores.match(rel, true)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			slog.Warn("Failed to stat file", "path", path, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(path, "stat", err)
+			return nil
+		}
+
+		p.visitFile(path, info)
+		return nil
+	})
+}
+
+// visitFile compares a file against the manifest. Changed files are
+// dispatched immediately; new files are held back for reconciliation.
+func (p *scanPass) visitFile(path string, info fs.FileInfo) {
+	// The extension only nominates candidates; dispatch validates the content
+	playlist := playlistfile.IsPlaylist(path)
+	if !isAudioCandidate(path) && !playlist {
+		return
+	}
+
+	// Normalize path relative to root for consistency
+	relPath, err := filepath.Rel(p.root.Path, path)
+	if err != nil {
+		return
+	}
+	if playlist {
+		if !p.root.excluded(relPath) && !p.ignores.ignored(relPath, false) {
+			p.playlists = append(p.playlists, relPath)
+		}
+		return
+	}
+	if p.root.excluded(relPath) || !p.root.included(relPath) || p.ignores.ignored(relPath, false) {
+		return
+	}
+	p.seen[relPath] = struct{}{}
+	p.result.Seen++
+	p.progress()
+
+	existing, known := p.manifest[relPath]
+	if known && existing.MissingSince != nil {
+		p.restored = append(p.restored, relPath)
+	}
+	directives := p.directives.forFile(relPath).fingerprint()
+	_, _, cueHash := p.cues.forFile(relPath)
+	if known && existing.Matches(info.Size(), info.ModTime()) && existing.Directives == directives && existing.CueHash == cueHash {
+		p.result.Unchanged++
+		p.unchanged = append(p.unchanged, relPath)
+		return
+	}
+	if q, ok := p.quarantine[relPath]; ok && q.Matches(info.Size(), info.ModTime()) {
+		// Still the file that failed validation, no need to probe it again
+		p.quarantined = append(p.quarantined, relPath)
+		return
+	}
+	if !p.mayProbe(relPath) {
+		return
+	}
+
+	entry := ManifestEntry{
+		FilePath:   relPath,
+		SizeBytes:  info.Size(),
+		ModTime:    info.ModTime(),
+		Directives: directives,
+		CueHash:    cueHash,
+	}
+	if HashContent {
+		if hash, err := hashFile(path); err == nil {
+			entry.ContentHash = &hash
+		} else {
+			slog.Warn("Failed to hash file", "path", path, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(path, "hash", err)
+		}
+	}
+
+	if !known {
+		p.added = append(p.added, pendingFile{path: path, entry: entry})
+		return
+	}
+
+	p.result.Changed++
+	p.dispatch(entry)
+}
+
+// dispatchPending sends the new files that were not matched as moves to the worker
+func (p *scanPass) dispatchPending() error {
+	defer func() { p.added = nil }()
+	for _, f := range p.added {
+		if err := p.checkpoint(); err != nil {
+			return err
+		}
+		p.result.Added++
+		p.dispatch(f.entry)
+		p.progress()
+	}
+	return nil
+}
+
+// mayProbe counts a file the pass is about to hash and probe, or records it
+// as unprobed once probeLimit is reached
+func (p *scanPass) mayProbe(relPath string) bool {
+	if p.probeLimit > 0 && p.probed >= p.probeLimit {
+		p.unprobed = append(p.unprobed, relPath)
+		return false
+	}
+	p.probed++
+	return true
+}
+
+// checkpoint blocks while the pass is paused and reports cancellation
+func (p *scanPass) checkpoint() error {
+	return p.gate.wait(p.ctl)
+}
+
+// dispatch validates a file by its content and hands it to the sink to be
+// indexed. Files that fail validation are quarantined instead.
+func (p *scanPass) dispatch(entry ManifestEntry) {
+	md, reason, err := probeFile(filepath.Join(p.root.Path, entry.FilePath))
+	if reason != "" {
+		p.result.Quarantined++
+		p.sink.quarantine(p, entry, reason, err, md)
+		return
+	}
+	if err != nil {
+		slog.Warn("Failed to probe file", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.result.Failed++
+		p.fileError(entry.FilePath, "probe", err)
+		return
+	}
+	p.sink.index(p, entry, md)
+}
+
+// fileError records a per-file failure on the run and notifies subscribers
+func (p *scanPass) fileError(path, stage string, err error) {
+	p.result.Errors++
+	if p.result.Errors > maxRecordedErrors {
+		return
+	}
+
+	if rel, relErr := filepath.Rel(p.root.Path, path); relErr == nil && filepath.IsAbs(path) {
+		path = rel
+	}
+	p.sink.fileError(p, FileError{
+		ScanID:    p.result.ScanID,
+		FilePath:  path,
+		Stage:     stage,
+		Error:     err.Error(),
+		CreatedAt: time.Now(),
+	})
+}
+
+// progress publishes the running counters at most once per progressInterval
+func (p *scanPass) progress() {
+	if time.Since(p.lastProgress) < progressInterval {
+		return
+	}
+	p.lastProgress = time.Now()
+	p.sink.progress(p)
+}
+
+// finish records the outcome of the pass through the sink
+func (p *scanPass) finish(err error) {
+	finishedAt := time.Now()
+	p.result.FinishedAt = &finishedAt
+	p.result.DurationMs = finishedAt.Sub(p.result.StartedAt).Milliseconds()
+	p.result.Restored = len(p.restored)
+	p.result.Status = RunCompleted
+	if errors.Is(err, context.Canceled) {
+		p.result.Status = RunCancelled
+		slog.Info("Scan cancelled", "files_seen", p.result.Seen, "jobs_dispatched", p.result.Dispatched, "scan_id", p.result.ScanID)
+	} else if err != nil {
+		p.result.Status = RunFailed
+		p.result.Error = err.Error()
+		slog.Error("Scan failed", "error", err, "scan_id", p.result.ScanID)
+	} else {
+		slog.Info("Scan complete",
+			"duration", finishedAt.Sub(p.result.StartedAt).String(),
+			"files_seen", p.result.Seen,
+			"added", p.result.Added,
+			"changed", p.result.Changed,
+			"unchanged", p.result.Unchanged,
+			"moved", p.result.Moved,
+			"missing", p.result.Missing,
+			"still_missing", p.result.StillMissing,
+			"restored", p.result.Restored,
+			"indexed", p.result.Indexed,
+			"quarantined", p.result.Quarantined,
+			"corrupt", p.result.Corrupt,
+			"playlists", p.result.Playlists,
+			"jobs_dispatched", p.result.Dispatched,
+			"failed", p.result.Failed,
+			"errors", p.result.Errors,
+			"scan_id", p.result.ScanID,
+		)
+	}
+	p.sink.finish(p)
+}
+
+// isHiddenDir reports whether a directory should be skipped by the scanner
+func isHiddenDir(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "."
+}
+
+// isAudioCandidate reports whether a path has an audio extension worth probing
+func isAudioCandidate(path string) bool {
+	return tags.IsAudioExtension(filepath.Ext(path))
+}
@@ -0,0 +1,329 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sonantica-core/database"
+	"sonantica-core/models"
+	"sonantica-core/playlistfile"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxPlaylistSize bounds the playlist files read into memory
+const maxPlaylistSize = 4 << 20
+
+// playlistSource is the state of a playlist imported from a file
+type playlistSource struct {
+	hash       string
+	unresolved int
+}
+
+// syncPlaylists imports the playlist files seen by the pass as MANUAL
+// playlists. It runs once the audio files of the pass are indexed so entries
+// can resolve against them. Files whose content did not change since their
+// last import are skipped, unless some of their entries were not found.
+func (p *scanPass) syncPlaylists() error {
+	if len(p.playlists) == 0 {
+		return nil
+	}
+	known, err := loadPlaylistSources(p.ctx, p.root.Path)
+	if err != nil {
+		slog.Warn("Failed to load imported playlists", "error", err, "scan_id", p.result.ScanID)
+		return nil
+	}
+
+	var idx *trackIndex
+	for _, rel := range p.playlists {
+		if err := p.checkpoint(); err != nil {
+			return err
+		}
+		abs := filepath.Join(p.root.Path, rel)
+		data, err := readPlaylistFile(abs)
+		if err != nil {
+			slog.Warn("Failed to read playlist", "file", rel, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(abs, "playlist", err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:16])
+		if src, ok := known[rel]; ok && src.hash == hash && src.unresolved == 0 {
+			continue
+		}
+
+		pl, err := playlistfile.Parse(rel, data)
+		if err != nil {
+			slog.Warn("Invalid playlist", "file", rel, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(abs, "playlist", err)
+			continue
+		}
+		if idx == nil {
+			if idx, err = loadTrackIndex(p.ctx); err != nil {
+				slog.Warn("Failed to load tracks for playlist import", "error", err, "scan_id", p.result.ScanID)
+				return nil
+			}
+		}
+
+		var trackIDs, unresolved []string
+		for _, e := range pl.Entries {
+			if id, ok := idx.resolve(e, filepath.Dir(abs)); ok {
+				trackIDs = append(trackIDs, id)
+			} else {
+				unresolved = append(unresolved, e.Location)
+			}
+		}
+		name := pl.Name
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(rel), filepath.Ext(rel))
+		}
+		if err := p.sink.importPlaylist(p, rel, name, hash, trackIDs, unresolved); err != nil {
+			slog.Warn("Failed to import playlist", "file", rel, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(abs, "playlist", err)
+			continue
+		}
+		p.result.Playlists++
+		slog.Info("Imported playlist", "file", rel, "tracks", len(trackIDs), "unresolved", len(unresolved), "scan_id", p.result.ScanID)
+	}
+	return nil
+}
+
+// removePlaylistSources deletes the playlists imported from a file, or from
+// any file below a directory, that no longer exists
+func (p *scanPass) removePlaylistSources(rel string) {
+	n, err := p.sink.removePlaylists(p, rel)
+	if err != nil {
+		slog.Warn("Failed to remove imported playlists", "path", rel, "error", err, "scan_id", p.result.ScanID)
+		return
+	}
+	p.result.Playlists += n
+}
+
+func readPlaylistFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxPlaylistSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPlaylistSize {
+		return nil, fmt.Errorf("playlist larger than %d bytes", maxPlaylistSize)
+	}
+	return data, nil
+}
+
+// loadPlaylistSources returns the playlists imported from files under a root, keyed by source path
+func loadPlaylistSources(ctx context.Context, root string) (map[string]playlistSource, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT source_path, COALESCE(source_hash, ''), COALESCE(cardinality(unresolved), 0)
+		FROM playlists WHERE source_root = $1
+	`, root)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sources := make(map[string]playlistSource)
+	for rows.Next() {
+		var rel string
+		var src playlistSource
+		if err := rows.Scan(&rel, &src.hash, &src.unresolved); err != nil {
+			return nil, err
+		}
+		sources[filepath.FromSlash(rel)] = src
+	}
+	return sources, rows.Err()
+}
+
+// importPlaylist creates or refreshes the playlist linked to a file. The file
+// is the source of truth: its tracks replace those of the playlist.
+func importPlaylist(ctx context.Context, root, rel, name, hash string, trackIDs, unresolved []string) error {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	source := filepath.ToSlash(rel)
+	var id string
+	err = tx.QueryRow(ctx, `SELECT id FROM playlists WHERE source_root = $1 AND source_path = $2 FOR UPDATE`, root, source).Scan(&id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		err = tx.QueryRow(ctx, `
+			INSERT INTO playlists (name, type, description, source_root, source_path, source_hash, unresolved, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+			RETURNING id
+		`, name, string(models.PlaylistTypeManual), "Imported from "+path.Base(source), root, source, hash, unresolved).Scan(&id)
+	case err == nil:
+		_, err = tx.Exec(ctx, `
+			UPDATE playlists SET name = $2, source_hash = $3, unresolved = $4, updated_at = NOW()
+			WHERE id = $1
+		`, id, name, hash, unresolved)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM playlist_tracks WHERE playlist_id = $1`, id); err != nil {
+		return err
+	}
+	// A playlist holds each track once; repeated entries keep their first position
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO playlist_tracks (playlist_id, track_id, position, added_at)
+		SELECT $1, e.track_id, MIN(e.position) - 1, NOW()
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS e(track_id, position)
+		GROUP BY e.track_id
+	`, id, append([]string{}, trackIDs...)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// trackIndex resolves playlist entries against the library
+type trackIndex struct {
+	byPath  map[string]string   // file_path → track id
+	byName  map[string][]string // Lower-cased file name → file paths
+	byStem  map[string][]string // Lower-cased file name without extension → file paths
+	byTitle map[string]string   // Lower-cased artist and title → track id, "" when ambiguous
+}
+
+func newTrackIndex() *trackIndex {
+	return &trackIndex{
+		byPath:  make(map[string]string),
+		byName:  make(map[string][]string),
+		byStem:  make(map[string][]string),
+		byTitle: make(map[string]string),
+	}
+}
+
+// loadTrackIndex reads the tracks still in the library. Cue sheet tracks share
+// the path of their image, which resolves to the first of them.
+func loadTrackIndex(ctx context.Context) (*trackIndex, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT t.id, t.file_path, t.title, COALESCE(a.name, '')
+		FROM tracks t
+		LEFT JOIN artists a ON t.artist_id = a.id
+		WHERE t.status <> 'deleted'
+		ORDER BY t.file_path, t.cue_track NULLS FIRST
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	idx := newTrackIndex()
+	for rows.Next() {
+		var id, filePath, title, artist string
+		if err := rows.Scan(&id, &filePath, &title, &artist); err != nil {
+			return nil, err
+		}
+		idx.add(id, filePath, title, artist)
+	}
+	return idx, rows.Err()
+}
+
+func (idx *trackIndex) add(id, filePath, title, artist string) {
+	if title != "" && artist != "" {
+		key := titleKey(artist, title)
+		if other, ok := idx.byTitle[key]; ok && other != id {
+			idx.byTitle[key] = ""
+		} else {
+			idx.byTitle[key] = id
+		}
+	}
+	if _, ok := idx.byPath[filePath]; ok {
+		return
+	}
+	idx.byPath[filePath] = id
+	name := strings.ToLower(path.Base(filepath.ToSlash(filePath)))
+	idx.byName[name] = append(idx.byName[name], filePath)
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	idx.byStem[stem] = append(idx.byStem[stem], filePath)
+}
+
+// resolve finds the track an entry refers to. dir is the absolute directory
+// of the playlist file, against which relative locations are resolved.
+// Locations that are not in the library fall back to the closest file of
+// the same name, then to the artist and title of the entry.
+func (idx *trackIndex) resolve(e playlistfile.Entry, dir string) (string, bool) {
+	if e.Location != "" && !e.Remote() {
+		loc := strings.ReplaceAll(e.Location, `\`, "/")
+		if !path.IsAbs(loc) && !isDrivePath(loc) {
+			loc = path.Join(filepath.ToSlash(dir), loc)
+		}
+		loc = path.Clean(loc)
+		if id, ok := idx.byPath[mediaTrackPath(filepath.FromSlash(loc))]; ok {
+			return id, true
+		}
+		if id, ok := idx.closest(loc); ok {
+			return id, true
+		}
+	}
+	if e.Artist != "" && e.Title != "" {
+		if id := idx.byTitle[titleKey(e.Artist, e.Title)]; id != "" {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// closest matches a location by file name, then by name without extension
+// for playlists that predate a re-encode, and picks the candidate sharing the
+// most parent directories with it. This covers playlists written on another
+// machine or before the library moved. Ties are left unresolved.
+func (idx *trackIndex) closest(loc string) (string, bool) {
+	parts := strings.Split(strings.ToLower(loc), "/")
+	name := parts[len(parts)-1]
+	dirs := parts[:len(parts)-1]
+
+	for _, candidates := range [][]string{idx.byName[name], idx.byStem[strings.TrimSuffix(name, path.Ext(name))]} {
+		best, bestScore, tie := "", -1, false
+		for _, c := range candidates {
+			cparts := strings.Split(strings.ToLower(filepath.ToSlash(c)), "/")
+			score := commonSuffix(dirs, cparts[:len(cparts)-1])
+			switch {
+			case score > bestScore:
+				best, bestScore, tie = c, score, false
+			case score == bestScore:
+				tie = true
+			}
+		}
+		if best != "" {
+			if tie {
+				return "", false
+			}
+			return idx.byPath[best], true
+		}
+	}
+	return "", false
+}
+
+// commonSuffix counts the trailing elements a and b have in common
+func commonSuffix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
+
+// isDrivePath reports whether a slash-separated path starts with a Windows drive letter
+func isDrivePath(p string) bool {
+	return len(p) >= 3 && p[1] == ':' && p[2] == '/'
+}
+
+func titleKey(artist, title string) string {
+	return strings.ToLower(artist) + "\x00" + strings.ToLower(title)
+}
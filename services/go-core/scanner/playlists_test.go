@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"testing"
+
+	"sonantica-core/playlistfile"
+)
+
+func TestTrackIndexResolve(t *testing.T) {
+	MediaPath = "/media"
+	idx := newTrackIndex()
+	idx.add("time", "Pink Floyd/The Dark Side of the Moon/04 - Time.flac", "Time", "Pink Floyd")
+	idx.add("innuendo", "Queen/Innuendo/01 Innuendo.flac", "Innuendo", "Queen")
+	idx.add("intro-a", "A/First/01 Intro.mp3", "Intro", "A")
+	idx.add("intro-b", "B/Second/01 Intro.mp3", "Intro", "B")
+	idx.add("outside", "/mnt/usb/Live/Set.flac", "Set", "DJ")
+
+	tests := []struct {
+		name  string
+		entry playlistfile.Entry
+		dir   string
+		want  string
+	}{
+		{"relative with Windows separators", playlistfile.Entry{Location: `..\Pink Floyd\The Dark Side of the Moon\04 - Time.flac`}, "/media/Playlists", "time"},
+		{"absolute under media", playlistfile.Entry{Location: "/media/Queen/Innuendo/01 Innuendo.flac"}, "/media", "innuendo"},
+		{"absolute outside media", playlistfile.Entry{Location: "/mnt/usb/Live/Set.flac"}, "/media", "outside"},
+		{"other machine", playlistfile.Entry{Location: "D:/Music/Pink Floyd/The Dark Side of the Moon/04 - Time.flac"}, "/media", "time"},
+		{"re-encoded", playlistfile.Entry{Location: "/home/me/Music/Queen/Innuendo/01 Innuendo.mp3"}, "/media", "innuendo"},
+		{"closest directory wins", playlistfile.Entry{Location: "/old/B/Second/01 Intro.mp3"}, "/media", "intro-b"},
+		{"ambiguous name", playlistfile.Entry{Location: "/old/01 Intro.mp3"}, "/media", ""},
+		{"artist and title", playlistfile.Entry{Location: "gone.ogg", Artist: "queen", Title: "INNUENDO"}, "/media", "innuendo"},
+		{"remote stream", playlistfile.Entry{Location: "http://radio.example.com/04 - Time.flac"}, "/media", ""},
+	}
+	for _, tt := range tests {
+		got, ok := idx.resolve(tt.entry, tt.dir)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: resolve = %q, %v, want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"sonantica-core/database"
+	"sonantica-core/tags"
+)
+
+// Quarantine reasons stored in library_quarantine.reason
+const (
+	QuarantineUnsupported = "unsupported" // Content is not a recognised audio container
+	QuarantineCorrupt     = "corrupt"     // Recognised container that cannot be parsed
+	QuarantineMisnamed    = "misnamed"    // Valid audio whose extension promises another container
+)
+
+// QuarantineEntry is a file the scanner refused to index or dispatch
+type QuarantineEntry struct {
+	Root      string    `json:"root"`
+	FilePath  string    `json:"filePath"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail"`
+	Container *string   `json:"container,omitempty"`
+	Codec     *string   `json:"codec,omitempty"`
+	SizeBytes int64     `json:"sizeBytes"`
+	ScanID    string    `json:"scanId"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// probeFile validates a file by its content and reads its tags.
+// A non-empty reason means the file must be quarantined; otherwise err is an I/O failure.
+func probeFile(path string) (*tags.Metadata, string, error) {
+	md, err := tags.ReadFile(path)
+	switch {
+	case errors.Is(err, tags.ErrUnsupported):
+		return nil, QuarantineUnsupported, err
+	case errors.Is(err, tags.ErrMalformed):
+		return nil, QuarantineCorrupt, err
+	case err != nil:
+		return nil, "", err
+	}
+
+	if ext := filepath.Ext(path); !md.MatchesExtension(ext) {
+		return md, QuarantineMisnamed, fmt.Errorf("extension %s does not match the detected %s container (%s)", ext, md.Container, md.Codec)
+	}
+	return md, "", nil
+}
+
+// loadQuarantine returns the quarantined files of a root with the size and mtime they had when probed
+func loadQuarantine(ctx context.Context, root string) (map[string]ManifestEntry, error) {
+	rows, err := database.DB.Query(ctx, `SELECT file_path, size_bytes, mtime FROM library_quarantine WHERE root = $1`, root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]ManifestEntry)
+	for rows.Next() {
+		var e ManifestEntry
+		if err := rows.Scan(&e.FilePath, &e.SizeBytes, &e.ModTime); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantine row: %w", err)
+		}
+		entries[e.FilePath] = e
+	}
+	return entries, rows.Err()
+}
+
+// quarantineFile records a file that failed validation
+func quarantineFile(ctx context.Context, root, scanID string, e ManifestEntry, reason string, cause error, md *tags.Metadata) error {
+	var container, codec *string
+	if md != nil {
+		container, codec = nullString(md.Container), nullString(md.Codec)
+	}
+	_, err := database.DB.Exec(ctx, `
+		INSERT INTO library_quarantine (root, file_path, reason, detail, container, codec, size_bytes, mtime, scan_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (root, file_path) DO UPDATE SET
+			reason = EXCLUDED.reason,
+			detail = EXCLUDED.detail,
+			container = EXCLUDED.container,
+			codec = EXCLUDED.codec,
+			size_bytes = EXCLUDED.size_bytes,
+			mtime = EXCLUDED.mtime,
+			scan_id = EXCLUDED.scan_id,
+			last_seen = NOW()
+	`, root, e.FilePath, reason, cause.Error(), container, codec, e.SizeBytes, e.ModTime, scanID)
+	return err
+}
+
+// touchQuarantine marks unchanged quarantined files as seen by scanID
+func touchQuarantine(ctx context.Context, root, scanID string, paths []string) error {
+	for start := 0; start < len(paths); start += manifestBatchSize {
+		batch := paths[start:min(start+manifestBatchSize, len(paths))]
+		if _, err := database.DB.Exec(ctx, `
+			UPDATE library_quarantine SET scan_id = $2, last_seen = NOW()
+			WHERE root = $1 AND file_path = ANY($3)
+		`, root, scanID, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune drops the quarantine entries and imported playlists of the files a
+// completed full scan did not encounter
+func (p *scanPass) prune() {
+	if p.result.Seen == 0 {
+		return // Same guard as reconciliation: an empty walk proves nothing
+	}
+	p.sink.prune(p)
+}
+
+// ListQuarantine returns quarantined files, optionally restricted to a root path, most recent first
+func ListQuarantine(ctx context.Context, root string, limit, offset int) ([]QuarantineEntry, error) {
+	query := `
+		SELECT q.file_path, q.reason, q.detail, q.container, q.codec, q.size_bytes, q.scan_id, q.first_seen, q.last_seen, q.root
+		FROM library_quarantine q`
+	args := []any{limit, offset}
+	if root != "" {
+		query += ` WHERE q.root = $3`
+		args = append(args, root)
+	}
+	query += ` ORDER BY q.last_seen DESC, q.file_path LIMIT $1 OFFSET $2`
+
+	rows, err := database.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	names := rootNames()
+	entries := make([]QuarantineEntry, 0)
+	for rows.Next() {
+		var q QuarantineEntry
+		var rootPath string
+		if err := rows.Scan(&q.FilePath, &q.Reason, &q.Detail, &q.Container, &q.Codec, &q.SizeBytes,
+			&q.ScanID, &q.FirstSeen, &q.LastSeen, &rootPath); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantine row: %w", err)
+		}
+		q.Root = names[rootPath]
+		entries = append(entries, q)
+	}
+	return entries, rows.Err()
+}
+
+// invalidateTracks marks the tracks of a known file that failed validation as
+// invalid, so they stop looking playable with stale metadata. It returns how
+// many tracks were marked.
+func invalidateTracks(ctx context.Context, trackPath string) (int64, error) {
+	tag, err := database.DB.Exec(ctx, `
+		UPDATE tracks SET status = 'invalid'
+		WHERE file_path = $1 AND status IN ('active', 'missing')
+	`, trackPath)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// revalidateTracks reactivates the tracks of a file that passes validation again
+func revalidateTracks(ctx context.Context, trackPath string) error {
+	_, err := database.DB.Exec(ctx, `
+		UPDATE tracks SET status = 'active', missing_since = NULL
+		WHERE file_path = $1 AND status = 'invalid' AND merged_into IS NULL
+	`, trackPath)
+	return err
+}
+
+// ReleaseQuarantine forgets a quarantined file so the next scan probes it again.
+// It reports whether the file was quarantined.
+func ReleaseQuarantine(ctx context.Context, root Root, path string) (bool, error) {
+	tag, err := database.DB.Exec(ctx, `DELETE FROM library_quarantine WHERE root = $1 AND file_path = $2`, root.Path, path)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,225 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"sonantica-core/database"
+)
+
+// unseen returns the manifest entries that the walk did not encounter
+func (p *scanPass) unseen() map[string]ManifestEntry {
+	gone := make(map[string]ManifestEntry)
+	for path, e := range p.manifest {
+		if _, ok := p.seen[path]; !ok {
+			gone[path] = e
+		}
+	}
+
+	// Guard against an unmounted or emptied volume wiping the whole library
+	if len(p.seen) == 0 && len(gone) > 0 {
+		slog.Warn("Scan found no files but the manifest is not empty, skipping reconciliation",
+			"root", p.root.Name, "path", p.root.Path, "manifest", len(gone), "scan_id", p.result.ScanID)
+		return nil
+	}
+	return gone
+}
+
+// reconcile matches vanished files against new ones to detect moves, then
+// marks whatever is left as missing and expires tracks past the grace period
+func (p *scanPass) reconcile(gone map[string]ManifestEntry) {
+	if len(gone) == 0 {
+		return
+	}
+
+	index := newMoveIndex(gone)
+	remaining := p.added[:0]
+	for _, f := range p.added {
+		old, ok := index.match(f.entry)
+		if !ok {
+			remaining = append(remaining, f)
+			continue
+		}
+		relinked, err := p.sink.move(p, old, f.entry)
+		if err != nil {
+			slog.Warn("Failed to record moved file", "from", old.FilePath, "to", f.entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+			remaining = append(remaining, f)
+			continue
+		}
+		delete(gone, old.FilePath)
+
+		if !relinked {
+			// The worker never produced a track for the old path, analyze the file under its new name
+			remaining = append(remaining, f)
+			continue
+		}
+		p.result.Moved++
+		slog.Debug("Detected moved file", "from", old.FilePath, "to", f.entry.FilePath, "scan_id", p.result.ScanID)
+		if old.Directives != f.entry.Directives || old.CueHash != f.entry.CueHash {
+			// Moved under different directives or cue sheet, re-index the relinked tracks
+			p.result.Changed++
+			p.dispatch(f.entry)
+		}
+	}
+	p.added = remaining
+
+	if len(gone) == 0 {
+		return
+	}
+	if err := p.sink.missing(p, gone); err != nil {
+		slog.Warn("Failed to mark missing files", "error", err, "scan_id", p.result.ScanID)
+		return
+	}
+	// Files already missing before this scan are re-marked but only counted apart
+	for _, e := range gone {
+		if e.MissingSince == nil {
+			p.result.Missing++
+		} else {
+			p.result.StillMissing++
+		}
+	}
+}
+
+// moveIndex looks up vanished files by content hash, or by size and base
+// name when hashes are unavailable. Ambiguous candidates are never matched.
+type moveIndex struct {
+	byHash map[string][]ManifestEntry
+	byName map[string][]ManifestEntry
+}
+
+func newMoveIndex(gone map[string]ManifestEntry) *moveIndex {
+	idx := &moveIndex{
+		byHash: make(map[string][]ManifestEntry),
+		byName: make(map[string][]ManifestEntry),
+	}
+	for _, e := range gone {
+		if e.ContentHash != nil {
+			idx.byHash[*e.ContentHash] = append(idx.byHash[*e.ContentHash], e)
+		}
+		key := nameKey(e)
+		idx.byName[key] = append(idx.byName[key], e)
+	}
+	return idx
+}
+
+// match returns the vanished entry that e most likely replaces and consumes it
+func (idx *moveIndex) match(e ManifestEntry) (ManifestEntry, bool) {
+	var candidates []ManifestEntry
+	if e.ContentHash != nil {
+		candidates = idx.byHash[*e.ContentHash]
+	}
+	if candidates == nil {
+		candidates = idx.byName[nameKey(e)]
+	}
+	if len(candidates) != 1 || candidates[0].SizeBytes != e.SizeBytes {
+		return ManifestEntry{}, false
+	}
+
+	old := candidates[0]
+	if old.ContentHash != nil {
+		delete(idx.byHash, *old.ContentHash)
+	}
+	delete(idx.byName, nameKey(old))
+	return old, true
+}
+
+func nameKey(e ManifestEntry) string {
+	return fmt.Sprintf("%d|%s", e.SizeBytes, filepath.Base(e.FilePath))
+}
+
+// relinkable reports whether recordMove would relink a track for the vanished file
+func relinkable(ctx context.Context, root Root, old ManifestEntry) (bool, error) {
+	var ok bool
+	err := database.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tracks WHERE `+relinkWhere+`)`,
+		root.trackPath(old.FilePath)).Scan(&ok)
+	return ok, err
+}
+
+// relinkWhere selects the tracks of a vanished file, given its track path as $1
+const relinkWhere = `file_path = $1 AND status <> 'deleted'`
+
+// recordMove points the track at its new path and moves the manifest row.
+// It reports whether an existing track was relinked.
+func recordMove(ctx context.Context, root Root, scanID string, old, moved ManifestEntry) (bool, error) {
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE tracks SET file_path = $2, status = 'active', missing_since = NULL,
+			file_size = $3, file_mtime = $4, content_hash = COALESCE($5, content_hash)
+		WHERE `+relinkWhere, root.trackPath(old.FilePath), root.trackPath(moved.FilePath), moved.SizeBytes, moved.ModTime, moved.ContentHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to relink track: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM library_files WHERE root = $1 AND file_path = $2`, root.Path, old.FilePath); err != nil {
+		return false, fmt.Errorf("failed to remove old manifest entry: %w", err)
+	}
+	if err := upsertManifestEntry(ctx, tx, root.Path, scanID, root.trackPath(moved.FilePath), moved); err != nil {
+		return false, fmt.Errorf("failed to record new manifest entry: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, tx.Commit(ctx)
+}
+
+// markMissing flags files that are no longer on disk and hides their tracks
+func markMissing(ctx context.Context, root string, paths []string) error {
+	for start := 0; start < len(paths); start += manifestBatchSize {
+		batch := paths[start:min(start+manifestBatchSize, len(paths))]
+		if _, err := database.DB.Exec(ctx, `
+			UPDATE library_files SET missing_since = COALESCE(missing_since, NOW()), updated_at = NOW()
+			WHERE root = $1 AND file_path = ANY($2)
+		`, root, batch); err != nil {
+			return err
+		}
+		if _, err := database.DB.Exec(ctx, `
+			UPDATE tracks SET status = 'missing', missing_since = COALESCE(missing_since, NOW())
+			WHERE file_path IN (SELECT track_path FROM library_files WHERE root = $1 AND file_path = ANY($2))
+			  AND status = 'active'
+		`, root, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreTracks reactivates tracks whose files have reappeared. Invalid tracks
+// stay invalid until their file passes validation again.
+func restoreTracks(ctx context.Context, root string, paths []string) error {
+	for start := 0; start < len(paths); start += manifestBatchSize {
+		batch := paths[start:min(start+manifestBatchSize, len(paths))]
+		if _, err := database.DB.Exec(ctx, `
+			UPDATE library_files SET missing_since = NULL, updated_at = NOW()
+			WHERE root = $1 AND file_path = ANY($2)
+		`, root, batch); err != nil {
+			return err
+		}
+		if _, err := database.DB.Exec(ctx, `
+			UPDATE tracks SET status = 'active', missing_since = NULL
+			WHERE file_path IN (SELECT track_path FROM library_files WHERE root = $1 AND file_path = ANY($2))
+			  AND status IN ('missing', 'deleted') AND merged_into IS NULL
+		`, root, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expireMissing marks tracks as deleted once they have been missing longer than MissingGracePeriod
+func expireMissing(ctx context.Context, root string) (int64, error) {
+	tag, err := database.DB.Exec(ctx, `
+		UPDATE tracks SET status = 'deleted'
+		WHERE status = 'missing'
+		  AND missing_since < NOW() - make_interval(secs => $2)
+		  AND file_path IN (SELECT track_path FROM library_files WHERE root = $1 AND missing_since IS NOT NULL)
+	`, root, MissingGracePeriod.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
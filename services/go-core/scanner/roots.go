@@ -0,0 +1,130 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Root is a named library directory with its own scan rules
+type Root struct {
+	Name     string
+	Path     string
+	Include  []string // Glob patterns a file must match to be scanned; empty means everything
+	Exclude  []string // Glob patterns for files and directories to skip
+	Enabled  bool     // Disabled roots are neither watched nor polled
+	Schedule string   // Cron expression of the periodic full scans, run by the scheduler
+}
+
+var (
+	// MediaPath is the primary media directory. Tracks under it are stored with
+	// paths relative to it; tracks under other roots are stored with absolute paths.
+	MediaPath = "/media"
+
+	roots   []Root
+	rootsMu sync.RWMutex
+)
+
+// Roots returns the configured library roots
+func Roots() []Root {
+	rootsMu.RLock()
+	defer rootsMu.RUnlock()
+	return append([]Root(nil), roots...)
+}
+
+// LookupRoot returns the root with the given name
+func LookupRoot(name string) (Root, bool) {
+	rootsMu.RLock()
+	defer rootsMu.RUnlock()
+	for _, r := range roots {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Root{}, false
+}
+
+// rootNames maps root paths, as stored in library tables, to root names
+func rootNames() map[string]string {
+	names := make(map[string]string)
+	for _, r := range Roots() {
+		names[r.Path] = r.Name
+	}
+	return names
+}
+
+func setRoots(list []Root) {
+	rootsMu.Lock()
+	defer rootsMu.Unlock()
+	roots = append([]Root(nil), list...)
+}
+
+// trackPath converts a path relative to the root into the file_path stored on tracks
+func (r Root) trackPath(rel string) string {
+	return mediaTrackPath(filepath.Join(r.Path, rel))
+}
+
+// mediaTrackPath converts an absolute path into the file_path stored on tracks:
+// relative to MEDIA_PATH when it lies below it, absolute otherwise
+func mediaTrackPath(abs string) string {
+	if p, err := filepath.Rel(MediaPath, abs); err == nil && p != ".." && !strings.HasPrefix(p, "../") {
+		return p
+	}
+	return abs
+}
+
+// excluded reports whether a path relative to the root matches an exclude pattern
+func (r Root) excluded(rel string) bool {
+	for _, pattern := range r.Exclude {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether a file relative to the root passes the include patterns
+func (r Root) included(rel string) bool {
+	if len(r.Include) == 0 {
+		return true
+	}
+	for _, pattern := range r.Include {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated relative path against a glob pattern.
+// "**" matches any number of directories. Patterns without a slash are
+// matched against the base name only, so "*.tmp" excludes temp files anywhere.
+func matchGlob(pattern, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,50 @@
+package scanner
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"*.tmp", "Artist/Album/01.tmp", true},
+		{"*.tmp", "Artist/Album/01.flac", false},
+		{"Incoming", "Incoming", true},
+		{"Incoming", "Artist/Incoming", true},
+		{"Incoming/**", "Incoming", true},
+		{"Incoming/**", "Incoming/a/b.mp3", true},
+		{"Incoming/**", "Other/Incoming/b.mp3", false},
+		{"**/Scans/**", "Artist/Album/Scans/cover.flac", true},
+		{"**/*.flac", "a.flac", true},
+		{"Artist/*/01.flac", "Artist/Album/01.flac", true},
+		{"Artist/*/01.flac", "Artist/Album/CD1/01.flac", false},
+	}
+
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.rel); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.rel, got, c.want)
+		}
+	}
+}
+
+func TestTrackPath(t *testing.T) {
+	MediaPath = "/media"
+
+	cases := []struct {
+		root string
+		rel  string
+		want string
+	}{
+		{"/media", "Artist/01.flac", "Artist/01.flac"},
+		{"/media/lossless", "Artist/01.flac", "lossless/Artist/01.flac"},
+		{"/mnt/audiobooks", "Book/01.mp3", "/mnt/audiobooks/Book/01.mp3"},
+		{"/media-archive", "01.mp3", "/media-archive/01.mp3"},
+	}
+
+	for _, c := range cases {
+		if got := (Root{Path: c.root}).trackPath(c.rel); got != c.want {
+			t.Errorf("trackPath(%q, %q) = %q, want %q", c.root, c.rel, got, c.want)
+		}
+	}
+}
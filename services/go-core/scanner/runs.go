@@ -0,0 +1,213 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sonantica-core/cache"
+	"sonantica-core/database"
+)
+
+// Trigger records what started a scan
+type Trigger string
+
+const (
+	TriggerStartup  Trigger = "startup"  // First scan after the service starts
+	TriggerSchedule Trigger = "schedule" // Periodic polling scan
+	TriggerManual   Trigger = "manual"   // Requested through the API
+	TriggerWatch    Trigger = "watch"    // Filesystem watcher events
+	TriggerDryRun   Trigger = "dry_run"  // Dry runs, never recorded
+)
+
+// Scan run statuses stored in scan_runs.status
+const (
+	RunRunning     = "running"
+	RunCompleted   = "completed"
+	RunFailed      = "failed"
+	RunCancelled   = "cancelled"
+	RunInterrupted = "interrupted"
+)
+
+// Scan event types published on the scan event channel
+const (
+	EventScanStart       = "scan:start"
+	EventScanProgress    = "scan:progress"
+	EventFileError       = "scan:file_error"
+	EventFileQuarantined = "scan:file_quarantined"
+	EventScanPaused      = "scan:paused"
+	EventScanResumed     = "scan:resumed"
+	EventScanComplete    = "scan:complete"
+)
+
+const (
+	// progressInterval throttles progress events during a scan
+	progressInterval = 1 * time.Second
+	// maxRecordedErrors caps the per-file errors stored for a single run
+	maxRecordedErrors = 1000
+)
+
+// FileError is a single file that could not be processed during a scan
+type FileError struct {
+	ScanID    string    `json:"scanId"`
+	FilePath  string    `json:"filePath"`
+	Stage     string    `json:"stage"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Event is published on the scan event channel and relayed to SSE clients
+type Event struct {
+	Type  string      `json:"type"`
+	Root  string      `json:"root"`
+	Stats *ScanResult `json:"stats,omitempty"`
+	Error *FileError  `json:"error,omitempty"`
+}
+
+func publish(ctx context.Context, event Event) {
+	if err := cache.PublishScanEvent(ctx, event.Type, event); err != nil {
+		slog.Debug("Failed to publish scan event", "type", event.Type, "error", err)
+	}
+}
+
+// insertRun records the start of a scan pass
+func insertRun(ctx context.Context, res *ScanResult) error {
+	_, err := database.DB.Exec(ctx, `
+		INSERT INTO scan_runs (id, root, root_path, trigger, status, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, res.ScanID, res.Root, res.Path, string(res.Trigger), res.Status, res.StartedAt)
+	return err
+}
+
+// completeRun stores the final counters of a scan pass
+func completeRun(ctx context.Context, res *ScanResult) error {
+	_, err := database.DB.Exec(ctx, `
+		UPDATE scan_runs SET
+			status = $2, finished_at = $3, duration_ms = $4, files_seen = $5,
+			added = $6, changed = $7, unchanged = $8, moved = $9, missing = $10, restored = $11,
+			dispatched = $12, failed = $13, errors = $14, error = NULLIF($15, ''), indexed = $16, quarantined = $17,
+			playlists = $18, corrupt = $19, still_missing = $20
+		WHERE id = $1
+	`, res.ScanID, res.Status, res.FinishedAt, res.DurationMs, res.Seen,
+		res.Added, res.Changed, res.Unchanged, res.Moved, res.Missing, res.Restored,
+		res.Dispatched, res.Failed, res.Errors, res.Error, res.Indexed, res.Quarantined, res.Playlists, res.Corrupt, res.StillMissing)
+	return err
+}
+
+// insertFileError appends a per-file error to a run
+func insertFileError(ctx context.Context, fe FileError) error {
+	_, err := database.DB.Exec(ctx, `
+		INSERT INTO scan_run_errors (scan_id, file_path, stage, error, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, fe.ScanID, fe.FilePath, fe.Stage, fe.Error, fe.CreatedAt)
+	return err
+}
+
+// recoverRuns marks runs left behind by a previous process as interrupted and
+// restores the last finished result of every root
+func recoverRuns(ctx context.Context) {
+	if tag, err := database.DB.Exec(ctx, `UPDATE scan_runs SET status = $1 WHERE status = $2`, RunInterrupted, RunRunning); err != nil {
+		slog.Warn("Failed to mark interrupted scan runs", "error", err)
+	} else if tag.RowsAffected() > 0 {
+		slog.Info("Marked interrupted scan runs", "count", tag.RowsAffected())
+	}
+
+	runs, err := queryRuns(ctx, `
+		SELECT DISTINCT ON (root) `+runColumns+`
+		FROM scan_runs WHERE status <> $1
+		ORDER BY root, started_at DESC
+	`, RunRunning)
+	if err != nil {
+		slog.Warn("Failed to load previous scan results", "error", err)
+		return
+	}
+
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for _, run := range runs {
+		if _, ok := lastResults[run.Root]; !ok {
+			lastResults[run.Root] = run
+		}
+	}
+}
+
+// runColumns is the column list shared by scan run queries
+const runColumns = `id, root, root_path, trigger, status, started_at, finished_at, COALESCE(duration_ms, 0),
+	files_seen, added, changed, unchanged, moved, missing, still_missing, restored, indexed, quarantined, dispatched, failed, errors, COALESCE(error, ''), playlists, corrupt`
+
+func queryRuns(ctx context.Context, query string, args ...any) ([]*ScanResult, error) {
+	rows, err := database.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]*ScanResult, 0)
+	for rows.Next() {
+		var r ScanResult
+		var trigger string
+		if err := rows.Scan(&r.ScanID, &r.Root, &r.Path, &trigger, &r.Status, &r.StartedAt, &r.FinishedAt, &r.DurationMs,
+			&r.Seen, &r.Added, &r.Changed, &r.Unchanged, &r.Moved, &r.Missing, &r.StillMissing, &r.Restored, &r.Indexed, &r.Quarantined,
+			&r.Dispatched, &r.Failed, &r.Errors, &r.Error, &r.Playlists, &r.Corrupt); err != nil {
+			return nil, fmt.Errorf("failed to scan run row: %w", err)
+		}
+		r.Trigger = Trigger(trigger)
+		runs = append(runs, &r)
+	}
+	return runs, rows.Err()
+}
+
+// ListRuns returns the most recent scan runs, optionally restricted to a root
+func ListRuns(ctx context.Context, root string, limit int) ([]*ScanResult, error) {
+	if root == "" {
+		return queryRuns(ctx, `SELECT `+runColumns+` FROM scan_runs ORDER BY started_at DESC LIMIT $1`, limit)
+	}
+	return queryRuns(ctx, `SELECT `+runColumns+` FROM scan_runs WHERE root = $1 ORDER BY started_at DESC LIMIT $2`, root, limit)
+}
+
+// GetRun returns a single scan run, or nil when it does not exist
+func GetRun(ctx context.Context, id string) (*ScanResult, error) {
+	runs, err := queryRuns(ctx, `SELECT `+runColumns+` FROM scan_runs WHERE id = $1`, id)
+	if err != nil || len(runs) == 0 {
+		return nil, err
+	}
+	return runs[0], nil
+}
+
+// PruneRuns deletes the finished runs started before a cutoff, with their
+// errors. The latest run of each root is kept so LastResult survives restarts.
+func PruneRuns(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := database.DB.Exec(ctx, `
+		DELETE FROM scan_runs
+		WHERE started_at < $1 AND status <> $2
+		  AND id NOT IN (SELECT DISTINCT ON (root) id FROM scan_runs ORDER BY root, started_at DESC)
+	`, before, RunRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune scan runs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListFileErrors returns the per-file errors recorded for a run
+func ListFileErrors(ctx context.Context, id string, limit, offset int) ([]FileError, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT scan_id, file_path, stage, error, created_at
+		FROM scan_run_errors WHERE scan_id = $1
+		ORDER BY id LIMIT $2 OFFSET $3
+	`, id, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan errors: %w", err)
+	}
+	defer rows.Close()
+
+	errs := make([]FileError, 0)
+	for rows.Next() {
+		var fe FileError
+		if err := rows.Scan(&fe.ScanID, &fe.FilePath, &fe.Stage, &fe.Error, &fe.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan error row: %w", err)
+		}
+		errs = append(errs, fe)
+	}
+	return errs, rows.Err()
+}
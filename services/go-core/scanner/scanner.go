@@ -3,36 +3,87 @@ package scanner
 import (
 	"context"
 	"fmt"
-	"io/fs"
 	"log/slog"
+	"maps"
+	"os"
 	"path/filepath"
 	"sonantica-core/cache"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 var (
-	// Security: Strict whitelist of allowed audio extensions
-	AllowedExtensions = map[string]bool{
-		".flac": true,
-		".mp3":  true,
-		".wav":  true,
-		".ogg":  true,
-		".m4a":  true,
-		".opus": true,
-		".alac": true,
-		".aiff": true,
-	}
-	rdb        *redis.Client
-	isScanning bool
+	// HashContent enables SHA-256 hashing of new and changed files during scans
+	HashContent = true
+	// MissingGracePeriod is how long a track may stay missing before it is marked deleted
+	MissingGracePeriod = 30 * 24 * time.Hour
+	// ReadTags indexes new and changed files from their embedded tags during scans
+	ReadTags = true
+	// DispatchAnalysis sends new and changed files to the analysis worker for enrichment
+	DispatchAnalysis = true
+	// VerifyIntegrity reads new and changed files in full to detect damaged audio during scans
+	VerifyIntegrity = false
+	// Fingerprint computes acoustic fingerprints of new and changed files during scans
+	Fingerprint = true
+	// MeasureLoudness reads new and changed files without ReplayGain tags in full to measure their loudness during scans
+	MeasureLoudness = false
+	// ExtractCovers reads the artwork embedded in new and changed files and next to them during scans
+	ExtractCovers = true
+
+	rdb *redis.Client
+
+	// stateMu guards the per-root results of finished scans
+	stateMu     sync.RWMutex
+	lastResults = make(map[string]*ScanResult)
 )
 
-// IsScanning returns whether a scan is currently in progress
-func IsScanning() bool {
-	return isScanning
+// ScanResult summarizes what a single scan pass found and dispatched
+type ScanResult struct {
+	ScanID       string     `json:"scanId"`
+	Root         string     `json:"root"`
+	Path         string     `json:"path"`
+	Trigger      Trigger    `json:"trigger"`
+	Status       string     `json:"status"`
+	StartedAt    time.Time  `json:"startedAt"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+	DurationMs   int64      `json:"durationMs"`
+	Seen         int        `json:"filesSeen"`
+	Added        int        `json:"added"`
+	Changed      int        `json:"changed"`
+	Unchanged    int        `json:"unchanged"`
+	Moved        int        `json:"moved"`
+	Missing      int        `json:"missing"`      // Files that went missing since the previous scan
+	StillMissing int        `json:"stillMissing"` // Files missing since an earlier scan
+	Restored     int        `json:"restored"`
+	Indexed      int        `json:"indexed"`
+	Quarantined  int        `json:"quarantined"`
+	Corrupt      int        `json:"corrupt"`   // Files that failed the integrity check
+	Playlists    int        `json:"playlists"` // Playlists imported, re-synced or removed
+	Dispatched   int        `json:"dispatched"`
+	Failed       int        `json:"failed"`
+	Errors       int        `json:"errors"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// LastResult returns the summary of the most recently completed scan of a root.
+// An empty name returns the most recent scan of any root.
+func LastResult(name string) *ScanResult {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	if name != "" {
+		return lastResults[name]
+	}
+
+	var latest *ScanResult
+	for _, res := range lastResults {
+		if latest == nil || res.StartedAt.After(latest.StartedAt) {
+			latest = res
+		}
+	}
+	return latest
 }
 
 // InitRedis initializes the Redis client for the scanner
@@ -43,106 +94,161 @@ func InitRedis(host, port, password string) {
 	})
 }
 
-// TriggerScan manually triggers a directory scan
-func TriggerScan(mediaPath string) {
-	slog.Info("Manual scan triggered", "path", mediaPath)
-	go scan(mediaPath)
-}
+// StartScanner scans every enabled library root once and starts the
+// filesystem watchers. Periodic full scans always run as a safety net; they
+// are driven by the scheduler through ScheduledScan. In watch mode a watcher
+// additionally dispatches changed paths as soon as events settle.
+func StartScanner(list []Root, mode Mode, debounce time.Duration) {
+	setRoots(list)
+	recoverRuns(context.Background())
 
-// StartScanner starts a periodic scan of the media directory
-// It uses polling to ensure consistency and security across Docker volumes
-func StartScanner(mediaPath string, interval time.Duration) {
-	slog.Info("Scanner started", "path", mediaPath, "interval", interval.String())
+	for _, root := range list {
+		if !root.Enabled {
+			slog.Info("Library root disabled, skipping", "root", root.Name, "path", root.Path)
+			continue
+		}
 
-	ticker := time.NewTicker(interval)
-	go func() {
-		// Run immediately on start
-		scan(mediaPath)
+		slog.Info("Scanner started", "root", root.Name, "path", root.Path, "schedule", root.Schedule, "mode", mode)
 
-		for range ticker.C {
-			scan(mediaPath)
+		if shouldWatch(root.Path, mode) {
+			if err := startWatcher(root, debounce); err != nil {
+				slog.Warn("Filesystem watcher unavailable, falling back to polling", "root", root.Name, "path", root.Path, "error", err)
+			}
 		}
-	}()
+
+		// Run immediately on start
+		requestScan(root, job{trigger: TriggerStartup})
+	}
 }
 
-// scan performs the actual directory traversal
-func scan(root string) {
-	isScanning = true
-	defer func() {
-		isScanning = false
-	}()
+// scan performs the actual directory traversal.
+// Files are compared against the persisted manifest so that only new or
+// changed files are dispatched to the analysis worker. Cancelling ctx stops
+// the walk without reconciling, so an interrupted scan never marks files missing.
+func scan(ctx context.Context, gate *pauseGate, root Root, trigger Trigger) {
+	pass := newScanPass(ctx, gate, root, trigger)
+	slog.Info("Starting library scan", "scan_id", pass.result.ScanID, "root", root.Name, "path", root.Path)
 
-	scanID := uuid.New().String()
-	slog.Info("Starting library scan", "scan_id", scanID, "root", root)
+	manifest, err := pass.sink.loadManifest(pass.ctx, root.Path, "")
+	if err != nil {
+		// Without a manifest every file is treated as new, matching the legacy behaviour
+		slog.Warn("Manifest unavailable, dispatching all files", "error", err, "scan_id", pass.result.ScanID)
+		manifest = map[string]ManifestEntry{}
+	}
+	pass.manifest = manifest
 
-	startTime := time.Now()
-	filesFound := 0
-	jobsDispatched := 0
+	err = pass.walk(root.Path)
+	if err == nil {
+		pass.reconcile(pass.unseen())
+		err = pass.dispatchPending()
+	}
+	if err == nil {
+		err = pass.syncPlaylists()
+	}
+	if err == nil {
+		pass.prune()
+	}
+	pass.finish(err)
+}
 
-	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			slog.Warn("Error accessing path", "path", path, "error", err, "scan_id", scanID)
-			return nil // Continue walking
-		}
+// scanPaths re-examines a set of paths reported by the watcher
+func scanPaths(ctx context.Context, gate *pauseGate, root Root, trigger Trigger, paths []string) {
+	newScanPass(ctx, gate, root, trigger).scanPaths(paths)
+}
 
-		if d.IsDir() {
-			// Security: Skip hidden directories (e.g. .git, .trash)
-			if strings.HasPrefix(d.Name(), ".") && d.Name() != "." {
-				return filepath.SkipDir
-			}
-			return nil
-		}
+// scanPaths walks the directories among paths recursively and visits the
+// files. Paths that no longer exist are reconciled so renames within the root
+// are detected as moves.
+func (p *scanPass) scanPaths(paths []string) {
+	slog.Debug("Scanning changed paths", "scan_id", p.result.ScanID, "root", p.root.Name, "paths", len(paths))
 
-		// Security: Validate file extension
-		ext := strings.ToLower(filepath.Ext(path))
-		if !AllowedExtensions[ext] {
-			return nil
+	// Paths outside the root cannot be matched against its manifest
+	kept, relPaths := paths[:0:0], make([]string, 0, len(paths))
+	for _, path := range paths {
+		rel, err := filepath.Rel(p.root.Path, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			slog.Warn("Ignoring changed path outside the root", "path", path, "error", err, "scan_id", p.result.ScanID)
+			continue
 		}
+		kept, relPaths = append(kept, path), append(relPaths, rel)
+	}
+	paths = kept
 
-		filesFound++
+	manifest, err := p.sink.loadManifestEntries(p.ctx, p.root.Path, relPaths)
+	if err != nil {
+		slog.Warn("Manifest unavailable for changed paths", "error", err, "scan_id", p.result.ScanID)
+		manifest = map[string]ManifestEntry{}
+	}
+	p.manifest = manifest
 
-		// Normalize path relative to root for consistency
-		relPath, err := filepath.Rel(root, path)
-		if err != nil {
-			return nil
+	gone := make(map[string]ManifestEntry)
+	for i, path := range paths {
+		if err := p.checkpoint(); err != nil {
+			p.finish(err)
+			return
 		}
 
-		// Dispatch Job to Redis
-		err = dispatchAnalysisJob(relPath, root, scanID)
+		info, err := os.Stat(path)
+		if err == nil && p.ignores.ignored(relPaths[i], info.IsDir()) {
+			err = errIgnored
+		}
 		if err != nil {
-			slog.Error("Failed to dispatch job", "file", relPath, "error", err, "scan_id", scanID)
-		} else {
-			jobsDispatched++
+			slog.Debug("Changed path no longer exists or is ignored", "path", path, "error", err, "scan_id", p.result.ScanID)
+			if e, ok := manifest[relPaths[i]]; ok {
+				gone[e.FilePath] = e
+			}
+			// The path may have been a directory holding many files
+			if entries, err := p.sink.loadManifest(p.ctx, p.root.Path, relPaths[i]); err == nil {
+				maps.Copy(gone, entries)
+			}
+			p.removePlaylistSources(relPaths[i])
+			continue
 		}
+		if info.IsDir() {
+			entries, err := p.sink.loadManifest(p.ctx, p.root.Path, relPaths[i])
+			if err == nil {
+				maps.Copy(p.manifest, entries)
+			}
+			if err := p.walk(path); err != nil {
+				p.finish(err)
+				return
+			}
+			// Files the walk no longer reaches were deleted or newly ignored
+			for rel, e := range entries {
+				if _, ok := p.seen[rel]; !ok {
+					gone[rel] = e
+				}
+			}
+			continue
+		}
+		p.visitFile(path, info)
+	}
 
-		return nil
-	})
-
-	if err != nil {
-		slog.Error("Scan failed", "error", err, "scan_id", scanID)
-	} else {
-		slog.Info("Scan complete",
-			"duration", time.Since(startTime).String(),
-			"files_found", filesFound,
-			"jobs_dispatched", jobsDispatched,
-			"scan_id", scanID,
-		)
-		// Invalidate cache when scan is complete
-		_ = cache.InvalidateLibraryCache(context.Background())
+	p.reconcile(gone)
+	err = p.dispatchPending()
+	if err == nil {
+		err = p.syncPlaylists()
 	}
+	p.finish(err)
 }
 
 type JobPayload struct {
-	FilePath string `json:"file_path"`
-	Root     string `json:"root"`
-	TraceID  string `json:"trace_id"`
+	FilePath string      `json:"file_path"`
+	Root     string      `json:"root"`
+	TraceID  string      `json:"trace_id"`
+	Hints    *Directives `json:"hints,omitempty"`
+	Indexed  bool        `json:"indexed,omitempty"` // The track rows were written from the tags; the worker only enriches them
 }
 
-func dispatchAnalysisJob(relPath, root, traceID string) error {
+func dispatchAnalysisJob(relPath, root, traceID string, directives Directives, indexed bool) error {
 	payload := JobPayload{
 		FilePath: relPath,
 		Root:     root,
 		TraceID:  traceID,
+		Indexed:  indexed,
+	}
+	if !directives.IsZero() {
+		payload.Hints = &directives
 	}
 
 	// Security: Use Celery for scalability
@@ -0,0 +1,290 @@
+package scanner
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"sonantica-core/cache"
+	"sonantica-core/database"
+	"sonantica-core/tags"
+)
+
+// sink receives every side effect of a scan pass: database writes, worker
+// jobs, quarantine, covers, playlists, the scan status in the cache and the
+// events sent to subscribers. The pass itself only reads the disk and the
+// manifest, so a dry run swaps in a sink that records instead of applying.
+type sink interface {
+	// loadManifest and loadManifestEntries read the manifest files are compared against
+	loadManifest(ctx context.Context, root, prefix string) (map[string]ManifestEntry, error)
+	loadManifestEntries(ctx context.Context, root string, paths []string) (map[string]ManifestEntry, error)
+
+	// start records a new pass and loads the files earlier scans quarantined
+	start(p *scanPass)
+	// index applies a new or changed file that passed validation
+	index(p *scanPass, entry ManifestEntry, md *tags.Metadata)
+	// quarantine keeps a file that failed validation away from the library
+	quarantine(p *scanPass, entry ManifestEntry, reason string, cause error, md *tags.Metadata)
+	// move points the track of a vanished file at the file that replaces it.
+	// It reports whether there was a track to relink.
+	move(p *scanPass, old, moved ManifestEntry) (bool, error)
+	// missing flags the vanished files reconciliation could not match
+	missing(p *scanPass, gone map[string]ManifestEntry) error
+	// importPlaylist creates or replaces the playlist imported from a file
+	importPlaylist(p *scanPass, rel, name, hash string, trackIDs, unresolved []string) error
+	// removePlaylists deletes the playlists imported from a file, or from any
+	// file below a directory, and returns how many there were
+	removePlaylists(p *scanPass, rel string) (int, error)
+	// prune forgets the playlists and quarantined files a full scan did not encounter
+	prune(p *scanPass)
+	fileError(p *scanPass, fe FileError)
+	progress(p *scanPass)
+	// finish records the outcome of the pass
+	finish(p *scanPass)
+}
+
+// manifestDB reads the manifest from the database
+type manifestDB struct{}
+
+func (manifestDB) loadManifest(ctx context.Context, root, prefix string) (map[string]ManifestEntry, error) {
+	return loadManifest(ctx, root, prefix)
+}
+
+func (manifestDB) loadManifestEntries(ctx context.Context, root string, paths []string) (map[string]ManifestEntry, error) {
+	return loadManifestEntries(ctx, root, paths)
+}
+
+// dbSink applies the side effects of a real scan
+type dbSink struct {
+	manifestDB
+}
+
+func (dbSink) start(p *scanPass) {
+	if err := insertRun(p.ctx, p.result); err != nil {
+		slog.Warn("Failed to record scan run", "error", err, "scan_id", p.result.ScanID)
+	}
+	quarantine, err := loadQuarantine(p.ctx, p.root.Path)
+	if err != nil {
+		slog.Warn("Quarantine unavailable, re-probing quarantined files", "error", err, "scan_id", p.result.ScanID)
+		quarantine = map[string]ManifestEntry{}
+	}
+	p.quarantine = quarantine
+	_ = cache.SetScanStatus(p.ctx, true, 0)
+	publish(p.ctx, Event{Type: EventScanStart, Root: p.root.Name, Stats: p.result})
+}
+
+// index indexes a file from its tags and the directives above it, runs the
+// enabled checks, queues it for analysis and records it in the manifest
+func (s dbSink) index(p *scanPass, entry ManifestEntry, md *tags.Metadata) {
+	trackPath := p.root.trackPath(entry.FilePath)
+	if _, ok := p.quarantine[entry.FilePath]; ok {
+		if _, err := ReleaseQuarantine(p.ctx, p.root, entry.FilePath); err != nil {
+			slog.Warn("Failed to release file from quarantine", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		}
+		if err := revalidateTracks(p.ctx, trackPath); err != nil {
+			slog.Warn("Failed to reactivate tracks of a valid file", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		}
+	}
+	directives := p.directives.forFile(entry.FilePath)
+	if sheet, file, _ := p.cues.forFile(entry.FilePath); file != nil {
+		if tags.CanSegment(md.Container) {
+			s.indexCue(p, entry, trackPath, md, sheet, file, directives)
+			return
+		}
+		slog.Warn("Ignoring cue sheet, the container cannot be split", "file", entry.FilePath, "container", md.Container, "scan_id", p.result.ScanID)
+	}
+	indexed := false
+	if ReadTags {
+		if err := upsertTrack(p.ctx, trackPath, entry, md, directives); err != nil {
+			slog.Warn("Failed to index file from tags", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+			p.fileError(entry.FilePath, "tags", err)
+			if !DispatchAnalysis {
+				p.result.Failed++
+				return
+			}
+		} else {
+			p.result.Indexed++
+			indexed = true
+		}
+	}
+	s.check(p, entry, trackPath)
+
+	// Dispatch Job to Redis
+	if DispatchAnalysis {
+		if err := dispatchAnalysisJob(trackPath, MediaPath, p.result.ScanID, directives, indexed); err != nil {
+			slog.Error("Failed to dispatch job", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+			p.result.Failed++
+			p.fileError(entry.FilePath, "dispatch", err)
+			// Leave the manifest untouched so the next scan retries this file
+			return
+		}
+		p.result.Dispatched++
+	}
+
+	if err := upsertManifestEntry(p.ctx, database.DB, p.root.Path, p.result.ScanID, trackPath, entry); err != nil {
+		slog.Warn("Failed to record manifest entry", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(entry.FilePath, "manifest", err)
+	}
+}
+
+// indexCue indexes the tracks of a single-file rip from its cue sheet. The
+// analysis worker only understands whole files, so the image is not queued.
+func (s dbSink) indexCue(p *scanPass, entry ManifestEntry, trackPath string, md *tags.Metadata, sheet *tags.CueSheet, file *tags.CueFile, directives Directives) {
+	if err := upsertCueTracks(p.ctx, trackPath, entry, md, sheet, file, directives); err != nil {
+		slog.Warn("Failed to index cue sheet tracks", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.result.Failed++
+		p.fileError(entry.FilePath, "cue", err)
+		return
+	}
+	p.result.Indexed++
+	s.check(p, entry, trackPath)
+
+	if err := upsertManifestEntry(p.ctx, database.DB, p.root.Path, p.result.ScanID, trackPath, entry); err != nil {
+		slog.Warn("Failed to record manifest entry", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		p.fileError(entry.FilePath, "manifest", err)
+	}
+}
+
+// check runs the enabled checks on the tracks of a file just indexed
+func (s dbSink) check(p *scanPass, entry ManifestEntry, trackPath string) {
+	if VerifyIntegrity {
+		s.verifyIntegrity(p, entry, trackPath)
+	}
+	if Fingerprint {
+		s.fingerprintTracks(p, entry, trackPath)
+	}
+	if MeasureLoudness {
+		s.measureLoudness(p, entry, trackPath)
+	}
+	if ExtractCovers {
+		s.extractCovers(p, entry, trackPath)
+	}
+}
+
+func (dbSink) quarantine(p *scanPass, entry ManifestEntry, reason string, cause error, md *tags.Metadata) {
+	slog.Warn("Quarantined file", "file", entry.FilePath, "reason", reason, "error", cause, "scan_id", p.result.ScanID)
+	if err := quarantineFile(p.ctx, p.root.Path, p.result.ScanID, entry, reason, cause, md); err != nil {
+		slog.Warn("Failed to record quarantined file", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+	}
+	if _, known := p.manifest[entry.FilePath]; known {
+		// The file was indexed while it was valid, its tracks must not stay playable
+		if n, err := invalidateTracks(p.ctx, p.root.trackPath(entry.FilePath)); err != nil {
+			slog.Warn("Failed to mark tracks of an invalid file", "file", entry.FilePath, "error", err, "scan_id", p.result.ScanID)
+		} else if n > 0 {
+			slog.Info("Marked tracks of an invalid file unavailable", "file", entry.FilePath, "tracks", n, "scan_id", p.result.ScanID)
+		}
+	}
+	publish(p.ctx, Event{Type: EventFileQuarantined, Root: p.root.Name, Error: &FileError{
+		ScanID:    p.result.ScanID,
+		FilePath:  entry.FilePath,
+		Stage:     reason,
+		Error:     cause.Error(),
+		CreatedAt: time.Now(),
+	}})
+}
+
+func (dbSink) move(p *scanPass, old, moved ManifestEntry) (bool, error) {
+	return recordMove(p.ctx, p.root, p.result.ScanID, old, moved)
+}
+
+// missing marks the files as missing and expires the tracks past the grace period
+func (dbSink) missing(p *scanPass, gone map[string]ManifestEntry) error {
+	if err := markMissing(p.ctx, p.root.Path, slices.Collect(maps.Keys(gone))); err != nil {
+		return err
+	}
+	expired, err := expireMissing(p.ctx, p.root.Path)
+	if err != nil {
+		slog.Warn("Failed to expire missing tracks", "error", err, "scan_id", p.result.ScanID)
+	} else if expired > 0 {
+		slog.Info("Marked missing tracks as deleted", "count", expired, "grace_period", MissingGracePeriod.String(), "scan_id", p.result.ScanID)
+	}
+	return nil
+}
+
+func (dbSink) importPlaylist(p *scanPass, rel, name, hash string, trackIDs, unresolved []string) error {
+	return importPlaylist(p.ctx, p.root.Path, rel, name, hash, trackIDs, unresolved)
+}
+
+func (dbSink) removePlaylists(p *scanPass, rel string) (int, error) {
+	rel = filepath.ToSlash(rel)
+	tag, err := database.DB.Exec(p.ctx, `
+		DELETE FROM playlists
+		WHERE source_root = $1 AND (source_path = $2 OR source_path LIKE $3)
+	`, p.root.Path, rel, escapeLike(rel)+"/%")
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// prune drops the quarantine entries and the imported playlists of files the
+// pass did not encounter. Unchanged quarantine entries are touched first so
+// they carry this scan's ID.
+func (dbSink) prune(p *scanPass) {
+	if err := touchQuarantine(p.ctx, p.root.Path, p.result.ScanID, p.quarantined); err != nil {
+		slog.Warn("Failed to update quarantined files", "error", err, "scan_id", p.result.ScanID)
+	} else {
+		p.quarantined = nil
+		if _, err := database.DB.Exec(p.ctx, `DELETE FROM library_quarantine WHERE root = $1 AND scan_id <> $2`,
+			p.root.Path, p.result.ScanID); err != nil {
+			slog.Warn("Failed to prune quarantine", "error", err, "scan_id", p.result.ScanID)
+		}
+	}
+
+	sources := make([]string, len(p.playlists))
+	for i, rel := range p.playlists {
+		sources[i] = filepath.ToSlash(rel)
+	}
+	tag, err := database.DB.Exec(p.ctx, `DELETE FROM playlists WHERE source_root = $1 AND source_path <> ALL($2)`,
+		p.root.Path, sources)
+	if err != nil {
+		slog.Warn("Failed to prune imported playlists", "error", err, "scan_id", p.result.ScanID)
+		return
+	}
+	p.result.Playlists += int(tag.RowsAffected())
+}
+
+func (dbSink) fileError(p *scanPass, fe FileError) {
+	if err := insertFileError(p.ctx, fe); err != nil {
+		slog.Debug("Failed to record scan error", "error", err, "scan_id", p.result.ScanID)
+	}
+	publish(p.ctx, Event{Type: EventFileError, Root: p.root.Name, Error: &fe})
+}
+
+func (dbSink) progress(p *scanPass) {
+	_ = cache.SetScanStatus(p.ctx, true, p.result.Seen)
+	publish(p.ctx, Event{Type: EventScanProgress, Root: p.root.Name, Stats: p.result})
+}
+
+// finish touches the unchanged files, restores the reappeared ones, records
+// the run and invalidates caches when the library may have changed
+func (dbSink) finish(p *scanPass) {
+	if err := touchManifestEntries(p.ctx, p.root.Path, p.result.ScanID, p.unchanged); err != nil {
+		slog.Warn("Failed to update manifest for unchanged files", "error", err, "scan_id", p.result.ScanID)
+	}
+	if err := restoreTracks(p.ctx, p.root.Path, p.restored); err != nil {
+		slog.Warn("Failed to restore reappeared tracks", "error", err, "scan_id", p.result.ScanID)
+	}
+	if err := touchQuarantine(p.ctx, p.root.Path, p.result.ScanID, p.quarantined); err != nil {
+		slog.Warn("Failed to update quarantined files", "error", err, "scan_id", p.result.ScanID)
+	}
+	if err := completeRun(p.ctx, p.result); err != nil {
+		slog.Warn("Failed to record scan run result", "error", err, "scan_id", p.result.ScanID)
+	}
+
+	stateMu.Lock()
+	lastResults[p.root.Name] = p.result
+	stateMu.Unlock()
+
+	if p.result.Indexed > 0 || p.result.Dispatched > 0 || p.result.Moved > 0 || p.result.Missing > 0 || p.result.Restored > 0 || p.result.Quarantined > 0 {
+		_ = cache.InvalidateLibraryCache(p.ctx)
+	}
+	if p.result.Playlists > 0 {
+		_ = cache.InvalidatePlaylistCache(p.ctx)
+	}
+	_ = cache.SetScanStatus(p.ctx, otherScansRunning(p.root.Name), p.result.Seen)
+	publish(p.ctx, Event{Type: EventScanComplete, Root: p.root.Name, Stats: p.result})
+}
@@ -0,0 +1,268 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sonantica-core/playlistfile"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Mode selects how the scanner notices changes in the media root
+type Mode string
+
+const (
+	ModePoll  Mode = "poll"  // Periodic full scans only
+	ModeWatch Mode = "watch" // Filesystem events plus periodic full scans
+	ModeAuto  Mode = "auto"  // Watch when the volume supports reliable events, otherwise poll
+)
+
+// ParseMode converts a configuration value into a Mode, defaulting to ModeAuto
+func ParseMode(value string) Mode {
+	switch Mode(value) {
+	case ModePoll, ModeWatch, ModeAuto:
+		return Mode(value)
+	default:
+		return ModeAuto
+	}
+}
+
+// shouldWatch decides whether a filesystem watcher should be started for root
+func shouldWatch(root string, mode Mode) bool {
+	switch mode {
+	case ModeWatch:
+		return true
+	case ModeAuto:
+		reliable, fsType := supportsReliableEvents(root)
+		if !reliable {
+			slog.Info("Filesystem events unreliable on this volume, using polling", "path", root, "fs_type", fsType)
+		}
+		return reliable
+	default:
+		return false
+	}
+}
+
+// watcher debounces filesystem events under a media root and rescans the
+// affected paths once they settle
+type watcher struct {
+	root     Root
+	debounce time.Duration
+	fsw      *fsnotify.Watcher
+	// scan rescans the settled paths
+	scan func(paths map[string]struct{})
+	// known reports whether the manifest holds files below a relative path
+	known func(rel string) bool
+	// dirs holds the watched directories, which events for vanished paths no
+	// longer tell apart from files
+	dirs map[string]struct{}
+
+	mu      sync.Mutex
+	pending map[string]struct{}
+	timer   *time.Timer
+}
+
+// startWatcher registers recursive watches under root and starts the event loop
+func startWatcher(root Root, debounce time.Duration) error {
+	w, err := newWatcher(root, debounce,
+		func(paths map[string]struct{}) { requestScan(root, job{trigger: TriggerWatch, paths: paths}) },
+		func(rel string) bool {
+			ok, err := hasManifestDir(context.Background(), root.Path, rel)
+			return err == nil && ok
+		})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Filesystem watcher started", "root", root.Name, "path", root.Path, "debounce", debounce.String(), "watches", len(w.dirs))
+	go w.run()
+	return nil
+}
+
+// newWatcher registers recursive watches under root without starting the event loop
+func newWatcher(root Root, debounce time.Duration, scan func(map[string]struct{}), known func(string) bool) (*watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	w := &watcher{
+		root:     root,
+		debounce: debounce,
+		fsw:      fsw,
+		scan:     scan,
+		known:    known,
+		dirs:     make(map[string]struct{}),
+		pending:  make(map[string]struct{}),
+	}
+	if err := w.addRecursive(root.Path); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// addRecursive watches dir and every non-hidden directory below it.
+// inotify watches are not recursive, so each directory needs its own watch.
+func (w *watcher) addRecursive(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if isHiddenDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		if err := w.fsw.Add(path); err != nil {
+			// Running out of inotify watches leaves parts of the tree blind
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		w.dirs[path] = struct{}{}
+		return nil
+	})
+}
+
+// unwatch drops the watches of a vanished directory and of every directory
+// below it, and reports whether dir was watched. inotify watches follow a
+// renamed directory, so they would otherwise report events under its old path.
+func (w *watcher) unwatch(dir string) bool {
+	if _, ok := w.dirs[dir]; !ok {
+		return false
+	}
+	prefix := dir + string(filepath.Separator)
+	for path := range w.dirs {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			delete(w.dirs, path)
+			_ = w.fsw.Remove(path) // inotify already dropped the watch of a deleted directory
+		}
+	}
+	return true
+}
+
+func (w *watcher) run() {
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Events were dropped, only a full scan can recover
+				slog.Warn("Watcher event queue overflowed, scheduling full scan", "root", w.root.Name)
+				requestScan(w.root, job{trigger: TriggerWatch})
+				continue
+			}
+			slog.Warn("Watcher error", "root", w.root.Name, "error", err)
+		}
+	}
+}
+
+func (w *watcher) handle(event fsnotify.Event) {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if isHiddenDir(filepath.Base(event.Name)) || w.excluded(event.Name) {
+				return
+			}
+			if err := w.addRecursive(event.Name); err != nil {
+				slog.Warn("Failed to watch new directory", "path", event.Name, "error", err)
+			}
+			w.enqueue(event.Name)
+			return
+		}
+	}
+
+	if (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)) && event.Name != w.root.Path {
+		// A vanished directory carries no extension; rescanning its path
+		// lets the scanner reconcile the files below it
+		if w.unwatch(event.Name) || (!isAudioCandidate(event.Name) && !w.isPending(event.Name) && w.known(w.rel(event.Name))) {
+			w.enqueue(event.Name)
+			return
+		}
+	}
+
+	if name := filepath.Base(event.Name); name == IgnoreFile || name == DirectiveFile || isCueSheet(name) {
+		// Sidecar files apply to the whole directory, rescan it
+		w.enqueue(filepath.Dir(event.Name))
+		return
+	}
+
+	if !(isAudioCandidate(event.Name) || playlistfile.IsPlaylist(event.Name)) || w.excluded(event.Name) {
+		return
+	}
+	w.enqueue(event.Name)
+}
+
+// excluded reports whether an absolute path falls under one of the root's exclude patterns
+func (w *watcher) excluded(path string) bool {
+	rel := w.rel(path)
+	if rel == "." || rel == "" {
+		return false
+	}
+	return w.root.excluded(rel)
+}
+
+// rel returns an absolute path relative to the root, empty when it is not below it
+func (w *watcher) rel(path string) string {
+	rel, err := filepath.Rel(w.root.Path, path)
+	if err != nil {
+		return ""
+	}
+	return rel
+}
+
+// isPending reports whether a path is already waiting for the next rescan
+func (w *watcher) isPending(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.pending[path]
+	return ok
+}
+
+// enqueue adds a path to the pending set and (re)arms the debounce timer
+func (w *watcher) enqueue(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending[path] = struct{}{}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.debounce, w.flush)
+	} else {
+		w.timer.Reset(w.debounce)
+	}
+}
+
+// flush hands the settled paths to the scanner
+func (w *watcher) flush() {
+	w.mu.Lock()
+	paths := w.pending
+	w.pending = make(map[string]struct{})
+	w.timer = nil
+	w.mu.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	slog.Info("Filesystem changes detected", "root", w.root.Name, "changed", len(paths))
+	w.scan(paths)
+}
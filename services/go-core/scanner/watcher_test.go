@@ -0,0 +1,147 @@
+package scanner
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"sonantica-core/tags"
+)
+
+// memorySink keeps the manifest and the relinkable tracks in memory and
+// applies nothing else
+type memorySink struct {
+	manifest map[string]ManifestEntry
+	tracks   map[string]bool // Relative paths of the files with a track
+	indexed  []string
+}
+
+func (m *memorySink) loadManifest(ctx context.Context, root, prefix string) (map[string]ManifestEntry, error) {
+	entries := make(map[string]ManifestEntry)
+	for rel, e := range m.manifest {
+		if strings.HasPrefix(rel, prefix+string(filepath.Separator)) {
+			entries[rel] = e
+		}
+	}
+	return entries, nil
+}
+
+func (m *memorySink) loadManifestEntries(ctx context.Context, root string, paths []string) (map[string]ManifestEntry, error) {
+	entries := make(map[string]ManifestEntry)
+	for _, rel := range paths {
+		if e, ok := m.manifest[rel]; ok {
+			entries[rel] = e
+		}
+	}
+	return entries, nil
+}
+
+func (m *memorySink) start(p *scanPass) {}
+
+func (m *memorySink) index(p *scanPass, entry ManifestEntry, md *tags.Metadata) {
+	m.indexed = append(m.indexed, entry.FilePath)
+}
+
+func (m *memorySink) quarantine(p *scanPass, entry ManifestEntry, reason string, cause error, md *tags.Metadata) {
+}
+
+func (m *memorySink) move(p *scanPass, old, moved ManifestEntry) (bool, error) {
+	delete(m.manifest, old.FilePath)
+	m.manifest[moved.FilePath] = moved
+	return m.tracks[old.FilePath], nil
+}
+
+func (m *memorySink) missing(p *scanPass, gone map[string]ManifestEntry) error { return nil }
+
+func (m *memorySink) importPlaylist(p *scanPass, rel, name, hash string, trackIDs, unresolved []string) error {
+	return nil
+}
+
+func (m *memorySink) removePlaylists(p *scanPass, rel string) (int, error) { return 0, nil }
+func (m *memorySink) prune(p *scanPass)                                    {}
+func (m *memorySink) fileError(p *scanPass, fe FileError)                  {}
+func (m *memorySink) progress(p *scanPass)                                 {}
+func (m *memorySink) finish(p *scanPass)                                   {}
+
+func TestWatcherDirectoryRename(t *testing.T) {
+	root := Root{Name: "test", Path: t.TempDir(), Enabled: true}
+	files := []string{filepath.Join("Album", "01.flac"), filepath.Join("Album", "CD2", "02.flac")}
+	sink := &memorySink{manifest: make(map[string]ManifestEntry), tracks: make(map[string]bool)}
+	for _, rel := range files {
+		path := filepath.Join(root.Path, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("audio of "+rel), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink.manifest[rel] = ManifestEntry{FilePath: rel, SizeBytes: info.Size(), ModTime: info.ModTime()}
+		sink.tracks[rel] = true
+	}
+
+	settled := make(chan map[string]struct{}, 1)
+	w, err := newWatcher(root, 100*time.Millisecond,
+		func(paths map[string]struct{}) { settled <- paths },
+		func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.fsw.Close()
+	go w.run()
+
+	if err := os.Rename(filepath.Join(root.Path, "Album"), filepath.Join(root.Path, "Renamed")); err != nil {
+		t.Fatal(err)
+	}
+	var paths map[string]struct{}
+	select {
+	case paths = <-settled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no rescan after renaming a directory")
+	}
+	for _, dir := range []string{"Album", "Renamed"} {
+		if _, ok := paths[filepath.Join(root.Path, dir)]; !ok {
+			t.Errorf("rescan paths %v lack %s", paths, dir)
+		}
+	}
+	for dir := range w.dirs {
+		if rel, _ := filepath.Rel(root.Path, dir); strings.HasPrefix(rel, "Album") {
+			t.Errorf("still watching %s after it was renamed", dir)
+		}
+	}
+
+	p := newPass(context.Background(), context.Background(), newPauseGate(), root, TriggerWatch, sink)
+	p.scanPaths(slices.Collect(maps.Keys(paths)))
+	if p.result.Moved != len(files) || p.result.Added != 0 || p.result.Missing != 0 {
+		t.Errorf("moved %d, added %d, missing %d; want %d moved", p.result.Moved, p.result.Added, p.result.Missing, len(files))
+	}
+	if len(sink.indexed) != 0 {
+		t.Errorf("indexed %v, want nothing", sink.indexed)
+	}
+}
+
+func TestScanPathsOutsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := Root{Name: "test", Path: filepath.Join(dir, "library"), Enabled: true}
+	outside := filepath.Join(dir, "elsewhere.mp3")
+	if err := os.MkdirAll(root.Path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outside, []byte("not audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sink := &memorySink{manifest: make(map[string]ManifestEntry), tracks: make(map[string]bool)}
+	p := newPass(context.Background(), context.Background(), newPauseGate(), root, TriggerWatch, sink)
+	p.scanPaths([]string{outside, dir})
+	if p.result.Seen != 0 || p.result.Quarantined != 0 || len(sink.indexed) != 0 {
+		t.Errorf("seen %d, quarantined %d, indexed %v; want paths outside the root ignored", p.result.Seen, p.result.Quarantined, sink.indexed)
+	}
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNext(t *testing.T) {
+	from := time.Date(2024, time.February, 27, 13, 47, 30, 0, time.UTC) // A Tuesday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@hourly", time.Date(2024, time.February, 27, 14, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.February, 27, 14, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, time.February, 27, 14, 5, 0, 0, time.UTC)},
+		{"30 3 * * *", time.Date(2024, time.February, 28, 3, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * mon-fri", time.Date(2024, time.February, 27, 17, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * sat,sun", time.Date(2024, time.March, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * sat", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)}, // Either day field matches
+		{"@every 90m", time.Date(2024, time.February, 27, 15, 17, 30, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	if s, err := Parse("0 0 31 feb *"); err != nil || !s.Next(from).IsZero() {
+		t.Errorf("impossible date should never fire, got %v, %v", s, err)
+	}
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "@every 10ms", "@often"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
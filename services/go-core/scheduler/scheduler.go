@@ -0,0 +1,238 @@
+// Package scheduler runs the periodic background jobs of the service (library
+// scans, analysis backfills, cache warmups, retention) on cron schedules and
+// keeps their last outcome for the admin API.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownJob is returned when running a job that is not registered
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned when running a job that has not finished its previous run
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// Trigger records what started a job run
+type Trigger string
+
+const (
+	TriggerSchedule Trigger = "schedule" // Due according to its schedule
+	TriggerManual   Trigger = "manual"   // Requested through the admin API
+)
+
+// Status is the state of a job as reported by the admin API
+type Status struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Schedule       string     `json:"schedule"` // Empty when the job only runs on demand
+	Running        bool       `json:"running"`
+	LastRun        *time.Time `json:"lastRun,omitempty"`
+	LastTrigger    Trigger    `json:"lastTrigger,omitempty"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextRun        *time.Time `json:"nextRun,omitempty"`
+	Runs           int        `json:"runs"`
+	Failures       int        `json:"failures"`
+}
+
+// job is a registered task and its run history
+type job struct {
+	run      func(context.Context) error
+	schedule Schedule
+
+	mu     sync.Mutex
+	status Status
+}
+
+var (
+	jobsMu  sync.RWMutex
+	jobs    = make(map[string]*job)
+	baseCtx = context.Background()
+	started bool
+)
+
+// Register adds a job. An empty spec or "off" registers the job without a
+// schedule: it never runs on its own but can still be run through RunNow. Jobs
+// registered after Start are scheduled immediately.
+func Register(name, spec, description string, run func(context.Context) error) error {
+	spec = strings.TrimSpace(spec)
+	var schedule Schedule
+	if spec != "" && spec != "off" {
+		s, err := Parse(spec)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", name, err)
+		}
+		schedule = s
+	} else {
+		spec = ""
+	}
+
+	j := &job{
+		run:      run,
+		schedule: schedule,
+		status:   Status{Name: name, Description: description, Schedule: spec},
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if _, ok := jobs[name]; ok {
+		return fmt.Errorf("job %s is already registered", name)
+	}
+	jobs[name] = j
+	if started {
+		go j.loop(baseCtx)
+	}
+	return nil
+}
+
+// Start runs every registered job on its schedule until ctx is cancelled
+func Start(ctx context.Context) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if started {
+		return
+	}
+	started = true
+	baseCtx = ctx
+	for _, j := range jobs {
+		go j.loop(ctx)
+	}
+	slog.Info("Scheduler started", "jobs", len(jobs))
+}
+
+// List returns the status of every job, sorted by name
+func List() []Status {
+	jobsMu.RLock()
+	list := make([]Status, 0, len(jobs))
+	for _, j := range jobs {
+		list = append(list, j.snapshot())
+	}
+	jobsMu.RUnlock()
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+	return list
+}
+
+// Lookup returns the status of a job
+func Lookup(name string) (Status, bool) {
+	jobsMu.RLock()
+	j, ok := jobs[name]
+	jobsMu.RUnlock()
+	if !ok {
+		return Status{}, false
+	}
+	return j.snapshot(), true
+}
+
+// RunNow starts a job outside its schedule. The run happens in the
+// background; its outcome shows up in the job status.
+func RunNow(name string) error {
+	jobsMu.RLock()
+	j, ok := jobs[name]
+	ctx := baseCtx
+	jobsMu.RUnlock()
+	if !ok {
+		return ErrUnknownJob
+	}
+	if !j.begin() {
+		return ErrJobRunning
+	}
+	slog.Info("Job triggered", "job", name)
+	go j.execute(ctx, TriggerManual)
+	return nil
+}
+
+// loop waits for each activation of the job's schedule and runs it
+func (j *job) loop(ctx context.Context) {
+	if j.schedule == nil {
+		return
+	}
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.Warn("Job schedule never fires again", "job", j.status.Name, "schedule", j.status.Schedule)
+			return
+		}
+		j.mu.Lock()
+		j.status.NextRun = &next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !j.begin() {
+			// Slow runs skip activations rather than piling up
+			slog.Warn("Job still running, skipping scheduled run", "job", j.status.Name)
+			continue
+		}
+		j.execute(ctx, TriggerSchedule)
+	}
+}
+
+// begin marks the job as running, reporting false when it already is
+func (j *job) begin() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status.Running {
+		return false
+	}
+	j.status.Running = true
+	return true
+}
+
+// execute runs the job once and records the outcome. The caller must have called begin.
+func (j *job) execute(ctx context.Context, trigger Trigger) {
+	startedAt := time.Now()
+	err := j.safeRun(ctx)
+	duration := time.Since(startedAt)
+
+	j.mu.Lock()
+	j.status.Running = false
+	j.status.LastRun = &startedAt
+	j.status.LastTrigger = trigger
+	j.status.LastDurationMs = duration.Milliseconds()
+	j.status.Runs++
+	j.status.LastError = ""
+	if err != nil {
+		j.status.LastError = err.Error()
+		j.status.Failures++
+	}
+	name := j.status.Name
+	j.mu.Unlock()
+
+	if err != nil {
+		slog.Error("Job failed", "job", name, "trigger", trigger, "duration", duration.String(), "error", err)
+		return
+	}
+	slog.Info("Job finished", "job", name, "trigger", trigger, "duration", duration.String())
+}
+
+// safeRun keeps a panicking job from taking the service down
+func (j *job) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.run(ctx)
+}
+
+func (j *job) snapshot() Status {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
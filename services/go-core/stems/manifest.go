@@ -0,0 +1,216 @@
+package stems
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"sonantica-core/database"
+	"sonantica-core/tags"
+)
+
+// Dir is where the separation plugin writes its jobs, one directory per job
+var Dir = "/stems"
+
+// NoVocals is the premixed accompaniment some separations write next to the stems
+const NoVocals = "no_vocals"
+
+// stemName is what a stem file may be called, which keeps manifest paths inside Dir
+var stemName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Stem is a file of the stem manifest of a track
+type Stem struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"` // Relative to Dir
+	Format    string    `json:"format"`
+	Model     string    `json:"model,omitempty"`
+	Duration  float64   `json:"duration"` // Seconds, 0 when unknown
+	JobID     string    `json:"jobId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// File returns the absolute path of the stem
+func (s Stem) File() string {
+	return filepath.Join(Dir, s.Path)
+}
+
+// Decodable reports whether the stem can be decoded for mixing
+func (s Stem) Decodable() bool {
+	return s.Format == "wav" || s.Format == "flac" || s.Format == "aiff"
+}
+
+// Find returns the stem called name, nil when the manifest has none
+func Find(manifest []Stem, name string) *Stem {
+	for i := range manifest {
+		if manifest[i].Name == name {
+			return &manifest[i]
+		}
+	}
+	return nil
+}
+
+// Job is a separation job whose stems are not recorded yet
+type Job struct {
+	TrackID string
+	JobID   string
+}
+
+// Dispatched records the separation job just sent for a track
+func Dispatched(ctx context.Context, trackID, jobID string) error {
+	_, err := database.DB.Exec(ctx, `UPDATE tracks SET stem_job_id = $2 WHERE id = $1`, trackID, jobID)
+	return err
+}
+
+// Abandon forgets the pending job of a track, e.g. after it failed
+func Abandon(ctx context.Context, trackID, jobID string) error {
+	_, err := database.DB.Exec(ctx, `UPDATE tracks SET stem_job_id = NULL WHERE id = $1 AND stem_job_id = $2`, trackID, jobID)
+	return err
+}
+
+// Pending lists the separation jobs without a manifest: those dispatched
+// since and those recorded in the AI metadata by older versions
+func Pending(ctx context.Context) ([]Job, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT t.id::text, COALESCE(t.stem_job_id, t.ai_metadata->>'demucs_job_id')
+		FROM tracks t
+		WHERE COALESCE(t.stem_job_id, t.ai_metadata->>'demucs_job_id') IS NOT NULL
+		  AND t.status <> 'deleted'
+		  AND NOT EXISTS (SELECT 1 FROM track_stems s WHERE s.track_id = t.id)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		if err := rows.Scan(&j.TrackID, &j.JobID); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Record replaces the stem manifest of a track with the files a finished job
+// wrote, given by stem name and path relative to Dir. Every file is probed
+// for its format and duration; a missing or unreadable one fails the whole job.
+func Record(ctx context.Context, trackID, jobID, model string, files map[string]string) ([]Stem, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("job %s has no stems", jobID)
+	}
+	manifest := make([]Stem, 0, len(files))
+	for name, rel := range files {
+		if !stemName.MatchString(name) {
+			return nil, fmt.Errorf("invalid stem name %q", name)
+		}
+		rel = filepath.Clean(rel)
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("stem %s is outside the stems directory: %s", name, rel)
+		}
+		m, err := tags.ReadFile(filepath.Join(Dir, rel))
+		if err != nil {
+			return nil, fmt.Errorf("stem %s: %w", name, err)
+		}
+		manifest = append(manifest, Stem{Name: name, Path: rel, Format: format(m), Model: model, Duration: m.Duration, JobID: jobID})
+	}
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM track_stems WHERE track_id = $1`, trackID); err != nil {
+		return nil, fmt.Errorf("failed to clear stem manifest: %w", err)
+	}
+	now := time.Now()
+	for i := range manifest {
+		s := &manifest[i]
+		s.CreatedAt = now
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO track_stems (track_id, stem, path, format, model, duration_seconds, job_id, created_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5::text, ''), NULLIF($6::double precision, 0), $7, $8)
+		`, trackID, s.Name, s.Path, s.Format, s.Model, s.Duration, s.JobID, now); err != nil {
+			return nil, fmt.Errorf("failed to record stem %s: %w", s.Name, err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE tracks SET has_stems = true, stem_job_id = $2 WHERE id = $1`, trackID, jobID); err != nil {
+		return nil, err
+	}
+	return manifest, tx.Commit(ctx)
+}
+
+// Scan lists the stem files a job left in its directory, for jobs the plugin
+// no longer knows about
+func Scan(jobID string) map[string]string {
+	if !isJobID(jobID) {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(Dir, jobID))
+	if err != nil {
+		return nil
+	}
+	files := make(map[string]string)
+	for _, e := range entries {
+		name, ext, _ := strings.Cut(e.Name(), ".")
+		if e.IsDir() || !stemName.MatchString(name) {
+			continue
+		}
+		switch ext {
+		case "wav", "flac", "mp3":
+			// Prefer the lossless file when both were written
+			if prev, ok := files[name]; !ok || strings.HasSuffix(prev, ".mp3") {
+				files[name] = filepath.Join(jobID, e.Name())
+			}
+		}
+	}
+	return files
+}
+
+// ForTrack returns the stem manifest of a track, empty when it was never separated
+func ForTrack(ctx context.Context, trackID string) ([]Stem, error) {
+	rows, err := database.DB.Query(ctx, `
+		SELECT stem, path, format, COALESCE(model, ''), COALESCE(duration_seconds, 0), job_id, created_at
+		FROM track_stems WHERE track_id = $1
+		ORDER BY array_position($2::text[], stem) NULLS LAST, stem
+	`, trackID, Names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	manifest := []Stem{}
+	for rows.Next() {
+		var s Stem
+		if err := rows.Scan(&s.Name, &s.Path, &s.Format, &s.Model, &s.Duration, &s.JobID, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, s)
+	}
+	return manifest, rows.Err()
+}
+
+// format names the audio of a stem by its container, or its codec for
+// containers that hold several
+func format(m *tags.Metadata) string {
+	switch m.Container {
+	case "wav", "aiff", "flac":
+		return m.Container
+	}
+	return m.Codec
+}
+
+// isJobID reports whether a job ID is safe to use as a directory name
+func isJobID(jobID string) bool {
+	return jobID != "" && jobID != "." && jobID != ".." && !strings.ContainsAny(jobID, `/\`)
+}
+
+// Recorded reports whether the manifest of a track comes from the job
+func Recorded(ctx context.Context, trackID, jobID string) (bool, error) {
+	var ok bool
+	err := database.DB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM track_stems WHERE track_id = $1 AND job_id = $2)`, trackID, jobID).Scan(&ok)
+	return ok, err
+}
@@ -0,0 +1,205 @@
+// Package stems mixes the sources a Demucs separation produced back into a
+// single stream, each at its own gain, for karaoke and practice modes.
+package stems
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"sonantica-core/tags"
+)
+
+// mixBlock is how many sample frames Mixer.Read returns at most
+const mixBlock = 4096
+
+// MaxGain bounds the gain of a stem in a mix (+12 dB)
+const MaxGain = 4.0
+
+// Names are the stems Demucs writes, the four of the default models and the
+// guitar and piano of the six-stem one
+var Names = []string{"vocals", "drums", "bass", "other", "guitar", "piano"}
+
+// Gain is the linear gain of a stem in a mix
+type Gain struct {
+	Stem string
+	Gain float32
+}
+
+// ParseMix parses a mix such as "vocals:0.2,drums:1,bass:1,other:0.8". A stem
+// without a gain plays at 1; stems left out are silent.
+func ParseMix(s string) ([]Gain, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("no stems")
+	}
+	var mix []Gain
+	for _, part := range strings.Split(s, ",") {
+		name, value, hasGain := strings.Cut(strings.TrimSpace(part), ":")
+		if !slices.Contains(Names, name) {
+			return nil, fmt.Errorf("unknown stem %q, expected one of %s", name, strings.Join(Names, ", "))
+		}
+		if slices.ContainsFunc(mix, func(g Gain) bool { return g.Stem == name }) {
+			return nil, fmt.Errorf("stem %s is listed twice", name)
+		}
+		gain := 1.0
+		if hasGain {
+			var err error
+			if gain, err = strconv.ParseFloat(value, 32); err != nil || !(gain >= 0 && gain <= MaxGain) { // Also rejects NaN
+				return nil, fmt.Errorf("gain of %s must be between 0 and %g", name, MaxGain)
+			}
+		}
+		mix = append(mix, Gain{Stem: name, Gain: float32(gain)})
+	}
+	return mix, nil
+}
+
+// Source is decoded audio, such as a tags.PCM
+type Source interface {
+	Read() ([][]float32, error)
+}
+
+// Mixer sums its sources sample by sample, each scaled by its gain. Sources
+// may return blocks of any size and must have the same channels; one that
+// ends early is silent for the rest of the mix.
+type Mixer struct {
+	channels int
+	inputs   []*input
+	out      [][]float32
+}
+
+type input struct {
+	src     Source
+	gain    float32
+	pending [][]float32
+	done    bool
+}
+
+// NewMixer creates a mixer of sources with channels channels
+func NewMixer(channels int) *Mixer {
+	return &Mixer{channels: channels, out: make([][]float32, channels)}
+}
+
+// Add adds a source to the mix
+func (m *Mixer) Add(src Source, gain float32) {
+	m.inputs = append(m.inputs, &input{src: src, gain: gain, pending: make([][]float32, m.channels)})
+}
+
+// Skip drops the next frames of every source without mixing them, to start
+// the mix at an offset
+func (m *Mixer) Skip(frames int64) error {
+	for _, in := range m.inputs {
+		for left := frames; left > 0; {
+			if err := in.fill(1); err != nil {
+				return err
+			}
+			if len(in.pending[0]) == 0 {
+				break
+			}
+			k := min(left, int64(len(in.pending[0])))
+			in.drop(int(k))
+			left -= k
+		}
+	}
+	return nil
+}
+
+// Read returns the next block of the mix, with the same contract as
+// tags.PCM.Read
+func (m *Mixer) Read() ([][]float32, error) {
+	n := 0
+	for _, in := range m.inputs {
+		if err := in.fill(mixBlock); err != nil {
+			return nil, err
+		}
+		n = max(n, min(len(in.pending[0]), mixBlock))
+	}
+	if n == 0 {
+		return nil, io.EOF
+	}
+	for ch := range m.out {
+		m.out[ch] = slices.Grow(m.out[ch][:0], n)[:n]
+		clear(m.out[ch])
+	}
+	for _, in := range m.inputs {
+		k := min(len(in.pending[0]), n)
+		for ch, out := range m.out {
+			for i, v := range in.pending[ch][:k] {
+				out[i] += v * in.gain
+			}
+		}
+		in.drop(k)
+	}
+	return m.out, nil
+}
+
+// fill reads from the source until frames are pending or it ends
+func (in *input) fill(frames int) error {
+	for !in.done && len(in.pending[0]) < frames {
+		block, err := in.src.Read()
+		if err == io.EOF {
+			in.done = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(block) != len(in.pending) {
+			return fmt.Errorf("source has %d channels, want %d", len(block), len(in.pending))
+		}
+		for ch := range block {
+			in.pending[ch] = append(in.pending[ch], block[ch]...)
+		}
+	}
+	return nil
+}
+
+// drop discards the first k pending frames
+func (in *input) drop(k int) {
+	for ch := range in.pending {
+		in.pending[ch] = in.pending[ch][:copy(in.pending[ch], in.pending[ch][k:])]
+	}
+}
+
+// Encode writes src to enc and closes the encoder. When frames is positive
+// exactly that many sample frames are written, padding an early end with
+// silence, so the length announced in the headers holds.
+func Encode(enc tags.Encoder, src Source, channels int, frames int64) error {
+	written := int64(0)
+	for frames <= 0 || written < frames {
+		block, err := src.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if frames > 0 && int64(len(block[0])) > frames-written {
+			for ch := range block {
+				block[ch] = block[ch][:frames-written]
+			}
+		}
+		if err := enc.Write(block); err != nil {
+			return err
+		}
+		written += int64(len(block[0]))
+	}
+	if silence := make([][]float32, channels); frames > written {
+		for ch := range silence {
+			silence[ch] = make([]float32, mixBlock)
+		}
+		for written < frames {
+			n := int(min(frames-written, mixBlock))
+			for ch := range silence {
+				silence[ch] = silence[ch][:n]
+			}
+			if err := enc.Write(silence); err != nil {
+				return err
+			}
+			written += int64(n)
+		}
+	}
+	return enc.Close()
+}
@@ -0,0 +1,124 @@
+package stems
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sonantica-core/tags"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("vocals:0.2, drums:1,bass,other:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Gain{{"vocals", 0.2}, {"drums", 1}, {"bass", 1}, {"other", 0}}
+	if len(mix) != len(want) {
+		t.Fatalf("ParseMix() = %v", mix)
+	}
+	for i := range want {
+		if mix[i] != want[i] {
+			t.Errorf("ParseMix()[%d] = %v, want %v", i, mix[i], want[i])
+		}
+	}
+	for _, bad := range []string{"", "lead:1", "vocals:-1", "drums:5", "bass:loud", "bass:NaN", "other:Inf", "bass:1,bass:0.5", "../vocals"} {
+		if _, err := ParseMix(bad); err == nil {
+			t.Errorf("ParseMix(%q) accepted", bad)
+		}
+	}
+}
+
+// constSource returns frames of a constant value in blocks of size
+type constSource struct {
+	value        float32
+	frames, size int
+}
+
+func (c *constSource) Read() ([][]float32, error) {
+	if c.frames == 0 {
+		return nil, io.EOF
+	}
+	n := min(c.frames, c.size)
+	c.frames -= n
+	block := [][]float32{make([]float32, n), make([]float32, n)}
+	for ch := range block {
+		for i := range block[ch] {
+			block[ch][i] = c.value
+		}
+	}
+	return block, nil
+}
+
+func TestMixer(t *testing.T) {
+	m := NewMixer(2)
+	m.Add(&constSource{value: 0.5, frames: 10000, size: 1152}, 0.5)
+	m.Add(&constSource{value: 0.25, frames: 6000, size: 4096}, 2)
+	if err := m.Skip(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	var left []float32
+	for {
+		block, err := m.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, block[0]...)
+	}
+	if len(left) != 9000 {
+		t.Fatalf("mixed %d frames, want 9000", len(left))
+	}
+	// The second source ends after 5000 frames of the mix
+	if left[0] != 0.75 || left[4999] != 0.75 || left[5000] != 0.25 || left[8999] != 0.25 {
+		t.Errorf("mix = %v %v %v %v", left[0], left[4999], left[5000], left[8999])
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	for _, tt := range []struct{ source, frames int }{{5000, 8000}, {9000, 8000}} {
+		var b bytes.Buffer
+		enc, err := tags.NewEncoder(&b, "wav", 48000, 2, int64(tt.frames))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Encode(enc, &constSource{value: 0.5, frames: tt.source, size: 4096}, 2, int64(tt.frames)); err != nil {
+			t.Fatal(err)
+		}
+		if int64(b.Len()) != tags.WAVSize(2, int64(tt.frames)) {
+			t.Errorf("source of %d frames: %d bytes, want %d", tt.source, b.Len(), tags.WAVSize(2, int64(tt.frames)))
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	Dir = t.TempDir()
+	job := filepath.Join(Dir, "4f1c")
+	if err := os.Mkdir(job, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"vocals.mp3", "vocals.wav", "drums.mp3", "no_vocals.flac", "notes.txt", "Bass.wav"} {
+		if err := os.WriteFile(filepath.Join(job, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{
+		"vocals":    filepath.Join("4f1c", "vocals.wav"),
+		"drums":     filepath.Join("4f1c", "drums.mp3"),
+		"no_vocals": filepath.Join("4f1c", "no_vocals.flac"),
+	}
+	if got := Scan("4f1c"); !maps.Equal(got, want) {
+		t.Errorf("Scan() = %v, want %v", got, want)
+	}
+	for _, id := range []string{"", "..", "../4f1c"} {
+		if got := Scan(id); len(got) != 0 {
+			t.Errorf("Scan(%q) = %v", id, got)
+		}
+	}
+}
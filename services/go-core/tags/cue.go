@@ -0,0 +1,231 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// cueFramesPerSecond is the resolution of cue sheet timestamps (CD frames)
+const cueFramesPerSecond = 75
+
+// CueSheet describes the tracks of one or more audio files, usually a
+// single-file album rip
+type CueSheet struct {
+	Title     string
+	Performer string
+	Genre     string
+	Year      int
+	Disc      int
+	Files     []CueFile
+	Gain      ReplayGain // Album gain from REM REPLAYGAIN_ALBUM_* lines
+}
+
+// CueFile is a FILE entry of a cue sheet with the tracks it holds
+type CueFile struct {
+	Name   string // As written in the sheet, relative to the sheet's directory
+	Tracks []CueTrack
+}
+
+// CueTrack is an audio track within a file
+type CueTrack struct {
+	Number    int
+	Title     string
+	Performer string
+	ISRC      string
+	Gain      ReplayGain // Track gain from REM REPLAYGAIN_TRACK_* lines
+	Start     float64    // INDEX 01, seconds from the start of the file
+	End       float64    // Start of the next track in the same file; 0 when the track runs to the end of the file
+}
+
+// ParseCue reads a cue sheet. Sheets that are not valid UTF-8 are decoded as
+// Latin-1, which is what most ripping tools on Windows write.
+func ParseCue(data []byte) (*CueSheet, error) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	if !utf8.Valid(data) {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		data = []byte(string(runes))
+	}
+
+	sheet := &CueSheet{}
+	var file *CueFile
+	var track *CueTrack
+	audio := false
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		fields := cueFields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		args := fields[1:]
+		arg := func(i int) string {
+			if i < len(args) {
+				return args[i]
+			}
+			return ""
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "REM":
+			switch strings.ToUpper(arg(0)) {
+			case "GENRE":
+				sheet.Genre = clean(arg(1))
+			case "DATE":
+				sheet.Year = parseYear(arg(1))
+			case "DISCNUMBER":
+				sheet.Disc = atoi(arg(1))
+			case "REPLAYGAIN_ALBUM_GAIN":
+				sheet.Gain.AlbumGain = parseGain(strings.Join(args[1:], " "))
+			case "REPLAYGAIN_ALBUM_PEAK":
+				sheet.Gain.AlbumPeak = parsePeak(arg(1))
+			case "REPLAYGAIN_TRACK_GAIN":
+				if track != nil {
+					track.Gain.TrackGain = parseGain(strings.Join(args[1:], " "))
+				}
+			case "REPLAYGAIN_TRACK_PEAK":
+				if track != nil {
+					track.Gain.TrackPeak = parsePeak(arg(1))
+				}
+			}
+		case "TITLE":
+			if track != nil {
+				track.Title = clean(arg(0))
+			} else {
+				sheet.Title = clean(arg(0))
+			}
+		case "PERFORMER":
+			if track != nil {
+				track.Performer = clean(arg(0))
+			} else {
+				sheet.Performer = clean(arg(0))
+			}
+		case "FILE":
+			if arg(0) == "" {
+				return nil, fmt.Errorf("%w: line %d: FILE without a name", ErrMalformed, n)
+			}
+			sheet.Files = append(sheet.Files, CueFile{Name: arg(0)})
+			file, track = &sheet.Files[len(sheet.Files)-1], nil
+		case "TRACK":
+			if file == nil {
+				return nil, fmt.Errorf("%w: line %d: TRACK before FILE", ErrMalformed, n)
+			}
+			audio = strings.EqualFold(arg(1), "AUDIO")
+			track = nil
+			if audio {
+				file.Tracks = append(file.Tracks, CueTrack{Number: atoi(arg(0)), Start: -1})
+				track = &file.Tracks[len(file.Tracks)-1]
+			}
+		case "ISRC":
+			if track != nil {
+				track.ISRC = arg(0)
+			}
+		case "INDEX":
+			if track == nil || atoi(arg(0)) != 1 {
+				continue // INDEX 00 is the pregap, later indexes are sub-positions
+			}
+			start, ok := parseCueTime(arg(1))
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: invalid INDEX time %q", ErrMalformed, n, arg(1))
+			}
+			track.Start = start
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for i := range sheet.Files {
+		f := &sheet.Files[i]
+		tracks := f.Tracks[:0]
+		for _, t := range f.Tracks {
+			if t.Start >= 0 {
+				tracks = append(tracks, t)
+			}
+		}
+		for j := range tracks {
+			if j+1 < len(tracks) {
+				tracks[j].End = tracks[j+1].Start
+			}
+			if tracks[j].End != 0 && tracks[j].End <= tracks[j].Start {
+				return nil, fmt.Errorf("%w: track %d ends before it starts", ErrMalformed, tracks[j].Number)
+			}
+		}
+		f.Tracks = tracks
+		count += len(tracks)
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("%w: cue sheet without audio tracks", ErrMalformed)
+	}
+	return sheet, nil
+}
+
+// File returns the entry for an audio file by name. Rips are often converted
+// after the sheet was written, so a FILE "album.wav" also matches album.flac.
+func (s *CueSheet) File(name string) *CueFile {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	stem := strings.TrimSuffix(base, path.Ext(base))
+
+	var byStem *CueFile
+	for i := range s.Files {
+		f := &s.Files[i]
+		ref := strings.ToLower(path.Base(strings.ReplaceAll(f.Name, `\`, "/")))
+		if ref == base {
+			return f
+		}
+		if strings.TrimSuffix(ref, path.Ext(ref)) == stem && byStem == nil {
+			byStem = f
+		}
+	}
+	return byStem
+}
+
+// parseCueTime reads an mm:ss:ff timestamp, where ff counts 1/75 second frames
+func parseCueTime(s string) (float64, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	var v [3]int
+	for i, p := range parts {
+		if _, err := fmt.Sscanf(p, "%d", &v[i]); err != nil || v[i] < 0 {
+			return 0, false
+		}
+	}
+	if v[1] >= 60 || v[2] >= cueFramesPerSecond {
+		return 0, false
+	}
+	return float64(v[0]*60+v[1]) + float64(v[2])/cueFramesPerSecond, true
+}
+
+// cueFields splits a cue sheet line into words, keeping quoted strings together
+func cueFields(line string) []string {
+	var fields []string
+	line = strings.TrimSpace(line)
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				fields = append(fields, line[1:])
+				break
+			}
+			fields = append(fields, line[1:end+1])
+			line = strings.TrimSpace(line[end+2:])
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = strings.TrimSpace(line[end:])
+	}
+	return fields
+}
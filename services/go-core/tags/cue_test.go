@@ -0,0 +1,121 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+const testCue = "\xEF\xBB\xBFREM GENRE \"Progressive Rock\"\r\n" +
+	"REM DATE 1973\r\n" +
+	"PERFORMER \"Pink Floyd\"\r\n" +
+	"TITLE \"The Dark Side of the Moon\"\r\n" +
+	"FILE \"Pink Floyd - The Dark Side of the Moon.wav\" WAVE\r\n" +
+	"  TRACK 01 AUDIO\r\n" +
+	"    TITLE \"Speak to Me\"\r\n" +
+	"    INDEX 01 00:00:00\r\n" +
+	"  TRACK 02 AUDIO\r\n" +
+	"    TITLE \"Breathe\"\r\n" +
+	"    PERFORMER \"Pink\tFloyd\"\r\n" +
+	"    INDEX 00 01:05:50\r\n" +
+	"    INDEX 01 01:07:30\r\n" +
+	"  TRACK 03 AUDIO\r\n" +
+	"    TITLE \"On the Run\"\r\n" +
+	"    INDEX 01 03:56:00\r\n"
+
+func TestParseCue(t *testing.T) {
+	sheet, err := ParseCue([]byte(testCue))
+	if err != nil {
+		t.Fatalf("ParseCue: %v", err)
+	}
+	if sheet.Title != "The Dark Side of the Moon" || sheet.Performer != "Pink Floyd" || sheet.Genre != "Progressive Rock" || sheet.Year != 1973 {
+		t.Errorf("sheet = %+v", sheet)
+	}
+
+	file := sheet.File("Pink Floyd - The Dark Side of the Moon.flac")
+	if file == nil || len(file.Tracks) != 3 {
+		t.Fatalf("File() = %+v, want the converted image with 3 tracks", file)
+	}
+	second := file.Tracks[1]
+	if second.Number != 2 || second.Title != "Breathe" || second.Performer != "Pink\tFloyd" {
+		t.Errorf("track 2 = %+v", second)
+	}
+	if second.Start != 67.4 || second.End != 236 || file.Tracks[2].End != 0 {
+		t.Errorf("offsets = %v-%v, last ends at %v", second.Start, second.End, file.Tracks[2].End)
+	}
+
+	if _, err := ParseCue([]byte("REM nothing here\n")); err == nil {
+		t.Error("expected an error for a sheet without tracks")
+	}
+}
+
+func TestCutWAVSegment(t *testing.T) {
+	wav := buildWAV() // 48 kHz, 1 second
+	seg, err := cutSegment(bytes.NewReader(wav), int64(len(wav)), 0.25, 0.75)
+	if err != nil {
+		t.Fatalf("cutSegment: %v", err)
+	}
+	checkSegment(t, seg, "wav", 0.5)
+}
+
+// buildFLACFrames writes a fixed-blocksize stream of 4096-sample frames with valid headers
+func buildFLACFrames(frames int) []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:], 4096)
+	binary.BigEndian.PutUint16(info[2:], 4096)
+	packed := uint64(44100)<<44 | uint64(1)<<41 | uint64(15)<<36 | uint64(frames*4096)
+	binary.BigEndian.PutUint64(info[10:], packed)
+	b.Write([]byte{0x80 | flacStreamInfo, 0, 0, 34})
+	b.Write(info)
+
+	for i := 0; i < frames; i++ {
+		header := []byte{0xFF, 0xF8, 0xC9, 0x18}
+		if i < 0x80 {
+			header = append(header, byte(i))
+		} else {
+			header = append(header, 0xC0|byte(i>>6), 0x80|byte(i&0x3F))
+		}
+		b.Write(header)
+		b.WriteByte(crc8(header))
+		b.Write(make([]byte, 1000))
+	}
+	return b.Bytes()
+}
+
+func TestCutFLACSegment(t *testing.T) {
+	flac := buildFLACFrames(200) // Large enough to be bisected
+	seg, err := cutSegment(bytes.NewReader(flac), int64(len(flac)), 10, 12)
+	if err != nil {
+		t.Fatalf("cutSegment: %v", err)
+	}
+	// 10 s falls in frame 107 and 12 s in frame 129, so 22 whole frames are kept
+	if seg.Start != 107*4096/44100.0 {
+		t.Errorf("Start = %v", seg.Start)
+	}
+	checkSegment(t, seg, "flac", 22*4096/44100.0)
+}
+
+func checkSegment(t *testing.T, seg *Segment, container string, duration float64) {
+	t.Helper()
+	data, err := io.ReadAll(seg)
+	if err != nil {
+		t.Fatalf("read segment: %v", err)
+	}
+	if _, err := seg.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	m, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Read(segment): %v", err)
+	}
+	if m.Container != container || math.Abs(m.Duration-duration) > 1e-6 {
+		t.Errorf("segment = %s %.4fs, want %s %.4fs", m.Container, m.Duration, container, duration)
+	}
+	if math.Abs(seg.End-seg.Start-duration) > 1e-6 {
+		t.Errorf("bounds = %v-%v, want %v long", seg.Start, seg.End, duration)
+	}
+}
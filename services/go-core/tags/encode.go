@@ -0,0 +1,337 @@
+package tags
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// flacEncodeBlock is the number of sample frames per encoded FLAC frame
+const flacEncodeBlock = 4096
+
+// EncoderTypes maps the formats NewEncoder writes to their content type
+var EncoderTypes = map[string]string{
+	"wav":  "audio/wav",
+	"flac": "audio/flac",
+}
+
+// Encoder writes decoded audio back to a lossless file as 16-bit PCM. Blocks
+// hold one slice per channel, like those of PCM.Read; samples outside
+// [-1, 1) are clipped.
+type Encoder interface {
+	Write(block [][]float32) error
+	// Close flushes buffered audio; the underlying writer is left open
+	Close() error
+}
+
+// NewEncoder starts a WAV or FLAC stream on w. frames is the length of the
+// audio written to the headers, 0 when unknown.
+func NewEncoder(w io.Writer, format string, sampleRate, channels int, frames int64) (Encoder, error) {
+	if sampleRate <= 0 || channels <= 0 || channels > 8 {
+		return nil, fmt.Errorf("%w: cannot encode %d channels at %d Hz", ErrUnsupported, channels, sampleRate)
+	}
+	switch format {
+	case "wav":
+		return newWAVEncoder(w, sampleRate, channels, frames)
+	case "flac":
+		return newFLACEncoder(w, sampleRate, channels, frames)
+	}
+	return nil, fmt.Errorf("%w: cannot encode %s", ErrUnsupported, format)
+}
+
+// WAVSize returns the size of the WAV file NewEncoder writes for frames
+func WAVSize(channels int, frames int64) int64 {
+	return 44 + frames*int64(channels)*2
+}
+
+// quantize converts a sample to 16 bits
+func quantize(v float32) int32 {
+	return int32(min(max(math.Round(float64(v)*32768), -32768), 32767))
+}
+
+type wavEncoder struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func newWAVEncoder(w io.Writer, sampleRate, channels int, frames int64) (*wavEncoder, error) {
+	// Streams of unknown or oversized length announce the largest size, as ffmpeg does
+	data := uint32(math.MaxUint32)
+	if size := WAVSize(channels, frames) - 44; frames > 0 && size <= math.MaxUint32-36 {
+		data = uint32(size)
+	}
+	riff := data
+	if data != math.MaxUint32 {
+		riff = data + 36
+	}
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], riff)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // Integer PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], data)
+
+	e := &wavEncoder{w: bufio.NewWriterSize(w, 64<<10)}
+	if _, err := e.w.Write(header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *wavEncoder) Write(block [][]float32) error {
+	if len(block) == 0 {
+		return nil
+	}
+	e.buf = e.buf[:0]
+	for i := range block[0] {
+		for ch := range block {
+			e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(quantize(block[ch][i])))
+		}
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+func (e *wavEncoder) Close() error {
+	return e.w.Flush()
+}
+
+// flacSampleRates are the sample rates a FLAC frame header can encode directly
+var flacSampleRates = map[int]byte{
+	88200: 1, 176400: 2, 192000: 3, 8000: 4, 16000: 5, 22050: 6,
+	24000: 7, 32000: 8, 44100: 9, 48000: 10, 96000: 11,
+}
+
+// flacEncoder writes independent channels with the best fixed predictor and
+// a single Rice partition per subframe. It trades some compression for
+// speed, which is what a live stream needs.
+type flacEncoder struct {
+	w        io.Writer
+	channels int
+	rateCode byte
+	pending  [][]int32
+	frame    int64
+	bw       flacBitWriter
+	residual []uint32
+}
+
+func newFLACEncoder(w io.Writer, sampleRate, channels int, frames int64) (*flacEncoder, error) {
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:], flacEncodeBlock)
+	binary.BigEndian.PutUint16(info[2:], flacEncodeBlock)
+	// Frame sizes and the MD5 are left unknown, they cannot be known before the end of a stream
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(15)<<36 | uint64(max(frames, 0))&(1<<36-1)
+	binary.BigEndian.PutUint64(info[10:], packed)
+
+	header := append([]byte("fLaC"), 0x80|flacStreamInfo, 0, 0, 34)
+	if _, err := w.Write(append(header, info...)); err != nil {
+		return nil, err
+	}
+	return &flacEncoder{
+		w:        w,
+		channels: channels,
+		rateCode: flacSampleRates[sampleRate], // 0 refers to STREAMINFO
+		pending:  make([][]int32, channels),
+	}, nil
+}
+
+func (e *flacEncoder) Write(block [][]float32) error {
+	if len(block) != e.channels {
+		return fmt.Errorf("flac encoder: got %d channels, want %d", len(block), e.channels)
+	}
+	for ch, samples := range block {
+		for _, v := range samples {
+			e.pending[ch] = append(e.pending[ch], quantize(v))
+		}
+	}
+	done := 0
+	for len(e.pending[0])-done >= flacEncodeBlock {
+		if err := e.writeFrame(done, flacEncodeBlock); err != nil {
+			return err
+		}
+		done += flacEncodeBlock
+	}
+	for ch := range e.pending {
+		e.pending[ch] = e.pending[ch][:copy(e.pending[ch], e.pending[ch][done:])]
+	}
+	return nil
+}
+
+func (e *flacEncoder) Close() error {
+	if n := len(e.pending[0]); n > 0 {
+		if err := e.writeFrame(0, n); err != nil {
+			return err
+		}
+		for ch := range e.pending {
+			e.pending[ch] = e.pending[ch][:0]
+		}
+	}
+	return nil
+}
+
+// writeFrame encodes n pending sample frames from from
+func (e *flacEncoder) writeFrame(from, n int) error {
+	blockCode := byte(12) // 4096
+	if n != flacEncodeBlock {
+		blockCode = 7 // 16-bit size at the end of the header
+	}
+	header := []byte{0xFF, 0xF8, blockCode<<4 | e.rateCode, byte(e.channels-1)<<4 | 4<<1}
+	header = appendFLACUTF8(header, e.frame)
+	if blockCode == 7 {
+		header = binary.BigEndian.AppendUint16(header, uint16(n-1))
+	}
+	header = append(header, crc8(header))
+
+	e.bw = flacBitWriter{buf: append(e.bw.buf[:0], header...)}
+	for ch := range e.pending {
+		e.subframe(e.pending[ch][from : from+n])
+	}
+	e.bw.align()
+	var crc uint16
+	for _, c := range e.bw.buf {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^c]
+	}
+	e.bw.buf = binary.BigEndian.AppendUint16(e.bw.buf, crc)
+	e.frame++
+	_, err := e.w.Write(e.bw.buf)
+	return err
+}
+
+// subframe writes a constant subframe for silence and otherwise the cheapest
+// of the fixed predictors, falling back to verbatim samples
+func (e *flacEncoder) subframe(s []int32) {
+	constant := true
+	for _, v := range s[1:] {
+		if v != s[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		e.bw.write(0, 8)
+		e.bw.write(uint64(uint16(s[0])), 16)
+		return
+	}
+
+	order, best := 0, uint64(math.MaxUint64)
+	for o := 0; o <= 4 && o < len(s); o++ {
+		var sum uint64
+		for i := o; i < len(s); i++ {
+			sum += uint64(zigzag(fixedResidual(s, i, o)))
+		}
+		if sum < best {
+			order, best = o, sum
+		}
+	}
+	e.residual = e.residual[:0]
+	for i := order; i < len(s); i++ {
+		e.residual = append(e.residual, zigzag(fixedResidual(s, i, order)))
+	}
+	param, bits := 0, uint64(math.MaxUint64)
+	for k := 0; k < 15; k++ {
+		cost := uint64(len(e.residual)) * uint64(k+1)
+		for _, u := range e.residual {
+			cost += uint64(u >> k)
+		}
+		if cost < bits {
+			param, bits = k, cost
+		}
+	}
+
+	if uint64(order)*16+10+bits >= uint64(len(s))*16 {
+		e.bw.write(1<<1, 8) // Verbatim
+		for _, v := range s {
+			e.bw.write(uint64(uint16(v)), 16)
+		}
+		return
+	}
+	e.bw.write(uint64(8|order)<<1, 8)
+	for _, v := range s[:order] {
+		e.bw.write(uint64(uint16(v)), 16)
+	}
+	e.bw.write(0, 6) // Rice coding with 4-bit parameters, one partition
+	e.bw.write(uint64(param), 4)
+	for _, u := range e.residual {
+		e.bw.unary(u >> param)
+		e.bw.write(uint64(u), uint(param))
+	}
+}
+
+// fixedResidual is the error of the fixed predictor of the order for sample i
+func fixedResidual(s []int32, i, order int) int32 {
+	switch order {
+	case 1:
+		return s[i] - s[i-1]
+	case 2:
+		return s[i] - 2*s[i-1] + s[i-2]
+	case 3:
+		return s[i] - 3*s[i-1] + 3*s[i-2] - s[i-3]
+	case 4:
+		return s[i] - 4*s[i-1] + 6*s[i-2] - 4*s[i-3] + s[i-4]
+	}
+	return s[i]
+}
+
+func zigzag(v int32) uint32 {
+	return uint32(v<<1 ^ v>>31)
+}
+
+// appendFLACUTF8 appends a frame number in FLAC's extended UTF-8 coding
+func appendFLACUTF8(b []byte, v int64) []byte {
+	if v < 0x80 {
+		return append(b, byte(v))
+	}
+	n := 2
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+	b = append(b, byte(uint16(0xFF00)>>n)|byte(v>>(6*(n-1))))
+	for i := n - 2; i >= 0; i-- {
+		b = append(b, 0x80|byte(v>>(6*i))&0x3F)
+	}
+	return b
+}
+
+// flacBitWriter packs a FLAC frame MSB first
+type flacBitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+// write appends the low bits of v, at most 32
+func (b *flacBitWriter) write(v uint64, bits uint) {
+	if bits == 0 {
+		return
+	}
+	b.acc = b.acc<<bits | v&(1<<bits-1)
+	b.n += bits
+	for b.n >= 8 {
+		b.n -= 8
+		b.buf = append(b.buf, byte(b.acc>>b.n))
+	}
+}
+
+// unary writes q zero bits and a one
+func (b *flacBitWriter) unary(q uint32) {
+	for ; q >= 32; q -= 32 {
+		b.write(0, 32)
+	}
+	b.write(1, uint(q)+1)
+}
+
+// align pads the frame to a byte boundary
+func (b *flacBitWriter) align() {
+	if b.n > 0 {
+		b.write(0, 8-b.n)
+	}
+}
@@ -0,0 +1,126 @@
+package tags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+)
+
+// readFLAC parses a native FLAC stream starting at off (after any ID3 tag)
+func readFLAC(r io.ReaderAt, size, off int64) (*Metadata, error) {
+	m := &Metadata{Container: "flac", Codec: "flac"}
+	pos := off + 4 // "fLaC"
+	var samples int64
+
+	for {
+		header, err := readAt(r, pos, 4)
+		if err != nil {
+			return nil, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4
+
+		switch blockType {
+		case flacStreamInfo:
+			block, err := readAt(r, pos, int(length))
+			if err != nil {
+				return nil, err
+			}
+			if samples, err = parseStreamInfo(m, block); err != nil {
+				return nil, err
+			}
+		case flacVorbisComment:
+			if length <= maxChunkSize {
+				block, err := readAt(r, pos, int(length))
+				if err != nil {
+					return nil, err
+				}
+				if err := parseVorbisComments(m, block); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		pos += length
+		if last || pos >= size {
+			break
+		}
+	}
+
+	if m.SampleRate == 0 {
+		return nil, fmt.Errorf("%w: FLAC stream without STREAMINFO", ErrMalformed)
+	}
+	if samples > 0 {
+		m.Duration = float64(samples) / float64(m.SampleRate)
+	}
+	m.Bitrate = averageBitrate(size-pos, m.Duration)
+	return m, nil
+}
+
+// parseStreamInfo reads the STREAMINFO block and returns the total sample count
+func parseStreamInfo(m *Metadata, b []byte) (int64, error) {
+	if len(b) < 18 {
+		return 0, fmt.Errorf("%w: short STREAMINFO block", ErrMalformed)
+	}
+	// 20 bits sample rate, 3 bits channels-1, 5 bits bits-per-sample-1, 36 bits total samples
+	packed := binary.BigEndian.Uint64(b[10:18])
+	m.SampleRate = int(packed >> 44)
+	m.Channels = int((packed>>41)&0x07) + 1
+	m.BitDepth = int((packed>>36)&0x1F) + 1
+	return int64(packed & 0xFFFFFFFFF), nil
+}
+
+// parseVorbisComments reads a Vorbis comment block (FLAC, Ogg Vorbis and Opus)
+func parseVorbisComments(m *Metadata, b []byte) error {
+	if len(b) >= 4 {
+		if n := int(binary.LittleEndian.Uint32(b)); n >= 0 && 4+n <= len(b) {
+			m.Encoder = clean(string(b[4 : 4+n]))
+		}
+	}
+	return eachVorbisComment(b, func(key, value string) {
+		if !strings.EqualFold(key, "METADATA_BLOCK_PICTURE") {
+			m.add(key, value)
+		}
+	})
+}
+
+// eachVorbisComment calls fn with every KEY=value field of a Vorbis comment block
+func eachVorbisComment(b []byte, fn func(key, value string)) error {
+	errShort := fmt.Errorf("%w: truncated Vorbis comment block", ErrMalformed)
+	if len(b) < 4 {
+		return errShort
+	}
+	vendorLen := int(binary.LittleEndian.Uint32(b))
+	pos := 4 + vendorLen
+	if vendorLen < 0 || pos+4 > len(b) {
+		return errShort
+	}
+	count := int(binary.LittleEndian.Uint32(b[pos:]))
+	pos += 4
+
+	for i := 0; i < count; i++ {
+		if pos+4 > len(b) {
+			return errShort
+		}
+		n := int(binary.LittleEndian.Uint32(b[pos:]))
+		pos += 4
+		if n < 0 || pos+n > len(b) {
+			return errShort
+		}
+		key, value, ok := strings.Cut(string(b[pos:pos+n]), "=")
+		pos += n
+		if ok {
+			fn(key, value)
+		}
+	}
+	return nil
+}
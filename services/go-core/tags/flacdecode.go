@@ -0,0 +1,462 @@
+package tags
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// errFLACFrame wraps the failures of a single FLAC frame
+var errFLACFrame = errors.New("invalid FLAC frame")
+
+// bitReader reads a FLAC frame MSB first and keeps the CRC-16 of the bytes consumed
+type bitReader struct {
+	r     *bufio.Reader
+	cache uint64 // The low n bits are not consumed yet
+	n     uint
+	crc   uint16
+	pos   int64 // Bytes consumed
+}
+
+func (b *bitReader) fill() error {
+	c, err := b.r.ReadByte()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	b.crc = b.crc<<8 ^ crc16Table[byte(b.crc>>8)^c]
+	b.pos++
+	b.cache = b.cache<<8 | uint64(c)
+	b.n += 8
+	return nil
+}
+
+// bits reads an unsigned value of up to 32 bits
+func (b *bitReader) bits(n uint) (uint64, error) {
+	for b.n < n {
+		if err := b.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b.n -= n
+	v := b.cache >> b.n & (1<<n - 1)
+	b.cache &= 1<<b.n - 1
+	return v, nil
+}
+
+// signed reads a two's complement value of up to 33 bits
+func (b *bitReader) signed(n uint) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if n > 32 {
+		hi, err := b.bits(n - 32)
+		if err != nil {
+			return 0, err
+		}
+		lo, err := b.bits(32)
+		if err != nil {
+			return 0, err
+		}
+		return int64(hi<<32|lo) << (64 - n) >> (64 - n), nil
+	}
+	v, err := b.bits(n)
+	if err != nil {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// unary counts the zero bits before the next one bit
+func (b *bitReader) unary() (uint64, error) {
+	var q uint64
+	for {
+		if b.n == 0 {
+			if err := b.fill(); err != nil {
+				return 0, err
+			}
+		}
+		if b.cache == 0 {
+			q += uint64(b.n)
+			b.n = 0
+			continue
+		}
+		zeros := b.n - uint(bits.Len64(b.cache))
+		q += uint64(zeros)
+		b.n -= zeros + 1
+		b.cache &= 1<<b.n - 1
+		return q, nil
+	}
+}
+
+// align drops the padding bits up to the next byte boundary
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+	b.cache &= 1<<b.n - 1
+}
+
+// flacDecoder decodes the frames of a FLAC stream into interleaved samples
+type flacDecoder struct {
+	br         bitReader
+	bps        int // Bits per sample from STREAMINFO
+	fixedBlock int64
+	channels   [][]int64
+}
+
+// flacFrameInfo describes a decoded frame
+type flacFrameInfo struct {
+	sample   int64
+	block    int
+	channels int
+	bps      int
+}
+
+// frame decodes the next frame into d.channels. It returns io.EOF at the end
+// of the stream and wraps errFLACFrame when the frame is damaged.
+func (d *flacDecoder) frame() (flacFrameInfo, error) {
+	var info flacFrameInfo
+	br := &d.br
+	br.crc = 0
+	if _, err := br.r.Peek(1); err == io.EOF {
+		return info, io.EOF
+	}
+
+	header := make([]byte, 0, flacMaxHeader)
+	next := func() (byte, error) {
+		v, err := br.bits(8)
+		header = append(header, byte(v))
+		return byte(v), err
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := next(); err != nil {
+			return info, err
+		}
+	}
+	if header[0] != 0xFF || header[1]&0xFE != 0xF8 {
+		return info, fmt.Errorf("%w: no frame sync", errFLACFrame)
+	}
+	variable := header[1]&0x01 != 0
+	blockCode, rateCode := header[2]>>4, header[2]&0x0F
+	assignment, sizeCode := header[3]>>4, header[3]>>1&0x07
+	if blockCode == 0 || rateCode == 0x0F || assignment > 10 || sizeCode == 3 || header[3]&0x01 != 0 {
+		return info, fmt.Errorf("%w: reserved header value", errFLACFrame)
+	}
+
+	// Coded frame or sample number, 1 to 7 bytes
+	first, err := next()
+	if err != nil {
+		return info, err
+	}
+	extra := bits.LeadingZeros8(^first)
+	if extra == 1 || extra > 7 {
+		return info, fmt.Errorf("%w: invalid frame number", errFLACFrame)
+	}
+	for i := 1; i < extra; i++ {
+		if _, err := next(); err != nil {
+			return info, err
+		}
+	}
+	number, n := flacUTF8(header[4:])
+	if n == 0 {
+		return info, fmt.Errorf("%w: invalid frame number", errFLACFrame)
+	}
+
+	switch {
+	case blockCode == 1:
+		info.block = 192
+	case blockCode <= 5:
+		info.block = 576 << (blockCode - 2)
+	case blockCode == 6:
+		v, err := next()
+		if err != nil {
+			return info, err
+		}
+		info.block = int(v) + 1
+	case blockCode == 7:
+		hi, err := next()
+		if err != nil {
+			return info, err
+		}
+		lo, err := next()
+		if err != nil {
+			return info, err
+		}
+		info.block = int(hi)<<8 | int(lo) + 1
+	default:
+		info.block = 256 << (blockCode - 8)
+	}
+	rateBytes := map[byte]int{12: 1, 13: 2, 14: 2}[rateCode]
+	for i := 0; i < rateBytes; i++ {
+		if _, err := next(); err != nil {
+			return info, err
+		}
+	}
+	sum, err := br.bits(8)
+	if err != nil {
+		return info, err
+	}
+	if crc8(header) != byte(sum) {
+		return info, fmt.Errorf("%w: header CRC mismatch", errFLACFrame)
+	}
+
+	info.sample = number
+	if !variable {
+		info.sample = number * d.fixedBlock
+	}
+	info.bps = d.bps
+	if sizeCode != 0 {
+		info.bps = []int{0, 8, 12, 0, 16, 20, 24, 32}[sizeCode]
+	}
+	info.channels = int(assignment) + 1
+	if assignment > 7 {
+		info.channels = 2
+	}
+
+	for len(d.channels) < info.channels {
+		d.channels = append(d.channels, nil)
+	}
+	for ch := 0; ch < info.channels; ch++ {
+		bps := info.bps
+		// The side channel carries one extra bit
+		if (assignment == 8 || assignment == 10) && ch == 1 || assignment == 9 && ch == 0 {
+			bps++
+		}
+		if cap(d.channels[ch]) < info.block {
+			d.channels[ch] = make([]int64, info.block)
+		}
+		d.channels[ch] = d.channels[ch][:info.block]
+		if err := d.subframe(d.channels[ch], bps); err != nil {
+			return info, err
+		}
+	}
+
+	br.align()
+	sum16 := br.crc
+	footer, err := br.bits(16)
+	if err != nil {
+		return info, err
+	}
+	if uint16(footer) != sum16 {
+		return info, fmt.Errorf("%w: frame CRC mismatch", errFLACFrame)
+	}
+
+	if assignment > 7 {
+		left, right := d.channels[0], d.channels[1]
+		for i := range left {
+			switch assignment {
+			case 8: // left/side
+				right[i] = left[i] - right[i]
+			case 9: // side/right
+				left[i] += right[i]
+			case 10: // mid/side
+				mid := left[i]<<1 | right[i]&1
+				side := right[i]
+				left[i], right[i] = (mid+side)>>1, (mid-side)>>1
+			}
+		}
+	}
+	return info, nil
+}
+
+// subframe decodes one channel of a frame
+func (d *flacDecoder) subframe(out []int64, bps int) error {
+	br := &d.br
+	header, err := br.bits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return fmt.Errorf("%w: invalid subframe padding", errFLACFrame)
+	}
+	kind := header >> 1 & 0x3F
+	wasted := 0
+	if header&0x01 != 0 {
+		k, err := br.unary()
+		if err != nil {
+			return err
+		}
+		wasted = int(k) + 1
+		bps -= wasted
+		if bps <= 0 {
+			return fmt.Errorf("%w: invalid wasted bits", errFLACFrame)
+		}
+	}
+
+	switch {
+	case kind == 0: // Constant
+		v, err := br.signed(uint(bps))
+		if err != nil {
+			return err
+		}
+		for i := range out {
+			out[i] = v
+		}
+	case kind == 1: // Verbatim
+		for i := range out {
+			if out[i], err = br.signed(uint(bps)); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		order := int(kind - 8)
+		if err := d.warmup(out, order, bps); err != nil {
+			return err
+		}
+		if err := d.residual(out, order); err != nil {
+			return err
+		}
+		fixedPredict(out, order)
+	case kind >= 32:
+		order := int(kind - 31)
+		if err := d.warmup(out, order, bps); err != nil {
+			return err
+		}
+		precision, err := br.bits(4)
+		if err != nil {
+			return err
+		}
+		if precision == 15 {
+			return fmt.Errorf("%w: invalid LPC precision", errFLACFrame)
+		}
+		shift, err := br.signed(5)
+		if err != nil {
+			return err
+		}
+		if shift < 0 {
+			return fmt.Errorf("%w: negative LPC shift", errFLACFrame)
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			if coefs[i], err = br.signed(uint(precision + 1)); err != nil {
+				return err
+			}
+		}
+		if err := d.residual(out, order); err != nil {
+			return err
+		}
+		for i := order; i < len(out); i++ {
+			var sum int64
+			for j, c := range coefs {
+				sum += c * out[i-j-1]
+			}
+			out[i] += sum >> uint(shift)
+		}
+	default:
+		return fmt.Errorf("%w: reserved subframe type %d", errFLACFrame, kind)
+	}
+
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= uint(wasted)
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) warmup(out []int64, order, bps int) error {
+	if order > len(out) {
+		return fmt.Errorf("%w: predictor order exceeds block size", errFLACFrame)
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.signed(uint(bps))
+		if err != nil {
+			return err
+		}
+		out[i] = v
+	}
+	return nil
+}
+
+// residual reads the Rice coded prediction errors following the warm-up samples
+func (d *flacDecoder) residual(out []int64, order int) error {
+	br := &d.br
+	method, err := br.bits(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return fmt.Errorf("%w: reserved residual coding", errFLACFrame)
+	}
+	paramBits, escape := uint(4), uint64(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+	partitionOrder, err := br.bits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	if len(out)%partitions != 0 || len(out)/partitions < order {
+		return fmt.Errorf("%w: invalid residual partitions", errFLACFrame)
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * len(out) / partitions
+		param, err := br.bits(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			n, err := br.bits(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				if out[i], err = br.signed(uint(n)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			q, err := br.unary()
+			if err != nil {
+				return err
+			}
+			r, err := br.bits(uint(param))
+			if err != nil {
+				return err
+			}
+			v := q<<param | r
+			out[i] = int64(v>>1) ^ -int64(v&1)
+		}
+	}
+	return nil
+}
+
+// fixedPredict restores the samples of a fixed predictor subframe from its residual
+func fixedPredict(out []int64, order int) {
+	for i := order; i < len(out); i++ {
+		switch order {
+		case 1:
+			out[i] += out[i-1]
+		case 2:
+			out[i] += 2*out[i-1] - out[i-2]
+		case 3:
+			out[i] += 3*out[i-1] - 3*out[i-2] + out[i-3]
+		case 4:
+			out[i] += 4*out[i-1] - 6*out[i-2] + 4*out[i-3] - out[i-4]
+		}
+	}
+}
+
+// crc16Table is the table of the FLAC frame footer checksum (polynomial x^16 + x^15 + x^2 + 1)
+var crc16Table = func() (t [256]uint16) {
+	for i := range t {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
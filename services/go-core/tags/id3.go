@@ -0,0 +1,353 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3Frames maps ID3v2.3/2.4 frame IDs to Vorbis comment names
+var id3Frames = map[string]string{
+	"TIT2": "TITLE",
+	"TPE1": "ARTIST",
+	"TPE2": "ALBUMARTIST",
+	"TALB": "ALBUM",
+	"TRCK": "TRACKNUMBER",
+	"TPOS": "DISCNUMBER",
+	"TYER": "DATE",
+	"TDRC": "DATE",
+	"TDOR": "ORIGINALDATE",
+	"TCON": "GENRE",
+	"TCOM": "COMPOSER",
+	"TCMP": "COMPILATION",
+	"TSRC": "ISRC",
+	"TBPM": "BPM",
+	"TLEN": "LENGTH",
+	"COMM": "COMMENT",
+	"TSSE": "ENCODER",
+}
+
+// id3v22Frames maps ID3v2.2 three-letter frame IDs to their v2.3 equivalents
+var id3v22Frames = map[string]string{
+	"TT2": "TIT2",
+	"TP1": "TPE1",
+	"TP2": "TPE2",
+	"TAL": "TALB",
+	"TRK": "TRCK",
+	"TPA": "TPOS",
+	"TYE": "TYER",
+	"TCO": "TCON",
+	"TCM": "TCOM",
+	"TCP": "TCMP",
+	"TRC": "TSRC",
+	"TBP": "TBPM",
+	"TLE": "TLEN",
+	"COM": "COMM",
+	"TSS": "TSSE",
+	"TXX": "TXXX",
+}
+
+// readID3File handles files starting with an ID3v2 tag: FLAC with a leading tag or MP3
+func readID3File(r io.ReaderAt, size int64) (*Metadata, error) {
+	tag := &Metadata{}
+	end, err := readID3v2(r, 0, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if magic, err := readAt(r, end, 4); err == nil && string(magic) == "fLaC" {
+		m, err := readFLAC(r, size, end)
+		if err != nil {
+			return nil, err
+		}
+		mergeComments(m, tag)
+		return m, nil
+	}
+
+	return readMPEG(r, size, end, tag)
+}
+
+// mergeComments copies the comments of src that dst does not already have
+func mergeComments(dst, src *Metadata) {
+	for k, values := range src.Comments {
+		if _, ok := dst.Comments[k]; ok {
+			continue
+		}
+		for _, v := range values {
+			dst.add(k, v)
+		}
+	}
+}
+
+// readID3v2 parses an ID3v2 tag at off into m and returns the offset just past it
+func readID3v2(r io.ReaderAt, off int64, m *Metadata) (int64, error) {
+	header, err := readAt(r, off, 10)
+	if err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return 0, fmt.Errorf("%w: missing ID3 header", ErrMalformed)
+	}
+	version := header[3]
+	flags := header[5]
+	size := int64(syncsafe(header[6:10]))
+	end := off + 10 + size
+	if flags&0x10 != 0 {
+		end += 10 // Footer
+	}
+
+	if size > maxChunkSize {
+		// Oversized tags carry artwork; skip them rather than failing the file
+		return end, nil
+	}
+	body, err := readAt(r, off+10, int(size))
+	if err != nil {
+		return 0, err
+	}
+	if err := parseID3v2(body, version, flags, m); err != nil {
+		return 0, err
+	}
+	return end, nil
+}
+
+// parseID3v2 reads the frames of an ID3v2 tag body
+func parseID3v2(body []byte, version, flags byte, m *Metadata) error {
+	return eachID3Frame(body, version, flags, func(id string, data []byte) {
+		if version == 2 {
+			id = id3v22Frames[id]
+		}
+		parseID3Frame(id, data, m)
+	})
+}
+
+// eachID3Frame calls fn with the ID and decoded payload of every frame of an
+// ID3v2 tag body; ID3v2.2 frames keep their three-letter IDs
+func eachID3Frame(body []byte, version, flags byte, fn func(id string, data []byte)) error {
+	if version < 2 || version > 4 {
+		return fmt.Errorf("%w: unsupported ID3v2.%d tag", ErrMalformed, version)
+	}
+	if flags&0x80 != 0 && version < 4 {
+		// Tag-wide unsynchronisation; v2.4 flags it per frame instead
+		body = unsynchronise(body)
+	}
+
+	pos := 0
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		// Skip the extended header
+		if version == 4 {
+			pos = int(syncsafe(body[:4]))
+		} else {
+			pos = int(binary.BigEndian.Uint32(body[:4])) + 4
+		}
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for pos+headerLen <= len(body) {
+		id := string(body[pos : pos+idLen])
+		if body[pos] == 0 {
+			break // Padding
+		}
+
+		var size int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			size = int(body[pos+3])<<16 | int(body[pos+4])<<8 | int(body[pos+5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(body[pos+4:]))
+			frameFlags = binary.BigEndian.Uint16(body[pos+8:])
+		case 4:
+			size = int(syncsafe(body[pos+4 : pos+8]))
+			frameFlags = binary.BigEndian.Uint16(body[pos+8:])
+		}
+		pos += headerLen
+		if size < 0 || pos+size > len(body) {
+			break
+		}
+		data := body[pos : pos+size]
+		pos += size
+
+		if version == 4 {
+			if frameFlags&0x000C != 0 {
+				continue // Compressed or encrypted
+			}
+			if frameFlags&0x0001 != 0 && len(data) >= 4 {
+				data = data[4:] // Data length indicator
+			}
+			if frameFlags&0x0002 != 0 || flags&0x80 != 0 {
+				data = unsynchronise(data)
+			}
+		} else if version == 3 && frameFlags&0x00C0 != 0 {
+			continue // Compressed or encrypted
+		}
+
+		fn(id, data)
+	}
+	return nil
+}
+
+// parseID3Frame records the value of a single text or comment frame
+func parseID3Frame(id string, data []byte, m *Metadata) {
+	if len(data) == 0 {
+		return
+	}
+	switch {
+	case id == "TXXX":
+		values := decodeID3Text(data[0], data[1:])
+		if len(values) >= 2 {
+			m.add(values[0], strings.Join(values[1:], "; "))
+		}
+	case id == "COMM":
+		// Encoding, three-letter language, description, text
+		if len(data) < 4 {
+			return
+		}
+		values := decodeID3Text(data[0], data[4:])
+		if len(values) >= 2 && values[0] == "" {
+			m.add("COMMENT", values[1])
+		}
+	case id == "TCON":
+		for _, v := range decodeID3Text(data[0], data[1:]) {
+			m.add("GENRE", id3Genre(v))
+		}
+	case strings.HasPrefix(id, "T"):
+		key, ok := id3Frames[id]
+		if !ok {
+			return
+		}
+		for _, v := range decodeID3Text(data[0], data[1:]) {
+			m.add(key, v)
+		}
+	}
+}
+
+// decodeID3Text decodes a text frame payload into its NUL-separated values
+func decodeID3Text(encoding byte, b []byte) []string {
+	var s string
+	switch encoding {
+	case 0: // ISO-8859-1
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		s = string(runes)
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		s = decodeUTF16(b, encoding == 2)
+	default: // UTF-8
+		s = string(b)
+	}
+	s = strings.TrimRight(s, "\x00")
+	return strings.Split(s, "\x00")
+}
+
+// decodeUTF16 decodes UTF-16 text, honouring byte order marks at the start of each value
+func decodeUTF16(b []byte, bigEndian bool) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		switch {
+		case b[i] == 0xFF && b[i+1] == 0xFE:
+			bigEndian = false
+			continue
+		case b[i] == 0xFE && b[i+1] == 0xFF:
+			bigEndian = true
+			continue
+		}
+		if bigEndian {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		} else {
+			units = append(units, uint16(b[i+1])<<8|uint16(b[i]))
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// id3Genre resolves numeric genre references such as "(17)" or "17" to their names
+func id3Genre(v string) string {
+	ref := v
+	if strings.HasPrefix(ref, "(") {
+		inner, rest, ok := strings.Cut(ref[1:], ")")
+		if !ok {
+			return v
+		}
+		if rest != "" {
+			return rest // "(17)Rock" carries its own refinement
+		}
+		ref = inner
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 0 && n < len(id3v1Genres) {
+		return id3v1Genres[n]
+	}
+	return v
+}
+
+// readID3v1 parses the 128-byte ID3v1 tag at the end of an MP3 file, if any.
+// It reports whether a tag was found.
+func readID3v1(r io.ReaderAt, size int64, m *Metadata) bool {
+	if size < 128 {
+		return false
+	}
+	b, err := readAt(r, size-128, 128)
+	if err != nil || string(b[:3]) != "TAG" {
+		return false
+	}
+
+	field := func(f []byte) string {
+		if i := bytes.IndexByte(f, 0); i >= 0 {
+			f = f[:i]
+		}
+		return decodeID3Text(0, f)[0]
+	}
+	m.setDefault("TITLE", field(b[3:33]))
+	m.setDefault("ARTIST", field(b[33:63]))
+	m.setDefault("ALBUM", field(b[63:93]))
+	m.setDefault("DATE", field(b[93:97]))
+	if b[125] == 0 && b[126] != 0 {
+		// ID3v1.1 stores the track number in the last comment byte
+		m.setDefault("TRACKNUMBER", strconv.Itoa(int(b[126])))
+	}
+	if int(b[127]) < len(id3v1Genres) {
+		m.setDefault("GENRE", id3v1Genres[b[127]])
+	}
+	return true
+}
+
+// syncsafe decodes a 28-bit integer stored in the low seven bits of four bytes
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// unsynchronise removes the zero bytes inserted after every 0xFF
+func unsynchronise(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// id3v1Genres is the ID3v1 genre list including the Winamp extensions
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop",
+	"Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap",
+	"Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska", "Death Metal", "Pranks",
+	"Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance",
+	"Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock",
+	"Ethnic", "Gothic", "Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle",
+	"Native American", "Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi",
+	"Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+	"Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebob", "Latin", "Revival",
+	"Celtic", "Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock", "Slow Rock",
+	"Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour", "Speech", "Chanson", "Opera",
+	"Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam",
+	"Club", "Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul", "Freestyle",
+	"Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House", "Dance Hall", "Goa", "Drum & Bass",
+	"Club-House", "Hardcore", "Terror", "Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover", "Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop",
+}
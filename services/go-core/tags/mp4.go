@@ -0,0 +1,404 @@
+package tags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// mp4Items maps iTunes metadata item atoms to Vorbis comment names
+var mp4Items = map[string]string{
+	"\xa9nam": "TITLE",
+	"\xa9ART": "ARTIST",
+	"aART":    "ALBUMARTIST",
+	"\xa9alb": "ALBUM",
+	"\xa9day": "DATE",
+	"\xa9gen": "GENRE",
+	"\xa9wrt": "COMPOSER",
+	"\xa9cmt": "COMMENT",
+	"\xa9grp": "GROUPING",
+	"\xa9too": "ENCODER",
+}
+
+// mp4Codecs maps audio sample entry types to codec names
+var mp4Codecs = map[string]string{
+	"mp4a": "aac",
+	"alac": "alac",
+	"fLaC": "flac",
+	"Opus": "opus",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	".mp3": "mp3",
+}
+
+// mp4Atom is a box header within an MP4 file
+type mp4Atom struct {
+	kind   string
+	offset int64 // Start of the payload
+	size   int64 // Payload size
+}
+
+// mp4Atoms lists the child atoms in [start, end)
+func mp4Atoms(r io.ReaderAt, start, end int64) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+	for pos := start; pos+8 <= end; {
+		header, err := readAt(r, pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		headerLen := int64(8)
+		switch size {
+		case 0: // Extends to the end of the enclosing atom
+			size = end - pos
+		case 1: // 64-bit size follows the type
+			ext, err := readAt(r, pos+8, 8)
+			if err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(ext))
+			headerLen = 16
+		}
+		if size < headerLen || pos+size > end {
+			return nil, fmt.Errorf("%w: invalid %q atom size", ErrMalformed, header[4:8])
+		}
+		atoms = append(atoms, mp4Atom{kind: string(header[4:8]), offset: pos + headerLen, size: size - headerLen})
+		pos += size
+	}
+	return atoms, nil
+}
+
+// mp4Child returns the first child atom of the given kind
+func mp4Child(r io.ReaderAt, parent mp4Atom, kind string) (mp4Atom, bool) {
+	atoms, err := mp4Atoms(r, parent.offset, parent.offset+parent.size)
+	if err != nil {
+		return mp4Atom{}, false
+	}
+	for _, a := range atoms {
+		if a.kind == kind {
+			return a, true
+		}
+	}
+	return mp4Atom{}, false
+}
+
+// mp4Path follows a chain of child atoms from parent
+func mp4Path(r io.ReaderAt, parent mp4Atom, kinds ...string) (mp4Atom, bool) {
+	atom := parent
+	for _, kind := range kinds {
+		var ok bool
+		if atom, ok = mp4Child(r, atom, kind); !ok {
+			return mp4Atom{}, false
+		}
+	}
+	return atom, true
+}
+
+// readMP4 parses an MP4/M4A file: stream properties from the first sound
+// track and tags from the iTunes-style ilst atom
+func readMP4(r io.ReaderAt, size int64) (*Metadata, error) {
+	top, err := mp4Atoms(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var moov mp4Atom
+	var mdatSize int64
+	for _, a := range top {
+		switch a.kind {
+		case "moov":
+			moov = a
+		case "mdat":
+			mdatSize += a.size
+		}
+	}
+	if moov.kind == "" {
+		return nil, fmt.Errorf("%w: MP4 file without moov atom", ErrMalformed)
+	}
+
+	m := &Metadata{Container: "mp4"}
+	if mvhd, ok := mp4Child(r, moov, "mvhd"); ok {
+		m.Duration = mp4Duration(r, mvhd)
+	}
+
+	traks, err := mp4Atoms(r, moov.offset, moov.offset+moov.size)
+	if err != nil {
+		return nil, err
+	}
+	for _, trak := range traks {
+		if trak.kind != "trak" || !mp4IsSound(r, trak) {
+			continue
+		}
+		if mdhd, ok := mp4Path(r, trak, "mdia", "mdhd"); ok {
+			if d := mp4Duration(r, mdhd); d > 0 {
+				m.Duration = d
+			}
+		}
+		if stsd, ok := mp4Path(r, trak, "mdia", "minf", "stbl", "stsd"); ok {
+			mp4SampleEntry(r, stsd, m)
+		}
+		break
+	}
+	if m.Codec == "" {
+		return nil, fmt.Errorf("%w: MP4 file without an audio track", ErrMalformed)
+	}
+
+	if ilst, ok := mp4Ilst(r, moov); ok {
+		if err := mp4Tags(r, ilst, m); err != nil {
+			return nil, err
+		}
+	}
+
+	m.Bitrate = averageBitrate(mdatSize, m.Duration)
+	return m, nil
+}
+
+// mp4Duration reads timescale and duration from an mvhd or mdhd atom
+func mp4Duration(r io.ReaderAt, atom mp4Atom) float64 {
+	b, err := readAt(r, atom.offset, int(min(atom.size, 32)))
+	if err != nil || len(b) < 24 {
+		return 0
+	}
+	var timescale uint32
+	var duration uint64
+	if b[0] == 1 {
+		// Version 1 uses 64-bit creation and modification times and duration
+		if len(b) < 32 {
+			return 0
+		}
+		timescale = binary.BigEndian.Uint32(b[20:])
+		duration = binary.BigEndian.Uint64(b[24:])
+	} else {
+		timescale = binary.BigEndian.Uint32(b[12:])
+		duration = uint64(binary.BigEndian.Uint32(b[16:]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return float64(duration) / float64(timescale)
+}
+
+// mp4IsSound reports whether a trak carries audio
+func mp4IsSound(r io.ReaderAt, trak mp4Atom) bool {
+	hdlr, ok := mp4Path(r, trak, "mdia", "hdlr")
+	if !ok {
+		return false
+	}
+	b, err := readAt(r, hdlr.offset, int(min(hdlr.size, 12)))
+	return err == nil && len(b) == 12 && string(b[8:12]) == "soun"
+}
+
+// mp4SampleEntry reads channels, sample size and rate from the first audio sample description
+func mp4SampleEntry(r io.ReaderAt, stsd mp4Atom, m *Metadata) {
+	// Full atom header and entry count precede the entries
+	entries, err := mp4Atoms(r, stsd.offset+8, stsd.offset+stsd.size)
+	if err != nil || len(entries) == 0 {
+		return
+	}
+	entry := entries[0]
+	b, err := readAt(r, entry.offset, int(min(entry.size, 28)))
+	if err != nil || len(b) < 28 {
+		return
+	}
+	m.Channels = int(binary.BigEndian.Uint16(b[16:]))
+	m.BitDepth = int(binary.BigEndian.Uint16(b[18:]))
+	m.SampleRate = int(binary.BigEndian.Uint32(b[24:]) >> 16)
+
+	// QuickTime sound description versions 1 and 2 append extra fields
+	extra := int64(0)
+	switch binary.BigEndian.Uint16(b[8:]) {
+	case 1:
+		extra = 16
+	case 2:
+		extra = 36
+	}
+
+	m.Codec = mp4Codecs[entry.kind]
+	if m.Codec == "" {
+		m.Codec = strings.TrimSpace(entry.kind)
+	}
+
+	switch entry.kind {
+	case "alac":
+		// The ALAC magic cookie holds the real bit depth and sample rate
+		cookie := mp4Atom{offset: entry.offset + 28 + extra, size: entry.size - 28 - extra}
+		if alac, ok := mp4Child(r, cookie, "alac"); ok && alac.size >= 28 {
+			if c, err := readAt(r, alac.offset, 28); err == nil {
+				m.BitDepth = int(c[9])
+				m.Channels = int(c[13])
+				m.SampleRate = int(binary.BigEndian.Uint32(c[24:]))
+			}
+		}
+	case "mp4a":
+		m.BitDepth = 0 // Lossy, the sample size field is meaningless
+		entryData := mp4Atom{offset: entry.offset + 28 + extra, size: entry.size - 28 - extra}
+		if esds, ok := mp4Child(r, entryData, "esds"); ok && esds.size > 4 {
+			if b, err := readAt(r, esds.offset+4, int(min(esds.size-4, 1024))); err == nil {
+				m.Profile = aacProfiles[aacObjectType(b)]
+			}
+		}
+	}
+}
+
+// aacProfiles names the MPEG-4 audio object types AAC files use
+var aacProfiles = map[int]string{
+	1:  "Main",
+	2:  "LC",
+	3:  "SSR",
+	4:  "LTP",
+	5:  "HE-AAC",
+	23: "LD",
+	29: "HE-AACv2",
+	39: "ELD",
+	42: "xHE-AAC",
+}
+
+// aacObjectType finds the AudioSpecificConfig in the descriptors of an esds
+// atom and returns its audio object type, or 0
+func aacObjectType(b []byte) int {
+	for len(b) >= 2 {
+		tag := b[0]
+		// The length is 1 to 4 bytes of 7 bits, high bit set on all but the last
+		n, i := 0, 1
+		for ; i < len(b) && i <= 4; i++ {
+			n = n<<7 | int(b[i]&0x7F)
+			if b[i]&0x80 == 0 {
+				break
+			}
+		}
+		i++
+		if i > len(b) {
+			return 0
+		}
+		body := b[i:min(i+n, len(b))]
+		switch tag {
+		case 0x03: // ES_Descriptor: ID, flags and optional fields, then nested descriptors
+			if len(body) < 3 {
+				return 0
+			}
+			skip, flags := 3, body[2]
+			if flags&0x80 != 0 {
+				skip += 2
+			}
+			if flags&0x40 != 0 && skip < len(body) {
+				skip += 1 + int(body[skip])
+			}
+			if flags&0x20 != 0 {
+				skip += 2
+			}
+			if skip > len(body) {
+				return 0
+			}
+			b = body[skip:]
+		case 0x04: // DecoderConfigDescriptor: 13 bytes of stream parameters, then nested descriptors
+			if len(body) < 13 {
+				return 0
+			}
+			b = body[13:]
+		case 0x05: // DecoderSpecificInfo: the AudioSpecificConfig
+			if len(body) < 1 {
+				return 0
+			}
+			aot := int(body[0] >> 3)
+			if aot == 31 && len(body) >= 2 {
+				aot = 32 + int(body[0]&0x07)<<3 | int(body[1]>>5)
+			}
+			return aot
+		default:
+			b = b[min(i+n, len(b)):]
+		}
+	}
+	return 0
+}
+
+// mp4Ilst finds the iTunes metadata list below moov/udta/meta
+func mp4Ilst(r io.ReaderAt, moov mp4Atom) (mp4Atom, bool) {
+	meta, ok := mp4Path(r, moov, "udta", "meta")
+	if !ok {
+		return mp4Atom{}, false
+	}
+	// meta is a full atom in ISO files but not in QuickTime ones
+	if b, err := readAt(r, meta.offset, 8); err == nil && string(b[4:8]) != "hdlr" {
+		meta.offset += 4
+		meta.size -= 4
+	}
+	return mp4Child(r, meta, "ilst")
+}
+
+// mp4Tags reads the items of an ilst atom
+func mp4Tags(r io.ReaderAt, ilst mp4Atom, m *Metadata) error {
+	items, err := mp4Atoms(r, ilst.offset, ilst.offset+ilst.size)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.kind == "covr" {
+			continue // Artwork is not a text tag
+		}
+		children, err := mp4Atoms(r, item.offset, item.offset+item.size)
+		if err != nil {
+			continue
+		}
+
+		var name string
+		for _, child := range children {
+			payload, err := readAt(r, child.offset, int(child.size))
+			if err != nil || len(payload) < 4 {
+				continue
+			}
+			switch child.kind {
+			case "name": // Freeform "----" items carry their key here
+				name = string(payload[4:])
+			case "data":
+				if len(payload) < 8 {
+					continue
+				}
+				mp4Item(item.kind, name, payload[8:], m)
+			}
+		}
+	}
+	return nil
+}
+
+// mp4Item records a single ilst data value
+func mp4Item(kind, name string, value []byte, m *Metadata) {
+	switch kind {
+	case "trkn", "disk":
+		if len(value) < 6 {
+			return
+		}
+		key := "TRACKNUMBER"
+		if kind == "disk" {
+			key = "DISCNUMBER"
+		}
+		num := binary.BigEndian.Uint16(value[2:])
+		total := binary.BigEndian.Uint16(value[4:])
+		if num > 0 {
+			m.add(key, fmt.Sprintf("%d/%d", num, total))
+		}
+	case "gnre":
+		// ID3v1 genre index plus one
+		if len(value) >= 2 {
+			if idx := int(binary.BigEndian.Uint16(value)) - 1; idx >= 0 && idx < len(id3v1Genres) {
+				m.add("GENRE", id3v1Genres[idx])
+			}
+		}
+	case "cpil":
+		if len(value) >= 1 {
+			m.add("COMPILATION", strconv.Itoa(int(value[0])))
+		}
+	case "tmpo":
+		if len(value) >= 2 {
+			m.add("BPM", strconv.Itoa(int(binary.BigEndian.Uint16(value))))
+		}
+	case "----":
+		m.add(name, string(value))
+	default:
+		if key, ok := mp4Items[kind]; ok {
+			m.add(key, string(value))
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mpegSyncWindow bounds how far past the ID3 tag the first frame is searched for
+const mpegSyncWindow = 64 << 10
+
+// MPEG audio header lookup tables, indexed by version (1, 2, 2.5) and layer
+var (
+	mpegBitrates = [2][3][16]int{
+		{ // MPEG-1: layer I, II, III
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		},
+		{ // MPEG-2 and 2.5
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		},
+	}
+	mpegSampleRates = map[byte][3]int{
+		3: {44100, 48000, 32000}, // MPEG-1
+		2: {22050, 24000, 16000}, // MPEG-2
+		0: {11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+// mpegFrame is a decoded MPEG audio frame header
+type mpegFrame struct {
+	version    byte // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+	layer      int  // 1, 2 or 3
+	bitrate    int  // bits per second
+	sampleRate int
+	channels   int
+	length     int // bytes, including the header
+}
+
+// parseMPEGHeader decodes a four-byte frame header
+func parseMPEGHeader(b []byte) (mpegFrame, bool) {
+	h := binary.BigEndian.Uint32(b)
+	if h&0xFFE00000 != 0xFFE00000 {
+		return mpegFrame{}, false
+	}
+	f := mpegFrame{version: byte(h>>19) & 0x03, layer: 4 - int(h>>17&0x03)}
+	bitrateIdx := h >> 12 & 0x0F
+	rateIdx := h >> 10 & 0x03
+	if f.version == 1 || f.layer == 4 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return mpegFrame{}, false
+	}
+
+	table := 0
+	if f.version != 3 {
+		table = 1
+	}
+	f.bitrate = mpegBitrates[table][f.layer-1][bitrateIdx] * 1000
+	f.sampleRate = mpegSampleRates[f.version][rateIdx]
+	f.channels = 2
+	if h>>6&0x03 == 3 {
+		f.channels = 1
+	}
+
+	padding := int(h >> 9 & 0x01)
+	switch {
+	case f.layer == 1:
+		f.length = (12*f.bitrate/f.sampleRate + padding) * 4
+	case f.layer == 3 && f.version != 3:
+		f.length = 72*f.bitrate/f.sampleRate + padding
+	default:
+		f.length = 144*f.bitrate/f.sampleRate + padding
+	}
+	return f, true
+}
+
+// samplesPerFrame returns the number of PCM samples a frame decodes to
+func (f mpegFrame) samplesPerFrame() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && f.version != 3:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+// sideInfoSize is the length of the layer III side information following the header
+func (f mpegFrame) sideInfoSize() int {
+	switch {
+	case f.version == 3 && f.channels == 1:
+		return 17
+	case f.version == 3:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// readMPEG parses an MPEG audio stream whose first frame is at or after off.
+// m carries the comments of a preceding ID3v2 tag, which take precedence over ID3v1.
+func readMPEG(r io.ReaderAt, size, off int64, m *Metadata) (*Metadata, error) {
+	window := int64(mpegSyncWindow)
+	if off+window > size {
+		window = size - off
+	}
+	if window < 4 {
+		return nil, fmt.Errorf("%w: no MPEG audio frame found", ErrMalformed)
+	}
+	buf, err := readAt(r, off, int(window))
+	if err != nil {
+		return nil, err
+	}
+
+	pos, frame, ok := findMPEGFrame(buf)
+	if !ok {
+		return nil, fmt.Errorf("%w: no MPEG audio frame found", ErrMalformed)
+	}
+	start := off + int64(pos)
+
+	m.Container = "mpeg"
+	m.Codec = fmt.Sprintf("mp%d", frame.layer)
+	m.SampleRate = frame.sampleRate
+	m.Channels = frame.channels
+	end := size
+	if readID3v1(r, size, m) {
+		end -= 128
+	}
+	audioBytes := end - start
+
+	m.Profile, m.Encoder = mpegEncoding(buf[pos:], frame)
+	if frames := vbrFrameCount(buf[pos:], frame); frames > 0 {
+		m.Duration = float64(frames) * float64(frame.samplesPerFrame()) / float64(frame.sampleRate)
+		m.Bitrate = averageBitrate(audioBytes, m.Duration)
+	} else {
+		// Constant bitrate: the payload size gives the duration
+		m.Bitrate = frame.bitrate
+		m.Duration = float64(audioBytes) * 8 / float64(frame.bitrate)
+	}
+	return m, nil
+}
+
+// findMPEGFrame locates the first frame header that is followed by another valid one
+func findMPEGFrame(buf []byte) (int, mpegFrame, bool) {
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF {
+			continue
+		}
+		f, ok := parseMPEGHeader(buf[i:])
+		if !ok || f.length <= 0 {
+			continue
+		}
+		next := i + f.length
+		if next+4 > len(buf) {
+			return i, f, true // Cannot confirm near the end of the window, trust it
+		}
+		if g, ok := parseMPEGHeader(buf[next:]); ok && g.sampleRate == f.sampleRate {
+			return i, f, true
+		}
+	}
+	return 0, mpegFrame{}, false
+}
+
+// mpegSyncFrames is how many consecutive frames confirm an MPEG stream that
+// does not start at the beginning of the file
+const mpegSyncFrames = 3
+
+// findMPEGStart locates the first frame of an MPEG stream preceded by padding
+// or junk, within mpegSyncWindow of the start. Without a tag to vouch for the
+// stream, mpegSyncFrames consistent frames in a row are required so arbitrary
+// binary data is not taken for MP3.
+func findMPEGStart(r io.ReaderAt, size int64) (int64, bool) {
+	buf, err := readAt(r, 0, int(min(int64(mpegSyncWindow), size)))
+	if err != nil {
+		return 0, false
+	}
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF {
+			continue
+		}
+		first, ok := parseMPEGHeader(buf[i:])
+		if !ok || first.length <= 0 {
+			continue
+		}
+		next, confirmed := i+first.length, 1
+		for ; confirmed < mpegSyncFrames && next+4 <= len(buf); confirmed++ {
+			f, ok := parseMPEGHeader(buf[next:])
+			if !ok || f.length <= 0 || f.version != first.version || f.layer != first.layer || f.sampleRate != first.sampleRate {
+				break
+			}
+			next += f.length
+		}
+		if confirmed == mpegSyncFrames {
+			return int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// vbrFrameCount reads the frame count from a Xing/Info or VBRI header in the first frame
+func vbrFrameCount(frame []byte, f mpegFrame) int {
+	xing := 4 + f.sideInfoSize()
+	if xing+12 <= len(frame) {
+		tag := frame[xing : xing+4]
+		if bytes.Equal(tag, []byte("Xing")) || bytes.Equal(tag, []byte("Info")) {
+			flags := binary.BigEndian.Uint32(frame[xing+4:])
+			if flags&0x01 != 0 {
+				return int(binary.BigEndian.Uint32(frame[xing+8:]))
+			}
+			return 0
+		}
+	}
+
+	const vbri = 4 + 32
+	if vbri+18 <= len(frame) && bytes.Equal(frame[vbri:vbri+4], []byte("VBRI")) {
+		return int(binary.BigEndian.Uint32(frame[vbri+14:]))
+	}
+	return 0
+}
+
+// lameVBRMethods maps the VBR method of a LAME tag to the bitrate mode
+var lameVBRMethods = map[byte]string{
+	1: "CBR", 2: "ABR", 3: "VBR", 4: "VBR", 5: "VBR", 6: "VBR", 8: "CBR", 9: "ABR",
+}
+
+// mpegEncoding reads the bitrate mode and the encoder from the Xing/Info, LAME
+// or VBRI header in the first frame. Info headers mark constant bitrate files;
+// files without any header are taken as constant bitrate too.
+func mpegEncoding(frame []byte, f mpegFrame) (profile, encoder string) {
+	xing := 4 + f.sideInfoSize()
+	if xing+8 <= len(frame) {
+		tag := string(frame[xing : xing+4])
+		if tag == "Xing" || tag == "Info" {
+			profile = "VBR"
+			if tag == "Info" {
+				profile = "CBR"
+			}
+			// Frame count, byte count, TOC and quality precede the LAME tag when present
+			flags := binary.BigEndian.Uint32(frame[xing+4:])
+			lame := xing + 8
+			for bit, size := range []int{4, 4, 100, 4} {
+				if flags&(1<<bit) != 0 {
+					lame += size
+				}
+			}
+			if lame+10 <= len(frame) && (bytes.HasPrefix(frame[lame:], []byte("LAME")) || bytes.HasPrefix(frame[lame:], []byte("Lavc"))) {
+				encoder = strings.TrimRight(string(frame[lame:lame+9]), " \x00")
+				if mode, ok := lameVBRMethods[frame[lame+9]&0x0F]; ok {
+					profile = mode
+				}
+			}
+			return profile, clean(encoder)
+		}
+	}
+
+	const vbri = 4 + 32
+	if vbri+4 <= len(frame) && bytes.Equal(frame[vbri:vbri+4], []byte("VBRI")) {
+		return "VBR", ""
+	}
+	return "CBR", ""
+}
@@ -0,0 +1,174 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	oggHeaderSize = 27
+	// oggTailWindow is how much of the end of the file is searched for the last page
+	oggTailWindow = 64 << 10
+	// opusRate is the fixed granule rate of Opus streams
+	opusRate = 48000
+)
+
+// oggPage is a parsed Ogg page header
+type oggPage struct {
+	granule  int64
+	serial   uint32
+	segments []byte
+	size     int64 // Header plus segment table
+}
+
+func readOggPage(r io.ReaderAt, off int64) (oggPage, error) {
+	header, err := readAt(r, off, oggHeaderSize)
+	if err != nil {
+		return oggPage{}, err
+	}
+	if string(header[:4]) != "OggS" {
+		return oggPage{}, fmt.Errorf("%w: lost Ogg page sync", ErrMalformed)
+	}
+	segments, err := readAt(r, off+oggHeaderSize, int(header[26]))
+	if err != nil {
+		return oggPage{}, err
+	}
+	return oggPage{
+		granule:  int64(binary.LittleEndian.Uint64(header[6:])),
+		serial:   binary.LittleEndian.Uint32(header[14:]),
+		segments: segments,
+		size:     oggHeaderSize + int64(len(segments)),
+	}, nil
+}
+
+// oggPackets reassembles the first n packets of the first logical stream
+func oggPackets(r io.ReaderAt, size int64, n int) ([][]byte, uint32, error) {
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+
+	for pos := int64(0); pos < size && len(packets) < n; {
+		page, err := readOggPage(r, pos)
+		if err != nil {
+			return nil, 0, err
+		}
+		if pos == 0 {
+			serial = page.serial
+		}
+		body := pos + page.size
+		pos = body
+		for _, seg := range page.segments {
+			pos += int64(seg)
+		}
+		if page.serial != serial {
+			continue // Another multiplexed stream
+		}
+
+		for _, seg := range page.segments {
+			if len(current)+int(seg) > maxChunkSize {
+				return nil, 0, fmt.Errorf("%w: oversized Ogg header packet", ErrMalformed)
+			}
+			data, err := readAt(r, body, int(seg))
+			if err != nil {
+				return nil, 0, err
+			}
+			body += int64(seg)
+			current = append(current, data...)
+			if seg < 255 {
+				packets = append(packets, current)
+				current = nil
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+	}
+	if len(packets) < n {
+		return nil, 0, fmt.Errorf("%w: missing Ogg header packets", ErrMalformed)
+	}
+	return packets, serial, nil
+}
+
+// oggLastGranule returns the granule position of the last page of a stream
+func oggLastGranule(r io.ReaderAt, size int64, serial uint32) int64 {
+	start := max(size-oggTailWindow, 0)
+	tail, err := readAt(r, start, int(size-start))
+	if err != nil {
+		return 0
+	}
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if i+oggHeaderSize > len(tail) {
+			continue
+		}
+		granule := int64(binary.LittleEndian.Uint64(tail[i+6:]))
+		if binary.LittleEndian.Uint32(tail[i+14:]) == serial && granule > 0 {
+			return granule
+		}
+	}
+	return 0
+}
+
+// readOgg parses an Ogg Vorbis, Opus or FLAC stream
+func readOgg(r io.ReaderAt, size int64) (*Metadata, error) {
+	packets, serial, err := oggPackets(r, size, 2)
+	if err != nil {
+		return nil, err
+	}
+	id, comments := packets[0], packets[1]
+
+	m := &Metadata{}
+	var rate int64
+	var preSkip int64
+	switch {
+	case bytes.HasPrefix(id, []byte("\x01vorbis")) && len(id) >= 30:
+		m.Container, m.Codec = "ogg", "vorbis"
+		m.Channels = int(id[11])
+		m.SampleRate = int(binary.LittleEndian.Uint32(id[12:]))
+		rate = int64(m.SampleRate)
+		if !bytes.HasPrefix(comments, []byte("\x03vorbis")) {
+			return nil, fmt.Errorf("%w: missing Vorbis comment header", ErrMalformed)
+		}
+		comments = comments[7:]
+	case bytes.HasPrefix(id, []byte("OpusHead")) && len(id) >= 19:
+		m.Container, m.Codec = "ogg", "opus"
+		m.Channels = int(id[9])
+		preSkip = int64(binary.LittleEndian.Uint16(id[10:]))
+		m.SampleRate = int(binary.LittleEndian.Uint32(id[12:])) // Rate of the original input
+		if m.SampleRate == 0 {
+			m.SampleRate = opusRate
+		}
+		rate = opusRate
+		if !bytes.HasPrefix(comments, []byte("OpusTags")) {
+			return nil, fmt.Errorf("%w: missing OpusTags header", ErrMalformed)
+		}
+		comments = comments[8:]
+	case bytes.HasPrefix(id, []byte("\x7fFLAC")) && len(id) >= 13+34:
+		// Mapping header, "fLaC" and the STREAMINFO block; comments follow as a FLAC metadata block
+		m.Container, m.Codec = "ogg", "flac"
+		if _, err := parseStreamInfo(m, id[17:]); err != nil {
+			return nil, err
+		}
+		rate = int64(m.SampleRate)
+		if len(comments) < 4 || comments[0]&0x7F != flacVorbisComment {
+			comments = nil
+		} else {
+			comments = comments[4:]
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported Ogg codec", ErrUnsupported)
+	}
+
+	if comments != nil {
+		if err := parseVorbisComments(m, comments); err != nil {
+			return nil, err
+		}
+	}
+
+	if granule := oggLastGranule(r, size, serial) - preSkip; granule > 0 && rate > 0 {
+		m.Duration = float64(granule) / float64(rate)
+	}
+	m.Bitrate = averageBitrate(size, m.Duration)
+	return m, nil
+}
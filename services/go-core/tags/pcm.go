@@ -0,0 +1,217 @@
+package tags
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// pcmBlock is how many sample frames PCM.Read returns at most for WAV and AIFF
+const pcmBlock = 4096
+
+// PCM decodes the audio of a lossless file. FLAC, WAV and AIFF holding
+// integer or float PCM are supported; other files return ErrUnsupported.
+type PCM struct {
+	SampleRate int
+	Channels   int
+	Frames     int64 // Sample frames per channel, 0 when unknown
+	read       func() ([][]float32, error)
+	file       *os.File
+}
+
+// OpenPCM opens the audio file at path for decoding
+func OpenPCM(path string) (*PCM, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	p, err := openPCM(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	p.file = f
+	return p, nil
+}
+
+func openPCM(r io.ReaderAt, size int64) (*PCM, error) {
+	m, err := Read(r, size)
+	if err != nil {
+		return nil, err
+	}
+	off := int64(0)
+	if head, err := readAt(r, 0, 3); err == nil && string(head) == "ID3" {
+		if off, err = readID3v2(r, 0, &Metadata{}); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &PCM{SampleRate: m.SampleRate, Channels: m.Channels}
+	switch {
+	case m.Container == "flac":
+		err = p.openFLAC(r, size, off, m)
+	case m.Container == "wav" && (m.Codec == "pcm" || m.Codec == "pcm_float"):
+		err = p.openIFF(r, size, binary.LittleEndian, "data", m)
+	case m.Container == "aiff" && (m.Codec == "pcm" || m.Codec == "pcm_float"):
+		err = p.openIFF(r, size, binary.BigEndian, "SSND", m)
+	default:
+		return nil, fmt.Errorf("%w: cannot decode %s audio", ErrUnsupported, m.Codec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.SampleRate <= 0 || p.Channels <= 0 {
+		return nil, fmt.Errorf("%w: invalid stream parameters", ErrMalformed)
+	}
+	return p, nil
+}
+
+// Read returns the next block of samples, one slice per channel, scaled to
+// [-1, 1). The slices are reused by the next call. It returns io.EOF at the
+// end of the audio and wraps ErrMalformed when the audio is damaged.
+func (p *PCM) Read() ([][]float32, error) {
+	return p.read()
+}
+
+// Close releases the underlying file
+func (p *PCM) Close() error {
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
+
+func (p *PCM) openFLAC(r io.ReaderAt, size, off int64, m *Metadata) error {
+	info, pos, err := flacAudio(r, size, off)
+	if err != nil {
+		return err
+	}
+	d := &flacDecoder{
+		br:         bitReader{r: bufio.NewReaderSize(io.NewSectionReader(r, pos, size-pos), 64<<10)},
+		bps:        m.BitDepth,
+		fixedBlock: int64(binary.BigEndian.Uint16(info[2:])),
+	}
+	p.Frames = int64(info[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(info[14:]))
+	out := make([][]float32, m.Channels)
+	p.read = func() ([][]float32, error) {
+		start := d.br.pos
+		frame, err := d.frame()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			if trailer, terr := readAt(r, pos+start, 3); terr == nil && string(trailer) == "TAG" && pos+start+128 == size {
+				return nil, io.EOF // ID3v1 tag appended by some taggers
+			}
+			if errors.Is(err, errFLACFrame) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("%w: %v at byte %d", ErrMalformed, err, pos+start)
+			}
+			return nil, err
+		}
+		if frame.channels != m.Channels {
+			return nil, fmt.Errorf("%w: frame at byte %d has %d channels", ErrMalformed, pos+start, frame.channels)
+		}
+		scale := 1 / float32(int64(1)<<(frame.bps-1))
+		for ch := range out {
+			out[ch] = out[ch][:0]
+			for _, s := range d.channels[ch][:frame.block] {
+				out[ch] = append(out[ch], float32(s)*scale)
+			}
+		}
+		return out, nil
+	}
+	return nil
+}
+
+// openIFF reads the sample data chunk of a WAV or AIFF file
+func (p *PCM) openIFF(r io.ReaderAt, size int64, order binary.ByteOrder, dataID string, m *Metadata) error {
+	chunks, err := iffChunks(r, 12, size, order)
+	if err != nil {
+		return err
+	}
+	var data *iffChunk
+	for i, c := range chunks {
+		switch c.id {
+		case dataID:
+			data = &chunks[i]
+		case "COMM":
+			// AIFF-C "sowt" stores little-endian samples
+			if kind, err := readAt(r, c.offset+18, 4); err == nil && c.size >= 22 && string(kind) == "sowt" {
+				order = binary.LittleEndian
+			}
+		}
+	}
+	if data == nil {
+		return fmt.Errorf("%w: no %s chunk", ErrMalformed, dataID)
+	}
+	start, length := data.offset, data.size
+	if dataID == "SSND" {
+		header, err := readAt(r, start, 8)
+		if err != nil {
+			return err
+		}
+		skip := int64(8 + order.Uint32(header))
+		start, length = start+skip, length-skip
+	}
+
+	width := (m.BitDepth + 7) / 8
+	float := m.Codec == "pcm_float"
+	if width == 0 || width > 8 || float && width != 4 && width != 8 {
+		return fmt.Errorf("%w: cannot decode %d-bit samples", ErrUnsupported, m.BitDepth)
+	}
+	frameSize := width * m.Channels
+	p.Frames = max(length, 0) / int64(frameSize)
+	br := bufio.NewReaderSize(io.NewSectionReader(r, start, max(length, 0)), 64<<10)
+	buf := make([]byte, pcmBlock*frameSize)
+	out := make([][]float32, m.Channels)
+	scale := 1 / float32(int64(1)<<(8*width-1))
+	p.read = func() ([][]float32, error) {
+		n, err := io.ReadFull(br, buf)
+		if n < frameSize {
+			if err == nil || err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return nil, err
+		}
+		frames := n / frameSize
+		for ch := range out {
+			out[ch] = out[ch][:0]
+		}
+		for i := 0; i < frames; i++ {
+			for ch := range out {
+				b := buf[(i*m.Channels+ch)*width:][:width]
+				var v float32
+				switch {
+				case float && width == 4:
+					v = math.Float32frombits(order.Uint32(b))
+				case float:
+					v = float32(math.Float64frombits(order.Uint64(b)))
+				case width == 1 && dataID == "data":
+					v = float32(int(b[0])-128) / 128 // 8-bit WAV is unsigned
+				default:
+					var u uint64
+					for k := 0; k < width; k++ {
+						if order == binary.LittleEndian {
+							u |= uint64(b[k]) << (8 * k)
+						} else {
+							u = u<<8 | uint64(b[k])
+						}
+					}
+					v = float32(int64(u<<(64-8*width))>>(64-8*width)) * scale
+				}
+				out[ch] = append(out[ch], v)
+			}
+		}
+		return out, nil
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package tags
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestOpenPCM(t *testing.T) {
+	decode := func(data []byte) (*PCM, [][]float32) {
+		p, err := openPCM(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		all := make([][]float32, p.Channels)
+		for {
+			block, err := p.Read()
+			if err == io.EOF {
+				return p, all
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ch := range block {
+				all[ch] = append(all[ch], block[ch]...)
+			}
+		}
+	}
+
+	p, samples := decode(buildVerifiableFLAC())
+	if p.SampleRate != 44100 || len(samples) != 2 || len(samples[0]) != 8192 {
+		t.Fatalf("flac: %d Hz, %d channels", p.SampleRate, len(samples))
+	}
+	for _, i := range []int{0, 100, 5000} {
+		want := float32(int64(3000*math.Sin(float64(i)/20))) / 32768
+		if samples[0][i] != want {
+			t.Errorf("flac sample %d = %v, want %v", i, samples[0][i], want)
+		}
+	}
+	if samples[1][8000] != -7.0/32768 {
+		t.Errorf("flac right channel = %v", samples[1][8000])
+	}
+
+	p, samples = decode(buildWAV())
+	if p.SampleRate != 48000 || len(samples[1]) != 48000 {
+		t.Errorf("wav: %d Hz, %d samples", p.SampleRate, len(samples[1]))
+	}
+
+	mp3 := buildMP3()
+	if _, err := openPCM(bytes.NewReader(mp3), int64(len(mp3))); err == nil {
+		t.Error("mp3 decoded")
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	const frames = 10000
+	block := make([][]float32, 2)
+	for i := 0; i < frames; i++ {
+		block[0] = append(block[0], float32(int(8000*math.Sin(float64(i)/15)))/32768)
+		block[1] = append(block[1], 0.25)
+	}
+	block[1][9000] = 1.5 // Clipped
+
+	for format := range EncoderTypes {
+		var b bytes.Buffer
+		enc, err := NewEncoder(&b, format, 44100, 2, frames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Blocks that do not line up with FLAC frames
+		for i := 0; i < frames; i += 3000 {
+			end := min(i+3000, frames)
+			if err := enc.Write([][]float32{block[0][i:end], block[1][i:end]}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if format == "wav" && int64(b.Len()) != WAVSize(2, frames) {
+			t.Errorf("wav: %d bytes, want %d", b.Len(), WAVSize(2, frames))
+		}
+
+		p, err := openPCM(bytes.NewReader(b.Bytes()), int64(b.Len()))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if p.SampleRate != 44100 || p.Channels != 2 || p.Frames != frames {
+			t.Errorf("%s: %d Hz, %d channels, %d frames", format, p.SampleRate, p.Channels, p.Frames)
+		}
+		var got [2][]float32
+		for {
+			decoded, err := p.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			got[0] = append(got[0], decoded[0]...)
+			got[1] = append(got[1], decoded[1]...)
+		}
+		if len(got[0]) != frames {
+			t.Fatalf("%s: decoded %d frames", format, len(got[0]))
+		}
+		for i := 0; i < frames; i++ {
+			want := block[1][i]
+			if i == 9000 {
+				want = 32767.0 / 32768
+			}
+			if got[0][i] != block[0][i] || got[1][i] != want {
+				t.Fatalf("%s: frame %d = %v %v", format, i, got[0][i], got[1][i])
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PictureFrontCover is the picture type of a front cover in FLAC PICTURE
+// blocks and ID3 APIC frames; 0 is "other" and most taggers use one or the other
+const PictureFrontCover = 3
+
+// flacPicture is the FLAC metadata block type of embedded pictures
+const flacPicture = 6
+
+// Picture is an image embedded in an audio file
+type Picture struct {
+	Type        int // ID3/FLAC picture type, see PictureFrontCover
+	MIME        string
+	Description string
+	Data        []byte
+}
+
+// ReadPictures returns the images embedded in the audio file at path
+func ReadPictures(path string) ([]Picture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return readPictures(f, info.Size())
+}
+
+// readPictures finds FLAC PICTURE blocks, ID3v2 APIC frames (MP3, WAV, AIFF),
+// MP4 covr items and the METADATA_BLOCK_PICTURE comments of Ogg streams
+func readPictures(r io.ReaderAt, size int64) ([]Picture, error) {
+	head := make([]byte, 12)
+	n, err := r.ReadAt(head, 0)
+	if n < len(head) {
+		if err == nil || err == io.EOF {
+			err = ErrUnsupported
+		}
+		return nil, err
+	}
+
+	switch {
+	case string(head[:4]) == "fLaC":
+		return flacPictures(r, size, 0)
+	case string(head[:3]) == "ID3":
+		pics, end, err := id3Pictures(r, 0)
+		if err != nil {
+			return nil, err
+		}
+		if magic, err := readAt(r, end, 4); err == nil && string(magic) == "fLaC" {
+			more, err := flacPictures(r, size, end)
+			return append(pics, more...), err
+		}
+		return pics, nil
+	case string(head[:4]) == "OggS":
+		return oggPictures(r, size)
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return iffPictures(r, size, binary.LittleEndian)
+	case string(head[:4]) == "FORM" && (string(head[8:12]) == "AIFF" || string(head[8:12]) == "AIFC"):
+		return iffPictures(r, size, binary.BigEndian)
+	case string(head[4:8]) == "ftyp":
+		return mp4Pictures(r, size)
+	case head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		return nil, nil // Bare MPEG stream, nowhere to embed a picture
+	}
+	return nil, ErrUnsupported
+}
+
+// flacPictures reads the PICTURE blocks of a FLAC stream starting at off
+func flacPictures(r io.ReaderAt, size, off int64) ([]Picture, error) {
+	var pics []Picture
+	for pos := off + 4; pos < size; {
+		header, err := readAt(r, pos, 4)
+		if err != nil {
+			return nil, err
+		}
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4
+		if header[0]&0x7F == flacPicture && length <= maxChunkSize {
+			block, err := readAt(r, pos, int(length))
+			if err != nil {
+				return nil, err
+			}
+			if p, ok := parseFLACPicture(block); ok {
+				pics = append(pics, p)
+			}
+		}
+		pos += length
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+	return pics, nil
+}
+
+// parseFLACPicture decodes a PICTURE block, also found base64 encoded in Ogg comments
+func parseFLACPicture(b []byte) (Picture, bool) {
+	var p Picture
+	field := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := int(binary.BigEndian.Uint32(b))
+		if n < 0 || 4+n > len(b) {
+			return nil, false
+		}
+		v := b[4 : 4+n]
+		b = b[4+n:]
+		return v, true
+	}
+	if len(b) < 4 {
+		return p, false
+	}
+	p.Type = int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	mime, ok := field()
+	if !ok {
+		return p, false
+	}
+	desc, ok := field()
+	if !ok || len(b) < 16 {
+		return p, false
+	}
+	b = b[16:] // Width, height, colour depth and palette size, often left at zero
+	data, ok := field()
+	if !ok || len(data) == 0 {
+		return p, false
+	}
+	p.MIME, p.Description, p.Data = strings.ToLower(string(mime)), clean(string(desc)), data
+	return p, true
+}
+
+// id3Pictures reads the APIC (PIC in ID3v2.2) frames of the ID3v2 tag at off
+// and returns the offset just past the tag
+func id3Pictures(r io.ReaderAt, off int64) ([]Picture, int64, error) {
+	header, err := readAt(r, off, 10)
+	if err != nil {
+		return nil, 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, 0, fmt.Errorf("%w: missing ID3 header", ErrMalformed)
+	}
+	version, flags := header[3], header[5]
+	size := int64(syncsafe(header[6:10]))
+	end := off + 10 + size
+	if flags&0x10 != 0 {
+		end += 10
+	}
+	if size > maxChunkSize {
+		return nil, end, nil
+	}
+	body, err := readAt(r, off+10, int(size))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var pics []Picture
+	err = eachID3Frame(body, version, flags, func(id string, data []byte) {
+		if p, ok := parseID3Picture(id, data); ok {
+			pics = append(pics, p)
+		}
+	})
+	return pics, end, err
+}
+
+// parseID3Picture decodes an APIC frame, or a PIC frame with its three-letter image format
+func parseID3Picture(id string, data []byte) (Picture, bool) {
+	var p Picture
+	if (id != "APIC" && id != "PIC") || len(data) < 2 {
+		return p, false
+	}
+	encoding := data[0]
+	data = data[1:]
+	if id == "PIC" {
+		if len(data) < 4 {
+			return p, false
+		}
+		switch strings.ToUpper(string(data[:3])) {
+		case "JPG":
+			p.MIME = "image/jpeg"
+		case "PNG":
+			p.MIME = "image/png"
+		}
+		data = data[3:]
+	} else {
+		i := bytes.IndexByte(data, 0)
+		if i < 0 {
+			return p, false
+		}
+		p.MIME = strings.ToLower(string(data[:i]))
+		data = data[i+1:]
+	}
+	if len(data) < 1 {
+		return p, false
+	}
+	p.Type = int(data[0])
+	data = data[1:]
+
+	// The description ends with a NUL, two in the UTF-16 encodings
+	terminator := []byte{0}
+	step := 1
+	if encoding == 1 || encoding == 2 {
+		terminator, step = []byte{0, 0}, 2
+	}
+	i := 0
+	for ; i+len(terminator) <= len(data); i += step {
+		if bytes.Equal(data[i:i+len(terminator)], terminator) {
+			break
+		}
+	}
+	if i+len(terminator) > len(data) {
+		return p, false
+	}
+	p.Description = decodeID3Text(encoding, data[:i])[0]
+	p.Data = data[i+len(terminator):]
+	return p, len(p.Data) > 0
+}
+
+// oggPictures reads the METADATA_BLOCK_PICTURE comments of a Vorbis or Opus stream
+func oggPictures(r io.ReaderAt, size int64) ([]Picture, error) {
+	packets, _, err := oggPackets(r, size, 2)
+	if err != nil {
+		return nil, err
+	}
+	comments := packets[1]
+	switch {
+	case bytes.HasPrefix(comments, []byte("\x03vorbis")):
+		comments = comments[7:]
+	case bytes.HasPrefix(comments, []byte("OpusTags")):
+		comments = comments[8:]
+	default:
+		return nil, nil
+	}
+
+	var pics []Picture
+	err = eachVorbisComment(comments, func(key, value string) {
+		if !strings.EqualFold(key, "METADATA_BLOCK_PICTURE") {
+			return
+		}
+		block, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return
+		}
+		if p, ok := parseFLACPicture(block); ok {
+			pics = append(pics, p)
+		}
+	})
+	return pics, err
+}
+
+// iffPictures reads the ID3 chunk of a WAV or AIFF file
+func iffPictures(r io.ReaderAt, size int64, order binary.ByteOrder) ([]Picture, error) {
+	chunks, err := iffChunks(r, 12, size, order)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range chunks {
+		if strings.EqualFold(c.id, "id3 ") {
+			pics, _, err := id3Pictures(r, c.offset)
+			return pics, err
+		}
+	}
+	return nil, nil
+}
+
+// mp4Pictures reads the covr item of an MP4 file; each of its data atoms is an image
+func mp4Pictures(r io.ReaderAt, size int64) ([]Picture, error) {
+	top, err := mp4Atoms(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+	var pics []Picture
+	for _, moov := range top {
+		if moov.kind != "moov" {
+			continue
+		}
+		ilst, ok := mp4Ilst(r, moov)
+		if !ok {
+			return nil, nil
+		}
+		covr, ok := mp4Child(r, ilst, "covr")
+		if !ok {
+			return nil, nil
+		}
+		atoms, err := mp4Atoms(r, covr.offset, covr.offset+covr.size)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range atoms {
+			if a.kind != "data" || a.size <= 8 {
+				continue
+			}
+			payload, err := readAt(r, a.offset, int(a.size))
+			if err != nil {
+				return nil, err
+			}
+			// iTunes has a single cover slot, so every image counts as the front cover
+			p := Picture{Type: PictureFrontCover, Data: payload[8:]}
+			switch binary.BigEndian.Uint32(payload) & 0xFFFFFF {
+			case 13:
+				p.MIME = "image/jpeg"
+			case 14:
+				p.MIME = "image/png"
+			case 27:
+				p.MIME = "image/bmp"
+			}
+			pics = append(pics, p)
+		}
+		break
+	}
+	return pics, nil
+}
@@ -0,0 +1,88 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func flacPictureBlock(kind uint32, mime, desc string, data []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, kind)
+	binary.Write(&b, binary.BigEndian, uint32(len(mime)))
+	b.WriteString(mime)
+	binary.Write(&b, binary.BigEndian, uint32(len(desc)))
+	b.WriteString(desc)
+	binary.Write(&b, binary.BigEndian, []uint32{600, 600, 24, 0})
+	binary.Write(&b, binary.BigEndian, uint32(len(data)))
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestReadPictures(t *testing.T) {
+	image := []byte("\xff\xd8\xff\xe0 not really a JPEG")
+
+	// FLAC: STREAMINFO, then a back cover and a front cover
+	var flac bytes.Buffer
+	flac.WriteString("fLaC")
+	flac.Write([]byte{flacStreamInfo, 0, 0, 34})
+	flac.Write(make([]byte, 34))
+	for i, kind := range []uint32{4, PictureFrontCover} {
+		block := flacPictureBlock(kind, "image/JPEG", "Cover", image)
+		header := byte(flacPicture)
+		if i == 1 {
+			header |= 0x80
+		}
+		flac.Write([]byte{header, 0, byte(len(block) >> 8), byte(len(block))})
+		flac.Write(block)
+	}
+
+	// MP3: an ID3v2.3 APIC frame with a UTF-16 description
+	var apic bytes.Buffer
+	apic.WriteByte(1)
+	apic.WriteString("image/png\x00")
+	apic.WriteByte(PictureFrontCover)
+	apic.Write([]byte{0xFF, 0xFE, 'F', 0, 'r', 0, 0, 0})
+	apic.Write(image)
+	frame := append([]byte("APIC"), 0, 0, 0, byte(apic.Len()), 0, 0)
+	frame = append(frame, apic.Bytes()...)
+	mp3 := append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, byte(len(frame) >> 7), byte(len(frame) & 0x7F)}, frame...)
+	mp3 = append(mp3, 0xFF, 0xFB, 0x90, 0x40)
+
+	// ID3v2.2 PIC frame with a three-letter format
+	pic := append([]byte{0, 'J', 'P', 'G', 0, 0}, image...)
+	frame22 := append([]byte("PIC"), 0, 0, byte(len(pic)))
+	frame22 = append(frame22, pic...)
+	mp322 := append([]byte{'I', 'D', '3', 2, 0, 0, 0, 0, 0, byte(len(frame22))}, frame22...)
+	mp322 = append(mp322, 0xFF, 0xFB, 0x90, 0x40, 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want []Picture
+	}{
+		{"flac", flac.Bytes(), []Picture{
+			{Type: 4, MIME: "image/jpeg", Description: "Cover", Data: image},
+			{Type: PictureFrontCover, MIME: "image/jpeg", Description: "Cover", Data: image},
+		}},
+		{"id3v2.3", mp3, []Picture{{Type: PictureFrontCover, MIME: "image/png", Description: "Fr", Data: image}}},
+		{"id3v2.2", mp322, []Picture{{Type: 0, MIME: "image/jpeg", Data: image}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pics, err := readPictures(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("readPictures() error = %v", err)
+			}
+			if len(pics) != len(tt.want) {
+				t.Fatalf("got %d pictures, want %d", len(pics), len(tt.want))
+			}
+			for i, p := range pics {
+				w := tt.want[i]
+				if p.Type != w.Type || p.MIME != w.MIME || p.Description != w.Description || !bytes.Equal(p.Data, w.Data) {
+					t.Errorf("picture %d = {%d %q %q %q}, want {%d %q %q %q}", i, p.Type, p.MIME, p.Description, p.Data, w.Type, w.MIME, w.Description, w.Data)
+				}
+			}
+		})
+	}
+}
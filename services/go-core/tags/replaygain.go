@@ -0,0 +1,79 @@
+package tags
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// replayGainReference is the loudness, in LUFS, ReplayGain 2.0 gains normalize to
+	replayGainReference = -18.0
+	// r128Reference is the loudness R128_*_GAIN tags of Opus files normalize to
+	r128Reference = -23.0
+)
+
+// ReplayGain holds loudness normalization values as ReplayGain 2.0 defines
+// them: gains in dB that bring the audio to -18 LUFS, peaks as linear sample
+// amplitudes. Fields are nil when unknown.
+type ReplayGain struct {
+	TrackGain *float64
+	TrackPeak *float64
+	AlbumGain *float64
+	AlbumPeak *float64
+}
+
+// HasTrack reports whether the track gain is known
+func (rg ReplayGain) HasTrack() bool {
+	return rg.TrackGain != nil
+}
+
+// ReplayGain returns the normalization values of the file's REPLAYGAIN_* tags
+// (Vorbis comments, ID3 TXXX frames, MP4 freeform atoms) or, for Opus, its
+// R128_*_GAIN tags converted to the ReplayGain reference
+func (m *Metadata) ReplayGain() ReplayGain {
+	rg := ReplayGain{
+		TrackGain: parseGain(m.Get("REPLAYGAIN_TRACK_GAIN")),
+		TrackPeak: parsePeak(m.Get("REPLAYGAIN_TRACK_PEAK")),
+		AlbumGain: parseGain(m.Get("REPLAYGAIN_ALBUM_GAIN")),
+		AlbumPeak: parsePeak(m.Get("REPLAYGAIN_ALBUM_PEAK")),
+	}
+	if g := parseR128(m.Get("R128_TRACK_GAIN")); g != nil {
+		rg.TrackGain = g
+	}
+	if g := parseR128(m.Get("R128_ALBUM_GAIN")); g != nil {
+		rg.AlbumGain = g
+	}
+	return rg
+}
+
+// parseGain reads a gain such as "-6.48 dB"
+func parseGain(s string) *float64 {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && strings.EqualFold(s[len(s)-2:], "db") {
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+	g, err := strconv.ParseFloat(s, 64)
+	if err != nil || g < -64 || g > 64 {
+		return nil
+	}
+	return &g
+}
+
+// parsePeak reads a linear peak such as "0.988553"
+func parsePeak(s string) *float64 {
+	p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || p < 0 || p > 100 {
+		return nil
+	}
+	return &p
+}
+
+// parseR128 reads an Opus R128 gain, a Q7.8 fixed point number of dB relative to -23 LUFS
+func parseR128(s string) *float64 {
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || v < -32768 || v > 32767 {
+		return nil
+	}
+	g := float64(v)/256 + replayGainReference - r128Reference
+	return &g
+}
@@ -0,0 +1,37 @@
+package tags
+
+import (
+	"math"
+	"testing"
+)
+
+func TestReplayGain(t *testing.T) {
+	m := &Metadata{}
+	m.add("replaygain_track_gain", "-6.48 dB")
+	m.add("REPLAYGAIN_TRACK_PEAK", "0.988553")
+	m.add("REPLAYGAIN_ALBUM_GAIN", "+1.5dB")
+	m.add("REPLAYGAIN_ALBUM_PEAK", "not a peak")
+	rg := m.ReplayGain()
+	if !rg.HasTrack() || *rg.TrackGain != -6.48 || *rg.TrackPeak != 0.988553 || *rg.AlbumGain != 1.5 || rg.AlbumPeak != nil {
+		t.Errorf("ReplayGain tags: %+v", rg)
+	}
+
+	// Opus gains are Q7.8 relative to -23 LUFS
+	m = &Metadata{}
+	m.add("R128_TRACK_GAIN", "-2560")
+	if rg := m.ReplayGain(); rg.TrackGain == nil || math.Abs(*rg.TrackGain-(-5)) > 1e-9 {
+		t.Errorf("R128 track gain: %v", rg.TrackGain)
+	}
+
+	sheet, err := ParseCue([]byte("REM REPLAYGAIN_ALBUM_GAIN -7.89 dB\nREM REPLAYGAIN_ALBUM_PEAK 0.998\n" +
+		"FILE \"a.flac\" WAVE\n  TRACK 01 AUDIO\n    REM REPLAYGAIN_TRACK_GAIN -8.10 dB\n    INDEX 01 00:00:00\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Gain.AlbumGain == nil || *sheet.Gain.AlbumGain != -7.89 || *sheet.Gain.AlbumPeak != 0.998 {
+		t.Errorf("cue album gain: %+v", sheet.Gain)
+	}
+	if g := sheet.Files[0].Tracks[0].Gain.TrackGain; g == nil || *g != -8.10 {
+		t.Errorf("cue track gain: %v", g)
+	}
+}
@@ -0,0 +1,223 @@
+package tags
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// riffInfo maps RIFF INFO list chunks to Vorbis comment names
+var riffInfo = map[string]string{
+	"INAM": "TITLE",
+	"IART": "ARTIST",
+	"IPRD": "ALBUM",
+	"ICRD": "DATE",
+	"IGNR": "GENRE",
+	"ITRK": "TRACKNUMBER",
+	"IPRT": "TRACKNUMBER",
+	"ICMT": "COMMENT",
+	"ISFT": "ENCODER",
+}
+
+// aiffText maps AIFF text chunks to Vorbis comment names
+var aiffText = map[string]string{
+	"NAME": "TITLE",
+	"AUTH": "ARTIST",
+	"ANNO": "COMMENT",
+}
+
+// wavCodecs names the common WAVE format tags
+var wavCodecs = map[uint16]string{
+	0x0001: "pcm",
+	0x0003: "pcm_float",
+	0x0006: "alaw",
+	0x0007: "mulaw",
+	0x0055: "mp3",
+}
+
+// aifcCodecs names the common AIFF-C compression types
+var aifcCodecs = map[string]string{
+	"NONE": "pcm",
+	"sowt": "pcm",
+	"twos": "pcm",
+	"fl32": "pcm_float",
+	"fl64": "pcm_float",
+	"alaw": "alaw",
+	"ulaw": "mulaw",
+}
+
+// iffChunk is a chunk of a RIFF (little-endian) or IFF (big-endian) file
+type iffChunk struct {
+	id     string
+	offset int64
+	size   int64
+}
+
+// iffChunks lists the chunks in [start, end); chunks are padded to even sizes
+func iffChunks(r io.ReaderAt, start, end int64, order binary.ByteOrder) ([]iffChunk, error) {
+	var chunks []iffChunk
+	for pos := start; pos+8 <= end; {
+		header, err := readAt(r, pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		size := int64(order.Uint32(header[4:]))
+		chunks = append(chunks, iffChunk{id: string(header[:4]), offset: pos + 8, size: min(size, end-pos-8)})
+		pos += 8 + size + size&1
+	}
+	return chunks, nil
+}
+
+// readWAV parses a RIFF/WAVE file
+func readWAV(r io.ReaderAt, size int64) (*Metadata, error) {
+	chunks, err := iffChunks(r, 12, size, binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{Container: "wav"}
+	var byteRate, dataSize int64
+	var info []iffChunk
+	for _, c := range chunks {
+		switch c.id {
+		case "fmt ":
+			b, err := readAt(r, c.offset, int(min(c.size, 26)))
+			if err != nil || len(b) < 16 {
+				return nil, fmt.Errorf("%w: short fmt chunk", ErrMalformed)
+			}
+			format := binary.LittleEndian.Uint16(b)
+			if format == 0xFFFE && len(b) >= 26 {
+				// WAVE_FORMAT_EXTENSIBLE: the sub-format GUID starts with the real tag
+				format = binary.LittleEndian.Uint16(b[24:])
+			}
+			m.Codec = wavCodecs[format]
+			if m.Codec == "" {
+				m.Codec = fmt.Sprintf("wav_0x%04x", format)
+			}
+			m.Channels = int(binary.LittleEndian.Uint16(b[2:]))
+			m.SampleRate = int(binary.LittleEndian.Uint32(b[4:]))
+			byteRate = int64(binary.LittleEndian.Uint32(b[8:]))
+			m.BitDepth = int(binary.LittleEndian.Uint16(b[14:]))
+		case "data":
+			dataSize = c.size
+		case "LIST":
+			info = append(info, c)
+		case "id3 ", "ID3 ":
+			if _, err := readID3v2(r, c.offset, m); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if m.SampleRate == 0 {
+		return nil, fmt.Errorf("%w: WAVE file without fmt chunk", ErrMalformed)
+	}
+
+	// INFO only fills what an embedded ID3 tag did not provide
+	for _, c := range info {
+		if err := readRIFFInfo(r, c, m); err != nil {
+			return nil, err
+		}
+	}
+
+	if byteRate > 0 {
+		m.Duration = float64(dataSize) / float64(byteRate)
+		m.Bitrate = int(byteRate * 8)
+	}
+	return m, nil
+}
+
+// readRIFFInfo reads the text chunks of a LIST/INFO chunk
+func readRIFFInfo(r io.ReaderAt, list iffChunk, m *Metadata) error {
+	kind, err := readAt(r, list.offset, 4)
+	if err != nil || string(kind) != "INFO" {
+		return nil
+	}
+	chunks, err := iffChunks(r, list.offset+4, list.offset+list.size, binary.LittleEndian)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		key, ok := riffInfo[c.id]
+		if !ok {
+			continue
+		}
+		b, err := readAt(r, c.offset, int(c.size))
+		if err != nil {
+			return err
+		}
+		m.setDefault(key, string(b))
+	}
+	return nil
+}
+
+// readAIFF parses an AIFF or AIFF-C file
+func readAIFF(r io.ReaderAt, size int64) (*Metadata, error) {
+	chunks, err := iffChunks(r, 12, size, binary.BigEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{Container: "aiff", Codec: "pcm"}
+	var frames int64
+	var text []iffChunk
+	for _, c := range chunks {
+		switch c.id {
+		case "COMM":
+			b, err := readAt(r, c.offset, int(min(c.size, 22)))
+			if err != nil || len(b) < 18 {
+				return nil, fmt.Errorf("%w: short COMM chunk", ErrMalformed)
+			}
+			if len(b) >= 22 {
+				// AIFF-C appends the compression type
+				if codec, ok := aifcCodecs[string(b[18:22])]; ok {
+					m.Codec = codec
+				} else {
+					m.Codec = strings.ToLower(strings.TrimSpace(string(b[18:22])))
+				}
+			}
+			m.Channels = int(binary.BigEndian.Uint16(b))
+			frames = int64(binary.BigEndian.Uint32(b[2:]))
+			m.BitDepth = int(binary.BigEndian.Uint16(b[6:]))
+			m.SampleRate = int(extendedFloat(b[8:18]))
+		case "ID3 ", "id3 ":
+			if _, err := readID3v2(r, c.offset, m); err != nil {
+				return nil, err
+			}
+		default:
+			if _, ok := aiffText[c.id]; ok {
+				text = append(text, c)
+			}
+		}
+	}
+	if m.SampleRate == 0 {
+		return nil, fmt.Errorf("%w: AIFF file without COMM chunk", ErrMalformed)
+	}
+
+	for _, c := range text {
+		b, err := readAt(r, c.offset, int(c.size))
+		if err != nil {
+			return nil, err
+		}
+		m.setDefault(aiffText[c.id], string(b))
+	}
+
+	m.Duration = float64(frames) / float64(m.SampleRate)
+	m.Bitrate = m.SampleRate * m.Channels * m.BitDepth
+	return m, nil
+}
+
+// extendedFloat decodes the 80-bit IEEE 754 extended value used for AIFF sample rates
+func extendedFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b)&0x7FFF) - 16383
+	mantissa := binary.BigEndian.Uint64(b[2:])
+	if mantissa == 0 {
+		return 0
+	}
+	value := math.Ldexp(float64(mantissa), exponent-63)
+	if b[0]&0x80 != 0 {
+		value = -value
+	}
+	return value
+}
@@ -0,0 +1,508 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	// flacSearchSpan is where the bisection for a FLAC frame hands over to a linear scan
+	flacSearchSpan = 64 << 10
+	// flacMaxHeader is the longest possible FLAC frame header
+	flacMaxHeader = 16
+)
+
+// segmentContainers lists the containers OpenSegment can cut without re-encoding
+var segmentContainers = map[string]string{
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"mpeg": "audio/mpeg",
+}
+
+// CanSegment reports whether OpenSegment supports the container
+func CanSegment(container string) bool {
+	_, ok := segmentContainers[container]
+	return ok
+}
+
+// Segment is a playable excerpt of an audio file, such as a cue sheet track.
+// It is a standalone file in the source container and supports seeking, so it
+// can be served with http.ServeContent.
+type Segment struct {
+	io.ReadSeeker
+	ContentType string
+	Start       float64 // Actual bounds in seconds; FLAC and MPEG cuts are aligned to frames
+	End         float64
+	file        *os.File
+}
+
+// Close releases the underlying file
+func (s *Segment) Close() error {
+	return s.file.Close()
+}
+
+// OpenSegment cuts the audio between start and end seconds out of the file at
+// path; end <= 0 means the end of the file. Only FLAC, WAV and MPEG audio can
+// be cut; other containers return ErrUnsupported.
+func OpenSegment(path string, start, end float64) (*Segment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	seg, err := cutSegment(f, info.Size(), start, end)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	seg.file = f
+	return seg, nil
+}
+
+func cutSegment(r io.ReaderAt, size int64, start, end float64) (*Segment, error) {
+	head, err := readAt(r, 0, 12)
+	if err != nil {
+		return nil, err
+	}
+
+	off := int64(0)
+	if string(head[:3]) == "ID3" {
+		if off, err = readID3v2(r, 0, &Metadata{}); err != nil {
+			return nil, err
+		}
+		if head, err = readAt(r, off, 4); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case string(head[:4]) == "fLaC":
+		return flacSegment(r, size, off, start, end)
+	case off == 0 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return wavSegment(r, size, start, end)
+	case head[0] == 0xFF && head[1]&0xE0 == 0xE0, off > 0:
+		return mpegSegment(r, size, off, start, end)
+	}
+	return nil, ErrUnsupported
+}
+
+// sectionReader concatenates a synthesized header with a range of the source file
+func sectionReader(header []byte, r io.ReaderAt, from, to int64) io.ReadSeeker {
+	return &concatReader{parts: []*io.SectionReader{
+		io.NewSectionReader(bytes.NewReader(header), 0, int64(len(header))),
+		io.NewSectionReader(r, from, to-from),
+	}}
+}
+
+// concatReader reads its parts back to back and seeks across them
+type concatReader struct {
+	parts []*io.SectionReader
+	off   int64
+}
+
+func (c *concatReader) size() int64 {
+	var n int64
+	for _, p := range c.parts {
+		n += p.Size()
+	}
+	return n
+}
+
+func (c *concatReader) Read(b []byte) (int, error) {
+	base := int64(0)
+	for _, p := range c.parts {
+		if c.off < base+p.Size() {
+			n, err := p.ReadAt(b[:min(int64(len(b)), base+p.Size()-c.off)], c.off-base)
+			c.off += int64(n)
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		base += p.Size()
+	}
+	return 0, io.EOF
+}
+
+func (c *concatReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += c.off
+	case io.SeekEnd:
+		offset += c.size()
+	}
+	if offset < 0 {
+		return 0, errors.New("tags: negative seek position")
+	}
+	c.off = offset
+	return offset, nil
+}
+
+// wavSegment copies the fmt chunk into a new RIFF header followed by the PCM range; cuts are sample exact
+func wavSegment(r io.ReaderAt, size int64, start, end float64) (*Segment, error) {
+	chunks, err := iffChunks(r, 12, size, binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+	var format []byte
+	var data iffChunk
+	for _, c := range chunks {
+		switch c.id {
+		case "fmt ":
+			if format, err = readAt(r, c.offset, int(c.size)); err != nil {
+				return nil, err
+			}
+		case "data":
+			data = c
+		}
+	}
+	if len(format) < 16 || data.size == 0 {
+		return nil, fmt.Errorf("%w: WAVE file without fmt or data chunk", ErrMalformed)
+	}
+	rate := int64(binary.LittleEndian.Uint32(format[4:]))
+	align := int64(binary.LittleEndian.Uint16(format[12:]))
+	if rate == 0 || align == 0 {
+		return nil, fmt.Errorf("%w: invalid WAVE format", ErrMalformed)
+	}
+
+	frames := data.size / align
+	first := min(int64(math.Round(start*float64(rate))), frames)
+	last := frames
+	if end > 0 {
+		last = min(int64(math.Round(end*float64(rate))), frames)
+	}
+	if last <= first {
+		return nil, fmt.Errorf("%w: segment outside the audio", ErrMalformed)
+	}
+	length := (last - first) * align
+
+	var h bytes.Buffer
+	h.WriteString("RIFF")
+	binary.Write(&h, binary.LittleEndian, uint32(4+8+len(format)+len(format)&1+8+int(length)))
+	h.WriteString("WAVEfmt ")
+	binary.Write(&h, binary.LittleEndian, uint32(len(format)))
+	h.Write(format)
+	if len(format)&1 != 0 {
+		h.WriteByte(0)
+	}
+	h.WriteString("data")
+	binary.Write(&h, binary.LittleEndian, uint32(length))
+
+	return &Segment{
+		ReadSeeker:  sectionReader(h.Bytes(), r, data.offset+first*align, data.offset+last*align),
+		ContentType: segmentContainers["wav"],
+		Start:       float64(first) / float64(rate),
+		End:         float64(last) / float64(rate),
+	}, nil
+}
+
+// flacFrame is the position of a FLAC frame and the samples it holds
+type flacFrame struct {
+	offset int64
+	sample int64
+	block  int64
+}
+
+// flacStream locates frames in a FLAC stream
+type flacStream struct {
+	r          io.ReaderAt
+	size       int64
+	audio      int64 // Offset of the first frame
+	fixedBlock int64 // Block size of fixed-blocksize streams
+	total      int64
+}
+
+// flacSegment copies the frames covering [start, end) behind a STREAMINFO block
+// rewritten for the new length. Cuts are aligned to frame boundaries.
+func flacSegment(r io.ReaderAt, size, off int64, start, end float64) (*Segment, error) {
+	var info []byte
+	pos := off + 4
+	for {
+		header, err := readAt(r, pos, 4)
+		if err != nil {
+			return nil, err
+		}
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if header[0]&0x7F == flacStreamInfo {
+			if info, err = readAt(r, pos+4, int(length)); err != nil {
+				return nil, err
+			}
+		}
+		pos += 4 + length
+		if header[0]&0x80 != 0 || pos >= size {
+			break
+		}
+	}
+
+	m := &Metadata{}
+	total, err := parseStreamInfo(m, info)
+	if err != nil {
+		return nil, err
+	}
+	if len(info) < 34 || m.SampleRate == 0 {
+		return nil, fmt.Errorf("%w: invalid STREAMINFO block", ErrMalformed)
+	}
+	s := &flacStream{r: r, size: size, audio: pos, fixedBlock: int64(binary.BigEndian.Uint16(info[2:])), total: total}
+	rate := float64(m.SampleRate)
+
+	from, err := s.locate(int64(math.Round(start * rate)))
+	if err != nil {
+		return nil, err
+	}
+	to := flacFrame{offset: size, sample: total}
+	if end > 0 {
+		if to, err = s.locate(int64(math.Round(end * rate))); err != nil {
+			return nil, err
+		}
+	}
+	if to.offset <= from.offset || to.sample <= from.sample {
+		return nil, fmt.Errorf("%w: segment outside the audio", ErrMalformed)
+	}
+
+	// A single STREAMINFO block with the new sample count and no MD5
+	block := append([]byte(nil), info[:34]...)
+	samples := uint64(to.sample - from.sample)
+	block[13] = block[13]&0xF0 | byte(samples>>32)&0x0F
+	binary.BigEndian.PutUint32(block[14:], uint32(samples))
+	clear(block[18:34])
+	header := append([]byte{'f', 'L', 'a', 'C', 0x80 | flacStreamInfo, 0, 0, 34}, block...)
+
+	return &Segment{
+		ReadSeeker:  sectionReader(header, r, from.offset, to.offset),
+		ContentType: segmentContainers["flac"],
+		Start:       float64(from.sample) / rate,
+		End:         float64(to.sample) / rate,
+	}, nil
+}
+
+// locate returns the frame holding the given sample by bisecting the file on
+// frame headers, then walking the last few frames
+func (s *flacStream) locate(sample int64) (flacFrame, error) {
+	if s.total > 0 && sample >= s.total {
+		return flacFrame{offset: s.size, sample: s.total}, nil
+	}
+
+	lo, hi := s.audio, s.size
+	for hi-lo > flacSearchSpan {
+		mid := lo + (hi-lo)/2
+		f, ok := s.frameAt(mid, -1)
+		if !ok || f.sample > sample {
+			hi = mid
+		} else {
+			lo = f.offset
+		}
+	}
+
+	cur, ok := s.frameAt(lo, -1)
+	if !ok {
+		return flacFrame{}, fmt.Errorf("%w: no FLAC frame found", ErrMalformed)
+	}
+	for cur.sample+cur.block <= sample {
+		next, ok := s.frameAt(cur.offset+1, cur.sample+cur.block)
+		if !ok {
+			return flacFrame{offset: s.size, sample: cur.sample + cur.block}, nil
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// frameAt finds the first frame header at or after pos. A non-negative want
+// only accepts the frame starting at that sample, which rules out false syncs.
+func (s *flacStream) frameAt(pos, want int64) (flacFrame, bool) {
+	for pos < s.size {
+		n := min(int64(flacSearchSpan), s.size-pos)
+		buf := make([]byte, n)
+		if _, err := s.r.ReadAt(buf, pos); err != nil && err != io.EOF {
+			return flacFrame{}, false
+		}
+		for i := 0; i+1 < len(buf); i++ {
+			if buf[i] != 0xFF || buf[i+1]&0xFE != 0xF8 {
+				continue
+			}
+			if i+flacMaxHeader > len(buf) && pos+int64(len(buf)) < s.size {
+				break // Re-read so the whole header is in the buffer
+			}
+			sample, block, ok := parseFLACFrameHeader(buf[i:], s.fixedBlock)
+			if ok && (want < 0 || sample == want) && (s.total == 0 || sample < s.total) {
+				return flacFrame{offset: pos + int64(i), sample: sample, block: block}, true
+			}
+		}
+		if n <= flacMaxHeader {
+			break
+		}
+		pos += n - flacMaxHeader
+	}
+	return flacFrame{}, false
+}
+
+// parseFLACFrameHeader decodes a frame header and checks its CRC-8, returning
+// the first sample of the frame and its block size
+func parseFLACFrameHeader(b []byte, fixedBlock int64) (int64, int64, bool) {
+	if len(b) < 6 || b[0] != 0xFF || b[1]&0xFE != 0xF8 {
+		return 0, 0, false
+	}
+	variable := b[1]&0x01 != 0
+	blockCode, rateCode := b[2]>>4, b[2]&0x0F
+	if blockCode == 0 || rateCode == 0x0F || b[3]>>4 > 10 || b[3]>>1&0x07 == 3 || b[3]&0x01 != 0 {
+		return 0, 0, false
+	}
+
+	number, pos := flacUTF8(b[4:])
+	if pos == 0 {
+		return 0, 0, false
+	}
+	pos += 4
+
+	var block int64
+	switch {
+	case blockCode == 1:
+		block = 192
+	case blockCode <= 5:
+		block = 576 << (blockCode - 2)
+	case blockCode == 6:
+		if pos >= len(b) {
+			return 0, 0, false
+		}
+		block = int64(b[pos]) + 1
+		pos++
+	case blockCode == 7:
+		if pos+1 >= len(b) {
+			return 0, 0, false
+		}
+		block = int64(binary.BigEndian.Uint16(b[pos:])) + 1
+		pos += 2
+	default:
+		block = 256 << (blockCode - 8)
+	}
+	switch rateCode {
+	case 12:
+		pos++
+	case 13, 14:
+		pos += 2
+	}
+	if pos >= len(b) || crc8(b[:pos]) != b[pos] {
+		return 0, 0, false
+	}
+
+	if !variable {
+		number *= fixedBlock
+	}
+	return number, block, true
+}
+
+// flacUTF8 decodes the UTF-8-like coded frame or sample number and returns its length
+func flacUTF8(b []byte) (int64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 0
+	for n < 8 && b[0]&(0x80>>n) != 0 {
+		n++
+	}
+	switch {
+	case n == 0:
+		return int64(b[0]), 1
+	case n == 1 || n > 7 || len(b) < n:
+		return 0, 0
+	}
+	v := int64(b[0] & (0x7F >> n))
+	for i := 1; i < n; i++ {
+		if b[i]&0xC0 != 0x80 {
+			return 0, 0
+		}
+		v = v<<6 | int64(b[i]&0x3F)
+	}
+	return v, n
+}
+
+// crc8 computes the FLAC frame header checksum (polynomial x^8 + x^2 + x + 1)
+func crc8(b []byte) byte {
+	var crc byte
+	for _, c := range b {
+		crc ^= c
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// mpegSegment copies the MPEG frames covering [start, end). Frames are walked
+// from the start of the stream, so cuts are frame accurate for VBR files too.
+func mpegSegment(r io.ReaderAt, size, off int64, start, end float64) (*Segment, error) {
+	window := min(int64(mpegSyncWindow), size-off)
+	if window < 4 {
+		return nil, fmt.Errorf("%w: no MPEG audio frame found", ErrMalformed)
+	}
+	buf, err := readAt(r, off, int(window))
+	if err != nil {
+		return nil, err
+	}
+	pos, first, ok := findMPEGFrame(buf)
+	if !ok {
+		return nil, fmt.Errorf("%w: no MPEG audio frame found", ErrMalformed)
+	}
+	audio := off + int64(pos)
+	stop := size
+	if tail, err := readAt(r, size-128, 3); err == nil && string(tail) == "TAG" {
+		stop -= 128
+	}
+	if vbrFrameCount(buf[pos:], first) > 0 {
+		audio += int64(first.length) // The Xing/VBRI frame carries no audio
+	}
+
+	rate := float64(first.sampleRate)
+	from, to := int64(-1), stop
+	var fromTime, toTime float64
+	elapsed := 0.0
+	br := bufio.NewReaderSize(io.NewSectionReader(r, audio, stop-audio), 64<<10)
+	for at := audio; at < stop; {
+		header, err := br.Peek(4)
+		if err != nil {
+			break
+		}
+		f, ok := parseMPEGHeader(header)
+		if !ok || f.length <= 0 {
+			br.Discard(1) // Lost sync, e.g. an embedded tag
+			at++
+			continue
+		}
+		if from < 0 && elapsed+float64(f.samplesPerFrame())/rate > start {
+			from, fromTime = at, elapsed
+		}
+		if end > 0 && elapsed >= end {
+			to, toTime = at, elapsed
+			break
+		}
+		elapsed += float64(f.samplesPerFrame()) / rate
+		toTime = elapsed
+		n, _ := br.Discard(f.length)
+		at += int64(n)
+	}
+	if from < 0 || to <= from {
+		return nil, fmt.Errorf("%w: segment outside the audio", ErrMalformed)
+	}
+
+	return &Segment{
+		ReadSeeker:  io.NewSectionReader(r, from, to-from),
+		ContentType: segmentContainers["mpeg"],
+		Start:       fromTime,
+		End:         toTime,
+	}, nil
+}
@@ -0,0 +1,291 @@
+// Package tags reads embedded metadata and stream properties from audio files
+// without external tools. Supported containers are FLAC, MP3 (ID3v1/ID3v2),
+// MP4/M4A, Ogg (Vorbis, Opus, FLAC), WAV and AIFF.
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrUnsupported is returned for files whose container is not recognised
+	ErrUnsupported = errors.New("unsupported audio format")
+	// ErrMalformed is returned when a recognised container cannot be parsed
+	ErrMalformed = errors.New("malformed audio file")
+)
+
+// extensionContainers maps the audio file extensions to the container they must hold.
+// Codecs are not constrained: an .m4a may hold AAC or ALAC, an .ogg Vorbis, Opus or FLAC.
+var extensionContainers = map[string]string{
+	".flac": "flac",
+	".mp3":  "mpeg",
+	".mp2":  "mpeg",
+	".m4a":  "mp4",
+	".m4b":  "mp4",
+	".mp4":  "mp4",
+	".ogg":  "ogg",
+	".oga":  "ogg",
+	".opus": "ogg",
+	".wav":  "wav",
+	".aiff": "aiff",
+	".aif":  "aiff",
+	".aifc": "aiff",
+}
+
+// IsAudioExtension reports whether ext (e.g. ".flac") names an audio file worth probing
+func IsAudioExtension(ext string) bool {
+	_, ok := extensionContainers[strings.ToLower(ext)]
+	return ok
+}
+
+// MatchesExtension reports whether the detected container is the one ext promises
+func (m *Metadata) MatchesExtension(ext string) bool {
+	return extensionContainers[strings.ToLower(ext)] == m.Container
+}
+
+// maxChunkSize caps the size of a single metadata block read into memory.
+// Larger blocks are almost always embedded artwork and are skipped.
+const maxChunkSize = 16 << 20
+
+// Metadata holds the tags and stream properties of an audio file
+type Metadata struct {
+	Container   string   // flac, mpeg, mp4, ogg, wav or aiff, detected from the content
+	Codec       string   // flac, mp3, aac, alac, vorbis, opus, pcm, ...
+	Title       string   // Empty when the file has no title tag
+	Artists     []string // Track artists in tag order
+	AlbumArtist string
+	Album       string
+	TrackNumber int
+	TrackTotal  int
+	DiscNumber  int
+	DiscTotal   int
+	Year        int
+	Genre       string
+
+	Duration   float64 // Seconds
+	SampleRate int     // Hz
+	BitDepth   int     // Bits per sample, 0 for lossy codecs
+	Channels   int
+	Bitrate    int // Average bits per second
+
+	Profile string // Codec profile or mode: CBR, ABR or VBR for MP3; LC, HE-AAC, ... for AAC
+	Encoder string // Software that encoded the file, e.g. LAME3.100 or libFLAC 1.4.3
+
+	// Comments holds every text tag keyed by its Vorbis comment name
+	// (TITLE, ARTIST, REPLAYGAIN_TRACK_GAIN, ...), whatever the container
+	Comments map[string][]string
+}
+
+// losslessCodecs are the codecs that decode to the exact samples they were given
+var losslessCodecs = map[string]bool{
+	"flac":      true,
+	"alac":      true,
+	"pcm":       true,
+	"pcm_float": true,
+}
+
+// IsLossless reports whether codec, as Metadata.Codec names it, is lossless
+func IsLossless(codec string) bool {
+	return losslessCodecs[codec]
+}
+
+// Lossless reports whether the file holds lossless audio
+func (m *Metadata) Lossless() bool {
+	return IsLossless(m.Codec)
+}
+
+// Artist returns the first track artist, or the album artist when there is none
+func (m *Metadata) Artist() string {
+	if len(m.Artists) > 0 {
+		return m.Artists[0]
+	}
+	return m.AlbumArtist
+}
+
+// Get returns the first value of a Vorbis-style comment
+func (m *Metadata) Get(key string) string {
+	if v := m.Comments[strings.ToUpper(key)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// add records a tag value under its normalized Vorbis comment name
+func (m *Metadata) add(key, value string) {
+	value = clean(value)
+	if key == "" || value == "" {
+		return
+	}
+	if m.Comments == nil {
+		m.Comments = make(map[string][]string)
+	}
+	key = strings.ToUpper(strings.TrimSpace(key))
+	m.Comments[key] = append(m.Comments[key], value)
+}
+
+// setDefault records a tag only when the file did not provide it already,
+// so fallback sources (e.g. ID3v1 or RIFF INFO) never override richer ones
+func (m *Metadata) setDefault(key, value string) {
+	if _, ok := m.Comments[key]; !ok {
+		m.add(key, value)
+	}
+}
+
+// finalize fills the typed fields from the collected comments
+func (m *Metadata) finalize() {
+	m.Title = m.Get("TITLE")
+	m.Artists = m.Comments["ARTIST"]
+	m.AlbumArtist = firstOf(m, "ALBUMARTIST", "ALBUM ARTIST", "ALBUM_ARTIST")
+	m.Album = m.Get("ALBUM")
+	m.Genre = m.Get("GENRE")
+
+	m.TrackNumber, m.TrackTotal = parseNumberPair(m.Get("TRACKNUMBER"))
+	if total := firstOf(m, "TRACKTOTAL", "TOTALTRACKS"); total != "" {
+		m.TrackTotal = atoi(total)
+	}
+	m.DiscNumber, m.DiscTotal = parseNumberPair(m.Get("DISCNUMBER"))
+	if total := firstOf(m, "DISCTOTAL", "TOTALDISCS"); total != "" {
+		m.DiscTotal = atoi(total)
+	}
+	m.Year = parseYear(firstOf(m, "DATE", "YEAR", "ORIGINALDATE"))
+	// An encoder tag names the tool that wrote the tags when the stream does not say
+	if m.Encoder == "" {
+		m.Encoder = m.Get("ENCODER")
+	}
+}
+
+// ReadFile parses the audio file at path
+func ReadFile(path string) (*Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, info.Size())
+}
+
+// Read parses an audio file of the given size. The container is detected from
+// its magic bytes, never from its name, or from the first MPEG frames found
+// near the start, and then probed far enough to find the stream parameters;
+// files that cannot be probed return ErrUnsupported or ErrMalformed.
+func Read(r io.ReaderAt, size int64) (*Metadata, error) {
+	head := make([]byte, 12)
+	n, err := r.ReadAt(head, 0)
+	if n < len(head) {
+		if err == nil || err == io.EOF {
+			err = ErrUnsupported
+		}
+		return nil, err
+	}
+
+	var m *Metadata
+	switch {
+	case string(head[:4]) == "fLaC":
+		m, err = readFLAC(r, size, 0)
+	case string(head[:3]) == "ID3":
+		m, err = readID3File(r, size)
+	case string(head[:4]) == "OggS":
+		m, err = readOgg(r, size)
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		m, err = readWAV(r, size)
+	case string(head[:4]) == "FORM" && (string(head[8:12]) == "AIFF" || string(head[8:12]) == "AIFC"):
+		m, err = readAIFF(r, size)
+	case string(head[4:8]) == "ftyp":
+		m, err = readMP4(r, size)
+	case head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		m, err = readMPEG(r, size, 0, &Metadata{})
+	default:
+		// MP3s without an ID3 tag may start with padding or junk before the first frame
+		off, ok := findMPEGStart(r, size)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+		m, err = readMPEG(r, size, off, &Metadata{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.finalize()
+	return m, nil
+}
+
+// readAt reads exactly n bytes at off
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	if n < 0 || n > maxChunkSize {
+		return nil, fmt.Errorf("%w: block of %d bytes", ErrMalformed, n)
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: unexpected end of file", ErrMalformed)
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// averageBitrate derives the bitrate from the audio payload size and duration
+func averageBitrate(audioBytes int64, duration float64) int {
+	if audioBytes <= 0 || duration <= 0 {
+		return 0
+	}
+	return int(float64(audioBytes) * 8 / duration)
+}
+
+func firstOf(m *Metadata, keys ...string) string {
+	for _, k := range keys {
+		if v := m.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseNumberPair reads "3" or "3/12" as number and total
+func parseNumberPair(s string) (int, int) {
+	num, total, _ := strings.Cut(s, "/")
+	return atoi(num), atoi(total)
+}
+
+// parseYear takes the leading four digits of a date such as "1997-05-21"
+func parseYear(s string) int {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 {
+		return 0
+	}
+	year := atoi(s[:4])
+	if year < 1000 {
+		return 0
+	}
+	return year
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// clean strips NUL padding and control characters from a tag value
+func clean(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == unicode.ReplacementChar || (unicode.IsControl(r) && r != '\n' && r != '\t') {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,242 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func vorbisComments(fields ...string) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, uint32(6))
+	b.WriteString("vendor")
+	binary.Write(&b, binary.LittleEndian, uint32(len(fields)))
+	for _, f := range fields {
+		binary.Write(&b, binary.LittleEndian, uint32(len(f)))
+		b.WriteString(f)
+	}
+	return b.Bytes()
+}
+
+func buildFLAC() []byte {
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+
+	// STREAMINFO: 44.1 kHz, 2 channels, 16 bits, 441000 samples (10 s)
+	info := make([]byte, 34)
+	packed := uint64(44100)<<44 | uint64(1)<<41 | uint64(15)<<36 | 441000
+	binary.BigEndian.PutUint64(info[10:], packed)
+	b.Write([]byte{flacStreamInfo, 0, 0, 34})
+	b.Write(info)
+
+	comments := vorbisComments("TITLE=Song", "ARTIST=First", "ARTIST=Second", "ALBUM=Record",
+		"TRACKNUMBER=3/12", "DISCNUMBER=1", "DATE=1997-05-21", "GENRE=Jazz")
+	b.Write([]byte{0x80 | flacVorbisComment, 0, byte(len(comments) >> 8), byte(len(comments))})
+	b.Write(comments)
+	b.Write(make([]byte, 1000)) // Audio frames
+	return b.Bytes()
+}
+
+func id3Frame(id string, text string) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.BigEndian, uint32(len(text)+1))
+	b.Write([]byte{0, 0, 3}) // Flags, UTF-8
+	b.WriteString(text)
+	return b.Bytes()
+}
+
+func buildMP3() []byte {
+	var frames bytes.Buffer
+	frames.Write(id3Frame("TIT2", "Titel"))
+	frames.Write(id3Frame("TPE1", "Künstler"))
+	frames.Write(id3Frame("TCON", "(31)"))
+	frames.Write(id3Frame("TRCK", "7"))
+	frames.Write(id3Frame("TSSE", "LAME 3.100"))
+
+	var b bytes.Buffer
+	size := frames.Len()
+	b.Write([]byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)})
+	b.Write(frames.Bytes())
+
+	// 100 MPEG-1 layer III frames at 128 kbit/s, 44.1 kHz, joint stereo
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x40})
+	for i := 0; i < 100; i++ {
+		b.Write(frame)
+	}
+	return b.Bytes()
+}
+
+func buildWAV() []byte {
+	var chunks bytes.Buffer
+	chunks.WriteString("fmt ")
+	binary.Write(&chunks, binary.LittleEndian, uint32(16))
+	binary.Write(&chunks, binary.LittleEndian, []uint16{1, 2})
+	binary.Write(&chunks, binary.LittleEndian, []uint32{48000, 48000 * 2 * 3})
+	binary.Write(&chunks, binary.LittleEndian, []uint16{6, 24})
+
+	info := []byte("INFOINAM\x05\x00\x00\x00Track\x00")
+	chunks.WriteString("LIST")
+	binary.Write(&chunks, binary.LittleEndian, uint32(len(info)))
+	chunks.Write(info)
+
+	chunks.WriteString("data")
+	binary.Write(&chunks, binary.LittleEndian, uint32(288000))
+	chunks.Write(make([]byte, 288000))
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(chunks.Len()+4))
+	b.WriteString("WAVE")
+	b.Write(chunks.Bytes())
+	return b.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Metadata
+	}{
+		{"flac", buildFLAC(), Metadata{
+			Container: "flac", Codec: "flac", Title: "Song", Album: "Record", TrackNumber: 3, TrackTotal: 12, DiscNumber: 1,
+			Year: 1997, Genre: "Jazz", Duration: 10, SampleRate: 44100, BitDepth: 16, Channels: 2, Encoder: "vendor",
+		}},
+		{"mp3", buildMP3(), Metadata{
+			Container: "mpeg", Codec: "mp3", Title: "Titel", TrackNumber: 7, Genre: "Trance", SampleRate: 44100, Channels: 2, Bitrate: 128000,
+			Profile: "CBR", Encoder: "LAME 3.100",
+		}},
+		{"wav", buildWAV(), Metadata{
+			Container: "wav", Codec: "pcm", Title: "Track", Duration: 1, SampleRate: 48000, BitDepth: 24, Channels: 2, Bitrate: 2304000,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Read(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if m.Container != tt.want.Container || m.Codec != tt.want.Codec || m.Title != tt.want.Title || m.Album != tt.want.Album ||
+				m.TrackNumber != tt.want.TrackNumber || m.TrackTotal != tt.want.TrackTotal ||
+				m.DiscNumber != tt.want.DiscNumber || m.Year != tt.want.Year || m.Genre != tt.want.Genre {
+				t.Errorf("tags = %+v, want %+v", m, tt.want)
+			}
+			if m.SampleRate != tt.want.SampleRate || m.BitDepth != tt.want.BitDepth || m.Channels != tt.want.Channels {
+				t.Errorf("stream = %d Hz/%d bit/%d ch, want %d Hz/%d bit/%d ch",
+					m.SampleRate, m.BitDepth, m.Channels, tt.want.SampleRate, tt.want.BitDepth, tt.want.Channels)
+			}
+			if tt.want.Duration > 0 && m.Duration != tt.want.Duration {
+				t.Errorf("Duration = %v, want %v", m.Duration, tt.want.Duration)
+			}
+			if tt.want.Bitrate > 0 && m.Bitrate != tt.want.Bitrate {
+				t.Errorf("Bitrate = %d, want %d", m.Bitrate, tt.want.Bitrate)
+			}
+			if m.Profile != tt.want.Profile || m.Encoder != tt.want.Encoder {
+				t.Errorf("Profile, Encoder = %q, %q, want %q, %q", m.Profile, m.Encoder, tt.want.Profile, tt.want.Encoder)
+			}
+		})
+	}
+
+	flac, _ := Read(bytes.NewReader(buildFLAC()), int64(len(buildFLAC())))
+	if len(flac.Artists) != 2 || flac.Artist() != "First" {
+		t.Errorf("Artists = %v, want [First Second]", flac.Artists)
+	}
+	if !flac.MatchesExtension(".FLAC") || flac.MatchesExtension(".mp3") {
+		t.Errorf("MatchesExtension() disagrees with container %q", flac.Container)
+	}
+	mp3, _ := Read(bytes.NewReader(buildMP3()), int64(len(buildMP3())))
+	if mp3.Artist() != "Künstler" {
+		t.Errorf("Artist() = %q, want Künstler", mp3.Artist())
+	}
+}
+
+func TestMPEGEncoding(t *testing.T) {
+	f, _ := parseMPEGHeader([]byte{0xFF, 0xFB, 0x90, 0x40})
+	xing := 4 + f.sideInfoSize()
+	build := func(tag string, flags uint32, lame string, method byte) []byte {
+		frame := make([]byte, f.length)
+		copy(frame, []byte{0xFF, 0xFB, 0x90, 0x40})
+		copy(frame[xing:], tag)
+		binary.BigEndian.PutUint32(frame[xing+4:], flags)
+		pos := xing + 8 + 4 + 100 // Frame count and TOC
+		copy(frame[pos:], lame)
+		frame[pos+9] = method
+		return frame
+	}
+
+	tests := []struct {
+		name          string
+		frame         []byte
+		profile, tool string
+	}{
+		{"lame vbr", build("Xing", 0x05, "LAME3.100", 0x14), "VBR", "LAME3.100"},
+		{"lame abr", build("Info", 0x05, "LAME3.99r", 0x02), "ABR", "LAME3.99r"},
+		{"info", build("Info", 0x05, "", 0), "CBR", ""},
+		{"xing", build("Xing", 0x05, "", 0), "VBR", ""},
+		{"none", build("", 0, "", 0), "CBR", ""},
+	}
+	for _, tt := range tests {
+		if profile, tool := mpegEncoding(tt.frame, f); profile != tt.profile || tool != tt.tool {
+			t.Errorf("%s: mpegEncoding() = %q, %q, want %q, %q", tt.name, profile, tool, tt.profile, tt.tool)
+		}
+	}
+}
+
+func TestAACObjectType(t *testing.T) {
+	// ES_Descriptor > DecoderConfigDescriptor > DecoderSpecificInfo, as iTunes and FFmpeg write them
+	esds := func(asc ...byte) []byte {
+		dsi := append([]byte{0x05, 0x80, 0x80, 0x80, byte(len(asc))}, asc...)
+		dcd := append([]byte{0x04, byte(13 + len(dsi)), 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, dsi...)
+		return append([]byte{0x03, byte(3 + len(dcd)), 0, 1, 0}, dcd...)
+	}
+
+	tests := []struct {
+		esds []byte
+		want string
+	}{
+		{esds(0x12, 0x10), "LC"},
+		{esds(0x2B, 0x92, 0x08, 0x00), "HE-AAC"},
+		{esds(0xEB, 0x09, 0x88), "HE-AACv2"},
+		{esds(0xF8, 0xE0), "ELD"},
+		{[]byte{0x03, 0x02}, ""},
+	}
+	for _, tt := range tests {
+		if got := aacProfiles[aacObjectType(tt.esds)]; got != tt.want {
+			t.Errorf("aacObjectType(% x) = %q, want %q", tt.esds, got, tt.want)
+		}
+	}
+}
+
+func TestReadUnsupported(t *testing.T) {
+	data := []byte("not an audio file at all")
+	if _, err := Read(bytes.NewReader(data), int64(len(data))); err != ErrUnsupported {
+		t.Errorf("Read() error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestReadLeadingJunk(t *testing.T) {
+	var b bytes.Buffer
+	b.Write(bytes.Repeat([]byte{0}, 300))
+	b.Write([]byte{0xFF, 0xFB, 0x90, 0x40, 0xFF, 0x00}) // A lone false sync
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x40})
+	for i := 0; i < 100; i++ {
+		b.Write(frame)
+	}
+	m, err := Read(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Container != "mpeg" || m.SampleRate != 44100 || m.Duration < 2.6 || m.Duration > 2.62 {
+		t.Errorf("Read() = %s at %d Hz for %.3fs, want 2.6s of mpeg at 44100 Hz", m.Container, m.SampleRate, m.Duration)
+	}
+	v, err := verify(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Status != IntegrityOK {
+		t.Errorf("verify() = %s %v, want ok", v.Status, v.Issues)
+	}
+}
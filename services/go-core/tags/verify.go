@@ -0,0 +1,326 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Integrity statuses
+const (
+	IntegrityOK         = "ok"
+	IntegrityCorrupt    = "corrupt"
+	IntegrityUnverified = "unverified" // The container has no check, e.g. MP4 and Ogg
+)
+
+const (
+	// durationTolerance is how far, in seconds, the audio found may fall short of the declared duration
+	durationTolerance = 0.5
+	// maxIssues caps the problems reported per file; damaged MP3s can lose sync thousands of times
+	maxIssues = 10
+)
+
+// Integrity is the outcome of reading every frame of an audio file
+type Integrity struct {
+	Status   string   // ok, corrupt or unverified
+	Issues   []string // What is wrong with a corrupt file
+	Duration float64  // Seconds of audio actually found, 0 when unverified
+}
+
+func (v *Integrity) issue(format string, args ...any) {
+	v.Status = IntegrityCorrupt
+	if len(v.Issues) < maxIssues {
+		v.Issues = append(v.Issues, fmt.Sprintf(format, args...))
+	}
+}
+
+// checkDuration compares the duration declared by the container with the audio found
+func (v *Integrity) checkDuration(declared float64) {
+	if declared > 0 && declared-v.Duration > durationTolerance {
+		v.issue("declares %.2fs of audio but holds %.2fs", declared, v.Duration)
+	}
+}
+
+// Verify reads the whole audio file at path and checks it for damage that
+// probing cannot see: FLAC frames are decoded and checked against their CRCs
+// and the STREAMINFO MD5, MPEG frames must follow each other without losing
+// sync, and the audio data must cover the duration the container declares.
+// Files that fail Read are reported through the error, like ReadFile.
+func Verify(path string) (*Integrity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return verify(f, info.Size())
+}
+
+func verify(r io.ReaderAt, size int64) (*Integrity, error) {
+	m, err := Read(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	off := int64(0)
+	if head, err := readAt(r, 0, 3); err == nil && string(head) == "ID3" {
+		if off, err = readID3v2(r, 0, &Metadata{}); err != nil {
+			return nil, err
+		}
+	} else if m.Container == "mpeg" {
+		// Leading junk is skipped the way Read found the first frame
+		if start, ok := findMPEGStart(r, size); ok {
+			off = start
+		}
+	}
+
+	v := &Integrity{Status: IntegrityOK}
+	switch m.Container {
+	case "flac":
+		err = verifyFLAC(r, size, off, v)
+	case "mpeg":
+		err = verifyMPEG(r, size, off, v)
+	case "wav":
+		err = verifyIFF(r, size, binary.LittleEndian, "data", m, v)
+	case "aiff":
+		err = verifyIFF(r, size, binary.BigEndian, "SSND", m, v)
+	default:
+		return &Integrity{Status: IntegrityUnverified}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// verifyFLAC decodes every frame and hashes the samples as the encoder did for STREAMINFO
+func verifyFLAC(r io.ReaderAt, size, off int64, v *Integrity) error {
+	m := &Metadata{}
+	info, pos, err := flacAudio(r, size, off)
+	if err != nil {
+		return err
+	}
+	total, err := parseStreamInfo(m, info)
+	if err != nil {
+		return err
+	}
+	want := info[18:34]
+	hasMD5 := !bytes.Equal(want, make([]byte, 16))
+
+	d := &flacDecoder{
+		br:         bitReader{r: bufio.NewReaderSize(io.NewSectionReader(r, pos, size-pos), 64<<10)},
+		bps:        m.BitDepth,
+		fixedBlock: int64(binary.BigEndian.Uint16(info[2:])),
+	}
+	width := (m.BitDepth + 7) / 8
+	hash := md5.New()
+	var buf []byte
+	var decoded int64
+	intact := true
+	for {
+		start := d.br.pos
+		frame, err := d.frame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !errors.Is(err, errFLACFrame) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return err
+			}
+			if trailer, terr := readAt(r, pos+start, 3); start > 0 && terr == nil && string(trailer) == "TAG" && pos+start+128 == size {
+				break // ID3v1 tag appended by some taggers
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				v.issue("file truncated inside the frame at byte %d", pos+start)
+			} else {
+				v.issue("%v at byte %d", err, pos+start)
+			}
+			intact = false
+			break
+		}
+		if frame.sample != decoded {
+			v.issue("frame at byte %d starts at sample %d, expected %d", pos+start, frame.sample, decoded)
+		}
+		if frame.channels != m.Channels || frame.bps != m.BitDepth {
+			v.issue("frame at byte %d has %d channels of %d bits, STREAMINFO declares %d of %d",
+				pos+start, frame.channels, frame.bps, m.Channels, m.BitDepth)
+			intact = false
+			break
+		}
+
+		buf = buf[:0]
+		for i := 0; i < frame.block; i++ {
+			for ch := 0; ch < frame.channels; ch++ {
+				s := d.channels[ch][i]
+				for b := 0; b < width; b++ {
+					buf = append(buf, byte(s>>(8*b)))
+				}
+			}
+		}
+		hash.Write(buf)
+		decoded += int64(frame.block)
+	}
+
+	v.Duration = float64(decoded) / float64(m.SampleRate)
+	if total > 0 && decoded != total {
+		v.issue("STREAMINFO declares %d samples but the frames hold %d", total, decoded)
+	}
+	if intact && hasMD5 && (total == 0 || decoded == total) && !bytes.Equal(hash.Sum(nil), want) {
+		v.issue("decoded audio does not match the STREAMINFO MD5")
+	}
+	return nil
+}
+
+// flacAudio returns the STREAMINFO block of a FLAC stream and the offset of its first frame
+func flacAudio(r io.ReaderAt, size, off int64) ([]byte, int64, error) {
+	var info []byte
+	pos := off + 4
+	for {
+		header, err := readAt(r, pos, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if header[0]&0x7F == flacStreamInfo {
+			if info, err = readAt(r, pos+4, int(length)); err != nil {
+				return nil, 0, err
+			}
+		}
+		pos += 4 + length
+		if header[0]&0x80 != 0 || pos >= size {
+			break
+		}
+	}
+	if len(info) < 34 {
+		return nil, 0, fmt.Errorf("%w: invalid STREAMINFO block", ErrMalformed)
+	}
+	return info, pos, nil
+}
+
+// verifyMPEG walks the frames from the first one to the end of the audio.
+// Bytes between frames mean lost sync; the last frame must be complete; the
+// Xing/VBRI frame count must match the frames found.
+func verifyMPEG(r io.ReaderAt, size, off int64, v *Integrity) error {
+	window := min(int64(mpegSyncWindow), size-off)
+	if window < 4 {
+		return fmt.Errorf("%w: no MPEG audio frame found", ErrMalformed)
+	}
+	buf, err := readAt(r, off, int(window))
+	if err != nil {
+		return err
+	}
+	pos, first, ok := findMPEGFrame(buf)
+	if !ok {
+		return fmt.Errorf("%w: no MPEG audio frame found", ErrMalformed)
+	}
+	audio := off + int64(pos)
+	stop := size
+	if tail, err := readAt(r, size-128, 3); err == nil && string(tail) == "TAG" {
+		stop -= 128
+	}
+	declared := vbrFrameCount(buf[pos:], first)
+	if declared > 0 {
+		audio += int64(first.length) // The Xing/VBRI frame carries no audio
+	}
+
+	// Frames of another version, layer or rate are false syncs
+	matches := func(f mpegFrame) bool {
+		return f.version == first.version && f.layer == first.layer && f.sampleRate == first.sampleRate && f.length > 0
+	}
+	frames := 0
+	lostAt, lost := int64(-1), 0
+	br := bufio.NewReaderSize(io.NewSectionReader(r, audio, stop-audio), 64<<10)
+	for at := audio; at < stop; {
+		header, err := br.Peek(4)
+		if err != nil {
+			if lostAt < 0 {
+				v.issue("%d stray bytes at the end of the audio", stop-at)
+			}
+			break
+		}
+		f, ok := parseMPEGHeader(header)
+		if !ok || !matches(f) {
+			if lostAt < 0 {
+				if tag, _ := br.Peek(8); bytes.HasPrefix(tag, []byte("APETAGEX")) || bytes.HasPrefix(tag, []byte("LYRICS")) {
+					break // Trailing APE or Lyrics3 tag
+				}
+				lostAt = at
+			}
+			br.Discard(1)
+			at++
+			lost++
+			continue
+		}
+		if lostAt >= 0 {
+			v.issue("lost frame sync at byte %d, skipped %d bytes", lostAt, lost)
+			lostAt, lost = -1, 0
+		}
+		if at+int64(f.length) > stop {
+			v.issue("last frame truncated: %d of %d bytes", stop-at, f.length)
+			break
+		}
+		frames++
+		n, _ := br.Discard(f.length)
+		at += int64(n)
+	}
+	if lostAt >= 0 {
+		v.issue("lost frame sync at byte %d, skipped %d bytes up to the end", lostAt, lost)
+	}
+
+	samples := float64(first.samplesPerFrame())
+	v.Duration = float64(frames) * samples / float64(first.sampleRate)
+	if declared > 0 {
+		v.checkDuration(float64(declared) * samples / float64(first.sampleRate))
+	}
+	if frames == 0 {
+		v.issue("no complete audio frame")
+	}
+	return nil
+}
+
+// verifyIFF checks that the sample data chunk of a WAV or AIFF file is as long as its header says
+func verifyIFF(r io.ReaderAt, size int64, order binary.ByteOrder, dataID string, m *Metadata, v *Integrity) error {
+	var present, declared int64
+	found := false
+	for pos := int64(12); pos+8 <= size; {
+		header, err := readAt(r, pos, 8)
+		if err != nil {
+			return err
+		}
+		length := int64(order.Uint32(header[4:]))
+		if string(header[:4]) == dataID {
+			found = true
+			declared = length
+			present = min(length, size-pos-8)
+		}
+		pos += 8 + length + length&1
+	}
+	if !found {
+		v.issue("no %s chunk", dataID)
+		return nil
+	}
+	if present < declared {
+		v.issue("%s chunk truncated: %d of %d bytes", dataID, present, declared)
+	}
+
+	if m.Codec != "pcm" && m.Codec != "pcm_float" {
+		return nil // Compressed samples have no fixed size
+	}
+	frameSize := int64(m.Channels * ((m.BitDepth + 7) / 8))
+	if dataID == "SSND" {
+		present -= 8 // Offset and block size fields
+	}
+	if frameSize > 0 && present > 0 {
+		v.Duration = float64(present/frameSize) / float64(m.SampleRate)
+		v.checkDuration(m.Duration)
+	}
+	return nil
+}
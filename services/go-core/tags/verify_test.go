@@ -0,0 +1,178 @@
+package tags
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// bitWriter packs values MSB first, the way FLAC frames are laid out
+type bitWriter struct {
+	buf  []byte
+	bits uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>uint(i)&1) << (7 - w.bits%8)
+		w.bits++
+	}
+}
+
+func (w *bitWriter) signed(v int64, n uint) { w.write(uint64(v)&(1<<n-1), n) }
+
+// rice writes the residual of a single partition with parameter k
+func (w *bitWriter) rice(residual []int64, k uint) {
+	w.write(0, 2) // 4-bit parameters
+	w.write(0, 4) // Partition order 0
+	w.write(uint64(k), 4)
+	for _, r := range residual {
+		u := uint64(r<<1 ^ r>>63)
+		for q := u >> k; q > 0; q-- {
+			w.write(0, 1)
+		}
+		w.write(1, 1)
+		w.write(u&(1<<k-1), k)
+	}
+}
+
+// buildVerifiableFLAC encodes two 4096-sample stereo frames with real
+// subframes: fixed and LPC prediction over left/side, then verbatim and constant
+func buildVerifiableFLAC() []byte {
+	const block = 4096
+	left := make([]int64, 2*block)
+	right := make([]int64, 2*block)
+	pcm := md5.New()
+	for i := range left {
+		left[i] = int64(3000 * math.Sin(float64(i)/20))
+		right[i] = int64(2000 * math.Cos(float64(i)/33))
+		if i >= block {
+			right[i] = -7
+		}
+		binary.Write(pcm, binary.LittleEndian, []int16{int16(left[i]), int16(right[i])})
+	}
+
+	var b bytes.Buffer
+	b.WriteString("fLaC")
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:], block)
+	binary.BigEndian.PutUint16(info[2:], block)
+	packed := uint64(44100)<<44 | uint64(1)<<41 | uint64(15)<<36 | uint64(len(left))
+	binary.BigEndian.PutUint64(info[10:], packed)
+	copy(info[18:], pcm.Sum(nil))
+	b.Write([]byte{0x80 | flacStreamInfo, 0, 0, 34})
+	b.Write(info)
+
+	for frame := 0; frame < 2; frame++ {
+		l, r := left[frame*block:(frame+1)*block], right[frame*block:(frame+1)*block]
+		assignment := byte(8) // left/side
+		if frame == 1 {
+			assignment = 1 // Independent stereo
+		}
+		w := &bitWriter{}
+		header := []byte{0xFF, 0xF8, 0xC9, assignment<<4 | 4<<1, byte(frame)}
+		for _, c := range append(header, crc8(header)) {
+			w.write(uint64(c), 8)
+		}
+
+		if frame == 0 {
+			// Left: fixed order 2
+			w.write(10<<1, 8)
+			w.signed(l[0], 16)
+			w.signed(l[1], 16)
+			residual := make([]int64, 0, block)
+			for i := 2; i < block; i++ {
+				residual = append(residual, l[i]-(2*l[i-1]-l[i-2]))
+			}
+			w.rice(residual, 2)
+
+			// Side: LPC order 2, 12-bit coefficients shifted by 10
+			side := make([]int64, block)
+			for i := range side {
+				side[i] = l[i] - r[i]
+			}
+			coefs := []int64{1843, -850}
+			w.write(33<<1, 8)
+			w.signed(side[0], 17)
+			w.signed(side[1], 17)
+			w.write(11, 4)
+			w.signed(10, 5)
+			w.signed(coefs[0], 12)
+			w.signed(coefs[1], 12)
+			residual = residual[:0]
+			for i := 2; i < block; i++ {
+				residual = append(residual, side[i]-(coefs[0]*side[i-1]+coefs[1]*side[i-2])>>10)
+			}
+			w.rice(residual, 9)
+		} else {
+			w.write(1<<1, 8) // Verbatim
+			for _, s := range l {
+				w.signed(s, 16)
+			}
+			w.write(0, 8) // Constant
+			w.signed(r[0], 16)
+		}
+
+		sum := uint16(0)
+		for _, c := range w.buf {
+			sum = sum<<8 ^ crc16Table[byte(sum>>8)^c]
+		}
+		b.Write(w.buf)
+		binary.Write(&b, binary.BigEndian, sum)
+	}
+	return b.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+	flac := buildVerifiableFLAC()
+	mp3 := buildMP3()
+	wav := buildWAV()
+
+	damaged := func(data []byte, at int) []byte {
+		c := bytes.Clone(data)
+		c[at] ^= 0x5A
+		return c
+	}
+	withJunk := func(data []byte, at int) []byte {
+		return append(append(bytes.Clone(data[:at]), make([]byte, 37)...), data[at:]...)
+	}
+	md5Flipped := bytes.Clone(flac)
+	md5Flipped[8+18] ^= 0x01
+
+	tests := []struct {
+		name  string
+		data  []byte
+		want  string
+		issue string
+	}{
+		{"flac", flac, IntegrityOK, ""},
+		{"flac broken frame", damaged(flac, len(flac)-3000), IntegrityCorrupt, "frame CRC mismatch"},
+		{"flac truncated", flac[:len(flac)-100], IntegrityCorrupt, "truncated"},
+		{"flac wrong md5", md5Flipped, IntegrityCorrupt, "MD5"},
+		{"mp3", mp3, IntegrityOK, ""},
+		{"mp3 lost sync", withJunk(mp3, len(mp3)-417*50), IntegrityCorrupt, "lost frame sync"},
+		{"mp3 truncated", mp3[:len(mp3)-200], IntegrityCorrupt, "last frame truncated"},
+		{"wav", wav, IntegrityOK, ""},
+		{"wav truncated", wav[:len(wav)-1000], IntegrityCorrupt, "data chunk truncated"},
+	}
+	for _, tt := range tests {
+		v, err := verify(bytes.NewReader(tt.data), int64(len(tt.data)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if v.Status != tt.want || tt.issue != "" && !strings.Contains(strings.Join(v.Issues, "; "), tt.issue) {
+			t.Errorf("%s: %s %q, want %s mentioning %q", tt.name, v.Status, v.Issues, tt.want, tt.issue)
+		}
+	}
+
+	if v, _ := verify(bytes.NewReader(flac), int64(len(flac))); math.Abs(v.Duration-8192/44100.0) > 1e-9 {
+		t.Errorf("flac duration = %v", v.Duration)
+	}
+}
@@ -0,0 +1,129 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache keeps the complete outputs of a Transcoder on disk, evicting the
+// least recently used ones once they take more than MaxBytes
+type Cache struct {
+	Transcoder Transcoder
+	Dir        string
+	MaxBytes   int64
+
+	// mu serializes evictions
+	mu sync.Mutex
+}
+
+// NewCache creates a cache of the outputs of t in dir
+func NewCache(t Transcoder, dir string, maxBytes int64) *Cache {
+	return &Cache{Transcoder: t, Dir: dir, MaxBytes: maxBytes}
+}
+
+// Lookup returns the path of the cached output of job, if any. Seeks are
+// never cached; segments are.
+func (c *Cache) Lookup(job Job) (string, bool) {
+	if !job.cacheable() || c.MaxBytes <= 0 {
+		return "", false
+	}
+	key, err := job.key()
+	if err != nil {
+		return "", false
+	}
+	path := c.path(key, job.Format)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	// The modification time orders evictions
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return path, true
+}
+
+// Transcode converts job and writes the output to w. Complete outputs of
+// whole tracks and segments are kept; a client going away before the end
+// stops the conversion and nothing is kept.
+func (c *Cache) Transcode(ctx context.Context, job Job, w io.Writer) error {
+	if !job.cacheable() || c.MaxBytes <= 0 {
+		return c.Transcoder.Transcode(ctx, job, w)
+	}
+	key, err := job.key()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create transcode cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(c.Dir, ".transcode-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = c.Transcoder.Transcode(ctx, job, io.MultiWriter(w, tmp))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path(key, job.Format)); err != nil {
+		return err
+	}
+	c.evict()
+	return nil
+}
+
+func (c *Cache) path(key string, f Format) string {
+	return filepath.Join(c.Dir, key+"."+f.Ext)
+}
+
+// evict removes the least recently used outputs until the cache fits MaxBytes
+func (c *Cache) evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{filepath.Join(c.Dir, e.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= c.MaxBytes {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to evict transcode", "path", f.path, "error", err)
+			continue
+		}
+		total -= f.size
+	}
+}
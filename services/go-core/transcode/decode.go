@@ -0,0 +1,124 @@
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"sonantica-core/tags"
+)
+
+// decodeBlock is how many sample frames Audio.Read returns at most
+const decodeBlock = 4096
+
+// Audio is a file ffmpeg decodes to 32-bit float PCM, for the formats
+// tags.OpenPCM cannot read. It has the same Read contract as tags.PCM.
+type Audio struct {
+	SampleRate int
+	Channels   int
+	ctx        context.Context
+	cmd        *exec.Cmd
+	out        *bufio.Reader
+	stderr     bytes.Buffer
+	buf        []byte
+	block      [][]float32
+	done       bool // The output ended
+	waited     bool
+}
+
+// Decode starts decoding the audio of the file at path, resampled to rate and
+// mixed to channels. Cancelling ctx kills the process; Close must be called
+// once done.
+func (f *FFmpeg) Decode(ctx context.Context, path string, rate, channels int) (*Audio, error) {
+	if rate <= 0 || channels <= 0 {
+		return nil, fmt.Errorf("invalid decoding parameters: %d Hz, %d channels", rate, channels)
+	}
+	a := &Audio{SampleRate: rate, Channels: channels, ctx: ctx}
+	a.cmd = exec.CommandContext(ctx, f.Binary,
+		"-hide_banner", "-loglevel", "error", "-nostdin",
+		"-i", path, "-map", "0:a:0", "-vn",
+		"-ac", strconv.Itoa(channels), "-ar", strconv.Itoa(rate),
+		"-f", "f32le", "pipe:1",
+	)
+	a.cmd.Stderr = &a.stderr
+	out, err := a.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	a.out = bufio.NewReaderSize(out, 64<<10)
+	a.buf = make([]byte, decodeBlock*channels*4)
+	a.block = make([][]float32, channels)
+	return a, nil
+}
+
+// Read returns the next block of samples, one slice per channel. The slices
+// are reused by the next call. It returns io.EOF at the end of the audio and
+// wraps tags.ErrMalformed when ffmpeg cannot decode the file.
+func (a *Audio) Read() ([][]float32, error) {
+	if a.done {
+		return nil, io.EOF
+	}
+	frameSize := a.Channels * 4
+	n, err := io.ReadFull(a.out, a.buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		a.done = true
+		if werr := a.wait(); werr != nil {
+			return nil, werr
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	frames := n / frameSize
+	if frames == 0 {
+		return nil, io.EOF
+	}
+	for ch := range a.block {
+		a.block[ch] = a.block[ch][:0]
+	}
+	for i := 0; i < frames; i++ {
+		for ch := range a.block {
+			bits := binary.LittleEndian.Uint32(a.buf[i*frameSize+ch*4:])
+			a.block[ch] = append(a.block[ch], math.Float32frombits(bits))
+		}
+	}
+	return a.block, nil
+}
+
+// Close stops ffmpeg if it is still decoding
+func (a *Audio) Close() error {
+	if a.waited {
+		return nil
+	}
+	a.waited = true
+	_ = a.cmd.Process.Kill()
+	_ = a.cmd.Wait()
+	return nil
+}
+
+// wait reaps ffmpeg once its output ended and reports how it exited
+func (a *Audio) wait() error {
+	if a.waited {
+		return nil
+	}
+	a.waited = true
+	if err := a.cmd.Wait(); err != nil {
+		if a.ctx.Err() != nil {
+			return a.ctx.Err()
+		}
+		if msg := strings.TrimSpace(a.stderr.String()); msg != "" {
+			return fmt.Errorf("%w: ffmpeg failed: %v: %s", tags.ErrMalformed, err, msg)
+		}
+		return fmt.Errorf("%w: ffmpeg failed: %v", tags.ErrMalformed, err)
+	}
+	return nil
+}
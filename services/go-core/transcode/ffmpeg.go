@@ -0,0 +1,83 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// FFmpeg transcodes with an ffmpeg subprocess
+type FFmpeg struct {
+	Binary string // Name or path of the ffmpeg executable
+}
+
+// Available reports whether the ffmpeg executable can be found
+func (f *FFmpeg) Available() bool {
+	_, err := exec.LookPath(f.Binary)
+	return err == nil
+}
+
+// Args returns the ffmpeg arguments of a job, writing to standard output
+func (f *FFmpeg) Args(job Job) ([]string, error) {
+	if job.Format.Encoder == "" || job.Format.Muxer == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, job.Format.Name)
+	}
+	args := []string{"-hide_banner", "-loglevel", "error", "-nostdin"}
+	// Seeking before the input skips decoding what comes before
+	if start := job.Start + job.Offset; start > 0 {
+		args = append(args, "-ss", seconds(start))
+	}
+	args = append(args, "-i", job.Path)
+	switch {
+	case job.Length > 0 && job.Duration > 0:
+		args = append(args, "-t", seconds(min(job.Length, max(job.Duration-job.Offset, 0))))
+	case job.Length > 0:
+		args = append(args, "-t", seconds(job.Length))
+	case job.Duration > 0:
+		args = append(args, "-t", seconds(max(job.Duration-job.Offset, 0)))
+	}
+	args = append(args,
+		"-map", "0:a:0", "-vn", "-map_metadata", "-1",
+		"-c:a", job.Format.Encoder, "-b:a", strconv.Itoa(job.Bitrate)+"k",
+	)
+	if job.Format.Encoder == "libopus" {
+		// libopus only accepts its own rates; 48 kHz is what Opus runs at anyway
+		args = append(args, "-ar", "48000")
+	}
+	if job.Format.Muxer == "mpegts" && job.Offset > 0 {
+		// Segments carry their position in the track so players can join them
+		args = append(args, "-output_ts_offset", seconds(job.Offset))
+	}
+	return append(args, "-f", job.Format.Muxer, "pipe:1"), nil
+}
+
+// Transcode runs ffmpeg on the job and copies its output to w. Cancelling ctx
+// kills the process.
+func (f *FFmpeg) Transcode(ctx context.Context, job Job, w io.Writer) error {
+	args, err := f.Args(job)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, f.Binary, args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("ffmpeg failed: %w: %s", err, msg)
+		}
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
+
+func seconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
@@ -0,0 +1,92 @@
+package transcode
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SegmentLength is the duration of HLS segments in seconds
+const SegmentLength = 6.0
+
+var (
+	// SegmentFormat is the format of HLS segments: AAC in MPEG-TS, which every HLS player supports
+	SegmentFormat = Format{Name: "hls", ContentType: "video/mp2t", Ext: "ts", Encoder: "aac", Muxer: "mpegts"}
+
+	// Renditions are the bitrates in kbps HLS streams are offered at
+	Renditions = []int{64, 128, 256}
+)
+
+// IsRendition reports whether bitrate is one of Renditions
+func IsRendition(bitrate int) bool {
+	for _, r := range Renditions {
+		if r == bitrate {
+			return true
+		}
+	}
+	return false
+}
+
+// RenditionsFor returns the renditions worth offering for a source at
+// bitrate kbps: the lowest one and those below the source. Sources of
+// unknown bitrate get them all.
+func RenditionsFor(bitrate int) []int {
+	if bitrate <= 0 {
+		return Renditions
+	}
+	out := []int{Renditions[0]}
+	for _, r := range Renditions[1:] {
+		if r <= bitrate {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Segments returns how many segments a track of duration seconds is cut into
+func Segments(duration float64) int {
+	return int(math.Ceil(duration / SegmentLength))
+}
+
+// Segment returns the job converting segment i of the track base describes at
+// bitrate kbps
+func Segment(base Job, duration float64, i, bitrate int) Job {
+	job := base
+	job.Offset = float64(i) * SegmentLength
+	job.Length = min(SegmentLength, duration-job.Offset)
+	job.Format, job.Bitrate = SegmentFormat, bitrate
+	return job
+}
+
+// MasterPlaylist lists the renditions, each with its media playlist. query,
+// when set, is appended to their URIs so options such as the stem carry over.
+func MasterPlaylist(renditions []int, query string) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		// BANDWIDTH is the peak in bits per second, MPEG-TS adds about a tenth
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"mp4a.40.2\"\n", r*1100)
+		fmt.Fprintf(&b, "%d/index.m3u8%s\n", r, withQuery(query))
+	}
+	return b.String()
+}
+
+// MediaPlaylist lists the segments of a track of duration seconds
+func MediaPlaylist(duration float64, query string) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(math.Ceil(SegmentLength)))
+	for i := 0; i < Segments(duration); i++ {
+		length := min(SegmentLength, duration-float64(i)*SegmentLength)
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.ts%s\n", length, i, withQuery(query))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+func withQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+	return "?" + query
+}
@@ -0,0 +1,142 @@
+// Package transcode converts audio files to the lossy formats clients can
+// stream on slow or metered connections. The conversion itself is left to a
+// Transcoder, by default an ffmpeg subprocess; Cache keeps complete outputs
+// on disk so a track is only converted once per profile.
+package transcode
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Format describes an output format and the bitrates it is encoded at, in kbps
+type Format struct {
+	Name           string
+	ContentType    string
+	Ext            string
+	Encoder        string // ffmpeg encoder
+	Muxer          string // ffmpeg muxer; AAC uses ADTS, which unlike MP4 can be written to a pipe
+	DefaultBitrate int
+	MinBitrate     int
+	MaxBitrate     int
+}
+
+// DefaultFormat is used when a client only caps the bitrate; every browser and phone plays MP3
+const DefaultFormat = "mp3"
+
+// Formats are the formats streams can be transcoded to
+var Formats = map[string]Format{
+	"opus": {Name: "opus", ContentType: "audio/ogg", Ext: "opus", Encoder: "libopus", Muxer: "ogg", DefaultBitrate: 128, MinBitrate: 24, MaxBitrate: 256},
+	"mp3":  {Name: "mp3", ContentType: "audio/mpeg", Ext: "mp3", Encoder: "libmp3lame", Muxer: "mp3", DefaultBitrate: 192, MinBitrate: 64, MaxBitrate: 320},
+	"aac":  {Name: "aac", ContentType: "audio/aac", Ext: "aac", Encoder: "aac", Muxer: "adts", DefaultBitrate: 192, MinBitrate: 48, MaxBitrate: 320},
+}
+
+// ErrUnknownFormat is returned for formats missing from Formats
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Profile is what a client asks for: a format and the highest bitrate it
+// accepts. Either may be empty.
+type Profile struct {
+	Format     string `mapstructure:"format" json:"format"`
+	MaxBitrate int    `mapstructure:"maxBitrate" json:"maxBitrate"`
+}
+
+// IsZero reports whether the profile asks for nothing, so the original is sent
+func (p Profile) IsZero() bool {
+	return p.Format == "" && p.MaxBitrate == 0
+}
+
+// Merge returns p with the fields set in override replaced
+func (p Profile) Merge(override Profile) Profile {
+	if override.Format != "" {
+		p.Format = override.Format
+	}
+	if override.MaxBitrate != 0 {
+		p.MaxBitrate = override.MaxBitrate
+	}
+	return p
+}
+
+// Satisfies reports whether a file in codec at bitrate kbps can be sent as it
+// is; an unknown bitrate is only accepted when the profile does not cap it
+func (p Profile) Satisfies(codec string, bitrate int) bool {
+	if p.Format != "" && p.Format != codec {
+		return false
+	}
+	if p.MaxBitrate == 0 {
+		return p.Format != ""
+	}
+	return bitrate > 0 && bitrate <= p.MaxBitrate
+}
+
+// Resolve returns the output format and bitrate of the profile: the default
+// format when none is set, and the format's default bitrate, lowered to the
+// profile's cap and kept within what the encoder supports
+func (p Profile) Resolve() (Format, int, error) {
+	name := p.Format
+	if name == "" {
+		name = DefaultFormat
+	}
+	f, ok := Formats[name]
+	if !ok {
+		return Format{}, 0, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+	}
+	bitrate := f.DefaultBitrate
+	if p.MaxBitrate > 0 && p.MaxBitrate < bitrate {
+		bitrate = max(p.MaxBitrate, f.MinBitrate)
+	}
+	return f, bitrate, nil
+}
+
+// Job is a single conversion: the source file, the part of it to convert and
+// the output format
+type Job struct {
+	Path     string
+	Start    float64 // Where the track starts in the file, for cue sheet tracks
+	Duration float64 // Length of the track from Start; 0 runs to the end of the file
+	Offset   float64 // Where to start playing within the track, for seeking
+	Length   float64 // How much to convert from Offset, for segments; 0 runs to the end of the track
+	Format   Format
+	Bitrate  int // kbps
+}
+
+// Transcoder converts the audio of a job and writes the output to w as it is produced
+type Transcoder interface {
+	Transcode(ctx context.Context, job Job, w io.Writer) error
+}
+
+// cacheable reports whether the output is always the same piece of the
+// track: the whole of it or a segment, but not what follows a seek
+func (j Job) cacheable() bool {
+	return j.Offset == 0 || j.Length > 0
+}
+
+// key identifies the output of a job whose source has not changed since
+func (j Job) key() (string, error) {
+	info, err := os.Stat(j.Path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, part := range []string{
+		j.Path,
+		strconv.FormatInt(info.Size(), 10),
+		strconv.FormatInt(info.ModTime().UnixNano(), 10),
+		strconv.FormatFloat(j.Start, 'f', 3, 64),
+		strconv.FormatFloat(j.Duration, 'f', 3, 64),
+		strconv.FormatFloat(j.Offset, 'f', 3, 64),
+		strconv.FormatFloat(j.Length, 'f', 3, 64),
+		j.Format.Name,
+		strconv.Itoa(j.Bitrate),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
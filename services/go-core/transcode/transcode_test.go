@@ -0,0 +1,204 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"sonantica-core/tags"
+)
+
+func TestProfile(t *testing.T) {
+	mobile := Profile{Format: "opus", MaxBitrate: 96}
+	if got := mobile.Merge(Profile{MaxBitrate: 64}); got != (Profile{Format: "opus", MaxBitrate: 64}) {
+		t.Errorf("Merge() = %+v", got)
+	}
+
+	tests := []struct {
+		profile Profile
+		codec   string
+		bitrate int
+		send    bool
+		format  string
+		kbps    int
+	}{
+		{Profile{Format: "opus", MaxBitrate: 96}, "flac", 1411, false, "opus", 96},
+		{Profile{Format: "mp3"}, "mp3", 320, true, "mp3", 192},
+		{Profile{Format: "mp3", MaxBitrate: 192}, "mp3", 320, false, "mp3", 192},
+		{Profile{MaxBitrate: 256}, "aac", 256, true, "mp3", 192},
+		{Profile{MaxBitrate: 256}, "flac", 0, false, "mp3", 192},
+		{Profile{Format: "aac", MaxBitrate: 16}, "flac", 900, false, "aac", 48},
+	}
+	for _, tt := range tests {
+		if got := tt.profile.Satisfies(tt.codec, tt.bitrate); got != tt.send {
+			t.Errorf("%+v.Satisfies(%s, %d) = %v, want %v", tt.profile, tt.codec, tt.bitrate, got, tt.send)
+		}
+		f, kbps, err := tt.profile.Resolve()
+		if err != nil || f.Name != tt.format || kbps != tt.kbps {
+			t.Errorf("%+v.Resolve() = %s %d %v, want %s %d", tt.profile, f.Name, kbps, err, tt.format, tt.kbps)
+		}
+	}
+	if _, _, err := (Profile{Format: "wma"}).Resolve(); err == nil {
+		t.Error("Resolve() accepted an unknown format")
+	}
+}
+
+func TestFFmpegArgs(t *testing.T) {
+	f := &FFmpeg{Binary: "ffmpeg"}
+	args, err := f.Args(Job{Path: "/media/image.flac", Start: 120, Duration: 300, Offset: 30, Format: Formats["opus"], Bitrate: 96})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-hide_banner", "-loglevel", "error", "-nostdin",
+		"-ss", "150.000", "-i", "/media/image.flac", "-t", "270.000",
+		"-map", "0:a:0", "-vn", "-map_metadata", "-1",
+		"-c:a", "libopus", "-b:a", "96k", "-ar", "48000",
+		"-f", "ogg", "pipe:1",
+	}
+	if !slices.Equal(args, want) {
+		t.Errorf("Args() = %v\nwant %v", args, want)
+	}
+}
+
+// fakeTranscoder writes a fixed amount of bytes per job
+type fakeTranscoder struct {
+	size  int
+	calls int
+}
+
+func (f *fakeTranscoder) Transcode(_ context.Context, _ Job, w io.Writer) error {
+	f.calls++
+	_, err := w.Write(bytes.Repeat([]byte{0xFF}, f.size))
+	return err
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	var sources []string
+	for _, name := range []string{"a.flac", "b.flac", "c.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, path)
+	}
+	fake := &fakeTranscoder{size: 400}
+	c := NewCache(fake, filepath.Join(dir, "cache"), 1000)
+	job := func(i int) Job { return Job{Path: sources[i], Format: Formats["mp3"], Bitrate: 192} }
+
+	var out bytes.Buffer
+	if err := c.Transcode(context.Background(), job(0), &out); err != nil || out.Len() != 400 {
+		t.Fatalf("Transcode() wrote %d bytes, error = %v", out.Len(), err)
+	}
+	if _, ok := c.Lookup(job(0)); !ok {
+		t.Fatal("Lookup() missed a complete transcode")
+	}
+	seek := job(0)
+	seek.Offset = 60
+	if _, ok := c.Lookup(seek); ok {
+		t.Error("Lookup() returned a whole track for a seek")
+	}
+
+	// The third transcode exceeds the cache and evicts the least recently used
+	old := time.Now().Add(-time.Hour)
+	_ = c.Transcode(context.Background(), job(1), io.Discard)
+	path0, _ := c.Lookup(job(0))
+	_ = os.Chtimes(path0, old, old)
+	_ = c.Transcode(context.Background(), job(2), io.Discard)
+	if _, ok := c.Lookup(job(0)); ok {
+		t.Error("least recently used transcode was kept")
+	}
+	for _, i := range []int{1, 2} {
+		if _, ok := c.Lookup(job(i)); !ok {
+			t.Errorf("transcode %d was evicted", i)
+		}
+	}
+
+	// Changing the source invalidates its transcodes
+	if err := os.WriteFile(sources[1], []byte("re-encoded"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Lookup(job(1)); ok {
+		t.Error("Lookup() returned the transcode of an older source")
+	}
+}
+
+func TestHLS(t *testing.T) {
+	if got := RenditionsFor(160); !slices.Equal(got, []int{64, 128}) {
+		t.Errorf("RenditionsFor(160) = %v", got)
+	}
+	if got := RenditionsFor(32); !slices.Equal(got, []int{64}) {
+		t.Errorf("RenditionsFor(32) = %v", got)
+	}
+
+	master := MasterPlaylist([]int{64, 128}, "stem=vocals")
+	if !strings.Contains(master, "BANDWIDTH=70400,") || !strings.Contains(master, "\n128/index.m3u8?stem=vocals\n") {
+		t.Errorf("MasterPlaylist() =\n%s", master)
+	}
+	media := MediaPlaylist(14.5, "")
+	for _, want := range []string{"#EXT-X-TARGETDURATION:6\n", "#EXTINF:6.000,\n1.ts\n", "#EXTINF:2.500,\n2.ts\n#EXT-X-ENDLIST\n"} {
+		if !strings.Contains(media, want) {
+			t.Errorf("MediaPlaylist() is missing %q:\n%s", want, media)
+		}
+	}
+
+	// The last segment of a cue sheet track stops at the end of the track
+	job := Segment(Job{Path: "/media/image.flac", Start: 100, Duration: 14.5}, 14.5, 2, 128)
+	args, err := (&FFmpeg{Binary: "ffmpeg"}).Args(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	for _, want := range []string{"-ss 112.000 -i /media/image.flac -t 2.500", "-c:a aac -b:a 128k", "-output_ts_offset 12.000 -f mpegts pipe:1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Args() = %s, missing %q", got, want)
+		}
+	}
+}
+
+// fakeFFmpeg writes a shell script standing in for ffmpeg
+func fakeFFmpeg(t *testing.T, script string) *FFmpeg {
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return &FFmpeg{Binary: path}
+}
+
+func TestDecode(t *testing.T) {
+	// Two stereo frames of float PCM: (1, -1) then (0.5, 0)
+	f := fakeFFmpeg(t, `printf '\000\000\200\077\000\000\200\277\000\000\000\077\000\000\000\000'`)
+	a, err := f.Decode(context.Background(), "/media/track.mp3", 44100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	block, err := a.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(block[0], []float32{1, 0.5}) || !slices.Equal(block[1], []float32{-1, 0}) {
+		t.Errorf("Read() = %v", block)
+	}
+	if _, err := a.Read(); err != io.EOF {
+		t.Errorf("Read() at the end = %v, want io.EOF", err)
+	}
+
+	f = fakeFFmpeg(t, "echo 'Invalid data found when processing input' >&2\nexit 1")
+	a, err = f.Decode(context.Background(), "/media/broken.mp3", 44100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if _, err := a.Read(); !errors.Is(err, tags.ErrMalformed) || !strings.Contains(err.Error(), "Invalid data") {
+		t.Errorf("Read() of a broken file = %v, want ErrMalformed", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package urlsign issues and verifies HMAC-signed media URLs. Players such as
+// <audio> elements and cast receivers cannot send headers, so the grant
+// travels in the query string: an expiry, a signature and, when the URL is
+// bound to a client, a flag telling the signature also covers its address.
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters of signed URLs
+const (
+	ParamExpires   = "exp"
+	ParamSignature = "sig"
+	ParamBind      = "bind"
+)
+
+// bindIP is the value of ParamBind for URLs bound to the client's address
+const bindIP = "ip"
+
+var (
+	ErrUnsigned  = errors.New("url is not signed")
+	ErrExpired   = errors.New("url has expired")
+	ErrSignature = errors.New("invalid signature")
+	// ErrNotMedia is returned for paths outside the media routes
+	ErrNotMedia = errors.New("not a media url")
+)
+
+// scopes are the media route prefixes and how many path segments a grant
+// covers: a signed track also opens its HLS playlists and segments, a signed
+// cover its resized variants. Static cover files are signed one by one.
+var scopes = []struct {
+	prefix   string
+	segments int
+}{
+	{"/stream/", 2},
+	{"/api/cover/", 3},
+	{"/covers/", 0},
+	{"/api/covers/", 0},
+}
+
+// Scope returns the part of a media path a signature covers
+func Scope(path string) (string, error) {
+	for _, s := range scopes {
+		if !strings.HasPrefix(path, s.prefix) || len(path) == len(s.prefix) {
+			continue
+		}
+		if s.segments == 0 {
+			return path, nil
+		}
+		parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", s.segments+1)
+		if len(parts) < s.segments || parts[s.segments-1] == "" {
+			return "", ErrNotMedia
+		}
+		return "/" + strings.Join(parts[:s.segments], "/"), nil
+	}
+	return "", ErrNotMedia
+}
+
+// Signer signs and verifies media URLs with a shared secret
+type Signer struct {
+	secret []byte
+}
+
+// New creates a signer
+func New(secret string) *Signer {
+	return &Signer{secret: []byte(secret)}
+}
+
+// Sign returns rawURL, a media path with an optional query, with the
+// parameters granting access to it until expires. A non-empty clientIP binds
+// the URL to that address.
+func (s *Signer) Sign(rawURL string, expires time.Time, clientIP string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.IsAbs() || u.Host != "" {
+		return "", ErrNotMedia
+	}
+	scope, err := Scope(u.Path)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Del(ParamExpires)
+	q.Del(ParamSignature)
+	q.Del(ParamBind)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	q.Set(ParamExpires, exp)
+	if clientIP != "" {
+		q.Set(ParamBind, bindIP)
+	}
+	q.Set(ParamSignature, s.mac(scope, exp, clientIP))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Verify checks the signature of a request for a media path against the
+// time now and the address of the client
+func (s *Signer) Verify(path string, query url.Values, clientIP string, now time.Time) error {
+	exp, sig := query.Get(ParamExpires), query.Get(ParamSignature)
+	if exp == "" || sig == "" {
+		return ErrUnsigned
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return ErrSignature
+	}
+	scope, err := Scope(path)
+	if err != nil {
+		return err
+	}
+	bound := ""
+	switch query.Get(ParamBind) {
+	case "":
+	case bindIP:
+		bound = clientIP
+	default:
+		return ErrSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.mac(scope, exp, bound))) {
+		return ErrSignature
+	}
+	if now.Unix() > expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Middleware refuses media requests without a valid signature
+func (s *Signer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Verify(r.URL.Path, r.URL.Query(), ClientIP(r), time.Now()); err != nil {
+			slog.Warn("Refused unsigned media request", "path", r.URL.Path, "reason", err)
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the address of the client, as set by the RealIP middleware
+func ClientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func (s *Signer) mac(scope, exp, clientIP string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(scope + "\n" + exp + "\n" + clientIP))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,79 @@
+package urlsign
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	s := New("secret")
+	now := time.Unix(1_800_000_000, 0)
+	track := "/stream/0b7c2f3e-8d1a-4a53-9b8e-1f2d3c4b5a69"
+
+	signed, err := s.Sign(track+"?format=opus", now.Add(time.Hour), "")
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	u, _ := url.Parse(signed)
+	if u.Query().Get("format") != "opus" {
+		t.Errorf("Sign() dropped the query: %s", signed)
+	}
+
+	bound, _ := s.Sign(track, now.Add(time.Hour), "10.0.0.7")
+	b, _ := url.Parse(bound)
+	tampered := u.Query()
+	tampered.Set(ParamExpires, "1900000000")
+
+	tests := []struct {
+		name  string
+		path  string
+		query url.Values
+		ip    string
+		at    time.Time
+		want  error
+	}{
+		{"valid", u.Path, u.Query(), "192.168.1.2", now, nil},
+		{"hls segment of the track", track + "/hls/128/3.ts", u.Query(), "", now, nil},
+		{"other track", "/stream/5d6e7f80-1a2b-4c3d-8e9f-a0b1c2d3e4f5", u.Query(), "", now, ErrSignature},
+		{"expired", u.Path, u.Query(), "", now.Add(2 * time.Hour), ErrExpired},
+		{"extended expiry", u.Path, tampered, "", now, ErrSignature},
+		{"unsigned", u.Path, url.Values{}, "", now, ErrUnsigned},
+		{"bound to the client", b.Path, b.Query(), "10.0.0.7", now, nil},
+		{"bound to another client", b.Path, b.Query(), "10.0.0.8", now, ErrSignature},
+		{"not media", "/api/library/tracks", u.Query(), "", now, ErrNotMedia},
+	}
+	for _, tt := range tests {
+		if err := s.Verify(tt.path, tt.query, tt.ip, tt.at); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := New("other").Verify(u.Path, u.Query(), "", now); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify() with another key = %v", err)
+	}
+	if _, err := s.Sign("https://example.com/stream/x", now, ""); !errors.Is(err, ErrNotMedia) {
+		t.Errorf("Sign() of an absolute URL = %v", err)
+	}
+}
+
+func TestScope(t *testing.T) {
+	tests := map[string]string{
+		"/stream/abc":                   "/stream/abc",
+		"/stream/abc/hls/master.m3u8":   "/stream/abc",
+		"/api/cover/def":                "/api/cover/def",
+		"/covers/0123abcd.jpg":          "/covers/0123abcd.jpg",
+		"/api/covers/variants/x/64.jpg": "/api/covers/variants/x/64.jpg",
+	}
+	for path, want := range tests {
+		if got, err := Scope(path); err != nil || got != want {
+			t.Errorf("Scope(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	for _, path := range []string{"/covers/", "/stream/", "/api/library/albums"} {
+		if _, err := Scope(path); err == nil {
+			t.Errorf("Scope(%q) accepted a path outside the media routes", path)
+		}
+	}
+}
@@ -13,12 +13,16 @@ class AnalyzeAudioUseCase:
         rel_path = job_data.get("file_path")
         full_path = os.path.join(job_data.get("root", settings.MEDIA_PATH), rel_path)
         trace_id = job_data.get("trace_id", "N/A")
+        # Directory directives resolved by the scanner (compilation, album_artist, media_kind)
+        hints = job_data.get("hints") or {}
+        # The scanner already wrote the track from its tags; the analysis only enriches it
+        indexed = job_data.get("indexed", False)
         
         logger.info(f"🎧 Analyzing audio: {rel_path}", extra={"trace_id": trace_id})
         
         meta = analyze_audio(full_path, settings.MEDIA_PATH)
         if meta:
-            self.audio_repo.save_track(meta, rel_path)
+            self.audio_repo.save_track(meta, rel_path, hints, indexed)
             return {"status": "success", "track": meta["title"]}
         
         return {"status": "failed", "path": rel_path}
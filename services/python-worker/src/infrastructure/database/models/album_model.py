@@ -1,4 +1,4 @@
-from sqlalchemy import Column, String, DateTime, ForeignKey, UniqueConstraint, func
+from sqlalchemy import Column, String, DateTime, Boolean, ForeignKey, UniqueConstraint, func
 from sqlalchemy.dialects import postgresql
 from .base import Base
 
@@ -11,6 +11,7 @@ class Album(Base):
     release_date = Column(String, nullable=True)
     cover_art = Column(String, nullable=True)
     genre = Column(String(100), nullable=True)
+    is_compilation = Column(Boolean, default=False)
     created_at = Column(DateTime(timezone=True), server_default=func.now())
     updated_at = Column(DateTime(timezone=True), server_default=func.now(), onupdate=func.now())
     
@@ -23,6 +23,9 @@ class Track(Base):
     disc_number = Column(Integer, default=1)
     genre = Column(String(100))
     year = Column(Integer)
+    media_kind = Column(String(20), default="music")
+    # Cue sheet tracks of a single-file rip share its file_path
+    cue_track = Column(Integer, nullable=True)
     
     # User data
     play_count = Column(Integer, default=0)
@@ -67,14 +67,68 @@ class AudioRepository:
                     session.commit()
             return album.id
 
-    def save_track(self, meta: dict, file_path_rel: str):
+    def enrich_track(self, session: Session, track: Track, meta: dict):
+        """
+        Add what the analysis found to a track the scanner indexed from its tags.
+        Its artist and album stay as the scanner grouped them; tag fields are
+        only filled in where the scanner left them empty.
+        """
+        year = meta.get("year") or None
+        fields = {
+            "duration_seconds": meta["duration"] or None,
+            "track_number": meta["track_number"] or None,
+            "genre": meta["genre"] if meta["genre"] != "Unknown" else None,
+            "year": year,
+            "format": meta["format"] or None,
+            "bitrate": meta["bitrate"] or None,
+            "sample_rate": meta["sample_rate"] or None,
+            "channels": meta["channels"] or None,
+        }
+        for field, value in fields.items():
+            if value is not None and not getattr(track, field):
+                setattr(track, field, value)
+
+        if track.album_id and meta.get("cover_path"):
+            album = session.query(Album).filter(Album.id == track.album_id).first()
+            if album and not album.cover_art:
+                album.cover_art = meta["cover_path"]
+
+        ai_meta = (track.ai_metadata or {}).copy()
+        ai_meta.update(meta.get("tech") or {})
+        track.ai_metadata = ai_meta
+
+    def save_track(self, meta: dict, file_path_rel: str, hints: dict = None, indexed: bool = False):
+        """
+        Write the analysis of a file. When the scanner already indexed it from
+        its tags (indexed), the analysis only enriches that row.
+        """
+        hints = hints or {}
         with self.SessionLocal() as session:
             try:
+                track = session.query(Track).filter(Track.file_path == file_path_rel, Track.cue_track.is_(None)).first()
+                if track and indexed:
+                    self.enrich_track(session, track, meta)
+                    session.commit()
+                    logger.info(f"💾 Enriched Track: {track.title} ({track.id})")
+                    return
+
                 artist_id = self.get_or_create_artist(session, meta["artist"])
-                album_id = self.get_or_create_album(session, meta["album"], artist_id, meta.get("cover_path"), meta.get("year", 0))
-                
-                track = session.query(Track).filter(Track.file_path == file_path_rel).first()
-                
+
+                # Directory directives decide who owns the album, then the tags do, as in the scanner
+                compilation = hints.get("compilation") or meta.get("compilation", False)
+                album_artist = hints.get("album_artist") or meta.get("album_artist")
+                if not album_artist and compilation:
+                    album_artist = "Various Artists"
+                album_artist_id = artist_id
+                if album_artist and album_artist != meta["artist"]:
+                    album_artist_id = self.get_or_create_artist(session, album_artist)
+                album_id = self.get_or_create_album(session, meta["album"], album_artist_id, meta.get("cover_path"), meta.get("year", 0))
+                if compilation:
+                    session.query(Album).filter(Album.id == album_id).update({"is_compilation": True})
+
+                media_kind = hints.get("media_kind") or ("audiobook" if meta["format"] == "m4b" else "music")
+                year = meta.get("year") or None
+
                 if track:
                     track.title = meta["title"]
                     track.artist_id = artist_id
@@ -82,9 +136,10 @@ class AudioRepository:
                     track.duration_seconds = meta["duration"]
                     track.track_number = meta["track_number"]
                     track.genre = meta["genre"]
-                    track.year = meta.get("year", 0)
+                    track.year = year
                     track.format = meta["format"]
                     track.bitrate = meta["bitrate"]
+                    track.media_kind = media_kind
                     track.updated_at = datetime.now(timezone.utc)
                     
                     # Merge Technical Metadata
@@ -107,7 +162,8 @@ class AudioRepository:
                         channels=meta["channels"],
                         track_number=meta["track_number"],
                         genre=meta["genre"],
-                        year=meta.get("year", 0),
+                        year=year,
+                        media_kind=media_kind,
                         ai_metadata=meta.get("tech", {})
                     )
                     session.add(track)
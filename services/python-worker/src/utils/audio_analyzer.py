@@ -90,6 +90,8 @@ def analyze_audio(file_path: str, media_path: str):
             "genre": "Unknown",
             "cover_path": None,
             "year": 0,
+            "album_artist": None,
+            "compilation": False,
             "tech": {}
         }
 
@@ -111,6 +113,10 @@ def analyze_audio(file_path: str, media_path: str):
             metadata["artist"] = clean(tags.get("artist", ["Unknown Artist"])[0])
             metadata["album"] = clean(tags.get("album", ["Unknown Album"])[0])
             metadata["genre"] = clean(tags.get("genre", ["Unknown"])[0])
+            if tags.get("albumartist"):
+                metadata["album_artist"] = clean(tags["albumartist"][0])
+            compilation_raw = str(tags.get("compilation", ["0"])[0]).strip().lower()
+            metadata["compilation"] = compilation_raw in ("1", "t", "true")
             
             # Extract Year
             year_raw = str(tags.get("date", tags.get("year", ["0"]))[0])
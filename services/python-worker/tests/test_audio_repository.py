@@ -0,0 +1,119 @@
+import unittest
+import uuid
+
+from src.infrastructure.database.models.album_model import Album
+from src.infrastructure.database.models.artist_model import Artist
+from src.infrastructure.database.models.track_model import Track
+from src.infrastructure.database.repositories.audio_repository import AudioRepository
+
+
+class FakeQuery:
+    def __init__(self, result):
+        self.result = result
+
+    def filter(self, *criteria):
+        return self
+
+    def first(self):
+        return self.result
+
+    def update(self, values):
+        return 1
+
+
+class FakeSession:
+    """Returns the given row of each model and records what is added"""
+
+    def __init__(self, rows):
+        self.rows = rows
+        self.added = []
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        return False
+
+    def query(self, model):
+        return FakeQuery(self.rows.get(model))
+
+    def add(self, obj):
+        if getattr(obj, "id", None) is None:
+            obj.id = uuid.uuid4()
+        self.added.append(obj)
+
+    def commit(self):
+        pass
+
+    def rollback(self):
+        pass
+
+
+def analysis(**overrides):
+    """Metadata as analyze_audio returns it for a track with a guest artist"""
+    meta = {
+        "title": "Song",
+        "artist": "Band feat. Guest",
+        "album": "Record",
+        "album_artist": "Band",
+        "compilation": False,
+        "duration": 200.5,
+        "bitrate": 320000,
+        "sample_rate": 44100,
+        "channels": 2,
+        "format": "mp3",
+        "track_number": 3,
+        "genre": "Rock",
+        "year": 0,
+        "cover_path": "/covers/record.jpg",
+        "tech": {"lufs": -9.5},
+    }
+    meta.update(overrides)
+    return meta
+
+
+class SaveTrackTest(unittest.TestCase):
+    def indexed_by_scanner(self):
+        # The rows the Go scanner wrote: the album belongs to the album artist
+        album = Album(id=uuid.uuid4(), title="Record", artist_id=uuid.uuid4())
+        track = Track(
+            id=uuid.uuid4(), title="Song", file_path="Band/Record/03.mp3",
+            artist_id=uuid.uuid4(), album_id=album.id, track_number=3,
+            genre=None, year=None, format="mp3", media_kind="music",
+            ai_metadata={"mood": "calm"},
+        )
+        return album, track
+
+    def test_indexed_track_keeps_its_album(self):
+        album, track = self.indexed_by_scanner()
+        artist_id, album_id = track.artist_id, track.album_id
+        session = FakeSession({Track: track, Album: album})
+
+        AudioRepository(lambda: session).save_track(analysis(), track.file_path, {}, indexed=True)
+
+        self.assertEqual(track.album_id, album_id)
+        self.assertEqual(track.artist_id, artist_id)
+        self.assertEqual(session.added, [], "no artist or album may be created")
+        self.assertEqual(track.genre, "Rock")
+        self.assertIsNone(track.year)
+        self.assertEqual(track.ai_metadata, {"mood": "calm", "lufs": -9.5})
+        self.assertEqual(album.cover_art, "/covers/record.jpg")
+
+    def test_unindexed_track_is_grouped_under_the_album_artist(self):
+        session = FakeSession({})
+
+        AudioRepository(lambda: session).save_track(analysis(), "Band/Record/03.mp3")
+
+        artists = {a.name: a for a in session.added if isinstance(a, Artist)}
+        albums = [a for a in session.added if isinstance(a, Album)]
+        tracks = [t for t in session.added if isinstance(t, Track)]
+        self.assertEqual(set(artists), {"Band feat. Guest", "Band"})
+        self.assertEqual(len(albums), 1)
+        self.assertEqual(albums[0].artist_id, artists["Band"].id)
+        self.assertEqual(tracks[0].artist_id, artists["Band feat. Guest"].id)
+        self.assertEqual(tracks[0].album_id, albums[0].id)
+        self.assertIsNone(tracks[0].year)
+
+
+if __name__ == "__main__":
+    unittest.main()